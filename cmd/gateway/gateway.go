@@ -7,9 +7,14 @@ import (
 	"github.com/roushou/pocpoc/internal/config"
 	"github.com/roushou/pocpoc/internal/database"
 	"github.com/roushou/pocpoc/internal/gateway"
+	"github.com/roushou/pocpoc/internal/grpcapi"
+	"github.com/roushou/pocpoc/internal/integrations"
 	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/printing"
 	"github.com/roushou/pocpoc/internal/router"
 	"github.com/roushou/pocpoc/internal/security"
+	"github.com/roushou/pocpoc/internal/services"
+	"google.golang.org/grpc"
 	"gorm.io/gorm"
 )
 
@@ -19,7 +24,9 @@ func main() {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	db, err := database.NewDatabase(config.DatabaseName)
 	if err != nil {
 		log.Fatalf("failed to create database: %v", err)
@@ -33,17 +40,75 @@ func main() {
 		log.Fatalf("failed to seed database: %v", err)
 	}
 
-	router, err := router.NewRouter(db, router.WithAllowedOrigins(config.AllowedOrigins))
+	// Services are shared by the REST and gRPC APIs, so that both stream the same order updates
+	services := services.New(services.NewGormStore(db.Connection))
+
+	// The readiness check reports the gateway draining once it starts shutting down
+	readiness := &router.Readiness{}
+
+	routerOptions := []router.Option{
+		router.WithAllowedOrigins(config.AllowedOrigins),
+		router.WithGuestOrderingURL(config.GuestOrderingURL),
+		router.WithTableTokenKey(config.TableTokenKey),
+		router.WithServices(services),
+		router.WithReadiness(readiness),
+	}
+	if config.TLSClientCAFile != "" {
+		routerOptions = append(routerOptions, router.WithTerminalCertificates())
+	}
+	if config.DocsBundleFile != "" {
+		routerOptions = append(routerOptions, router.WithDocsBundle(config.DocsBundleFile))
+	}
+
+	router, err := router.NewRouter(db, routerOptions...)
 	if err != nil {
 		log.Fatalf("failed to create router: %v", err)
 	}
 
-	gateway, err := gateway.NewGateway(router, gateway.WithAddr(config.GatewayAddr))
+	printWorker, err := printing.NewWorker(db.Connection)
+	if err != nil {
+		log.Fatalf("failed to create print worker: %v", err)
+	}
+
+	integrationWorker, err := integrations.NewWorker(db.Connection)
+	if err != nil {
+		log.Fatalf("failed to create integration worker: %v", err)
+	}
+
+	gatewayOptions := []gateway.Option{
+		gateway.WithAddr(config.GatewayAddr),
+		gateway.WithDrainer(readiness),
+		gateway.WithWorker("print", printWorker),
+		gateway.WithWorker("integration", integrationWorker),
+	}
+	if config.GRPCAddr != "" {
+		grpcOptions := []grpcapi.Option{}
+		if config.TLSClientCAFile != "" {
+			grpcOptions = append(grpcOptions, grpcapi.WithTerminalCertificates())
+		}
+		newGRPCServer := func(opts ...grpc.ServerOption) *grpc.Server {
+			return grpcapi.NewServer(db, services, append(grpcOptions, grpcapi.WithServerOptions(opts...))...)
+		}
+		gatewayOptions = append(gatewayOptions, gateway.WithGRPC(newGRPCServer, config.GRPCAddr))
+	}
+	if config.TLSCertFile != "" || config.TLSKeyFile != "" {
+		gatewayOptions = append(gatewayOptions, gateway.WithTLS(config.TLSCertFile, config.TLSKeyFile))
+	}
+	if config.TLSClientCAFile != "" {
+		gatewayOptions = append(gatewayOptions, gateway.WithClientCA(config.TLSClientCAFile))
+	}
+	if config.HTTPRedirectAddr != "" {
+		gatewayOptions = append(gatewayOptions, gateway.WithHTTPRedirect(config.HTTPRedirectAddr))
+	}
+
+	gateway, err := gateway.NewGateway(router, gatewayOptions...)
 	if err != nil {
 		log.Fatalf("failed to create gateway: %v", err)
 	}
 
-	gateway.Serve(ctx)
+	if err := gateway.Serve(ctx); err != nil {
+		log.Fatalf("gateway failed: %v", err)
+	}
 }
 
 // seedDatabase seeds the database if no user records is found. For simplicity, it assumes other tables are empty or not based on that.
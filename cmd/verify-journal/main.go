@@ -0,0 +1,67 @@
+// Command verify-journal verifies the sales journals of restaurants and exits with a non-zero status
+// if any of them was tampered with.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/database"
+	"github.com/roushou/pocpoc/internal/journal"
+	"github.com/roushou/pocpoc/internal/models"
+)
+
+func main() {
+	restaurant := flag.String("restaurant", "", "ID of the restaurant to verify, all restaurants if empty")
+	flag.Parse()
+
+	dbName, ok := os.LookupEnv("DATABASE_NAME")
+	if !ok {
+		log.Fatalf("environment variable 'DATABASE_NAME' not found")
+	}
+
+	db, err := database.NewDatabase(dbName)
+	if err != nil {
+		log.Fatalf("failed to create database: %v", err)
+	}
+
+	restaurantIDs := make([]uuid.UUID, 0)
+	if *restaurant != "" {
+		id, err := uuid.Parse(*restaurant)
+		if err != nil {
+			log.Fatalf("invalid restaurant ID: %v", err)
+		}
+		restaurantIDs = append(restaurantIDs, id)
+	} else if err := db.Connection.
+		Model(&models.JournalEntry{}).
+		Distinct("restaurant_id").
+		Order("restaurant_id").
+		Pluck("restaurant_id", &restaurantIDs).Error; err != nil {
+		log.Fatalf("failed to list journals: %v", err)
+	}
+
+	valid := true
+	for _, restaurantID := range restaurantIDs {
+		verification, err := journal.Verify(db.Connection, restaurantID)
+		if err != nil {
+			log.Fatalf("failed to verify journal of restaurant %s: %v", restaurantID, err)
+		}
+		if verification.Valid {
+			fmt.Printf("%s: %d entries, valid\n", restaurantID, verification.Entries)
+			continue
+		}
+
+		valid = false
+		fmt.Printf("%s: %d entries, %d problems\n", restaurantID, verification.Entries, len(verification.Problems))
+		for _, problem := range verification.Problems {
+			fmt.Printf("  entry %d: %s\n", problem.Sequence, problem.Reason)
+		}
+	}
+
+	if !valid {
+		os.Exit(1)
+	}
+}
@@ -10,6 +10,22 @@ type Config struct {
 	AllowedOrigins []string
 	GatewayAddr    string
 	DatabaseName   string
+	// TableTokenKey signs the tokens of the table QR codes.
+	TableTokenKey string
+	// GuestOrderingURL is the base URL of the app guests order from, optional.
+	GuestOrderingURL string
+	// GRPCAddr is the address the gRPC API listens on, which is not served when empty.
+	GRPCAddr string
+	// TLSCertFile and TLSKeyFile are the certificate and key HTTPS and gRPC are served with, plain HTTP and
+	// gRPC when empty.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile is the CA issuing the client certificates terminals must present, optional.
+	TLSClientCAFile string
+	// HTTPRedirectAddr is the address redirecting plain HTTP to HTTPS, optional.
+	HTTPRedirectAddr string
+	// DocsBundleFile is the Redoc bundle served with the API docs, loaded from a CDN when empty.
+	DocsBundleFile string
 }
 
 // LoadConfig loads all required configuration from environment variables.
@@ -29,9 +45,22 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("environment variable 'DATABASE_NAME' not found")
 	}
 
+	tableTokenKey, ok := os.LookupEnv("TABLE_TOKEN_KEY")
+	if !ok {
+		return nil, fmt.Errorf("environment variable 'TABLE_TOKEN_KEY' not found")
+	}
+
 	return &Config{
-		AllowedOrigins: allowedOrigins,
-		GatewayAddr:    gatewayAddr,
-		DatabaseName:   dbName,
+		AllowedOrigins:   allowedOrigins,
+		GatewayAddr:      gatewayAddr,
+		DatabaseName:     dbName,
+		TableTokenKey:    tableTokenKey,
+		GuestOrderingURL: os.Getenv("GUEST_ORDERING_URL"),
+		GRPCAddr:         os.Getenv("GRPC_ADDR"),
+		TLSCertFile:      os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:       os.Getenv("TLS_KEY_FILE"),
+		TLSClientCAFile:  os.Getenv("TLS_CLIENT_CA_FILE"),
+		HTTPRedirectAddr: os.Getenv("HTTP_REDIRECT_ADDR"),
+		DocsBundleFile:   os.Getenv("DOCS_BUNDLE_FILE"),
 	}, nil
 }
@@ -2,8 +2,10 @@ package database
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/search"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -13,7 +15,11 @@ type Database struct {
 }
 
 func NewDatabase(databaseName string) (*Database, error) {
-	connection, err := gorm.Open(sqlite.Open(databaseName), &gorm.Config{TranslateError: true})
+	connection, err := gorm.Open(sqlite.Open(databaseName), &gorm.Config{
+		TranslateError: true,
+		// Timestamps are stored as text in SQLite, keep them in a single zone so they compare correctly.
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
@@ -21,12 +27,38 @@ func NewDatabase(databaseName string) (*Database, error) {
 }
 
 func (db *Database) AutoMigrate() error {
-	return db.Connection.AutoMigrate(
+	if err := search.Drop(db.Connection); err != nil {
+		return err
+	}
+	if err := db.Connection.AutoMigrate(
 		&models.Owner{},
 		&models.Restaurant{},
 		&models.Staff{},
+		&models.Terminal{},
 		&models.Product{},
 		&models.Order{},
 		&models.OrderItem{},
-	)
+		&models.Table{},
+		&models.SyncMutation{},
+		&models.Shift{},
+		&models.ShiftBreak{},
+		&models.Payment{},
+		&models.CashSession{},
+		&models.CashMovement{},
+		&models.ZReport{},
+		&models.Printer{},
+		&models.PrintJob{},
+		&models.JournalEntry{},
+		&models.JournalHead{},
+		&models.Customer{},
+		&models.LoyaltyTransaction{},
+		&models.Integration{},
+		&models.IntegrationEvent{},
+		&models.Promotion{},
+		&models.PromotionRedemption{},
+	); err != nil {
+		return err
+	}
+	// Full-text indexes are virtual tables kept in sync by triggers, which gorm doesn't migrate
+	return search.Migrate(db.Connection)
 }
@@ -0,0 +1,26 @@
+// Package databasetest provides the databases of tests.
+package databasetest
+
+import (
+	"testing"
+
+	"github.com/roushou/pocpoc/internal/database"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// New returns an in-memory database with the schema migrated, dropped once the test is done. The
+// cache is shared so that every connection of the pool sees the same database, e.g. a worker querying
+// it from its own goroutine while the test holds a transaction.
+func New(t testing.TB) *gorm.DB {
+	t.Helper()
+	db, err := database.NewDatabase("file:" + t.Name() + "?mode=memory&cache=shared")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.Connection.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	require.NoError(t, db.AutoMigrate())
+	return db.Connection
+}
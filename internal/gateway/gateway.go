@@ -2,26 +2,74 @@ package gateway
 
 import (
 	"context"
+	"crypto/x509"
 	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 const defaultAddr = ":8080"
 const defaultShutdownTimeout = 5 * time.Second
 
+// Defaults of the limits of the server, generous enough for slow terminals on the restaurant LAN and
+// for the exports of reports.
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 60 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+	defaultMaxHeaderBytes    = 1 << 20
+	defaultMaxBodyBytes      = 10 << 20
+)
+
 // Option defines the function signature for gateway options.
 type Option func(options *options) error
 
 type options struct {
-	addr            string
-	shutdownTimeout time.Duration
+	addr              string
+	shutdownTimeout   time.Duration
+	newGRPCServer     func(opts ...grpc.ServerOption) *grpc.Server
+	grpcAddr          string
+	certFile          string
+	keyFile           string
+	clientCAFile      string
+	redirectAddr      string
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	maxBodyBytes      int64
+	drainDelay        time.Duration
+	drainers          []Drainer
+	workers           []worker
+}
+
+// Worker runs in the background of the gateway until its context is cancelled, e.g. the print worker.
+type Worker interface {
+	Run(ctx context.Context) error
+}
+
+type worker struct {
+	name string
+	Worker
+}
+
+// Drainer is told when the gateway starts shutting down, e.g. to report it is not ready anymore so
+// that clients and load balancers stop sending requests.
+type Drainer interface {
+	Drain()
 }
 
 // WithAddr sets the address on which the gateway will listen.
@@ -43,17 +91,166 @@ func WithShutdownTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithGRPC serves a gRPC server on its own address alongside the router. The server is created by
+// newServer with the options of the gateway, e.g. the TLS credentials of WithTLS, so that gRPC is
+// served as securely as HTTP.
+func WithGRPC(newServer func(opts ...grpc.ServerOption) *grpc.Server, addr string) Option {
+	return func(options *options) error {
+		if newServer == nil {
+			return errors.New("gRPC server constructor should not be nil")
+		}
+		if addr == "" {
+			return errors.New("gRPC address should not be empty")
+		}
+		options.newGRPCServer = newServer
+		options.grpcAddr = addr
+		return nil
+	}
+}
+
+// WithTLS serves HTTPS, and HTTP/2 to the clients supporting it, with the certificate and key of the
+// PEM encoded files. The files are reloaded when they change, e.g. when the certificate is renewed.
+func WithTLS(certFile, keyFile string) Option {
+	return func(options *options) error {
+		if certFile == "" || keyFile == "" {
+			return errors.New("TLS certificate and key files should not be empty")
+		}
+		options.certFile = certFile
+		options.keyFile = keyFile
+		return nil
+	}
+}
+
+// WithClientCA verifies the client certificates presented to the gateway against the PEM encoded
+// certificates of the file, e.g. the CA issuing the certificates of registered terminals. Requires
+// WithTLS.
+func WithClientCA(caFile string) Option {
+	return func(options *options) error {
+		if caFile == "" {
+			return errors.New("client CA file should not be empty")
+		}
+		options.clientCAFile = caFile
+		return nil
+	}
+}
+
+// WithHTTPRedirect listens for plain HTTP on the address and redirects requests to HTTPS. Requires
+// WithTLS.
+func WithHTTPRedirect(addr string) Option {
+	return func(options *options) error {
+		if addr == "" {
+			return errors.New("redirect address should not be empty")
+		}
+		options.redirectAddr = addr
+		return nil
+	}
+}
+
+// WithTimeouts sets how long the server waits to read the headers of requests, to read whole
+// requests, to write responses and for the next request on idle connections. Zero disables a timeout.
+func WithTimeouts(readHeader, read, write, idle time.Duration) Option {
+	return func(options *options) error {
+		if readHeader < 0 || read < 0 || write < 0 || idle < 0 {
+			return errors.New("timeouts should not be negative")
+		}
+		options.readHeaderTimeout = readHeader
+		options.readTimeout = read
+		options.writeTimeout = write
+		options.idleTimeout = idle
+		return nil
+	}
+}
+
+// WithMaxHeaderBytes sets the maximum size of the headers of requests.
+func WithMaxHeaderBytes(size int) Option {
+	return func(options *options) error {
+		if size <= 0 {
+			return errors.New("maximum header size should be positive")
+		}
+		options.maxHeaderBytes = size
+		return nil
+	}
+}
+
+// WithMaxBodyBytes sets the maximum size of the bodies of requests, larger requests are refused with
+// 413 Request Entity Too Large. Zero disables the limit.
+func WithMaxBodyBytes(size int64) Option {
+	return func(options *options) error {
+		if size < 0 {
+			return errors.New("maximum body size should not be negative")
+		}
+		options.maxBodyBytes = size
+		return nil
+	}
+}
+
+// WithDrainer tells the drainer when the gateway starts shutting down, before it stops accepting
+// requests.
+func WithDrainer(drainer Drainer) Option {
+	return func(options *options) error {
+		if drainer == nil {
+			return errors.New("drainer should not be nil")
+		}
+		options.drainers = append(options.drainers, drainer)
+		return nil
+	}
+}
+
+// WithDrainDelay sets how long the gateway keeps serving requests after telling drainers it is
+// shutting down, so that load balancers notice before it stops accepting requests.
+func WithDrainDelay(delay time.Duration) Option {
+	return func(options *options) error {
+		if delay < 0 {
+			return errors.New("drain delay should not be negative")
+		}
+		options.drainDelay = delay
+		return nil
+	}
+}
+
+// WithWorker runs the worker while the gateway serves. Workers are stopped once the servers are shut
+// down, so that requests still being served can hand them work.
+func WithWorker(name string, w Worker) Option {
+	return func(options *options) error {
+		if w == nil {
+			return fmt.Errorf("worker %s should not be nil", name)
+		}
+		options.workers = append(options.workers, worker{name: name, Worker: w})
+		return nil
+	}
+}
+
 type Gateway struct {
 	addr            string
 	router          *echo.Echo
 	shutdownTimeout time.Duration
+	grpcServer      *grpc.Server
+	grpcAddr        string
+	// certificates is the certificate HTTPS is served with, nil to serve plain HTTP.
+	certificates      *certificateReloader
+	clientCAs         *x509.CertPool
+	redirectAddr      string
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	drainDelay        time.Duration
+	drainers          []Drainer
+	workers           []worker
 }
 
 // NewGateway initializes and configures a new Gateway instance with the provided options.
 func NewGateway(router *echo.Echo, opts ...Option) (*Gateway, error) {
 	options := &options{
-		addr:            defaultAddr,
-		shutdownTimeout: defaultShutdownTimeout,
+		addr:              defaultAddr,
+		shutdownTimeout:   defaultShutdownTimeout,
+		readHeaderTimeout: defaultReadHeaderTimeout,
+		readTimeout:       defaultReadTimeout,
+		writeTimeout:      defaultWriteTimeout,
+		idleTimeout:       defaultIdleTimeout,
+		maxHeaderBytes:    defaultMaxHeaderBytes,
+		maxBodyBytes:      defaultMaxBodyBytes,
 	}
 	for _, opt := range opts {
 		err := opt(options)
@@ -61,35 +258,245 @@ func NewGateway(router *echo.Echo, opts ...Option) (*Gateway, error) {
 			return nil, err
 		}
 	}
-	return &Gateway{
-		router:          router,
-		addr:            options.addr,
-		shutdownTimeout: options.shutdownTimeout,
-	}, nil
+
+	gw := &Gateway{
+		router:            router,
+		addr:              options.addr,
+		shutdownTimeout:   options.shutdownTimeout,
+		grpcAddr:          options.grpcAddr,
+		redirectAddr:      options.redirectAddr,
+		readHeaderTimeout: options.readHeaderTimeout,
+		readTimeout:       options.readTimeout,
+		writeTimeout:      options.writeTimeout,
+		idleTimeout:       options.idleTimeout,
+		maxHeaderBytes:    options.maxHeaderBytes,
+		drainDelay:        options.drainDelay,
+		drainers:          options.drainers,
+		workers:           options.workers,
+	}
+
+	if options.certFile != "" {
+		// Certificates are loaded upfront so that invalid files fail now rather than on the first connection
+		var err error
+		gw.certificates, err = newCertificateReloader(options.certFile, options.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if options.clientCAFile != "" {
+			gw.clientCAs, err = loadClientCAs(options.clientCAFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else if options.clientCAFile != "" || options.redirectAddr != "" {
+		return nil, errors.New("client CA and HTTP redirect require TLS")
+	}
+
+	if options.newGRPCServer != nil {
+		var serverOptions []grpc.ServerOption
+		if gw.certificates != nil {
+			// gRPC shares the reloaded certificate and the client CA of HTTPS
+			serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(gw.tlsConfig())))
+		}
+		gw.grpcServer = options.newGRPCServer(serverOptions...)
+	}
+
+	// The body limit is checked by the router so that refused requests get its error responses
+	if options.maxBodyBytes > 0 {
+		router.Pre(limitBody(options.maxBodyBytes))
+	}
+	return gw, nil
+}
+
+// limitBody refuses requests whose body is larger than limit, and stops reading bodies of unknown
+// length at the limit.
+func limitBody(limit int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			request := ctx.Request()
+			if request.ContentLength > limit {
+				return echo.ErrStatusRequestEntityTooLarge
+			}
+			request.Body = http.MaxBytesReader(ctx.Response(), request.Body, limit)
+			return next(ctx)
+		}
+	}
 }
 
-// Serve starts the gateway server and handles graceful shutdown on receiving interrupt signals.
-func (gw *Gateway) Serve(ctx context.Context) {
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+// newServer returns a server of the router, or of the handler when not nil, with the limits of the
+// gateway.
+func (gw *Gateway) newServer(handler http.Handler) *http.Server {
+	if handler == nil {
+		handler = gw.router
+	}
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: gw.readHeaderTimeout,
+		ReadTimeout:       gw.readTimeout,
+		WriteTimeout:      gw.writeTimeout,
+		IdleTimeout:       gw.idleTimeout,
+		MaxHeaderBytes:    gw.maxHeaderBytes,
+	}
+}
 
-	go func() {
-		err := gw.router.Start(gw.addr)
-		if err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
+// Serve serves the router, and the gRPC server and HTTP redirect when configured, until the context
+// is done or an interrupt signal is received, then shuts down gracefully. It returns an error when
+// a server fails to listen or stops unexpectedly, after shutting down the others.
+func (gw *Gateway) Serve(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Listeners are opened upfront so that the gateway fails before serving when an address is taken
+	var listeners []net.Listener
+	defer func() {
+		for _, listener := range listeners {
+			listener.Close()
 		}
 	}()
+	listen := func(name, addr string) (net.Listener, error) {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("%s failed to listen: %w", name, err)
+		}
+		listeners = append(listeners, listener)
+		return listener, nil
+	}
+
+	serverListener, err := listen("server", gw.addr)
+	if err != nil {
+		return err
+	}
+	var redirectListener, grpcListener net.Listener
+	if gw.certificates != nil && gw.redirectAddr != "" {
+		if redirectListener, err = listen("redirect", gw.redirectAddr); err != nil {
+			return err
+		}
+	}
+	if gw.grpcServer != nil {
+		if grpcListener, err = listen("gRPC server", gw.grpcAddr); err != nil {
+			return err
+		}
+	}
+
+	// Workers outlive the context so that they only stop once requests are done
+	workersCtx, stopWorkers := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopWorkers()
+	workers := gw.startWorkers(workersCtx)
+
+	failed := make(chan error, len(listeners))
+	serve := func(name string, serve func() error) {
+		go func() {
+			if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				failed <- fmt.Errorf("%s stopped: %w", name, err)
+			}
+		}()
+	}
 
-	<-quit
+	server := gw.newServer(nil)
+	if gw.certificates != nil {
+		server.TLSConfig = gw.tlsConfig()
+		go gw.certificates.watch(ctx, certificateReloadInterval)
+
+		log.Printf("HTTPS server listening on %s", gw.addr)
+		serve("server", func() error { return server.ServeTLS(serverListener, "", "") })
+	} else {
+		log.Printf("HTTP server listening on %s", gw.addr)
+		serve("server", func() error { return server.Serve(serverListener) })
+	}
+
+	var redirect *http.Server
+	if redirectListener != nil {
+		redirect = gw.newServer(redirectHandler(gw.addr))
+		log.Printf("Redirecting HTTP to HTTPS from %s", gw.redirectAddr)
+		serve("redirect", func() error { return redirect.Serve(redirectListener) })
+	}
+
+	if grpcListener != nil {
+		log.Printf("gRPC server listening on %s", gw.grpcAddr)
+		serve("gRPC server", func() error { return gw.grpcServer.Serve(grpcListener) })
+	}
+
+	select {
+	case <-ctx.Done():
+		gw.drain()
+	case err = <-failed:
+		log.Printf("Server failed: %v", err)
+	}
 
 	log.Println("Shutting down server...")
 
-	ctx, cancel := context.WithTimeout(ctx, gw.shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), gw.shutdownTimeout)
 	defer cancel()
 
-	if err := gw.router.Shutdown(ctx); err != nil {
-		log.Fatalf("server shutdown failed: %v", err)
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+		err = errors.Join(err, fmt.Errorf("server shutdown failed: %w", shutdownErr))
+	}
+	if redirect != nil {
+		if shutdownErr := redirect.Shutdown(shutdownCtx); shutdownErr != nil {
+			err = errors.Join(err, fmt.Errorf("redirect shutdown failed: %w", shutdownErr))
+		}
+	}
+	if gw.grpcServer != nil {
+		gw.stopGRPC(shutdownCtx)
+	}
+
+	stopWorkers()
+	select {
+	case <-workers:
+	case <-shutdownCtx.Done():
+		err = errors.Join(err, errors.New("workers did not stop before the shutdown timeout"))
 	}
 
 	log.Println("Server stopped")
+	return err
+}
+
+// drain tells drainers the gateway is shutting down, then keeps serving for the drain delay.
+func (gw *Gateway) drain() {
+	if len(gw.drainers) == 0 {
+		return
+	}
+	log.Println("Draining server...")
+	for _, drainer := range gw.drainers {
+		drainer.Drain()
+	}
+	time.Sleep(gw.drainDelay)
+}
+
+// startWorkers runs the workers until the context is cancelled. The returned channel is closed once
+// they have all returned.
+func (gw *Gateway) startWorkers(ctx context.Context) <-chan struct{} {
+	var wg sync.WaitGroup
+	for _, worker := range gw.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := worker.Run(ctx); err != nil {
+				log.Printf("%s worker stopped: %v", worker.name, err)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// stopGRPC waits for pending gRPC calls to complete until the context is done, then cancels the
+// remaining ones, e.g. streams of order updates which never complete on their own.
+func (gw *Gateway) stopGRPC(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		gw.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		gw.grpcServer.Stop()
+	}
 }
@@ -0,0 +1,118 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testDrainer struct {
+	drained atomic.Bool
+}
+
+func (d *testDrainer) Drain() {
+	d.drained.Store(true)
+}
+
+// testWorker runs until its context is cancelled, and reports when it started and stopped.
+type testWorker struct {
+	started, stopped chan struct{}
+}
+
+func (w *testWorker) Run(ctx context.Context) error {
+	close(w.started)
+	<-ctx.Done()
+	close(w.stopped)
+	return nil
+}
+
+func TestServe(t *testing.T) {
+	drainer := &testDrainer{}
+	worker := &testWorker{started: make(chan struct{}), stopped: make(chan struct{})}
+	gw, err := NewGateway(echo.New(), WithAddr("127.0.0.1:0"), WithDrainer(drainer), WithWorker("test", worker))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- gw.Serve(ctx) }()
+
+	<-worker.started
+	assert.False(t, drainer.drained.Load())
+	cancel()
+
+	select {
+	case err := <-served:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("gateway did not shut down")
+	}
+	assert.True(t, drainer.drained.Load())
+	select {
+	case <-worker.stopped:
+	default:
+		t.Fatal("gateway returned before its worker stopped")
+	}
+}
+
+func TestServeListenError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	worker := &testWorker{started: make(chan struct{}), stopped: make(chan struct{})}
+	gw, err := NewGateway(echo.New(), WithAddr(listener.Addr().String()), WithWorker("test", worker))
+	require.NoError(t, err)
+
+	err = gw.Serve(context.Background())
+	assert.ErrorContains(t, err, "server failed to listen")
+	select {
+	case <-worker.started:
+		t.Fatal("worker started although the gateway failed to listen")
+	default:
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	router := echo.New()
+	router.POST("/", func(ctx echo.Context) error {
+		body, err := io.ReadAll(ctx.Request().Body)
+		if err != nil {
+			return echo.ErrBadRequest
+		}
+		return ctx.String(http.StatusOK, string(body))
+	})
+	_, err := NewGateway(router, WithMaxBodyBytes(8))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool
+		status  int
+	}{
+		{name: "within the limit", body: "12345678", status: http.StatusOK},
+		{name: "over the limit", body: "123456789", status: http.StatusRequestEntityTooLarge},
+		{name: "unknown length over the limit", body: "123456789", chunked: true, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.chunked {
+				request.ContentLength = -1
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			assert.Equal(t, tt.status, recorder.Code)
+		})
+	}
+}
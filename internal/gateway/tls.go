@@ -0,0 +1,155 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certificateReloadInterval is how often the certificate files are checked for changes.
+const certificateReloadInterval = 10 * time.Second
+
+// certificateReloader serves the certificate of a key pair and reloads it when its files change,
+// e.g. when it is renewed, so that the gateway doesn't have to restart.
+type certificateReloader struct {
+	certFile, keyFile string
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	modTime     time.Time
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config.
+func (r *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.certificate, nil
+}
+
+// reload loads the key pair if its files changed since it was last loaded, and reports whether it
+// did. The current certificate is kept when the key pair fails to load.
+func (r *certificateReloader) reload() (bool, error) {
+	modTime, err := lastModified(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	changed := !modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	r.certificate = &certificate
+	r.modTime = modTime
+	r.mu.Unlock()
+	return true, nil
+}
+
+// watch reloads the key pair as its files change until the context is done. Failed reloads, e.g.
+// while the files are being replaced, are retried on the next check.
+func (r *certificateReloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				log.Printf("TLS certificate reload failed: %v", err)
+			} else if reloaded {
+				log.Println("TLS certificate reloaded")
+			}
+		}
+	}
+}
+
+// lastModified returns the latest modification time of the files.
+func lastModified(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// loadClientCAs returns the pool of the PEM encoded certificates of the file.
+func loadClientCAs(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", caFile)
+	}
+	return pool, nil
+}
+
+// tlsConfig returns the TLS config of the gateway, which negotiates HTTP/2 with the clients
+// supporting it.
+func (gw *Gateway) tlsConfig() *tls.Config {
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: gw.certificates.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	if gw.clientCAs != nil {
+		// Client certificates are verified when presented but not required, so that browsers
+		// connect without one. The router requires them where needed, e.g. from terminals
+		config.ClientCAs = gw.clientCAs
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config
+}
+
+// redirectHandler redirects requests to the same URL over HTTPS, on the port of the address the
+// gateway listens on.
+func redirectHandler(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		host = strings.Trim(host, "[]")
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
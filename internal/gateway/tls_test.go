@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// writeCertificate writes a self-signed certificate for commonName and its key to the files.
+func writeCertificate(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, "first")
+
+	reloader, err := newCertificateReloader(certFile, keyFile)
+	require.NoError(t, err)
+	commonName := func() string {
+		certificate, err := reloader.GetCertificate(&tls.ClientHelloInfo{})
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+		require.NoError(t, err)
+		return leaf.Subject.CommonName
+	}
+	assert.Equal(t, "first", commonName())
+
+	reloaded, err := reloader.reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	// The current certificate is kept while the files are invalid
+	require.NoError(t, os.WriteFile(keyFile, []byte("half written"), 0o600))
+	require.NoError(t, os.Chtimes(keyFile, time.Now(), time.Now().Add(time.Minute)))
+	_, err = reloader.reload()
+	assert.Error(t, err)
+	assert.Equal(t, "first", commonName())
+
+	writeCertificate(t, certFile, keyFile, "second")
+	require.NoError(t, os.Chtimes(certFile, time.Now(), time.Now().Add(2*time.Minute)))
+	reloaded, err = reloader.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "second", commonName())
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		addr     string
+		host     string
+		expected string
+	}{
+		{addr: ":443", host: "pos.local", expected: "https://pos.local/api/orders?status=pending"},
+		{addr: ":8443", host: "pos.local:8080", expected: "https://pos.local:8443/api/orders?status=pending"},
+		{addr: ":8443", host: "[fe80::1]:8080", expected: "https://[fe80::1]:8443/api/orders?status=pending"},
+		{addr: ":443", host: "[fe80::1]", expected: "https://[fe80::1]/api/orders?status=pending"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr+" "+tt.host, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/orders?status=pending", nil)
+			request.Host = tt.host
+			recorder := httptest.NewRecorder()
+			redirectHandler(tt.addr).ServeHTTP(recorder, request)
+			assert.Equal(t, http.StatusPermanentRedirect, recorder.Code)
+			assert.Equal(t, tt.expected, recorder.Header().Get("Location"))
+		})
+	}
+}
+
+func TestGRPCTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, "pos.local")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcAddr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	newServer := func(opts ...grpc.ServerOption) *grpc.Server {
+		server := grpc.NewServer(opts...)
+		healthpb.RegisterHealthServer(server, health.NewServer())
+		return server
+	}
+	gw, err := NewGateway(echo.New(), WithAddr("127.0.0.1:0"), WithTLS(certFile, keyFile), WithGRPC(newServer, grpcAddr))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- gw.Serve(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-served)
+	})
+
+	// check calls the health service with the credentials and returns the peer of the call
+	check := func(t *testing.T, creds credentials.TransportCredentials, opts ...grpc.CallOption) (*peer.Peer, error) {
+		conn, err := grpc.NewClient(grpcAddr, grpc.WithTransportCredentials(creds))
+		require.NoError(t, err)
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		p := &peer.Peer{}
+		_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, append(opts, grpc.Peer(p))...)
+		return p, err
+	}
+
+	// The gateway may still be starting, so the first call waits for the server
+	p, err := check(t, credentials.NewTLS(&tls.Config{InsecureSkipVerify: true}), grpc.WaitForReady(true))
+	require.NoError(t, err)
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	require.True(t, ok)
+	assert.Equal(t, "pos.local", info.State.PeerCertificates[0].Subject.CommonName)
+
+	_, err = check(t, insecure.NewCredentials())
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
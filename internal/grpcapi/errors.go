@@ -0,0 +1,77 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/roushou/pocpoc/internal/pickup"
+	"github.com/roushou/pocpoc/internal/promotions"
+	"github.com/roushou/pocpoc/internal/services"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// domainError is how an error of the domain is reported to clients.
+type domainError struct {
+	err  error
+	code codes.Code
+}
+
+// domainErrors maps errors of the domain to statuses, so that handlers can return them as is. They
+// mirror the errors of the REST API.
+var domainErrors = []domainError{
+	{err: gorm.ErrRecordNotFound, code: codes.NotFound},
+	{err: gorm.ErrDuplicatedKey, code: codes.AlreadyExists},
+
+	// Callers are authenticated, so unauthorized actions are denied
+	{err: services.ErrUnauthorized, code: codes.PermissionDenied},
+	{err: services.ErrNotFound, code: codes.NotFound},
+	{err: services.ErrStaffDeactivated, code: codes.PermissionDenied},
+	{err: services.ErrAlreadyArchived, code: codes.FailedPrecondition},
+	{err: services.ErrNotArchived, code: codes.FailedPrecondition},
+	{err: services.ErrEmptyOrder, code: codes.InvalidArgument},
+	{err: services.ErrUnknownProduct, code: codes.InvalidArgument},
+	{err: services.ErrUnknownCustomer, code: codes.InvalidArgument},
+	{err: services.ErrInvalidOrderType, code: codes.InvalidArgument},
+	{err: services.ErrInvalidOrderStatus, code: codes.InvalidArgument},
+	{err: services.ErrInvalidPageSize, code: codes.InvalidArgument},
+	{err: services.ErrInvalidPageToken, code: codes.InvalidArgument},
+	{err: services.ErrInvalidStatusTransition, code: codes.FailedPrecondition},
+	{err: services.ErrOrderPaid, code: codes.FailedPrecondition},
+	{err: services.ErrNotClockedIn, code: codes.FailedPrecondition},
+
+	{err: pickup.ErrSlotUnavailable, code: codes.InvalidArgument},
+	{err: pickup.ErrSlotFull, code: codes.FailedPrecondition},
+	{err: pickup.ErrNoSlot, code: codes.FailedPrecondition},
+
+	{err: promotions.ErrUnknownCoupon, code: codes.InvalidArgument},
+}
+
+// toStatus returns the status of an error returned by a handler. Unknown errors are logged and
+// reported as internal errors without details.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	for _, domainErr := range domainErrors {
+		if errors.Is(err, domainErr.err) {
+			return status.Error(domainErr.code, domainErr.err.Error())
+		}
+	}
+
+	log.Printf("grpc: internal error: %v", err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+// invalidArgument reports a malformed field of a request.
+func invalidArgument(field string, message string) error {
+	return status.Errorf(codes.InvalidArgument, "%s: %s", field, message)
+}
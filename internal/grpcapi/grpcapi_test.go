@@ -0,0 +1,197 @@
+package grpcapi_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/database"
+	"github.com/roushou/pocpoc/internal/grpcapi"
+	"github.com/roushou/pocpoc/internal/grpcapi/pocpocv1"
+	"github.com/roushou/pocpoc/internal/router"
+	"github.com/roushou/pocpoc/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testAPI is the REST and gRPC APIs sharing services over an in-memory SQLite database.
+type testAPI struct {
+	router *echo.Echo
+	conn   *grpc.ClientConn
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	db, err := database.NewDatabase("file:" + t.Name() + "?mode=memory&cache=shared")
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate())
+	t.Cleanup(func() {
+		if sqlDB, err := db.Connection.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	svc := services.New(services.NewGormStore(db.Connection))
+	rest, err := router.NewRouter(db, router.WithServices(svc))
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpcapi.NewServer(db, svc)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return &testAPI{router: rest, conn: conn}
+}
+
+// rest sends a request to the REST API with the token and returns the response.
+func (api *testAPI) rest(t *testing.T, token string, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	encoded, err := json.Marshal(body)
+	require.NoError(t, err)
+	request := httptest.NewRequest(method, path, bytes.NewReader(encoded))
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.AddCookie(&http.Cookie{Name: "token", Value: token})
+	}
+	recorder := httptest.NewRecorder()
+	api.router.ServeHTTP(recorder, request)
+	require.Less(t, recorder.Code, 300, "%s %s: %s", method, path, recorder.Body)
+	return recorder
+}
+
+// signIn signs in over REST and returns the token of the session.
+func (api *testAPI) signIn(t *testing.T, path string, body any) string {
+	t.Helper()
+	for _, cookie := range api.rest(t, "", http.MethodPost, path, body).Result().Cookies() {
+		if cookie.Name == "token" {
+			return cookie.Value
+		}
+	}
+	t.Fatalf("no token set by %s", path)
+	return ""
+}
+
+// as returns a context authenticated with the token.
+func as(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestGRPC(t *testing.T) {
+	api := newTestAPI(t)
+	restaurants := pocpocv1.NewRestaurantServiceClient(api.conn)
+	products := pocpocv1.NewProductServiceClient(api.conn)
+	orders := pocpocv1.NewOrderServiceClient(api.conn)
+
+	credentials := map[string]string{"username": "owner", "password": "password"}
+	api.rest(t, "", http.MethodPost, "/api/auth/owners/sign-up", credentials)
+	owner := api.signIn(t, "/api/auth/owners/sign-in", credentials)
+
+	// Calls need the token of the REST API
+	_, err := restaurants.ListRestaurants(context.Background(), &pocpocv1.ListRestaurantsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = restaurants.ListRestaurants(as("forged"), &pocpocv1.ListRestaurantsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	restaurant, err := restaurants.RegisterRestaurant(as(owner), &pocpocv1.RegisterRestaurantRequest{Name: "Ramen House"})
+	require.NoError(t, err)
+	listed, err := restaurants.ListRestaurants(as(owner), &pocpocv1.ListRestaurantsRequest{})
+	require.NoError(t, err)
+	require.Len(t, listed.Restaurants, 1)
+	assert.Equal(t, "Ramen House", listed.Restaurants[0].Name)
+
+	product, err := products.RegisterProduct(as(owner), &pocpocv1.RegisterProductRequest{
+		RestaurantId: restaurant.RestaurantId,
+		Title:        "Ramen",
+		Description:  "Shoyu",
+		UnitPrice:    10,
+	})
+	require.NoError(t, err)
+	_, err = products.RegisterProduct(as(owner), &pocpocv1.RegisterProductRequest{RestaurantId: restaurant.RestaurantId})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	api.rest(t, owner, http.MethodPost, "/api/restaurants/"+restaurant.RestaurantId+"/staff", map[string]string{
+		"username": "waiter",
+		"password": "password",
+		"role":     "waiter",
+	})
+	waiter := api.signIn(t, "/api/auth/staff/sign-in", map[string]string{
+		"restaurant_id": restaurant.RestaurantId,
+		"username":      "waiter",
+		"password":      "password",
+	})
+
+	// Only owners register products, and errors of the domain keep their meaning
+	_, err = products.RegisterProduct(as(waiter), &pocpocv1.RegisterProductRequest{
+		RestaurantId: restaurant.RestaurantId,
+		Title:        "Gyoza",
+		Description:  "Pork",
+		UnitPrice:    6,
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// The waiter watches the orders of the restaurant
+	ctx, cancel := context.WithTimeout(as(waiter), 10*time.Second)
+	defer cancel()
+	watch, err := orders.WatchOrders(ctx, &pocpocv1.WatchOrdersRequest{RestaurantId: restaurant.RestaurantId})
+	require.NoError(t, err)
+	_, err = watch.Header()
+	require.NoError(t, err)
+
+	created, err := orders.CreateOrder(as(waiter), &pocpocv1.CreateOrderRequest{
+		RestaurantId: restaurant.RestaurantId,
+		TableNumber:  "1",
+		Items:        []*pocpocv1.OrderItemInput{{ProductId: product.ProductId, Quantity: 2}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "pending", created.Order.Status)
+	assert.Equal(t, 20.0, created.Order.TotalAmount)
+
+	_, err = orders.CreateOrder(as(waiter), &pocpocv1.CreateOrderRequest{RestaurantId: restaurant.RestaurantId, TableNumber: "1"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Changes made over REST are streamed too
+	api.rest(t, owner, http.MethodPut, "/api/orders/"+created.Order.OrderId+"/status", map[string]string{"status": "confirmed"})
+	_, err = orders.UpdateOrderStatus(as(waiter), &pocpocv1.UpdateOrderStatusRequest{OrderId: created.Order.OrderId, Status: "pending"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	for _, expected := range []string{"pending", "confirmed"} {
+		update, err := watch.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, created.Order.OrderId, update.Order.OrderId)
+		assert.Equal(t, expected, update.Order.Status)
+	}
+
+	listedOrders, err := orders.ListOrders(as(owner), &pocpocv1.ListOrdersRequest{RestaurantId: restaurant.RestaurantId, Status: "confirmed"})
+	require.NoError(t, err)
+	require.Len(t, listedOrders.Orders, 1)
+	assert.Equal(t, created.Order.OrderId, listedOrders.Orders[0].OrderId)
+	assert.Empty(t, listedOrders.NextPageToken)
+	_, err = orders.ListOrders(as(owner), &pocpocv1.ListOrdersRequest{RestaurantId: restaurant.RestaurantId, PageToken: "not a token"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Restaurants of other owners can't be watched
+	other := map[string]string{"username": "other", "password": "password"}
+	api.rest(t, "", http.MethodPost, "/api/auth/owners/sign-up", other)
+	otherOwner := api.signIn(t, "/api/auth/owners/sign-in", other)
+	denied, err := orders.WatchOrders(as(otherOwner), &pocpocv1.WatchOrdersRequest{RestaurantId: restaurant.RestaurantId})
+	require.NoError(t, err)
+	_, err = denied.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
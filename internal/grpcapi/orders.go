@@ -0,0 +1,272 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/grpcapi/pocpocv1"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/services"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Limits of order inputs, as in the REST API.
+const (
+	maxModifiers       = 10
+	maxModifierLength  = 100
+	maxContactName     = 100
+	maxContactPhone    = 30
+	maxDeliveryAddress = 500
+	maxCouponCode      = 32
+)
+
+type orderServer struct {
+	pocpocv1.UnimplementedOrderServiceServer
+	services *services.Services
+}
+
+func newOrder(order *models.Order) *pocpocv1.Order {
+	items := make([]*pocpocv1.OrderItem, 0, len(order.OrderItems))
+	for _, item := range order.OrderItems {
+		items = append(items, &pocpocv1.OrderItem{
+			ItemId:    item.ID.String(),
+			ProductId: item.ProductID.String(),
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			Modifiers: item.Modifiers,
+		})
+	}
+
+	response := &pocpocv1.Order{
+		OrderId:           order.ID.String(),
+		RestaurantId:      order.RestaurantID.String(),
+		StaffId:           order.StaffID.String(),
+		Type:              string(order.Type),
+		TableNumber:       order.TableNumber,
+		Status:            string(order.Status),
+		Source:            string(order.Source),
+		ExternalId:        order.ExternalID,
+		ContactName:       order.ContactName,
+		ContactPhone:      order.ContactPhone,
+		PickupAt:          newTimestamp(order.PickupAt),
+		DeliveryAddress:   order.DeliveryAddress,
+		DeliveryFee:       order.DeliveryFee,
+		TotalAmount:       order.TotalAmount,
+		DiscountAmount:    order.DiscountAmount,
+		PromotionDiscount: order.PromotionDiscount,
+		CouponCode:        order.CouponCode,
+		TaxAmount:         order.TaxAmount,
+		PaidAt:            newTimestamp(order.PaidAt),
+		InvoiceNumber:     order.InvoiceNumber,
+		RedeemedPoints:    order.RedeemedPoints,
+		CreatedAt:         timestamppb.New(order.CreatedAt),
+		UpdatedAt:         timestamppb.New(order.UpdatedAt),
+		Items:             items,
+	}
+	if order.CustomerID != nil {
+		customerID := order.CustomerID.String()
+		response.CustomerId = &customerID
+	}
+	return response
+}
+
+func (s *orderServer) ListOrders(ctx context.Context, req *pocpocv1.ListOrdersRequest) (*pocpocv1.ListOrdersResponse, error) {
+	restaurantID, err := parseID("restaurant_id", req.RestaurantId)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.services.Orders.List(ctx, actorFrom(ctx), restaurantID, services.ListOrders{
+		Status:    models.OrderStatus(req.Status),
+		PageSize:  int(req.PageSize),
+		PageToken: req.PageToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]*pocpocv1.Order, 0, len(page.Orders))
+	for _, order := range page.Orders {
+		orders = append(orders, newOrder(&order))
+	}
+	return &pocpocv1.ListOrdersResponse{Orders: orders, NextPageToken: page.NextPageToken}, nil
+}
+
+func (s *orderServer) CreateOrder(ctx context.Context, req *pocpocv1.CreateOrderRequest) (*pocpocv1.CreateOrderResponse, error) {
+	restaurantID, err := parseID("restaurant_id", req.RestaurantId)
+	if err != nil {
+		return nil, err
+	}
+	input, err := newOrderInput(req)
+	if err != nil {
+		return nil, err
+	}
+
+	order, result, err := s.services.Orders.Create(ctx, actorFrom(ctx), restaurantID, input)
+	if err != nil {
+		return nil, err
+	}
+
+	outcomes := make([]*pocpocv1.PromotionOutcome, 0, len(result.Promotions))
+	for _, outcome := range result.Promotions {
+		outcomes = append(outcomes, &pocpocv1.PromotionOutcome{
+			PromotionId: outcome.PromotionID.String(),
+			Name:        outcome.Name,
+			Kind:        string(outcome.Kind),
+			Code:        outcome.Code,
+			Applied:     outcome.Applied,
+			Amount:      outcome.Amount,
+			Reason:      outcome.Reason,
+		})
+	}
+	return &pocpocv1.CreateOrderResponse{Order: newOrder(order), Promotions: outcomes}, nil
+}
+
+// newOrderInput validates the order to create like the REST API does.
+func newOrderInput(req *pocpocv1.CreateOrderRequest) (services.NewOrder, error) {
+	input := services.NewOrder{
+		OrderDetails: services.OrderDetails{
+			Type:            models.OrderType(req.Type),
+			TableNumber:     req.TableNumber,
+			ContactName:     req.ContactName,
+			ContactPhone:    req.ContactPhone,
+			DeliveryAddress: req.DeliveryAddress,
+			DeliveryFee:     req.DeliveryFee,
+		},
+		CouponCode: req.CouponCode,
+	}
+	switch {
+	case len(req.ContactName) > maxContactName:
+		return input, invalidArgument("contact_name", "is too long")
+	case len(req.ContactPhone) > maxContactPhone:
+		return input, invalidArgument("contact_phone", "is too long")
+	case len(req.DeliveryAddress) > maxDeliveryAddress:
+		return input, invalidArgument("delivery_address", "is too long")
+	case req.DeliveryFee != nil && *req.DeliveryFee < 0:
+		return input, invalidArgument("delivery_fee", "should not be negative")
+	case len(req.CouponCode) > maxCouponCode:
+		return input, invalidArgument("coupon_code", "is too long")
+	case len(req.Items) == 0:
+		return input, invalidArgument("items", "is required")
+	}
+
+	if req.PickupAt != nil {
+		if err := req.PickupAt.CheckValid(); err != nil {
+			return input, invalidArgument("pickup_at", "is not a valid timestamp")
+		}
+		pickupAt := req.PickupAt.AsTime()
+		input.PickupAt = &pickupAt
+	}
+	if req.CustomerId != nil {
+		customerID, err := parseID("customer_id", *req.CustomerId)
+		if err != nil {
+			return input, err
+		}
+		input.CustomerID = &customerID
+	}
+
+	for i, item := range req.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		productID, err := parseID(field+".product_id", item.ProductId)
+		if err != nil {
+			return input, err
+		}
+		var itemID uuid.UUID
+		if item.ItemId != "" {
+			if itemID, err = parseID(field+".item_id", item.ItemId); err != nil {
+				return input, err
+			}
+		}
+		if item.Quantity == 0 {
+			return input, invalidArgument(field+".quantity", "is required")
+		}
+		if len(item.Modifiers) > maxModifiers {
+			return input, invalidArgument(field+".modifiers", "has too many modifiers")
+		}
+		for _, modifier := range item.Modifiers {
+			if modifier == "" || len(modifier) > maxModifierLength {
+				return input, invalidArgument(field+".modifiers", "should be 1 to 100 characters")
+			}
+		}
+		input.Items = append(input.Items, services.OrderItem{
+			ItemID:    itemID,
+			ProductID: productID,
+			Quantity:  item.Quantity,
+			Modifiers: item.Modifiers,
+		})
+	}
+	return input, nil
+}
+
+func (s *orderServer) UpdateOrderStatus(ctx context.Context, req *pocpocv1.UpdateOrderStatusRequest) (*pocpocv1.Order, error) {
+	orderID, err := parseID("order_id", req.OrderId)
+	if err != nil {
+		return nil, err
+	}
+	if req.Status == "" {
+		return nil, invalidArgument("status", "is required")
+	}
+
+	order, err := s.services.Orders.ChangeStatus(ctx, actorFrom(ctx), orderID, models.OrderStatus(req.Status))
+	if err != nil {
+		return nil, err
+	}
+	return newOrder(order), nil
+}
+
+// WatchOrders sends the orders of the restaurant as they are taken and change status until the client
+// cancels the call. The call fails with Unavailable if the client can't keep up with the updates.
+func (s *orderServer) WatchOrders(req *pocpocv1.WatchOrdersRequest, stream grpc.ServerStreamingServer[pocpocv1.OrderUpdate]) error {
+	ctx := stream.Context()
+	restaurantID, err := parseID("restaurant_id", req.RestaurantId)
+	if err != nil {
+		return err
+	}
+	var orderID uuid.UUID
+	if req.OrderId != "" {
+		if orderID, err = parseID("order_id", req.OrderId); err != nil {
+			return err
+		}
+	}
+
+	updates, stop, err := s.services.Orders.Watch(ctx, actorFrom(ctx), restaurantID)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	// Headers are sent right away so that clients know they are watching
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case order, ok := <-updates:
+			if !ok {
+				return status.Error(codes.Unavailable, "too many pending updates, list orders and watch again")
+			}
+			if orderID != uuid.Nil && order.ID != orderID {
+				continue
+			}
+			if err := stream.Send(&pocpocv1.OrderUpdate{Order: newOrder(&order)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// newTimestamp returns the timestamp of an optional time.
+func newTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
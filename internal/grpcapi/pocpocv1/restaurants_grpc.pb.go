@@ -0,0 +1,319 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: pocpoc/v1/restaurants.proto
+
+package pocpocv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	RestaurantService_ListRestaurants_FullMethodName     = "/pocpoc.v1.RestaurantService/ListRestaurants"
+	RestaurantService_GetRestaurant_FullMethodName       = "/pocpoc.v1.RestaurantService/GetRestaurant"
+	RestaurantService_RegisterRestaurant_FullMethodName  = "/pocpoc.v1.RestaurantService/RegisterRestaurant"
+	RestaurantService_RenameRestaurant_FullMethodName    = "/pocpoc.v1.RestaurantService/RenameRestaurant"
+	RestaurantService_ArchiveRestaurant_FullMethodName   = "/pocpoc.v1.RestaurantService/ArchiveRestaurant"
+	RestaurantService_UnarchiveRestaurant_FullMethodName = "/pocpoc.v1.RestaurantService/UnarchiveRestaurant"
+)
+
+// RestaurantServiceClient is the client API for RestaurantService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// RestaurantService mirrors the /restaurants resources of the REST API.
+type RestaurantServiceClient interface {
+	// ListRestaurants lists the restaurants the caller owns, or the restaurant they work at for staff.
+	ListRestaurants(ctx context.Context, in *ListRestaurantsRequest, opts ...grpc.CallOption) (*ListRestaurantsResponse, error)
+	GetRestaurant(ctx context.Context, in *GetRestaurantRequest, opts ...grpc.CallOption) (*Restaurant, error)
+	// RegisterRestaurant registers a restaurant owned by the caller, who must be an owner.
+	RegisterRestaurant(ctx context.Context, in *RegisterRestaurantRequest, opts ...grpc.CallOption) (*Restaurant, error)
+	RenameRestaurant(ctx context.Context, in *RenameRestaurantRequest, opts ...grpc.CallOption) (*Restaurant, error)
+	ArchiveRestaurant(ctx context.Context, in *ArchiveRestaurantRequest, opts ...grpc.CallOption) (*Restaurant, error)
+	UnarchiveRestaurant(ctx context.Context, in *UnarchiveRestaurantRequest, opts ...grpc.CallOption) (*Restaurant, error)
+}
+
+type restaurantServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRestaurantServiceClient(cc grpc.ClientConnInterface) RestaurantServiceClient {
+	return &restaurantServiceClient{cc}
+}
+
+func (c *restaurantServiceClient) ListRestaurants(ctx context.Context, in *ListRestaurantsRequest, opts ...grpc.CallOption) (*ListRestaurantsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRestaurantsResponse)
+	err := c.cc.Invoke(ctx, RestaurantService_ListRestaurants_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restaurantServiceClient) GetRestaurant(ctx context.Context, in *GetRestaurantRequest, opts ...grpc.CallOption) (*Restaurant, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Restaurant)
+	err := c.cc.Invoke(ctx, RestaurantService_GetRestaurant_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restaurantServiceClient) RegisterRestaurant(ctx context.Context, in *RegisterRestaurantRequest, opts ...grpc.CallOption) (*Restaurant, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Restaurant)
+	err := c.cc.Invoke(ctx, RestaurantService_RegisterRestaurant_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restaurantServiceClient) RenameRestaurant(ctx context.Context, in *RenameRestaurantRequest, opts ...grpc.CallOption) (*Restaurant, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Restaurant)
+	err := c.cc.Invoke(ctx, RestaurantService_RenameRestaurant_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restaurantServiceClient) ArchiveRestaurant(ctx context.Context, in *ArchiveRestaurantRequest, opts ...grpc.CallOption) (*Restaurant, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Restaurant)
+	err := c.cc.Invoke(ctx, RestaurantService_ArchiveRestaurant_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *restaurantServiceClient) UnarchiveRestaurant(ctx context.Context, in *UnarchiveRestaurantRequest, opts ...grpc.CallOption) (*Restaurant, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Restaurant)
+	err := c.cc.Invoke(ctx, RestaurantService_UnarchiveRestaurant_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RestaurantServiceServer is the server API for RestaurantService service.
+// All implementations must embed UnimplementedRestaurantServiceServer
+// for forward compatibility.
+//
+// RestaurantService mirrors the /restaurants resources of the REST API.
+type RestaurantServiceServer interface {
+	// ListRestaurants lists the restaurants the caller owns, or the restaurant they work at for staff.
+	ListRestaurants(context.Context, *ListRestaurantsRequest) (*ListRestaurantsResponse, error)
+	GetRestaurant(context.Context, *GetRestaurantRequest) (*Restaurant, error)
+	// RegisterRestaurant registers a restaurant owned by the caller, who must be an owner.
+	RegisterRestaurant(context.Context, *RegisterRestaurantRequest) (*Restaurant, error)
+	RenameRestaurant(context.Context, *RenameRestaurantRequest) (*Restaurant, error)
+	ArchiveRestaurant(context.Context, *ArchiveRestaurantRequest) (*Restaurant, error)
+	UnarchiveRestaurant(context.Context, *UnarchiveRestaurantRequest) (*Restaurant, error)
+	mustEmbedUnimplementedRestaurantServiceServer()
+}
+
+// UnimplementedRestaurantServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRestaurantServiceServer struct{}
+
+func (UnimplementedRestaurantServiceServer) ListRestaurants(context.Context, *ListRestaurantsRequest) (*ListRestaurantsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRestaurants not implemented")
+}
+func (UnimplementedRestaurantServiceServer) GetRestaurant(context.Context, *GetRestaurantRequest) (*Restaurant, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRestaurant not implemented")
+}
+func (UnimplementedRestaurantServiceServer) RegisterRestaurant(context.Context, *RegisterRestaurantRequest) (*Restaurant, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterRestaurant not implemented")
+}
+func (UnimplementedRestaurantServiceServer) RenameRestaurant(context.Context, *RenameRestaurantRequest) (*Restaurant, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RenameRestaurant not implemented")
+}
+func (UnimplementedRestaurantServiceServer) ArchiveRestaurant(context.Context, *ArchiveRestaurantRequest) (*Restaurant, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ArchiveRestaurant not implemented")
+}
+func (UnimplementedRestaurantServiceServer) UnarchiveRestaurant(context.Context, *UnarchiveRestaurantRequest) (*Restaurant, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnarchiveRestaurant not implemented")
+}
+func (UnimplementedRestaurantServiceServer) mustEmbedUnimplementedRestaurantServiceServer() {}
+func (UnimplementedRestaurantServiceServer) testEmbeddedByValue()                           {}
+
+// UnsafeRestaurantServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RestaurantServiceServer will
+// result in compilation errors.
+type UnsafeRestaurantServiceServer interface {
+	mustEmbedUnimplementedRestaurantServiceServer()
+}
+
+func RegisterRestaurantServiceServer(s grpc.ServiceRegistrar, srv RestaurantServiceServer) {
+	// If the following call pancis, it indicates UnimplementedRestaurantServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&RestaurantService_ServiceDesc, srv)
+}
+
+func _RestaurantService_ListRestaurants_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRestaurantsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestaurantServiceServer).ListRestaurants(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestaurantService_ListRestaurants_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestaurantServiceServer).ListRestaurants(ctx, req.(*ListRestaurantsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestaurantService_GetRestaurant_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRestaurantRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestaurantServiceServer).GetRestaurant(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestaurantService_GetRestaurant_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestaurantServiceServer).GetRestaurant(ctx, req.(*GetRestaurantRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestaurantService_RegisterRestaurant_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRestaurantRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestaurantServiceServer).RegisterRestaurant(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestaurantService_RegisterRestaurant_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestaurantServiceServer).RegisterRestaurant(ctx, req.(*RegisterRestaurantRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestaurantService_RenameRestaurant_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenameRestaurantRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestaurantServiceServer).RenameRestaurant(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestaurantService_RenameRestaurant_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestaurantServiceServer).RenameRestaurant(ctx, req.(*RenameRestaurantRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestaurantService_ArchiveRestaurant_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ArchiveRestaurantRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestaurantServiceServer).ArchiveRestaurant(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestaurantService_ArchiveRestaurant_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestaurantServiceServer).ArchiveRestaurant(ctx, req.(*ArchiveRestaurantRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RestaurantService_UnarchiveRestaurant_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnarchiveRestaurantRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RestaurantServiceServer).UnarchiveRestaurant(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RestaurantService_UnarchiveRestaurant_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RestaurantServiceServer).UnarchiveRestaurant(ctx, req.(*UnarchiveRestaurantRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RestaurantService_ServiceDesc is the grpc.ServiceDesc for RestaurantService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RestaurantService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pocpoc.v1.RestaurantService",
+	HandlerType: (*RestaurantServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListRestaurants",
+			Handler:    _RestaurantService_ListRestaurants_Handler,
+		},
+		{
+			MethodName: "GetRestaurant",
+			Handler:    _RestaurantService_GetRestaurant_Handler,
+		},
+		{
+			MethodName: "RegisterRestaurant",
+			Handler:    _RestaurantService_RegisterRestaurant_Handler,
+		},
+		{
+			MethodName: "RenameRestaurant",
+			Handler:    _RestaurantService_RenameRestaurant_Handler,
+		},
+		{
+			MethodName: "ArchiveRestaurant",
+			Handler:    _RestaurantService_ArchiveRestaurant_Handler,
+		},
+		{
+			MethodName: "UnarchiveRestaurant",
+			Handler:    _RestaurantService_UnarchiveRestaurant_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pocpoc/v1/restaurants.proto",
+}
@@ -0,0 +1,95 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/roushou/pocpoc/internal/grpcapi/pocpocv1"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/services"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxCategoryLength is the maximum length of product categories, as in the REST API.
+const maxCategoryLength = 50
+
+type productServer struct {
+	pocpocv1.UnimplementedProductServiceServer
+	services *services.Services
+}
+
+func newProduct(product *models.Product) *pocpocv1.Product {
+	return &pocpocv1.Product{
+		ProductId:    product.ID.String(),
+		RestaurantId: product.RestaurantID.String(),
+		Title:        product.Title,
+		Description:  product.Description,
+		Category:     product.Category,
+		UnitPrice:    product.UnitPrice,
+		Available:    product.Available,
+		CreatedAt:    timestamppb.New(product.CreatedAt),
+		UpdatedAt:    timestamppb.New(product.UpdatedAt),
+	}
+}
+
+func (s *productServer) ListProducts(ctx context.Context, req *pocpocv1.ListProductsRequest) (*pocpocv1.ListProductsResponse, error) {
+	restaurantID, err := parseID("restaurant_id", req.RestaurantId)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.services.Products.List(ctx, actorFrom(ctx), restaurantID)
+	if err != nil {
+		return nil, err
+	}
+
+	products := make([]*pocpocv1.Product, 0, len(rows))
+	for _, product := range rows {
+		products = append(products, newProduct(&product))
+	}
+	return &pocpocv1.ListProductsResponse{Products: products}, nil
+}
+
+func (s *productServer) RegisterProduct(ctx context.Context, req *pocpocv1.RegisterProductRequest) (*pocpocv1.Product, error) {
+	restaurantID, err := parseID("restaurant_id", req.RestaurantId)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case req.Title == "":
+		return nil, invalidArgument("title", "is required")
+	case req.Description == "":
+		return nil, invalidArgument("description", "is required")
+	case len(req.Category) > maxCategoryLength:
+		return nil, invalidArgument("category", "is too long")
+	case req.UnitPrice <= 0:
+		return nil, invalidArgument("unit_price", "should be positive")
+	}
+
+	product, err := s.services.Products.Register(ctx, actorFrom(ctx), restaurantID, services.NewProduct{
+		Title:       req.Title,
+		Description: req.Description,
+		Category:    req.Category,
+		UnitPrice:   req.UnitPrice,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newProduct(product), nil
+}
+
+func (s *productServer) SetProductAvailability(ctx context.Context, req *pocpocv1.SetProductAvailabilityRequest) (*pocpocv1.Product, error) {
+	restaurantID, err := parseID("restaurant_id", req.RestaurantId)
+	if err != nil {
+		return nil, err
+	}
+	productID, err := parseID("product_id", req.ProductId)
+	if err != nil {
+		return nil, err
+	}
+
+	product, err := s.services.Products.SetAvailability(ctx, actorFrom(ctx), restaurantID, productID, req.Available)
+	if err != nil {
+		return nil, err
+	}
+	return newProduct(product), nil
+}
@@ -0,0 +1,111 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/grpcapi/pocpocv1"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/services"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type restaurantServer struct {
+	pocpocv1.UnimplementedRestaurantServiceServer
+	services *services.Services
+}
+
+func newRestaurant(restaurant *models.Restaurant) *pocpocv1.Restaurant {
+	return &pocpocv1.Restaurant{
+		RestaurantId: restaurant.ID.String(),
+		OwnerId:      restaurant.OwnerID.String(),
+		Name:         restaurant.Name,
+		ArchivedAt:   newTimestamp(restaurant.ArchivedAt),
+		CreatedAt:    timestamppb.New(restaurant.CreatedAt),
+		UpdatedAt:    timestamppb.New(restaurant.UpdatedAt),
+	}
+}
+
+func (s *restaurantServer) ListRestaurants(ctx context.Context, req *pocpocv1.ListRestaurantsRequest) (*pocpocv1.ListRestaurantsResponse, error) {
+	rows, err := s.services.Restaurants.List(ctx, actorFrom(ctx), req.IncludeArchived)
+	if err != nil {
+		return nil, err
+	}
+
+	restaurants := make([]*pocpocv1.Restaurant, 0, len(rows))
+	for _, restaurant := range rows {
+		restaurants = append(restaurants, newRestaurant(&restaurant))
+	}
+	return &pocpocv1.ListRestaurantsResponse{Restaurants: restaurants}, nil
+}
+
+func (s *restaurantServer) GetRestaurant(ctx context.Context, req *pocpocv1.GetRestaurantRequest) (*pocpocv1.Restaurant, error) {
+	restaurantID, err := parseID("restaurant_id", req.RestaurantId)
+	if err != nil {
+		return nil, err
+	}
+
+	restaurant, err := s.services.Restaurants.Get(ctx, actorFrom(ctx), restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	return newRestaurant(restaurant), nil
+}
+
+func (s *restaurantServer) RegisterRestaurant(ctx context.Context, req *pocpocv1.RegisterRestaurantRequest) (*pocpocv1.Restaurant, error) {
+	if req.Name == "" {
+		return nil, invalidArgument("name", "is required")
+	}
+
+	restaurant, err := s.services.Restaurants.Register(ctx, actorFrom(ctx), req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return newRestaurant(restaurant), nil
+}
+
+func (s *restaurantServer) RenameRestaurant(ctx context.Context, req *pocpocv1.RenameRestaurantRequest) (*pocpocv1.Restaurant, error) {
+	restaurantID, err := parseID("restaurant_id", req.RestaurantId)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name == "" {
+		return nil, invalidArgument("name", "is required")
+	}
+
+	restaurant, err := s.services.Restaurants.Rename(ctx, actorFrom(ctx), restaurantID, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return newRestaurant(restaurant), nil
+}
+
+func (s *restaurantServer) ArchiveRestaurant(ctx context.Context, req *pocpocv1.ArchiveRestaurantRequest) (*pocpocv1.Restaurant, error) {
+	return s.setArchived(ctx, req.RestaurantId, true)
+}
+
+func (s *restaurantServer) UnarchiveRestaurant(ctx context.Context, req *pocpocv1.UnarchiveRestaurantRequest) (*pocpocv1.Restaurant, error) {
+	return s.setArchived(ctx, req.RestaurantId, false)
+}
+
+func (s *restaurantServer) setArchived(ctx context.Context, rawRestaurantID string, archived bool) (*pocpocv1.Restaurant, error) {
+	restaurantID, err := parseID("restaurant_id", rawRestaurantID)
+	if err != nil {
+		return nil, err
+	}
+
+	restaurant, err := s.services.Restaurants.SetArchived(ctx, actorFrom(ctx), restaurantID, archived)
+	if err != nil {
+		return nil, err
+	}
+	return newRestaurant(restaurant), nil
+}
+
+// parseID parses the UUID of a field of a request.
+func parseID(field string, raw string) (uuid.UUID, error) {
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, invalidArgument(field, "is not a valid UUID")
+	}
+	return id, nil
+}
@@ -0,0 +1,144 @@
+// Package grpcapi serves the restaurants, products and orders of the REST API over gRPC for internal
+// services. Handlers call the same services as the REST API and clients authenticate with the same
+// tokens, sent as a bearer token in the authorization metadata.
+package grpcapi
+
+//go:generate make -C ../.. proto
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"strings"
+
+	"github.com/roushou/pocpoc/internal/database"
+	"github.com/roushou/pocpoc/internal/grpcapi/pocpocv1"
+	"github.com/roushou/pocpoc/internal/router"
+	"github.com/roushou/pocpoc/internal/services"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// authorizationMetadata is the metadata key of the bearer token.
+const authorizationMetadata = "authorization"
+
+type actorContextKey struct{}
+
+type options struct {
+	serverOptions        []grpc.ServerOption
+	terminalCertificates bool
+}
+
+// Option configures the server.
+type Option func(options *options)
+
+// WithServerOptions creates the server with the options, e.g. its transport credentials.
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(options *options) {
+		options.serverOptions = append(options.serverOptions, opts...)
+	}
+}
+
+// WithTerminalCertificates only accepts the sessions of staff signed in on a terminal over connections
+// made with the client certificate of the terminal, as router.WithTerminalCertificates does.
+func WithTerminalCertificates() Option {
+	return func(options *options) {
+		options.terminalCertificates = true
+	}
+}
+
+// NewServer returns a gRPC server with the services registered. Calls are authenticated, and errors of
+// the domain returned by handlers are translated to gRPC statuses.
+func NewServer(database *database.Database, services *services.Services, opts ...Option) *grpc.Server {
+	options := &options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	auth := &authenticator{database: database, services: services, terminalCertificates: options.terminalCertificates}
+	serverOptions := append(options.serverOptions,
+		grpc.ChainUnaryInterceptor(auth.unary),
+		grpc.ChainStreamInterceptor(auth.stream),
+	)
+
+	server := grpc.NewServer(serverOptions...)
+	pocpocv1.RegisterRestaurantServiceServer(server, &restaurantServer{services: services})
+	pocpocv1.RegisterProductServiceServer(server, &productServer{services: services})
+	pocpocv1.RegisterOrderServiceServer(server, &orderServer{services: services})
+	return server
+}
+
+// authenticator sets the actor of calls in their context from the bearer token of their metadata.
+type authenticator struct {
+	database *database.Database
+	services *services.Services
+	// terminalCertificates requires terminal sessions to be sent with the client certificate of their
+	// terminal.
+	terminalCertificates bool
+}
+
+func (a *authenticator) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	return resp, toStatus(err)
+}
+
+func (a *authenticator) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return toStatus(handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx}))
+}
+
+func (a *authenticator) authenticate(ctx context.Context) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(authorizationMetadata)
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "malformed bearer token")
+	}
+
+	// Client certificates are only known on connections secured with TLS credentials
+	var connection *tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			connection = &info.State
+		}
+	}
+
+	actor, err := router.Authenticate(ctx, a.database, a.services, token, connection, a.terminalCertificates)
+	if err != nil {
+		if errors.Is(err, services.ErrUnauthorized) {
+			return nil, status.Error(codes.Unauthenticated, "invalid or revoked token")
+		}
+		return nil, toStatus(err)
+	}
+	return context.WithValue(ctx, actorContextKey{}, actor), nil
+}
+
+// authenticatedStream is a stream with the actor in its context.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// actorFrom returns the actor set by the authenticator.
+func actorFrom(ctx context.Context) services.Actor {
+	actor, _ := ctx.Value(actorContextKey{}).(services.Actor)
+	return actor
+}
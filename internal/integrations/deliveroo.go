@@ -0,0 +1,295 @@
+package integrations
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+)
+
+// PlatformDeliveroo is the Deliveroo marketplace, see Deliveroo.
+const PlatformDeliveroo = "deliveroo"
+
+const (
+	// HeaderDeliverooSequenceGUID and HeaderDeliverooSignature sign the webhooks of Deliveroo.
+	HeaderDeliverooSequenceGUID = "X-Deliveroo-Sequence-Guid"
+	HeaderDeliverooSignature    = "X-Deliveroo-Hmac-Sha256"
+)
+
+// Fulfillment types of Deliveroo orders, which tell who takes the order to the customer.
+const (
+	deliverooFulfillmentRider      = "deliveroo"
+	deliverooFulfillmentRestaurant = "restaurant"
+	deliverooFulfillmentCustomer   = "customer"
+)
+
+// deliverooLanguage is the language of the texts of pushed menus.
+const deliverooLanguage = "en"
+
+// Deliveroo is the adapter of the Deliveroo order and menu APIs:
+//
+//   - Webhooks carry a unique GUID in the X-Deliveroo-Sequence-Guid header and the hex HMAC-SHA256 of
+//     "<guid> <body>" keyed with the webhook secret in the X-Deliveroo-Hmac-Sha256 header. They are not
+//     timestamped, replayed webhooks are caught by the ID of their order like retries. Only the
+//     order.new event carries an order.
+//   - Stores are identified as "<brand_id>/<site_id>". The menu of the site is replaced with
+//     PUT <endpoint>/menu/v1/brands/<brand_id>/menus/<site_id>, sold out products are left out of it.
+//   - Orders are accepted or rejected with PATCH <endpoint>/order/v1/orders/<order_id> and their
+//     preparation is reported with POST <endpoint>/order/v1/orders/<order_id>/prep_stage.
+//
+// Orders collected by a Deliveroo rider or by the customer are takeaway orders, only the orders
+// delivered by the restaurant are delivery orders. Amounts are in cents. Requests to the platform are
+// authenticated with the API key as a bearer token.
+type Deliveroo struct{}
+
+// DeliverooMoney is an amount in cents.
+type DeliverooMoney struct {
+	Fractional   int64  `json:"fractional"`
+	CurrencyCode string `json:"currency_code,omitempty"`
+}
+
+// DeliverooWebhook is the body of order webhooks of Deliveroo.
+type DeliverooWebhook struct {
+	Event string `json:"event"`
+	Body  struct {
+		Order DeliverooOrder `json:"order"`
+	} `json:"body"`
+}
+
+type DeliverooOrder struct {
+	ID              string     `json:"id"`
+	FulfillmentType string     `json:"fulfillment_type"`
+	PickupAt        *time.Time `json:"pickup_at,omitempty"`
+	Customer        struct {
+		FirstName     string `json:"first_name"`
+		ContactNumber string `json:"contact_number"`
+	} `json:"customer"`
+	Delivery *struct {
+		DeliveryFee DeliverooMoney   `json:"delivery_fee"`
+		Address     DeliverooAddress `json:"address"`
+	} `json:"delivery,omitempty"`
+	Items []DeliverooOrderItem `json:"items"`
+}
+
+type DeliverooAddress struct {
+	Number     string `json:"number"`
+	Street     string `json:"street"`
+	PostalCode string `json:"postal_code"`
+	City       string `json:"city"`
+}
+
+// String formats the address on one line, e.g. "1 rue de Rivoli, 75001 Paris".
+func (a DeliverooAddress) String() string {
+	street := strings.TrimSpace(a.Number + " " + a.Street)
+	city := strings.TrimSpace(a.PostalCode + " " + a.City)
+	if street == "" || city == "" {
+		return street + city
+	}
+	return street + ", " + city
+}
+
+// DeliverooOrderItem is an item of an order, or a modifier of an item. PosItemID is the PLU the
+// product was pushed with.
+type DeliverooOrderItem struct {
+	PosItemID string               `json:"pos_item_id"`
+	Name      string               `json:"name"`
+	Quantity  uint32               `json:"quantity"`
+	Modifiers []DeliverooOrderItem `json:"modifiers,omitempty"`
+}
+
+// DeliverooMenu is the body of menu pushes of Deliveroo.
+type DeliverooMenu struct {
+	Name    string               `json:"name"`
+	Menu    DeliverooMenuContent `json:"menu"`
+	SiteIDs []string             `json:"site_ids"`
+}
+
+type DeliverooMenuContent struct {
+	Categories []DeliverooCategory `json:"categories"`
+	Items      []DeliverooMenuItem `json:"items"`
+}
+
+type DeliverooCategory struct {
+	ID      string            `json:"id"`
+	Name    map[string]string `json:"name"`
+	ItemIDs []string          `json:"item_ids"`
+}
+
+type DeliverooMenuItem struct {
+	ID          string            `json:"id"`
+	PLU         string            `json:"plu"`
+	Name        map[string]string `json:"name"`
+	Description map[string]string `json:"description"`
+	PriceInfo   struct {
+		Price int64 `json:"price"`
+	} `json:"price_info"`
+}
+
+// DeliverooOrderStatus is the body of order acceptances and rejections.
+type DeliverooOrderStatus struct {
+	Status string `json:"status"`
+}
+
+// DeliverooPrepStage is the body of preparation updates.
+type DeliverooPrepStage struct {
+	Stage string `json:"stage"`
+}
+
+// SignDeliverooWebhook returns the signature of a Deliveroo webhook with the sequence GUID.
+func SignDeliverooWebhook(body []byte, secret string, sequenceGUID string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(sequenceGUID))
+	mac.Write([]byte(" "))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (Deliveroo) VerifyWebhook(header http.Header, body []byte, secret string, now time.Time) error {
+	sequenceGUID := header.Get(HeaderDeliverooSequenceGUID)
+	if sequenceGUID == "" {
+		return ErrInvalidSignature
+	}
+	signature, err := hex.DecodeString(header.Get(HeaderDeliverooSignature))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	expected, _ := hex.DecodeString(SignDeliverooWebhook(body, secret, sequenceGUID))
+	if !hmac.Equal(signature, expected) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (Deliveroo) ParseOrder(body []byte) (*Order, error) {
+	payload := DeliverooWebhook{}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Event != "order.new" {
+		return nil, ErrInvalidOrder
+	}
+	external := payload.Body.Order
+
+	order := &Order{
+		ExternalID:   external.ID,
+		ContactName:  external.Customer.FirstName,
+		ContactPhone: external.Customer.ContactNumber,
+		PickupAt:     external.PickupAt,
+		Items:        make([]OrderItem, 0, len(external.Items)),
+	}
+	switch external.FulfillmentType {
+	case deliverooFulfillmentRider, deliverooFulfillmentCustomer:
+		order.Type = models.OrderTypeTakeaway
+	case deliverooFulfillmentRestaurant:
+		if external.Delivery == nil {
+			return nil, ErrInvalidOrder
+		}
+		order.Type = models.OrderTypeDelivery
+		order.DeliveryAddress = external.Delivery.Address.String()
+		order.DeliveryFee = float64(external.Delivery.DeliveryFee.Fractional) / 100
+	default:
+		return nil, ErrInvalidOrder
+	}
+
+	for _, item := range external.Items {
+		productID, err := uuid.Parse(item.PosItemID)
+		if err != nil {
+			return nil, ErrUnknownProduct
+		}
+		var modifiers []string
+		for _, modifier := range item.Modifiers {
+			modifiers = append(modifiers, modifier.Name)
+		}
+		order.Items = append(order.Items, OrderItem{
+			ProductID: productID,
+			Quantity:  item.Quantity,
+			Modifiers: modifiers,
+		})
+	}
+	return order, nil
+}
+
+func (Deliveroo) PushMenu(ctx context.Context, client *http.Client, integration *models.Integration, menu *Menu) error {
+	brandID, siteID, err := deliverooStore(integration.StoreID)
+	if err != nil {
+		return err
+	}
+
+	category := DeliverooCategory{ID: "menu", Name: map[string]string{deliverooLanguage: "Menu"}, ItemIDs: make([]string, 0, len(menu.Items))}
+	items := make([]DeliverooMenuItem, 0, len(menu.Items))
+	for _, item := range menu.Items {
+		if !item.Available {
+			continue
+		}
+		menuItem := DeliverooMenuItem{
+			ID:          item.ProductID.String(),
+			PLU:         item.ProductID.String(),
+			Name:        map[string]string{deliverooLanguage: item.Title},
+			Description: map[string]string{deliverooLanguage: item.Description},
+		}
+		menuItem.PriceInfo.Price = int64(math.Round(item.UnitPrice * 100))
+		items = append(items, menuItem)
+		category.ItemIDs = append(category.ItemIDs, menuItem.ID)
+	}
+
+	payload := DeliverooMenu{
+		Name:    "Menu",
+		Menu:    DeliverooMenuContent{Categories: []DeliverooCategory{category}, Items: items},
+		SiteIDs: []string{siteID},
+	}
+	return pushJSON(ctx, client, integration, http.MethodPut, payload, "menu", "v1", "brands", brandID, "menus", siteID)
+}
+
+// PushStatus accepts confirmed orders and rejects cancelled ones, the other statuses are reported as
+// preparation stages. Statuses without a stage on Deliveroo are not pushed.
+func (Deliveroo) PushStatus(ctx context.Context, client *http.Client, integration *models.Integration, order *models.Order, status models.OrderStatus) error {
+	switch status {
+	case models.OrderStatusConfirmed:
+		return pushJSON(ctx, client, integration, http.MethodPatch, DeliverooOrderStatus{Status: "accepted"},
+			"order", "v1", "orders", order.ExternalID)
+	case models.OrderStatusCancelled:
+		return pushJSON(ctx, client, integration, http.MethodPatch, DeliverooOrderStatus{Status: "rejected"},
+			"order", "v1", "orders", order.ExternalID)
+	}
+
+	stage := deliverooPrepStage(order, status)
+	if stage == "" {
+		return nil
+	}
+	return pushJSON(ctx, client, integration, http.MethodPost, DeliverooPrepStage{Stage: stage},
+		"order", "v1", "orders", order.ExternalID, "prep_stage")
+}
+
+// ValidateStoreID checks that the store ID names both the brand and the site.
+func (Deliveroo) ValidateStoreID(storeID string) error {
+	_, _, err := deliverooStore(storeID)
+	return err
+}
+
+// deliverooStore splits the store ID of an integration in the brand and the site.
+func deliverooStore(storeID string) (brandID, siteID string, err error) {
+	brandID, siteID, ok := strings.Cut(storeID, "/")
+	if !ok || brandID == "" || siteID == "" || strings.Contains(siteID, "/") {
+		return "", "", ErrInvalidStoreID
+	}
+	return brandID, siteID, nil
+}
+
+// deliverooPrepStage returns the preparation stage of the order in the status. The order is collected
+// when it leaves the restaurant, which is when takeaway orders are completed.
+func deliverooPrepStage(order *models.Order, status models.OrderStatus) string {
+	switch {
+	case status == models.OrderStatusPrepared:
+		return "ready_for_collection"
+	case status == models.OrderStatusOutForDelivery:
+		return "collected"
+	case status == models.OrderStatusCompleted && order.Type == models.OrderTypeTakeaway:
+		return "collected"
+	}
+	return ""
+}
@@ -0,0 +1,190 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+)
+
+// PlatformGeneric is a platform, or middleware aggregating platforms, speaking the generic protocol of
+// Generic.
+const PlatformGeneric = "generic"
+
+const (
+	// HeaderWebhookTimestamp and HeaderWebhookSignature sign the webhooks of the generic protocol.
+	HeaderWebhookTimestamp = "X-Webhook-Timestamp"
+	HeaderWebhookSignature = "X-Webhook-Signature"
+	// webhookTolerance is how old webhooks can be, so that captured requests can't be replayed later.
+	webhookTolerance = 5 * time.Minute
+)
+
+// Generic is the adapter of platforms, or middleware aggregating them, speaking a generic JSON
+// protocol:
+//
+//   - Webhooks carry the Unix time they were sent at in the X-Webhook-Timestamp header and the hex
+//     HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret in the X-Webhook-Signature header.
+//   - The menu is replaced with PUT <endpoint>/stores/<store_id>/menu.
+//   - Order statuses are sent with POST <endpoint>/stores/<store_id>/orders/<order_id>/status.
+//
+// Requests to the platform are authenticated with the API key as a bearer token.
+type Generic struct{}
+
+// GenericOrder is the body of order webhooks of the generic protocol.
+type GenericOrder struct {
+	ID       string           `json:"id"`
+	Type     models.OrderType `json:"type"`
+	Customer struct {
+		Name  string `json:"name"`
+		Phone string `json:"phone"`
+	} `json:"customer"`
+	Delivery *struct {
+		Address string  `json:"address"`
+		Fee     float64 `json:"fee"`
+	} `json:"delivery,omitempty"`
+	PickupAt *time.Time `json:"pickup_at,omitempty"`
+	Items    []struct {
+		SKU       uuid.UUID `json:"sku"`
+		Quantity  uint32    `json:"quantity"`
+		Modifiers []string  `json:"modifiers,omitempty"`
+	} `json:"items"`
+}
+
+// GenericMenu is the body of menu pushes of the generic protocol.
+type GenericMenu struct {
+	Currency string            `json:"currency"`
+	Items    []GenericMenuItem `json:"items"`
+}
+
+type GenericMenuItem struct {
+	SKU         uuid.UUID `json:"sku"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Price       float64   `json:"price"`
+	Available   bool      `json:"available"`
+}
+
+// GenericStatus is the body of status pushes of the generic protocol.
+type GenericStatus struct {
+	Status models.OrderStatus `json:"status"`
+}
+
+// SignWebhook returns the signature of a webhook of the generic protocol sent at the timestamp.
+func SignWebhook(body []byte, secret string, timestamp time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (Generic) VerifyWebhook(header http.Header, body []byte, secret string, now time.Time) error {
+	seconds, err := strconv.ParseInt(header.Get(HeaderWebhookTimestamp), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	timestamp := time.Unix(seconds, 0)
+	if now.Sub(timestamp).Abs() > webhookTolerance {
+		return ErrInvalidSignature
+	}
+
+	signature, err := hex.DecodeString(header.Get(HeaderWebhookSignature))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	expected, _ := hex.DecodeString(SignWebhook(body, secret, timestamp))
+	if !hmac.Equal(signature, expected) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (Generic) ParseOrder(body []byte) (*Order, error) {
+	payload := GenericOrder{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, ErrInvalidOrder
+	}
+
+	order := &Order{
+		ExternalID:   payload.ID,
+		Type:         payload.Type,
+		ContactName:  payload.Customer.Name,
+		ContactPhone: payload.Customer.Phone,
+		PickupAt:     payload.PickupAt,
+		Items:        make([]OrderItem, 0, len(payload.Items)),
+	}
+	if payload.Delivery != nil {
+		order.DeliveryAddress = payload.Delivery.Address
+		order.DeliveryFee = payload.Delivery.Fee
+	}
+	for _, item := range payload.Items {
+		order.Items = append(order.Items, OrderItem{
+			ProductID: item.SKU,
+			Quantity:  item.Quantity,
+			Modifiers: item.Modifiers,
+		})
+	}
+	return order, nil
+}
+
+func (Generic) PushMenu(ctx context.Context, client *http.Client, integration *models.Integration, menu *Menu) error {
+	payload := GenericMenu{Currency: menu.Currency, Items: make([]GenericMenuItem, 0, len(menu.Items))}
+	for _, item := range menu.Items {
+		payload.Items = append(payload.Items, GenericMenuItem{
+			SKU:         item.ProductID,
+			Title:       item.Title,
+			Description: item.Description,
+			Price:       item.UnitPrice,
+			Available:   item.Available,
+		})
+	}
+	return pushJSON(ctx, client, integration, http.MethodPut, payload, "stores", integration.StoreID, "menu")
+}
+
+func (Generic) PushStatus(ctx context.Context, client *http.Client, integration *models.Integration, order *models.Order, status models.OrderStatus) error {
+	return pushJSON(ctx, client, integration, http.MethodPost, GenericStatus{Status: status},
+		"stores", integration.StoreID, "orders", order.ExternalID, "status")
+}
+
+// genericRequest sends the payload as JSON to the path of the platform API made of the elements.
+func pushJSON(ctx context.Context, client *http.Client, integration *models.Integration, method string, payload any, elem ...string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	endpoint, err := url.JoinPath(integration.Endpoint, elem...)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+integration.APIKey)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	// Drain the body so that the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: unexpected status %s", method, endpoint, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+// Package integrations connects restaurants to delivery platforms. Orders are received from platforms
+// through signed webhooks and mapped to orders of the restaurant, the menu and the status of orders are
+// pushed back to the platforms. Each platform has an adapter translating its payloads.
+//
+// Adapters of Deliveroo and of a generic protocol, which middleware aggregating other platforms can
+// speak, ship with the package. Other platforms are added with Register.
+package integrations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownPlatform    = errors.New("unknown platform")
+	ErrInvalidStoreID     = errors.New("invalid store ID for the platform")
+	ErrInvalidSignature   = errors.New("invalid webhook signature")
+	ErrInvalidOrder       = errors.New("invalid order payload")
+	ErrUnknownProduct     = errors.New("unknown product")
+	ErrProductUnavailable = errors.New("product is not available")
+)
+
+// Order is an order received from a platform, before it is mapped to an order of the restaurant.
+type Order struct {
+	// ExternalID identifies the order on the platform.
+	ExternalID      string
+	Type            models.OrderType
+	ContactName     string
+	ContactPhone    string
+	DeliveryAddress string
+	DeliveryFee     float64
+	PickupAt        *time.Time
+	Items           []OrderItem
+}
+
+type OrderItem struct {
+	// ProductID is the SKU the product was pushed to the platform with.
+	ProductID uuid.UUID
+	Quantity  uint32
+	Modifiers []string
+}
+
+// Menu is the menu of a restaurant as pushed to platforms.
+type Menu struct {
+	Currency string
+	Items    []MenuItem
+}
+
+type MenuItem struct {
+	ProductID   uuid.UUID
+	Title       string
+	Description string
+	UnitPrice   float64
+	Available   bool
+}
+
+// Adapter translates between a delivery platform and the restaurant.
+type Adapter interface {
+	// VerifyWebhook checks that the webhook was signed by the platform with the secret.
+	VerifyWebhook(header http.Header, body []byte, secret string, now time.Time) error
+	// ParseOrder reads the order sent in the body of a webhook.
+	ParseOrder(body []byte) (*Order, error)
+	// PushMenu replaces the menu of the store on the platform.
+	PushMenu(ctx context.Context, client *http.Client, integration *models.Integration, menu *Menu) error
+	// PushStatus notifies the platform that the order moved to the status.
+	PushStatus(ctx context.Context, client *http.Client, integration *models.Integration, order *models.Order, status models.OrderStatus) error
+}
+
+var (
+	adaptersMu sync.RWMutex
+	adapters   = map[string]Adapter{
+		PlatformGeneric:   Generic{},
+		PlatformDeliveroo: Deliveroo{},
+	}
+)
+
+// storeValidator is implemented by adapters of platforms which identify stores with more than an ID.
+type storeValidator interface {
+	ValidateStoreID(storeID string) error
+}
+
+// Register makes the adapter available for integrations with the platform. It panics if the platform
+// already has an adapter.
+func Register(platform string, adapter Adapter) {
+	adaptersMu.Lock()
+	defer adaptersMu.Unlock()
+	if _, ok := adapters[platform]; ok {
+		panic("integrations: adapter registered twice for platform " + platform)
+	}
+	adapters[platform] = adapter
+}
+
+// Lookup returns the adapter of the platform.
+func Lookup(platform string) (Adapter, error) {
+	adaptersMu.RLock()
+	defer adaptersMu.RUnlock()
+	adapter, ok := adapters[platform]
+	if !ok {
+		return nil, ErrUnknownPlatform
+	}
+	return adapter, nil
+}
+
+// ValidateStore checks that the platform has an adapter and that the adapter accepts the store ID.
+func ValidateStore(platform, storeID string) error {
+	adapter, err := Lookup(platform)
+	if err != nil {
+		return err
+	}
+	if validator, ok := adapter.(storeValidator); ok {
+		return validator.ValidateStoreID(storeID)
+	}
+	return nil
+}
+
+// Platforms returns the platforms that have an adapter, sorted by name.
+func Platforms() []string {
+	adaptersMu.RLock()
+	defer adaptersMu.RUnlock()
+	platforms := make([]string, 0, len(adapters))
+	for platform := range adapters {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+	return platforms
+}
+
+// BuildOrder maps the order received from the platform to an order of the restaurant. Items are
+// priced at the current price of the products, which is the price pushed with the menu.
+func BuildOrder(tx *gorm.DB, integration *models.Integration, restaurant *models.Restaurant, external *Order) (*models.Order, error) {
+	if external.ExternalID == "" || len(external.Items) == 0 || !external.Type.IsScheduled() {
+		return nil, ErrInvalidOrder
+	}
+	if external.Type == models.OrderTypeDelivery && external.DeliveryAddress == "" {
+		return nil, ErrInvalidOrder
+	}
+
+	productIDs := make([]uuid.UUID, 0, len(external.Items))
+	for _, item := range external.Items {
+		if item.Quantity == 0 {
+			return nil, ErrInvalidOrder
+		}
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	products := make([]models.Product, 0, len(productIDs))
+	if err := tx.
+		Where("restaurant_id = ? AND id IN ?", restaurant.ID, productIDs).
+		Find(&products).Error; err != nil {
+		return nil, err
+	}
+	productsByID := make(map[uuid.UUID]models.Product, len(products))
+	for _, product := range products {
+		productsByID[product.ID] = product
+	}
+
+	items := make([]models.OrderItem, 0, len(external.Items))
+	for _, item := range external.Items {
+		product, ok := productsByID[item.ProductID]
+		if !ok {
+			return nil, ErrUnknownProduct
+		}
+		if !product.Available {
+			return nil, ErrProductUnavailable
+		}
+		items = append(items, models.OrderItem{
+			ProductID: product.ID,
+			Quantity:  item.Quantity,
+			UnitPrice: product.UnitPrice,
+			Modifiers: item.Modifiers,
+		})
+	}
+
+	var pickupAt *time.Time
+	if external.PickupAt != nil {
+		at := external.PickupAt.UTC()
+		pickupAt = &at
+	}
+
+	integrationID := integration.ID
+	order := &models.Order{
+		RestaurantID:    restaurant.ID,
+		Type:            external.Type,
+		Source:          models.OrderSourceMarketplace,
+		IntegrationID:   &integrationID,
+		ExternalID:      external.ExternalID,
+		ContactName:     external.ContactName,
+		ContactPhone:    external.ContactPhone,
+		PickupAt:        pickupAt,
+		DeliveryAddress: external.DeliveryAddress,
+		DeliveryFee:     models.RoundAmount(external.DeliveryFee),
+		OrderItems:      items,
+	}
+	order.UpdateTotals(restaurant.TaxRate)
+	return order, nil
+}
+
+// BuildMenu returns the menu of the restaurant, sold out products included as unavailable.
+func BuildMenu(tx *gorm.DB, restaurant *models.Restaurant) (*Menu, error) {
+	products := make([]models.Product, 0)
+	if err := tx.
+		Where("restaurant_id = ?", restaurant.ID).
+		Order("title").
+		Find(&products).Error; err != nil {
+		return nil, err
+	}
+
+	menu := &Menu{Currency: restaurant.Currency, Items: make([]MenuItem, 0, len(products))}
+	for _, product := range products {
+		menu.Items = append(menu.Items, MenuItem{
+			ProductID:   product.ID,
+			Title:       product.Title,
+			Description: product.Description,
+			UnitPrice:   product.UnitPrice,
+			Available:   product.Available,
+		})
+	}
+	return menu, nil
+}
+
+// EnqueueMenu queues a push of the menu to every integration of the restaurant. Events are queued in
+// the transaction changing the menu so that they are only sent if it commits.
+func EnqueueMenu(tx *gorm.DB, restaurantID uuid.UUID) ([]models.IntegrationEvent, error) {
+	integrations := make([]models.Integration, 0)
+	if err := tx.Where("restaurant_id = ?", restaurantID).Find(&integrations).Error; err != nil {
+		return nil, err
+	}
+
+	events := make([]models.IntegrationEvent, 0, len(integrations))
+	for _, integration := range integrations {
+		event, err := EnqueueIntegrationMenu(tx, &integration)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+	return events, nil
+}
+
+// EnqueueIntegrationMenu queues a push of the menu to the integration. The menu is read when the
+// event is sent, so that it is up to date.
+func EnqueueIntegrationMenu(tx *gorm.DB, integration *models.Integration) (*models.IntegrationEvent, error) {
+	event := &models.IntegrationEvent{
+		IntegrationID: integration.ID,
+		Kind:          models.IntegrationEventKindMenu,
+		Status:        models.IntegrationEventStatusPending,
+		NextAttemptAt: tx.NowFunc(),
+	}
+	if err := tx.Create(event).Error; err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// EnqueueStatus queues a push of the new status of an order received from a platform. Nothing is
+// queued for other orders.
+func EnqueueStatus(tx *gorm.DB, order *models.Order, status models.OrderStatus) (*models.IntegrationEvent, error) {
+	if order.IntegrationID == nil {
+		return nil, nil
+	}
+
+	event := &models.IntegrationEvent{
+		IntegrationID: *order.IntegrationID,
+		OrderID:       &order.ID,
+		Kind:          models.IntegrationEventKindStatus,
+		Status:        models.IntegrationEventStatusPending,
+		OrderStatus:   status,
+		NextAttemptAt: tx.NowFunc(),
+	}
+	if err := tx.Create(event).Error; err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Receive verifies a webhook sent by the platform of the integration and creates the order it carries.
+// Platforms retry webhooks, the order created by the first delivery is returned with created unset
+// for the following ones.
+func Receive(tx *gorm.DB, integration *models.Integration, restaurant *models.Restaurant, header http.Header, body []byte, now time.Time) (order *models.Order, created bool, err error) {
+	adapter, err := Lookup(integration.Platform)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := adapter.VerifyWebhook(header, body, integration.WebhookSecret, now); err != nil {
+		return nil, false, err
+	}
+	external, err := adapter.ParseOrder(body)
+	if err != nil {
+		return nil, false, err
+	}
+
+	existing := &models.Order{}
+	err = tx.
+		Preload("OrderItems").
+		Where("integration_id = ? AND external_id = ?", integration.ID, external.ExternalID).
+		First(existing).Error
+	if err == nil {
+		return existing, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, err
+	}
+
+	order, err = BuildOrder(tx, integration, restaurant, external)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := tx.Create(order).Error; err != nil {
+		return nil, false, err
+	}
+	return order, true, nil
+}
@@ -0,0 +1,365 @@
+package integrations_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/database/databasetest"
+	"github.com/roushou/pocpoc/internal/integrations"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// marketplaceRequest is a request received by the mock marketplace.
+type marketplaceRequest struct {
+	method        string
+	path          string
+	authorization string
+	body          []byte
+}
+
+// mockMarketplace is the API of a delivery platform. It records the menus and statuses pushed to it,
+// the tests send its signed order webhooks.
+type mockMarketplace struct {
+	server   *httptest.Server
+	requests chan marketplaceRequest
+	failing  atomic.Bool
+}
+
+func newMockMarketplace(t *testing.T) *mockMarketplace {
+	marketplace := &mockMarketplace{requests: make(chan marketplaceRequest, 10)}
+	marketplace.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if marketplace.failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		marketplace.requests <- marketplaceRequest{
+			method:        r.Method,
+			path:          r.URL.Path,
+			authorization: r.Header.Get("Authorization"),
+			body:          body,
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(marketplace.server.Close)
+	return marketplace
+}
+
+// webhook returns the headers of an order webhook signed with the secret at the timestamp.
+func webhook(body []byte, secret string, timestamp time.Time) http.Header {
+	header := http.Header{}
+	header.Set(integrations.HeaderWebhookTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	header.Set(integrations.HeaderWebhookSignature, integrations.SignWebhook(body, secret, timestamp))
+	return header
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"id":"ext-1"}`)
+	now := time.Unix(1760000000, 0)
+	adapter := integrations.Generic{}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		valid  bool
+	}{
+		{name: "valid", header: webhook(body, "secret", now), valid: true},
+		{name: "clock skew", header: webhook(body, "secret", now.Add(time.Minute)), valid: true},
+		{name: "other secret", header: webhook(body, "other", now), valid: false},
+		{name: "replayed", header: webhook(body, "secret", now.Add(-10*time.Minute)), valid: false},
+		{name: "unsigned", header: http.Header{}, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := adapter.VerifyWebhook(tt.header, body, "secret", now)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, integrations.ErrInvalidSignature)
+			}
+		})
+	}
+
+	// The signature covers the body
+	assert.ErrorIs(t, adapter.VerifyWebhook(webhook(body, "secret", now), []byte(`{"id":"ext-2"}`), "secret", now), integrations.ErrInvalidSignature)
+}
+
+func TestRoundTrip(t *testing.T) {
+	db := databasetest.New(t)
+	marketplace := newMockMarketplace(t)
+
+	restaurant := &models.Restaurant{Name: "r", OwnerID: uuid.New(), Currency: "EUR", TaxRate: 10}
+	require.NoError(t, db.Create(restaurant).Error)
+	ramen := &models.Product{RestaurantID: restaurant.ID, Title: "Ramen", Description: "Shoyu", UnitPrice: 12.5, Available: true}
+	gyoza := &models.Product{RestaurantID: restaurant.ID, Title: "Gyoza", Description: "Pork", UnitPrice: 6, Available: true}
+	require.NoError(t, db.Create(ramen).Error)
+	require.NoError(t, db.Create(gyoza).Error)
+	require.NoError(t, db.Model(gyoza).Update("available", false).Error)
+
+	integration := &models.Integration{
+		RestaurantID:  restaurant.ID,
+		Platform:      integrations.PlatformGeneric,
+		StoreID:       "store-1",
+		Endpoint:      marketplace.server.URL + "/v1",
+		APIKey:        "api-key",
+		WebhookSecret: "webhook-secret",
+	}
+	require.NoError(t, db.Create(integration).Error)
+
+	worker, err := integrations.NewWorker(db, integrations.WithRetryDelay(0))
+	require.NoError(t, err)
+
+	// The menu is pushed with sold out products
+	_, err = integrations.EnqueueMenu(db, restaurant.ID)
+	require.NoError(t, err)
+	sent, err := worker.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	request := <-marketplace.requests
+	assert.Equal(t, http.MethodPut, request.method)
+	assert.Equal(t, "/v1/stores/store-1/menu", request.path)
+	assert.Equal(t, "Bearer api-key", request.authorization)
+	menu := integrations.GenericMenu{}
+	require.NoError(t, json.Unmarshal(request.body, &menu))
+	assert.Equal(t, "EUR", menu.Currency)
+	assert.Equal(t, []integrations.GenericMenuItem{
+		{SKU: gyoza.ID, Title: "Gyoza", Description: "Pork", Price: 6, Available: false},
+		{SKU: ramen.ID, Title: "Ramen", Description: "Shoyu", Price: 12.5, Available: true},
+	}, menu.Items)
+
+	// The marketplace sends an order
+	now := time.Now()
+	body := []byte(`{"id":"ext-1","type":"delivery","customer":{"name":"Ada","phone":"+33600000000"},` +
+		`"delivery":{"address":"1 rue de Rivoli","fee":3},"items":[{"sku":"` + ramen.ID.String() + `","quantity":2}]}`)
+	order, created, err := integrations.Receive(db, integration, restaurant, webhook(body, "webhook-secret", now), body, now)
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, models.OrderSourceMarketplace, order.Source)
+	assert.Equal(t, models.OrderTypeDelivery, order.Type)
+	assert.Equal(t, "ext-1", order.ExternalID)
+	assert.Equal(t, "1 rue de Rivoli", order.DeliveryAddress)
+	assert.Equal(t, 28.0, order.TotalAmount)
+
+	// Retried webhooks return the same order
+	retried, created, err := integrations.Receive(db, integration, restaurant, webhook(body, "webhook-secret", now), body, now)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, order.ID, retried.ID)
+
+	_, _, err = integrations.Receive(db, integration, restaurant, webhook(body, "other", now), body, now)
+	assert.ErrorIs(t, err, integrations.ErrInvalidSignature)
+
+	soldOut := []byte(`{"id":"ext-2","type":"takeaway","customer":{"name":"Bob","phone":"1"},"items":[{"sku":"` + gyoza.ID.String() + `","quantity":1}]}`)
+	_, _, err = integrations.Receive(db, integration, restaurant, webhook(soldOut, "webhook-secret", now), soldOut, now)
+	assert.ErrorIs(t, err, integrations.ErrProductUnavailable)
+
+	// Status changes are pushed back in order, waiting for the marketplace to be back online
+	marketplace.failing.Store(true)
+	for _, status := range []models.OrderStatus{models.OrderStatusConfirmed, models.OrderStatusPrepared} {
+		_, err = integrations.EnqueueStatus(db, order, status)
+		require.NoError(t, err)
+	}
+	sent, err = worker.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	event := &models.IntegrationEvent{}
+	require.NoError(t, db.Where("order_status = ?", models.OrderStatusConfirmed).First(event).Error)
+	assert.Equal(t, models.IntegrationEventStatusPending, event.Status)
+	assert.Equal(t, 1, event.Attempts)
+	assert.Contains(t, event.LastError, "503")
+
+	marketplace.failing.Store(false)
+	sent, err = worker.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+
+	for _, status := range []models.OrderStatus{models.OrderStatusConfirmed, models.OrderStatusPrepared} {
+		request := <-marketplace.requests
+		assert.Equal(t, http.MethodPost, request.method)
+		assert.Equal(t, "/v1/stores/store-1/orders/ext-1/status", request.path)
+		assert.JSONEq(t, `{"status":"`+string(status)+`"}`, string(request.body))
+	}
+
+	// Orders taken by staff are not pushed
+	event, err = integrations.EnqueueStatus(db, &models.Order{ID: uuid.New()}, models.OrderStatusConfirmed)
+	require.NoError(t, err)
+	assert.Nil(t, event)
+}
+
+// deliverooWebhook returns the headers of a Deliveroo webhook signed with the secret.
+func deliverooWebhook(body []byte, secret string, sequenceGUID string) http.Header {
+	header := http.Header{}
+	header.Set(integrations.HeaderDeliverooSequenceGUID, sequenceGUID)
+	header.Set(integrations.HeaderDeliverooSignature, integrations.SignDeliverooWebhook(body, secret, sequenceGUID))
+	return header
+}
+
+func TestVerifyDeliverooWebhook(t *testing.T) {
+	body := []byte(`{"event":"order.new"}`)
+	now := time.Unix(1760000000, 0)
+	adapter := integrations.Deliveroo{}
+
+	otherGUID := deliverooWebhook(body, "secret", "guid-1")
+	otherGUID.Set(integrations.HeaderDeliverooSequenceGUID, "guid-2")
+
+	tests := []struct {
+		name   string
+		header http.Header
+		valid  bool
+	}{
+		{name: "valid", header: deliverooWebhook(body, "secret", "guid-1"), valid: true},
+		{name: "other secret", header: deliverooWebhook(body, "other", "guid-1"), valid: false},
+		{name: "other sequence", header: otherGUID, valid: false},
+		{name: "generic signature", header: webhook(body, "secret", now), valid: false},
+		{name: "unsigned", header: http.Header{}, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := adapter.VerifyWebhook(tt.header, body, "secret", now)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, integrations.ErrInvalidSignature)
+			}
+		})
+	}
+
+	// The signature covers the body
+	assert.ErrorIs(t, adapter.VerifyWebhook(deliverooWebhook(body, "secret", "guid-1"), []byte(`{"event":"order.status_update"}`), "secret", now), integrations.ErrInvalidSignature)
+}
+
+func TestValidateStore(t *testing.T) {
+	assert.NoError(t, integrations.ValidateStore(integrations.PlatformGeneric, "store-1"))
+	assert.NoError(t, integrations.ValidateStore(integrations.PlatformDeliveroo, "brand-1/site-1"))
+	for _, storeID := range []string{"site-1", "/site-1", "brand-1/", "brand-1/site-1/menu"} {
+		assert.ErrorIs(t, integrations.ValidateStore(integrations.PlatformDeliveroo, storeID), integrations.ErrInvalidStoreID, storeID)
+	}
+	assert.ErrorIs(t, integrations.ValidateStore("unknown", "store-1"), integrations.ErrUnknownPlatform)
+}
+
+func TestDeliverooRoundTrip(t *testing.T) {
+	db := databasetest.New(t)
+	marketplace := newMockMarketplace(t)
+
+	restaurant := &models.Restaurant{Name: "r", OwnerID: uuid.New(), Currency: "EUR", TaxRate: 10}
+	require.NoError(t, db.Create(restaurant).Error)
+	ramen := &models.Product{RestaurantID: restaurant.ID, Title: "Ramen", Description: "Shoyu", UnitPrice: 12.5, Available: true}
+	gyoza := &models.Product{RestaurantID: restaurant.ID, Title: "Gyoza", Description: "Pork", UnitPrice: 6, Available: true}
+	require.NoError(t, db.Create(ramen).Error)
+	require.NoError(t, db.Create(gyoza).Error)
+	require.NoError(t, db.Model(gyoza).Update("available", false).Error)
+
+	integration := &models.Integration{
+		RestaurantID:  restaurant.ID,
+		Platform:      integrations.PlatformDeliveroo,
+		StoreID:       "brand-1/site-1",
+		Endpoint:      marketplace.server.URL,
+		APIKey:        "api-key",
+		WebhookSecret: "webhook-secret",
+	}
+	require.NoError(t, db.Create(integration).Error)
+
+	worker, err := integrations.NewWorker(db, integrations.WithRetryDelay(0))
+	require.NoError(t, err)
+
+	// The menu of the site is pushed without sold out products, in cents
+	_, err = integrations.EnqueueMenu(db, restaurant.ID)
+	require.NoError(t, err)
+	sent, err := worker.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	request := <-marketplace.requests
+	assert.Equal(t, http.MethodPut, request.method)
+	assert.Equal(t, "/menu/v1/brands/brand-1/menus/site-1", request.path)
+	assert.Equal(t, "Bearer api-key", request.authorization)
+	menu := integrations.DeliverooMenu{}
+	require.NoError(t, json.Unmarshal(request.body, &menu))
+	assert.Equal(t, []string{"site-1"}, menu.SiteIDs)
+	require.Len(t, menu.Menu.Items, 1)
+	item := menu.Menu.Items[0]
+	assert.Equal(t, ramen.ID.String(), item.PLU)
+	assert.Equal(t, map[string]string{"en": "Ramen"}, item.Name)
+	assert.Equal(t, int64(1250), item.PriceInfo.Price)
+	require.Len(t, menu.Menu.Categories, 1)
+	assert.Equal(t, []string{item.ID}, menu.Menu.Categories[0].ItemIDs)
+
+	// Deliveroo sends an order delivered by the restaurant
+	now := time.Now()
+	body := []byte(`{"event":"order.new","body":{"order":{"id":"gb-1","fulfillment_type":"restaurant",` +
+		`"customer":{"first_name":"Ada","contact_number":"+33600000000"},` +
+		`"delivery":{"delivery_fee":{"fractional":300,"currency_code":"EUR"},"address":{"number":"1","street":"rue de Rivoli","postal_code":"75001","city":"Paris"}},` +
+		`"items":[{"pos_item_id":"` + ramen.ID.String() + `","name":"Ramen","quantity":2,"modifiers":[{"pos_item_id":"egg","name":"Extra egg","quantity":1}]}]}}}`)
+	order, created, err := integrations.Receive(db, integration, restaurant, deliverooWebhook(body, "webhook-secret", "guid-1"), body, now)
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, models.OrderSourceMarketplace, order.Source)
+	assert.Equal(t, models.OrderTypeDelivery, order.Type)
+	assert.Equal(t, "gb-1", order.ExternalID)
+	assert.Equal(t, "Ada", order.ContactName)
+	assert.Equal(t, "1 rue de Rivoli, 75001 Paris", order.DeliveryAddress)
+	assert.Equal(t, 3.0, order.DeliveryFee)
+	assert.Equal(t, 28.0, order.TotalAmount)
+	require.Len(t, order.OrderItems, 1)
+	assert.Equal(t, []string{"Extra egg"}, []string(order.OrderItems[0].Modifiers))
+
+	// Replayed webhooks return the same order
+	replayed, created, err := integrations.Receive(db, integration, restaurant, deliverooWebhook(body, "webhook-secret", "guid-2"), body, now)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, order.ID, replayed.ID)
+
+	_, _, err = integrations.Receive(db, integration, restaurant, webhook(body, "webhook-secret", now), body, now)
+	assert.ErrorIs(t, err, integrations.ErrInvalidSignature)
+
+	// Orders collected by a rider are takeaway orders
+	collected := []byte(`{"event":"order.new","body":{"order":{"id":"gb-2","fulfillment_type":"deliveroo",` +
+		`"customer":{"first_name":"Bob","contact_number":"1"},"items":[{"pos_item_id":"` + ramen.ID.String() + `","name":"Ramen","quantity":1}]}}}`)
+	rider, _, err := integrations.Receive(db, integration, restaurant, deliverooWebhook(collected, "webhook-secret", "guid-3"), collected, now)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderTypeTakeaway, rider.Type)
+	assert.Empty(t, rider.DeliveryAddress)
+
+	updated := []byte(`{"event":"order.status_update","body":{"order":{"id":"gb-1"}}}`)
+	_, _, err = integrations.Receive(db, integration, restaurant, deliverooWebhook(updated, "webhook-secret", "guid-4"), updated, now)
+	assert.ErrorIs(t, err, integrations.ErrInvalidOrder)
+
+	// Statuses are pushed as acceptances and preparation stages, the delivery leaves with the courier
+	for _, status := range []models.OrderStatus{models.OrderStatusConfirmed, models.OrderStatusPrepared, models.OrderStatusOutForDelivery, models.OrderStatusCompleted} {
+		_, err = integrations.EnqueueStatus(db, order, status)
+		require.NoError(t, err)
+	}
+	_, err = integrations.EnqueueStatus(db, rider, models.OrderStatusCancelled)
+	require.NoError(t, err)
+	sent, err = worker.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 5, sent)
+
+	for _, expected := range []marketplaceRequest{
+		{method: http.MethodPatch, path: "/order/v1/orders/gb-1", body: []byte(`{"status":"accepted"}`)},
+		{method: http.MethodPost, path: "/order/v1/orders/gb-1/prep_stage", body: []byte(`{"stage":"ready_for_collection"}`)},
+		{method: http.MethodPost, path: "/order/v1/orders/gb-1/prep_stage", body: []byte(`{"stage":"collected"}`)},
+		{method: http.MethodPatch, path: "/order/v1/orders/gb-2", body: []byte(`{"status":"rejected"}`)},
+	} {
+		request := <-marketplace.requests
+		assert.Equal(t, expected.method, request.method)
+		assert.Equal(t, expected.path, request.path)
+		assert.JSONEq(t, string(expected.body), string(request.body))
+	}
+	// Completing a delivered order has no stage on Deliveroo
+	assert.Len(t, marketplace.requests, 0)
+}
@@ -0,0 +1,260 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPollInterval  = 2 * time.Second
+	defaultMaxAttempts   = 10
+	defaultRetryDelay    = 5 * time.Second
+	defaultMaxRetryDelay = 5 * time.Minute
+	defaultTimeout       = 10 * time.Second
+	defaultBatchSize     = 50
+)
+
+// Option defines the function signature for worker options.
+type Option func(options *options) error
+
+type options struct {
+	pollInterval time.Duration
+	maxAttempts  int
+	retryDelay   time.Duration
+	timeout      time.Duration
+}
+
+// WithPollInterval sets how often the worker looks for events to send.
+func WithPollInterval(interval time.Duration) Option {
+	return func(options *options) error {
+		if interval <= 0 {
+			return errors.New("poll interval should be positive")
+		}
+		options.pollInterval = interval
+		return nil
+	}
+}
+
+// WithMaxAttempts sets the number of attempts after which an event is marked as failed.
+func WithMaxAttempts(attempts int) Option {
+	return func(options *options) error {
+		if attempts < 1 {
+			return errors.New("max attempts should be at least 1")
+		}
+		options.maxAttempts = attempts
+		return nil
+	}
+}
+
+// WithRetryDelay sets the delay before the first retry of an event. The delay doubles on each retry.
+func WithRetryDelay(delay time.Duration) Option {
+	return func(options *options) error {
+		if delay < 0 {
+			return errors.New("retry delay should not be negative")
+		}
+		options.retryDelay = delay
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout of requests to platforms.
+func WithTimeout(timeout time.Duration) Option {
+	return func(options *options) error {
+		if timeout <= 0 {
+			return errors.New("timeout should be positive")
+		}
+		options.timeout = timeout
+		return nil
+	}
+}
+
+// Worker pushes queued events to the platforms of their integration.
+type Worker struct {
+	db           *gorm.DB
+	client       *http.Client
+	pollInterval time.Duration
+	maxAttempts  int
+	retryDelay   time.Duration
+}
+
+// NewWorker initializes a worker sending the events queued in the database.
+func NewWorker(db *gorm.DB, opts ...Option) (*Worker, error) {
+	options := &options{
+		pollInterval: defaultPollInterval,
+		maxAttempts:  defaultMaxAttempts,
+		retryDelay:   defaultRetryDelay,
+		timeout:      defaultTimeout,
+	}
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			return nil, err
+		}
+	}
+	return &Worker{
+		db:           db,
+		client:       &http.Client{Timeout: options.timeout},
+		pollInterval: options.pollInterval,
+		maxAttempts:  options.maxAttempts,
+		retryDelay:   options.retryDelay,
+	}, nil
+}
+
+// Run sends due events until the context is cancelled. Events left sending by a previous run, which
+// stopped while sending them, are sent again.
+func (w *Worker) Run(ctx context.Context) error {
+	if err := w.db.WithContext(ctx).
+		Model(&models.IntegrationEvent{}).
+		Where("status = ?", models.IntegrationEventStatusSending).
+		Update("status", models.IntegrationEventStatusPending).Error; err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.ProcessDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("failed to process integration events: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue sends the events due for an attempt, oldest first, and returns how many were sent. Events
+// of an integration are sent in the order they were queued so that platforms see order statuses in
+// order: once an event fails or waits for its next attempt, the following ones wait too.
+func (w *Worker) ProcessDue(ctx context.Context) (int, error) {
+	db := w.db.WithContext(ctx)
+	now := db.NowFunc()
+
+	events := make([]models.IntegrationEvent, 0)
+	if err := db.
+		Preload("Integration").
+		Where("status = ?", models.IntegrationEventStatusPending).
+		Order("id").
+		Limit(defaultBatchSize).
+		Find(&events).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	blockedIntegrations := make(map[uuid.UUID]bool)
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		if blockedIntegrations[event.IntegrationID] {
+			continue
+		}
+		if event.NextAttemptAt.After(now) {
+			blockedIntegrations[event.IntegrationID] = true
+			continue
+		}
+
+		// Claim the event, another worker may have taken it
+		claim := db.
+			Model(&models.IntegrationEvent{}).
+			Where("id = ? AND status = ?", event.ID, models.IntegrationEventStatusPending).
+			Update("status", models.IntegrationEventStatusSending)
+		if claim.Error != nil {
+			return sent, claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		err := w.send(ctx, &event)
+		if err := w.complete(db, &event, err); err != nil {
+			return sent, err
+		}
+		if err != nil {
+			blockedIntegrations[event.IntegrationID] = true
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// send pushes the event to the platform of its integration.
+func (w *Worker) send(ctx context.Context, event *models.IntegrationEvent) error {
+	// Deleted integrations are not preloaded
+	if event.Integration.ID == uuid.Nil {
+		return errors.New("integration was removed")
+	}
+	adapter, err := Lookup(event.Integration.Platform)
+	if err != nil {
+		return err
+	}
+
+	db := w.db.WithContext(ctx)
+
+	switch event.Kind {
+	case models.IntegrationEventKindMenu:
+		restaurant := &models.Restaurant{}
+		if err := db.First(restaurant, "id = ?", event.Integration.RestaurantID).Error; err != nil {
+			return err
+		}
+		menu, err := BuildMenu(db, restaurant)
+		if err != nil {
+			return err
+		}
+		return adapter.PushMenu(ctx, w.client, &event.Integration, menu)
+	case models.IntegrationEventKindStatus:
+		if event.OrderID == nil {
+			return errors.New("status event without order")
+		}
+		order := &models.Order{}
+		if err := db.First(order, "id = ?", *event.OrderID).Error; err != nil {
+			return err
+		}
+		return adapter.PushStatus(ctx, w.client, &event.Integration, order, event.OrderStatus)
+	}
+	return errors.New("unknown event kind")
+}
+
+// complete records the outcome of an attempt to send the event.
+func (w *Worker) complete(db *gorm.DB, event *models.IntegrationEvent, sendErr error) error {
+	now := db.NowFunc()
+	event.Attempts++
+	updates := map[string]any{"attempts": event.Attempts}
+
+	switch {
+	case sendErr == nil:
+		event.Status = models.IntegrationEventStatusSent
+		event.SentAt = &now
+		event.LastError = ""
+		updates["sent_at"] = now
+	case event.Attempts >= w.maxAttempts:
+		event.Status = models.IntegrationEventStatusFailed
+		event.LastError = sendErr.Error()
+	default:
+		event.Status = models.IntegrationEventStatusPending
+		event.LastError = sendErr.Error()
+		event.NextAttemptAt = now.Add(w.backoff(event.Attempts))
+		updates["next_attempt_at"] = event.NextAttemptAt
+	}
+	updates["status"] = event.Status
+	updates["last_error"] = event.LastError
+
+	return db.Model(&models.IntegrationEvent{}).Where("id = ?", event.ID).Updates(updates).Error
+}
+
+// backoff returns the delay before the next attempt, doubling with each attempt.
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.retryDelay
+	for i := 1; i < attempts && delay < defaultMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, defaultMaxRetryDelay)
+}
@@ -0,0 +1,276 @@
+// Package journal keeps the sales journal of restaurants: invoices get sequential gap-free numbers
+// and every entry is chained to the previous one by its hash, which makes any change detectable.
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// genesisHash is the previous hash of the first entry of a journal.
+var genesisHash = strings.Repeat("0", 64)
+
+var (
+	ErrNotInvoiced     = errors.New("order is not invoiced")
+	ErrAlreadyInvoiced = errors.New("order is already invoiced")
+	ErrCreditExceeded  = errors.New("credit exceeds the invoiced amount")
+)
+
+// lockHead returns the head of the journal of the restaurant, locked until the end of the
+// transaction so that entries are appended one at a time. It must come before anything else is read
+// in the transaction: SQLite only lets a transaction which has read go on writing if no other one
+// wrote in between.
+func lockHead(tx *gorm.DB, restaurantID uuid.UUID) (*models.JournalHead, error) {
+	head := &models.JournalHead{RestaurantID: restaurantID, Hash: genesisHash}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(head).Error; err != nil {
+		return nil, err
+	}
+	return head, tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(head, "restaurant_id = ?", restaurantID).Error
+}
+
+// appendEntry chains the entry to the journal of its restaurant, whose head is locked. It must run in
+// the transaction that records what the entry is about, so that numbers are only used by committed
+// documents.
+func appendEntry(tx *gorm.DB, head *models.JournalHead, entry *models.JournalEntry) error {
+	entry.Sequence = head.Sequence + 1
+	entry.PreviousHash = head.Hash
+
+	var number int64
+	if err := tx.
+		Model(&models.JournalEntry{}).
+		Where("restaurant_id = ? AND kind = ?", entry.RestaurantID, entry.Kind).
+		Select("COALESCE(MAX(number), 0)").
+		Scan(&number).Error; err != nil {
+		return err
+	}
+	entry.Number = number + 1
+
+	if entry.ID == uuid.Nil {
+		id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		entry.ID = id
+	}
+	// Stored timestamps keep microseconds at most on some databases
+	entry.CreatedAt = tx.NowFunc().Truncate(time.Microsecond)
+
+	var err error
+	entry.Hash, err = entry.ComputeHash()
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		return err
+	}
+	return tx.Model(head).Updates(map[string]any{"sequence": entry.Sequence, "hash": entry.Hash}).Error
+}
+
+// AppendInvoice records the invoice of a paid order and sets its invoice number. The order must be
+// loaded with its items and their product.
+func AppendInvoice(tx *gorm.DB, order *models.Order, restaurant *models.Restaurant) (*models.JournalEntry, error) {
+	if order.InvoiceNumber != "" {
+		return nil, ErrAlreadyInvoiced
+	}
+	head, err := lockHead(tx, order.RestaurantID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]models.JournalLine, 0, len(order.OrderItems))
+	for _, item := range order.OrderItems {
+		lines = append(lines, models.JournalLine{
+			ProductID: item.ProductID,
+			Title:     item.Product.Title,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+		})
+	}
+
+	entry := &models.JournalEntry{
+		RestaurantID: order.RestaurantID,
+		Kind:         models.JournalEntryInvoice,
+		OrderID:      order.ID,
+		Amount:       order.TotalAmount,
+		TaxAmount:    order.TaxAmount,
+		Currency:     restaurant.Currency,
+		Lines:        lines,
+	}
+	if err := appendEntry(tx, head, entry); err != nil {
+		return nil, err
+	}
+
+	order.InvoiceNumber = entry.DocumentNumber()
+	if err := tx.Model(order).Omit(clause.Associations).Update("invoice_number", order.InvoiceNumber).Error; err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// AppendCreditNote records a refund of an invoiced order. The tax refunded is proportional to the
+// amount. Credit notes of an invoice can't exceed its amount.
+func AppendCreditNote(tx *gorm.DB, order *models.Order, amount float64, reason string) (*models.JournalEntry, error) {
+	head, err := lockHead(tx, order.RestaurantID)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice := &models.JournalEntry{}
+	if err := tx.
+		Where("order_id = ? AND kind = ?", order.ID, models.JournalEntryInvoice).
+		First(invoice).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotInvoiced
+		}
+		return nil, err
+	}
+
+	var credited float64
+	if err := tx.
+		Model(&models.JournalEntry{}).
+		Where("credited_entry_id = ?", invoice.ID).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&credited).Error; err != nil {
+		return nil, err
+	}
+	amount = models.RoundAmount(amount)
+	if models.RoundAmount(credited+amount) > invoice.Amount {
+		return nil, ErrCreditExceeded
+	}
+
+	tax := 0.0
+	if invoice.Amount > 0 {
+		tax = models.RoundAmount(invoice.TaxAmount * amount / invoice.Amount)
+	}
+	entry := &models.JournalEntry{
+		RestaurantID:    invoice.RestaurantID,
+		Kind:            models.JournalEntryCreditNote,
+		OrderID:         order.ID,
+		CreditedEntryID: &invoice.ID,
+		Amount:          amount,
+		TaxAmount:       tax,
+		Currency:        invoice.Currency,
+		Lines:           make([]models.JournalLine, 0),
+		Reason:          reason,
+	}
+	if err := appendEntry(tx, head, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Problem is an inconsistency found in a journal.
+type Problem struct {
+	Sequence int64  `json:"sequence"`
+	Reason   string `json:"reason"`
+}
+
+// Verification is the outcome of the verification of a journal.
+type Verification struct {
+	RestaurantID uuid.UUID `json:"restaurant_id"`
+	Entries      int64     `json:"entries"`
+	Valid        bool      `json:"valid"`
+	Problems     []Problem `json:"problems"`
+}
+
+// verifyBatchSize is the number of entries loaded at once when verifying a journal.
+const verifyBatchSize = 500
+
+// Verify walks the journal of the restaurant and reports entries that were changed, removed or
+// inserted, and gaps in document numbers. The last entries are checked against the journal head and
+// the invoiced orders, so that removing them is detected too.
+func Verify(db *gorm.DB, restaurantID uuid.UUID) (*Verification, error) {
+	verification := &Verification{RestaurantID: restaurantID, Problems: make([]Problem, 0)}
+	report := func(sequence int64, format string, args ...any) {
+		verification.Problems = append(verification.Problems, Problem{Sequence: sequence, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	previousSequence := int64(0)
+	previousHash := genesisHash
+	numbers := map[models.JournalEntryKind]int64{}
+
+	// Entries are paged by sequence rather than by ID, which a tampered entry could break
+	lastSequence := int64(-1)
+	for {
+		entries := make([]models.JournalEntry, 0, verifyBatchSize)
+		if err := db.
+			Where("restaurant_id = ? AND sequence > ?", restaurantID, lastSequence).
+			Order("sequence").
+			Limit(verifyBatchSize).
+			Find(&entries).Error; err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			verification.Entries++
+
+			if entry.Sequence != previousSequence+1 {
+				report(entry.Sequence, "expected sequence %d", previousSequence+1)
+			}
+			if entry.PreviousHash != previousHash {
+				report(entry.Sequence, "previous hash does not match the previous entry")
+			}
+			hash, err := entry.ComputeHash()
+			if err != nil {
+				return nil, err
+			}
+			if hash != entry.Hash {
+				report(entry.Sequence, "content does not match its hash")
+			}
+			if entry.Number != numbers[entry.Kind]+1 {
+				report(entry.Sequence, "expected %s number %d", entry.Kind, numbers[entry.Kind]+1)
+			}
+
+			previousSequence = entry.Sequence
+			previousHash = entry.Hash
+			numbers[entry.Kind] = entry.Number
+			lastSequence = entry.Sequence
+		}
+		if len(entries) < verifyBatchSize {
+			break
+		}
+	}
+
+	head := &models.JournalHead{}
+	err := db.First(head, "restaurant_id = ?", restaurantID).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if previousSequence > 0 {
+			report(previousSequence, "journal head is missing")
+		}
+	case err != nil:
+		return nil, err
+	case head.Sequence > previousSequence:
+		report(head.Sequence, "entries after sequence %d are missing", previousSequence)
+	case head.Sequence != previousSequence || head.Hash != previousHash:
+		report(previousSequence, "last entry does not match the journal head")
+	}
+
+	// Invoiced orders whose invoice is not in the journal
+	orders := make([]models.Order, 0)
+	if err := db.
+		Unscoped().
+		Select("invoice_number").
+		Where("restaurant_id = ? AND invoice_number <> ''", restaurantID).
+		Where("NOT EXISTS (?)", db.
+			Model(&models.JournalEntry{}).
+			Select("1").
+			Where("journal_entries.order_id = orders.id AND journal_entries.kind = ?", models.JournalEntryInvoice)).
+		Order("invoice_number").
+		Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	for _, order := range orders {
+		report(0, "invoice %s is missing", order.InvoiceNumber)
+	}
+
+	verification.Valid = len(verification.Problems) == 0
+	return verification, nil
+}
@@ -0,0 +1,169 @@
+package journal_test
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/database"
+	"github.com/roushou/pocpoc/internal/database/databasetest"
+	"github.com/roushou/pocpoc/internal/journal"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// invoice records a paid order of the amount in the journal of the restaurant.
+func invoice(t *testing.T, db *gorm.DB, restaurant *models.Restaurant, amount float64) *models.Order {
+	order := &models.Order{
+		RestaurantID: restaurant.ID,
+		TableNumber:  "1",
+		Status:       models.OrderStatusCompleted,
+		TotalAmount:  amount,
+		TaxAmount:    models.RoundAmount(amount / 11),
+	}
+	require.NoError(t, db.Create(order).Error)
+	_, err := journal.AppendInvoice(db, order, restaurant)
+	require.NoError(t, err)
+	return order
+}
+
+func TestJournal(t *testing.T) {
+	db := databasetest.New(t)
+	restaurant := &models.Restaurant{ID: uuid.New(), Currency: "EUR"}
+
+	first := invoice(t, db, restaurant, 22)
+	second := invoice(t, db, restaurant, 11)
+	assert.Equal(t, "INV-000001", first.InvoiceNumber)
+	assert.Equal(t, "INV-000002", second.InvoiceNumber)
+
+	_, err := journal.AppendInvoice(db, first, restaurant)
+	assert.ErrorIs(t, err, journal.ErrAlreadyInvoiced)
+
+	note, err := journal.AppendCreditNote(db, first, 11, "Cold dish")
+	require.NoError(t, err)
+	assert.Equal(t, "CN-000001", note.DocumentNumber())
+	assert.Equal(t, 1.0, note.TaxAmount)
+	assert.Equal(t, int64(3), note.Sequence)
+
+	_, err = journal.AppendCreditNote(db, first, 11.01, "Too much")
+	assert.ErrorIs(t, err, journal.ErrCreditExceeded)
+	_, err = journal.AppendCreditNote(db, &models.Order{ID: uuid.New()}, 1, "Unknown")
+	assert.ErrorIs(t, err, journal.ErrNotInvoiced)
+
+	// Entries can't be changed through models
+	assert.ErrorIs(t, db.Model(note).Update("amount", 1).Error, models.ErrImmutable)
+
+	verification, err := journal.Verify(db, restaurant.ID)
+	require.NoError(t, err)
+	assert.True(t, verification.Valid)
+	assert.Equal(t, int64(3), verification.Entries)
+	assert.Empty(t, verification.Problems)
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name     string
+		tamper   string
+		problems []journal.Problem
+	}{
+		{
+			name:   "modified amount",
+			tamper: "UPDATE journal_entries SET amount = 1 WHERE sequence = 2",
+			problems: []journal.Problem{
+				{Sequence: 2, Reason: "content does not match its hash"},
+			},
+		},
+		{
+			name:   "deleted entry",
+			tamper: "DELETE FROM journal_entries WHERE sequence = 2",
+			problems: []journal.Problem{
+				{Sequence: 3, Reason: "expected sequence 2"},
+				{Sequence: 3, Reason: "previous hash does not match the previous entry"},
+				{Sequence: 3, Reason: "expected invoice number 2"},
+				{Sequence: 0, Reason: "invoice INV-000002 is missing"},
+			},
+		},
+		{
+			name:   "deleted last entries",
+			tamper: "DELETE FROM journal_entries WHERE sequence > 1",
+			problems: []journal.Problem{
+				{Sequence: 3, Reason: "entries after sequence 1 are missing"},
+				{Sequence: 0, Reason: "invoice INV-000002 is missing"},
+				{Sequence: 0, Reason: "invoice INV-000003 is missing"},
+			},
+		},
+		{
+			name:   "deleted last entry and head",
+			tamper: "DELETE FROM journal_entries WHERE sequence = 3; DELETE FROM journal_heads",
+			problems: []journal.Problem{
+				{Sequence: 2, Reason: "journal head is missing"},
+				{Sequence: 0, Reason: "invoice INV-000003 is missing"},
+			},
+		},
+		{
+			name:   "rehashed entry",
+			tamper: "UPDATE journal_entries SET hash = 'ff' WHERE sequence = 1",
+			problems: []journal.Problem{
+				{Sequence: 1, Reason: "content does not match its hash"},
+				{Sequence: 2, Reason: "previous hash does not match the previous entry"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := databasetest.New(t)
+			restaurant := &models.Restaurant{ID: uuid.New(), Currency: "EUR"}
+			for _, amount := range []float64{10, 20, 30} {
+				invoice(t, db, restaurant, amount)
+			}
+
+			require.NoError(t, db.Exec(tt.tamper).Error)
+
+			verification, err := journal.Verify(db, restaurant.ID)
+			require.NoError(t, err)
+			assert.False(t, verification.Valid)
+			assert.Equal(t, tt.problems, verification.Problems)
+		})
+	}
+}
+
+func TestAppendConcurrently(t *testing.T) {
+	// Connections to a file see each other's writes, unlike those to a private in-memory database
+	file, err := database.NewDatabase(filepath.Join(t.TempDir(), "journal.db"))
+	require.NoError(t, err)
+	require.NoError(t, file.AutoMigrate())
+	db := file.Connection
+
+	restaurant := &models.Restaurant{ID: uuid.New(), Currency: "EUR"}
+	orders := make([]*models.Order, 0)
+	for range 10 {
+		orders = append(orders, invoice(t, db, restaurant, 10))
+	}
+
+	errs := make(chan error, len(orders))
+	var wg sync.WaitGroup
+	for _, order := range orders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- db.Transaction(func(tx *gorm.DB) error {
+				_, err := journal.AppendCreditNote(tx, order, 5, "Cold dish")
+				return err
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	verification, err := journal.Verify(db, restaurant.ID)
+	require.NoError(t, err)
+	assert.Empty(t, verification.Problems)
+	assert.Equal(t, int64(20), verification.Entries)
+}
@@ -0,0 +1,123 @@
+// Package loyalty accrues and redeems the loyalty points of customers. Every change of points is
+// recorded as a transaction and applied to the balance of the customer in the same database transaction.
+package loyalty
+
+import (
+	"errors"
+
+	"github.com/roushou/pocpoc/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNoCustomer         = errors.New("order has no customer")
+	ErrRedemptionDisabled = errors.New("points can't be redeemed in this restaurant")
+	ErrBelowMinimum       = errors.New("points are below the minimum redemption")
+	ErrInsufficientPoints = errors.New("customer doesn't have enough points")
+	ErrRedemptionExceeded = errors.New("redeemed points exceed the order total")
+	ErrAlreadyRedeemed    = errors.New("points were already redeemed on this order")
+)
+
+// record adds the transaction and applies its points to the balance of the customer. Balances never
+// go below zero.
+func record(tx *gorm.DB, transaction *models.LoyaltyTransaction) error {
+	result := tx.
+		Model(&models.Customer{}).
+		Where("id = ? AND loyalty_points + ? >= 0", transaction.CustomerID, transaction.Points).
+		Update("loyalty_points", gorm.Expr("loyalty_points + ?", transaction.Points))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientPoints
+	}
+	return tx.Create(transaction).Error
+}
+
+// Earn credits the customer of a paid order with the points earned by its total. It does nothing when
+// the order has no customer or the restaurant has no loyalty program.
+func Earn(tx *gorm.DB, order *models.Order, restaurant *models.Restaurant) (*models.LoyaltyTransaction, error) {
+	if order.CustomerID == nil || !restaurant.Loyalty.IsEnabled() {
+		return nil, nil
+	}
+	points := restaurant.Loyalty.PointsEarned(order.TotalAmount)
+	if points == 0 {
+		return nil, nil
+	}
+
+	transaction := &models.LoyaltyTransaction{
+		CustomerID:   *order.CustomerID,
+		RestaurantID: order.RestaurantID,
+		OrderID:      order.ID,
+		Kind:         models.LoyaltyTransactionEarn,
+		Points:       points,
+	}
+	if err := record(tx, transaction); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// Redeem turns points of the customer of the order into a discount on the order. Points can be
+// redeemed once per order, and the discount can't exceed the order total.
+func Redeem(tx *gorm.DB, order *models.Order, restaurant *models.Restaurant, points int64) (*models.LoyaltyTransaction, error) {
+	if order.CustomerID == nil {
+		return nil, ErrNoCustomer
+	}
+	if restaurant.Loyalty.PointValue <= 0 {
+		return nil, ErrRedemptionDisabled
+	}
+	if order.RedeemedPoints > 0 {
+		return nil, ErrAlreadyRedeemed
+	}
+	if points < restaurant.Loyalty.MinRedemption {
+		return nil, ErrBelowMinimum
+	}
+	discount := restaurant.Loyalty.Discount(points)
+	if discount > order.TotalAmount {
+		return nil, ErrRedemptionExceeded
+	}
+
+	transaction := &models.LoyaltyTransaction{
+		CustomerID:   *order.CustomerID,
+		RestaurantID: order.RestaurantID,
+		OrderID:      order.ID,
+		Kind:         models.LoyaltyTransactionRedeem,
+		Points:       -points,
+	}
+	if err := record(tx, transaction); err != nil {
+		return nil, err
+	}
+
+	order.RedeemedPoints = points
+	order.DiscountAmount = models.RoundAmount(order.DiscountAmount + discount)
+	order.UpdateTotals(restaurant.TaxRate)
+	if err := tx.
+		Model(order).
+		Omit(clause.Associations).
+		Select("redeemed_points", "discount_amount", "total_amount", "tax_amount").
+		Updates(order).Error; err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// Restore gives back the points redeemed on a cancelled order.
+func Restore(tx *gorm.DB, order *models.Order) (*models.LoyaltyTransaction, error) {
+	if order.CustomerID == nil || order.RedeemedPoints == 0 {
+		return nil, nil
+	}
+
+	transaction := &models.LoyaltyTransaction{
+		CustomerID:   *order.CustomerID,
+		RestaurantID: order.RestaurantID,
+		OrderID:      order.ID,
+		Kind:         models.LoyaltyTransactionRestore,
+		Points:       order.RedeemedPoints,
+	}
+	if err := record(tx, transaction); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
@@ -0,0 +1,94 @@
+package loyalty_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/database/databasetest"
+	"github.com/roushou/pocpoc/internal/loyalty"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func balance(t *testing.T, db *gorm.DB, customer *models.Customer) int64 {
+	reloaded := &models.Customer{}
+	require.NoError(t, db.First(reloaded, "id = ?", customer.ID).Error)
+	return reloaded.LoyaltyPoints
+}
+
+func TestPointsEarned(t *testing.T) {
+	tests := []struct {
+		rules  models.LoyaltyRules
+		amount float64
+		points int64
+	}{
+		{rules: models.LoyaltyRules{PointsPerUnit: 1}, amount: 23.99, points: 23},
+		{rules: models.LoyaltyRules{PointsPerUnit: 0.1}, amount: 30, points: 3},
+		{rules: models.LoyaltyRules{PointsPerUnit: 2}, amount: 0.49, points: 0},
+		{rules: models.LoyaltyRules{PointsPerUnit: 1}, amount: -5, points: 0},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.points, tt.rules.PointsEarned(tt.amount))
+	}
+}
+
+func TestLoyalty(t *testing.T) {
+	db := databasetest.New(t)
+	restaurant := &models.Restaurant{
+		ID:      uuid.New(),
+		TaxRate: 10,
+		Loyalty: models.LoyaltyRules{PointsPerUnit: 1, PointValue: 0.1, MinRedemption: 50},
+	}
+	customer := &models.Customer{OwnerID: uuid.New(), Name: "Ada"}
+	require.NoError(t, db.Create(customer).Error)
+
+	paid := &models.Order{RestaurantID: restaurant.ID, CustomerID: &customer.ID, TotalAmount: 120.5}
+	require.NoError(t, db.Create(paid).Error)
+	earned, err := loyalty.Earn(db, paid, restaurant)
+	require.NoError(t, err)
+	assert.Equal(t, int64(120), earned.Points)
+	assert.Equal(t, int64(120), balance(t, db, customer))
+
+	// Orders without customer earn nothing
+	earned, err = loyalty.Earn(db, &models.Order{TotalAmount: 10}, restaurant)
+	require.NoError(t, err)
+	assert.Nil(t, earned)
+
+	order := &models.Order{
+		RestaurantID: restaurant.ID,
+		CustomerID:   &customer.ID,
+		OrderItems:   []models.OrderItem{{Quantity: 2, UnitPrice: 11}},
+	}
+	order.UpdateTotals(restaurant.TaxRate)
+	require.NoError(t, db.Create(order).Error)
+
+	_, err = loyalty.Redeem(db, order, restaurant, 20)
+	assert.ErrorIs(t, err, loyalty.ErrBelowMinimum)
+	_, err = loyalty.Redeem(db, order, restaurant, 230)
+	assert.ErrorIs(t, err, loyalty.ErrRedemptionExceeded)
+
+	redeemed, err := loyalty.Redeem(db, order, restaurant, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-100), redeemed.Points)
+	assert.Equal(t, int64(20), balance(t, db, customer))
+	assert.Equal(t, 10.0, order.DiscountAmount)
+	assert.Equal(t, 12.0, order.TotalAmount)
+	assert.Equal(t, 1.09, order.TaxAmount)
+
+	_, err = loyalty.Redeem(db, order, restaurant, 50)
+	assert.ErrorIs(t, err, loyalty.ErrAlreadyRedeemed)
+
+	other := &models.Order{RestaurantID: restaurant.ID, CustomerID: &customer.ID, TotalAmount: 50}
+	require.NoError(t, db.Create(other).Error)
+	_, err = loyalty.Redeem(db, other, restaurant, 50)
+	assert.ErrorIs(t, err, loyalty.ErrInsufficientPoints)
+	assert.Equal(t, int64(20), balance(t, db, customer))
+
+	restored, err := loyalty.Restore(db, order)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), restored.Points)
+	assert.Equal(t, int64(120), balance(t, db, customer))
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrImmutable is returned when trying to change or delete a record that can't be modified.
+var ErrImmutable = errors.New("record is immutable")
+
+// CashSession is the time a cash drawer is in use, from the opening float being counted in to the
+// drawer being counted at close. Sessions belong to a terminal, or to the staff member who opened them
+// when not opened on a terminal.
+type CashSession struct {
+	gorm.Model
+	ID           uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	RestaurantID uuid.UUID  `gorm:"type:uuid;not null;index"`
+	TerminalID   *uuid.UUID `gorm:"type:uuid;index"`
+	OpenedByID   uuid.UUID  `gorm:"type:uuid;not null;index"`
+	OpenedAt     time.Time  `gorm:"not null"`
+	OpeningFloat float64    `gorm:"not null"`
+	ClosedByID   *uuid.UUID `gorm:"type:uuid"`
+	ClosedAt     *time.Time
+	// ExpectedAmount, CountedAmount and Variance are set when the session is closed.
+	ExpectedAmount float64        `gorm:"not null;default:0.0"`
+	CountedAmount  float64        `gorm:"not null;default:0.0"`
+	Variance       float64        `gorm:"not null;default:0.0"`
+	Movements      []CashMovement `gorm:"foreignKey:CashSessionID;references:ID"`
+	Payments       []Payment      `gorm:"foreignKey:CashSessionID;references:ID"`
+}
+
+func (s *CashSession) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	s.ID = id
+	return
+}
+
+// IsOpen reports whether the drawer has not been counted yet.
+func (s *CashSession) IsOpen() bool {
+	return s.ClosedAt == nil
+}
+
+// CalculateExpectedAmount returns the cash that should be in the drawer: the opening float, plus
+// cash payments and pay-ins, minus pay-outs. Tips paid in cash are kept in the drawer.
+func (s *CashSession) CalculateExpectedAmount() float64 {
+	expected := s.OpeningFloat
+	for _, payment := range s.Payments {
+		expected += payment.Amount + payment.TipAmount
+	}
+	for _, movement := range s.Movements {
+		switch movement.Kind {
+		case CashMovementPayIn:
+			expected += movement.Amount
+		case CashMovementPayOut:
+			expected -= movement.Amount
+		}
+	}
+	return RoundAmount(expected)
+}
+
+type CashMovementKind string
+
+const (
+	CashMovementPayIn  CashMovementKind = "pay_in"
+	CashMovementPayOut CashMovementKind = "pay_out"
+)
+
+// CashMovement is cash put in or taken out of a drawer for another reason than a payment.
+type CashMovement struct {
+	gorm.Model
+	ID            uuid.UUID        `gorm:"type:uuid;primaryKey"`
+	CashSessionID uuid.UUID        `gorm:"type:uuid;not null;index"`
+	StaffID       uuid.UUID        `gorm:"type:uuid;not null"`
+	Kind          CashMovementKind `gorm:"not null"`
+	Amount        float64          `gorm:"not null"`
+	Reason        string           `gorm:"not null;default:''"`
+}
+
+func (m *CashMovement) BeforeCreate(tx *gorm.DB) (err error) {
+	if m.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	m.ID = id
+	return
+}
+
+// ZReport is the end of day report of a restaurant. Once produced, it can't be changed.
+type ZReport struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey"`
+	CreatedAt    time.Time `gorm:"not null"`
+	RestaurantID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_z_reports_restaurant_date"`
+	// BusinessDate is the day covered by the report, in the restaurant time zone.
+	BusinessDate string         `gorm:"not null;uniqueIndex:idx_z_reports_restaurant_date"`
+	TimeZone     string         `gorm:"not null"`
+	PeriodStart  time.Time      `gorm:"not null"`
+	PeriodEnd    time.Time      `gorm:"not null"`
+	ClosedByID   uuid.UUID      `gorm:"type:uuid;not null"`
+	Summary      ZReportSummary `gorm:"serializer:json;not null"`
+}
+
+func (r *ZReport) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	r.ID = id
+	return
+}
+
+func (r *ZReport) BeforeUpdate(tx *gorm.DB) error {
+	return ErrImmutable
+}
+
+func (r *ZReport) BeforeDelete(tx *gorm.DB) error {
+	return ErrImmutable
+}
+
+// ZReportSummary sums the activity of a business day.
+type ZReportSummary struct {
+	OrdersCount int64 `json:"orders_count"`
+	// GrossSales is the amount of items sold, before discounts.
+	GrossSales float64 `json:"gross_sales"`
+	Discounts  float64 `json:"discounts"`
+	// NetSales is the amount due for orders, after discounts and including taxes.
+	NetSales float64                 `json:"net_sales"`
+	Taxes    float64                 `json:"taxes"`
+	Tips     float64                 `json:"tips"`
+	Payments []ZReportPaymentSummary `json:"payments"`
+	Voids    ZReportVoidSummary      `json:"voids"`
+	Cash     ZReportCashSummary      `json:"cash"`
+}
+
+type ZReportPaymentSummary struct {
+	Method PaymentMethod `json:"method"`
+	Count  int64         `json:"count"`
+	Amount float64       `json:"amount"`
+	Tips   float64       `json:"tips"`
+}
+
+// ZReportVoidSummary sums the orders that were cancelled.
+type ZReportVoidSummary struct {
+	Count  int64   `json:"count"`
+	Amount float64 `json:"amount"`
+}
+
+// ZReportCashSummary sums the cash drawer sessions closed during the day.
+type ZReportCashSummary struct {
+	Sessions int64   `json:"sessions"`
+	Expected float64 `json:"expected"`
+	Counted  float64 `json:"counted"`
+	Variance float64 `json:"variance"`
+}
@@ -0,0 +1,24 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCashSessionCalculateExpectedAmount(t *testing.T) {
+	session := models.CashSession{
+		OpeningFloat: 100,
+		Payments: []models.Payment{
+			{Method: models.PaymentMethodCash, Amount: 12.5, TipAmount: 1.5},
+			{Method: models.PaymentMethodCash, Amount: 8},
+		},
+		Movements: []models.CashMovement{
+			{Kind: models.CashMovementPayIn, Amount: 20},
+			{Kind: models.CashMovementPayOut, Amount: 7.25},
+		},
+	}
+
+	assert.Equal(t, 134.75, session.CalculateExpectedAmount())
+}
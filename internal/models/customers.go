@@ -0,0 +1,102 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Customer is a regular of the restaurants of an owner. Customers are shared by all the restaurants of
+// their owner and earn loyalty points in any of them.
+type Customer struct {
+	gorm.Model
+	ID      uuid.UUID `gorm:"type:uuid;primaryKey"`
+	OwnerID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Name    string    `gorm:"not null"`
+	Phone   string    `gorm:"not null;default:'';index"`
+	Email   string    `gorm:"not null;default:'';index"`
+	// EmailConsent and SMSConsent record whether the customer agreed to receive marketing messages.
+	EmailConsent bool `gorm:"not null;default:false"`
+	SMSConsent   bool `gorm:"not null;default:false"`
+	// ConsentUpdatedAt is when consents were last changed.
+	ConsentUpdatedAt *time.Time
+	// LoyaltyPoints is the balance of points, kept in sync with the loyalty transactions.
+	LoyaltyPoints int64 `gorm:"not null;default:0"`
+}
+
+func (c *Customer) BeforeCreate(tx *gorm.DB) (err error) {
+	if c.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	c.ID = id
+	return
+}
+
+type LoyaltyTransactionKind string
+
+const (
+	LoyaltyTransactionEarn   LoyaltyTransactionKind = "earn"
+	LoyaltyTransactionRedeem LoyaltyTransactionKind = "redeem"
+	// LoyaltyTransactionRestore gives back points redeemed on a cancelled order.
+	LoyaltyTransactionRestore LoyaltyTransactionKind = "restore"
+)
+
+// LoyaltyTransaction is a change of the loyalty points of a customer. Points are positive when
+// earned or restored and negative when redeemed.
+type LoyaltyTransaction struct {
+	ID           uuid.UUID              `gorm:"type:uuid;primaryKey"`
+	CreatedAt    time.Time              `gorm:"not null"`
+	CustomerID   uuid.UUID              `gorm:"type:uuid;not null;index"`
+	RestaurantID uuid.UUID              `gorm:"type:uuid;not null"`
+	OrderID      uuid.UUID              `gorm:"type:uuid;not null;index"`
+	Kind         LoyaltyTransactionKind `gorm:"not null"`
+	Points       int64                  `gorm:"not null"`
+}
+
+func (t *LoyaltyTransaction) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	t.ID = id
+	return
+}
+
+// LoyaltyRules are the earning and redemption rules of loyalty points in a restaurant. Points are
+// disabled when PointsPerUnit is zero.
+type LoyaltyRules struct {
+	// PointsPerUnit is the number of points earned per unit of currency paid.
+	PointsPerUnit float64 `json:"points_per_unit" gorm:"not null;default:0" validate:"gte=0"`
+	// PointValue is the discount given for each redeemed point.
+	PointValue float64 `json:"point_value" gorm:"not null;default:0" validate:"gte=0"`
+	// MinRedemption is the minimum number of points redeemed at once.
+	MinRedemption int64 `json:"min_redemption" gorm:"not null;default:0" validate:"gte=0"`
+}
+
+// IsEnabled reports whether customers earn points.
+func (r LoyaltyRules) IsEnabled() bool {
+	return r.PointsPerUnit > 0
+}
+
+// PointsEarned returns the whole points earned by paying the amount.
+func (r LoyaltyRules) PointsEarned(amount float64) int64 {
+	if amount <= 0 {
+		return 0
+	}
+	// Rounded to cents first so that 0.1 * 30 doesn't end up just below 3
+	return int64(math.Floor(RoundAmount(amount * r.PointsPerUnit)))
+}
+
+// Discount returns the discount given for redeeming the points.
+func (r LoyaltyRules) Discount(points int64) float64 {
+	return RoundAmount(float64(points) * r.PointValue)
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Integration connects a restaurant to its store on a delivery platform. Orders are received from the
+// platform through signed webhooks, the menu and order statuses are pushed back to its API.
+type Integration struct {
+	gorm.Model
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey"`
+	RestaurantID uuid.UUID `gorm:"type:uuid;not null;index"`
+	// Platform is the name of the adapter talking to the platform.
+	Platform string `gorm:"not null"`
+	// StoreID identifies the restaurant on the platform.
+	StoreID string `gorm:"not null"`
+	// Endpoint is the base URL of the platform API.
+	Endpoint string `gorm:"not null"`
+	// APIKey authenticates requests to the platform API.
+	APIKey string `gorm:"not null"`
+	// WebhookSecret signs the webhooks sent by the platform.
+	WebhookSecret string `gorm:"not null"`
+}
+
+func (i *Integration) BeforeCreate(tx *gorm.DB) (err error) {
+	if i.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	i.ID = id
+	return
+}
+
+type IntegrationEventKind string
+
+const (
+	// IntegrationEventKindMenu pushes the menu and availability of products.
+	IntegrationEventKindMenu IntegrationEventKind = "menu"
+	// IntegrationEventKindStatus pushes the status of an order.
+	IntegrationEventKindStatus IntegrationEventKind = "status"
+)
+
+type IntegrationEventStatus string
+
+const (
+	IntegrationEventStatusPending IntegrationEventStatus = "pending"
+	IntegrationEventStatusSending IntegrationEventStatus = "sending"
+	IntegrationEventStatusSent    IntegrationEventStatus = "sent"
+	// IntegrationEventStatusFailed is set once all attempts to send the event failed.
+	IntegrationEventStatusFailed IntegrationEventStatus = "failed"
+)
+
+// IntegrationEvent is an update waiting to be pushed to a delivery platform. Events are queued in the
+// transaction making the change and retried until they are sent or run out of attempts.
+type IntegrationEvent struct {
+	gorm.Model
+	ID            uuid.UUID              `gorm:"type:uuid;primaryKey"`
+	IntegrationID uuid.UUID              `gorm:"type:uuid;not null;index"`
+	OrderID       *uuid.UUID             `gorm:"type:uuid;index"`
+	Kind          IntegrationEventKind   `gorm:"not null"`
+	Status        IntegrationEventStatus `gorm:"not null;default:pending;index"`
+	// OrderStatus is the status pushed by status events.
+	OrderStatus   OrderStatus `gorm:"not null;default:''"`
+	Attempts      int         `gorm:"not null;default:0"`
+	NextAttemptAt time.Time   `gorm:"not null;index"`
+	LastError     string      `gorm:"not null;default:''"`
+	SentAt        *time.Time
+	Integration   Integration `gorm:"foreignKey:IntegrationID;references:ID"`
+}
+
+func (e *IntegrationEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	e.ID = id
+	return
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type JournalEntryKind string
+
+const (
+	JournalEntryInvoice    JournalEntryKind = "invoice"
+	JournalEntryCreditNote JournalEntryKind = "credit_note"
+)
+
+// Prefix returns the prefix of the document numbers of the kind.
+func (k JournalEntryKind) Prefix() string {
+	if k == JournalEntryCreditNote {
+		return "CN"
+	}
+	return "INV"
+}
+
+// JournalEntry is a record of the sales journal of a restaurant. Entries are chained: each one
+// includes the hash of the previous one, so that changing, removing or inserting an entry is detected.
+// Entries are never modified, refunds are recorded with credit notes.
+type JournalEntry struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey"`
+	CreatedAt    time.Time `gorm:"not null"`
+	RestaurantID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_journal_restaurant_sequence;uniqueIndex:idx_journal_restaurant_kind_number"`
+	// Sequence is the position of the entry in the journal, starting at 1.
+	Sequence int64            `gorm:"not null;uniqueIndex:idx_journal_restaurant_sequence"`
+	Kind     JournalEntryKind `gorm:"not null;uniqueIndex:idx_journal_restaurant_kind_number"`
+	// Number is the gap-free number of the document among the documents of the same kind.
+	Number  int64     `gorm:"not null;uniqueIndex:idx_journal_restaurant_kind_number"`
+	OrderID uuid.UUID `gorm:"type:uuid;not null;index"`
+	// CreditedEntryID is the invoice a credit note refunds.
+	CreditedEntryID *uuid.UUID    `gorm:"type:uuid"`
+	Amount          float64       `gorm:"not null"`
+	TaxAmount       float64       `gorm:"not null"`
+	Currency        string        `gorm:"not null"`
+	Lines           []JournalLine `gorm:"serializer:json"`
+	Reason          string        `gorm:"not null;default:''"`
+	PreviousHash    string        `gorm:"not null"`
+	Hash            string        `gorm:"not null"`
+}
+
+// JournalHead is the last entry of the journal of a restaurant. It is moved with each entry, which
+// detects the removal of the last entries, and it is locked while an entry is appended.
+type JournalHead struct {
+	RestaurantID uuid.UUID `gorm:"type:uuid;primaryKey"`
+	Sequence     int64     `gorm:"not null"`
+	Hash         string    `gorm:"not null"`
+	UpdatedAt    time.Time `gorm:"not null"`
+}
+
+// JournalLine is an item sold on an invoice.
+type JournalLine struct {
+	ProductID uuid.UUID `json:"product_id"`
+	Title     string    `json:"title"`
+	Quantity  uint32    `json:"quantity"`
+	UnitPrice float64   `json:"unit_price"`
+}
+
+func (e *JournalEntry) BeforeCreate(tx *gorm.DB) (err error) {
+	if e.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	e.ID = id
+	return
+}
+
+func (e *JournalEntry) BeforeUpdate(tx *gorm.DB) error {
+	return ErrImmutable
+}
+
+func (e *JournalEntry) BeforeDelete(tx *gorm.DB) error {
+	return ErrImmutable
+}
+
+// DocumentNumber returns the number printed on the document, e.g. "INV-000042".
+func (e *JournalEntry) DocumentNumber() string {
+	return fmt.Sprintf("%s-%06d", e.Kind.Prefix(), e.Number)
+}
+
+// ComputeHash returns the hash of the entry content and of the previous entry hash.
+func (e *JournalEntry) ComputeHash() (string, error) {
+	lines, err := json.Marshal(e.Lines)
+	if err != nil {
+		return "", err
+	}
+	creditedEntryID := ""
+	if e.CreditedEntryID != nil {
+		creditedEntryID = e.CreditedEntryID.String()
+	}
+
+	content := strings.Join([]string{
+		e.ID.String(),
+		e.RestaurantID.String(),
+		strconv.FormatInt(e.Sequence, 10),
+		string(e.Kind),
+		strconv.FormatInt(e.Number, 10),
+		e.OrderID.String(),
+		creditedEntryID,
+		strconv.FormatFloat(e.Amount, 'f', 2, 64),
+		strconv.FormatFloat(e.TaxAmount, 'f', 2, 64),
+		e.Currency,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		string(lines),
+		e.Reason,
+		e.PreviousHash,
+	}, "|")
+
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:]), nil
+}
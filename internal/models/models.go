@@ -1,6 +1,9 @@
 package models
 
 import (
+	"math"
+	"time"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -20,6 +23,9 @@ type Owner struct {
 }
 
 func (o *Owner) BeforeCreate(tx *gorm.DB) (err error) {
+	if o.ID != uuid.Nil {
+		return
+	}
 	ID, err := uuid.NewV7()
 	if err != nil {
 		return
@@ -28,16 +34,42 @@ func (o *Owner) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+type StaffRole string
+
+const (
+	StaffRoleWaiter  StaffRole = "waiter"
+	StaffRoleCashier StaffRole = "cashier"
+	StaffRoleKitchen StaffRole = "kitchen"
+	StaffRoleManager StaffRole = "manager"
+)
+
 type Staff struct {
 	gorm.Model
-	ID           uuid.UUID  `gorm:"type:uuid;primaryKey"`
-	RestaurantID uuid.UUID  `gorm:"type:uuid;not null"`
-	Username     string     `gorm:"not null"`
-	PasswordHash string     `gorm:"not null"`
-	Restaurant   Restaurant `gorm:"foreignKey:RestaurantID;references:ID"`
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey"`
+	RestaurantID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_staff_restaurant_username"`
+	Username     string    `gorm:"not null;uniqueIndex:idx_staff_restaurant_username"`
+	DisplayName  string    `gorm:"not null;default:''"`
+	Role         StaffRole `gorm:"not null;default:waiter"`
+	PasswordHash string    `gorm:"not null"`
+	// PinHash is used to sign in on terminals, staff without a PIN can't use terminals.
+	PinHash           string `gorm:"not null;default:''"`
+	FailedPinAttempts uint32 `gorm:"not null;default:0"`
+	PinLockedUntil    *time.Time
+	// TokenVersion is embedded in issued tokens, incrementing it revokes every token issued before.
+	TokenVersion  uint32 `gorm:"not null;default:0"`
+	DeactivatedAt *time.Time
+	Restaurant    Restaurant `gorm:"foreignKey:RestaurantID;references:ID"`
+}
+
+// IsActive reports whether the staff member is allowed to sign in.
+func (s *Staff) IsActive() bool {
+	return s.DeactivatedAt == nil
 }
 
 func (s *Staff) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID != uuid.Nil {
+		return
+	}
 	ID, err := uuid.NewV7()
 	if err != nil {
 		return
@@ -48,13 +80,56 @@ func (s *Staff) BeforeCreate(tx *gorm.DB) (err error) {
 
 type Restaurant struct {
 	gorm.Model
-	ID      uuid.UUID `gorm:"type:uuid;primaryKey"`
-	OwnerID uuid.UUID `gorm:"type:uuid;not null"`
-	Name    string    `gorm:"not null"`
-	Owner   Owner     `gorm:"foreignKey:OwnerID;references:ID"`
+	ID           uuid.UUID      `gorm:"type:uuid;primaryKey"`
+	OwnerID      uuid.UUID      `gorm:"type:uuid;not null"`
+	Name         string         `gorm:"not null"`
+	Address      string         `gorm:"not null;default:''"`
+	TimeZone     string         `gorm:"not null;default:UTC"`
+	Currency     string         `gorm:"not null;default:EUR"`
+	TaxID        string         `gorm:"not null;default:''"`
+	OpeningHours []OpeningHours `gorm:"serializer:json"`
+	// ReceiptFooter is printed at the bottom of receipts.
+	ReceiptFooter string `gorm:"not null;default:''"`
+	// TaxRate is the sales tax percentage included in product prices.
+	TaxRate float64 `gorm:"not null;default:0"`
+	// RequireClockIn prevents staff from creating orders when they are not clocked in.
+	RequireClockIn bool `gorm:"not null;default:false"`
+	// Loyalty are the rules of loyalty points earned by customers.
+	Loyalty LoyaltyRules `gorm:"embedded;embeddedPrefix:loyalty_"`
+	// Pickup are the scheduling rules of takeaway and delivery orders.
+	Pickup PickupRules `gorm:"embedded;embeddedPrefix:pickup_"`
+	// DeliveryFee is added to delivery orders.
+	DeliveryFee float64 `gorm:"not null;default:0"`
+	ArchivedAt  *time.Time
+	Owner       Owner `gorm:"foreignKey:OwnerID;references:ID"`
+}
+
+// OpeningHours is a time range during which a restaurant is open on a given day. Times are
+// formatted as "15:04" in the restaurant time zone, a range closing before it opens ends on the next day.
+type OpeningHours struct {
+	Weekday time.Weekday `json:"weekday" validate:"min=0,max=6"`
+	Opens   string       `json:"opens" validate:"required,datetime=15:04"`
+	Closes  string       `json:"closes" validate:"required,datetime=15:04"`
+}
+
+// Location returns the time zone of the restaurant, falling back to UTC if it is unknown.
+func (r *Restaurant) Location() *time.Location {
+	location, err := time.LoadLocation(r.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// IsArchived reports whether the restaurant was archived by its owner.
+func (r *Restaurant) IsArchived() bool {
+	return r.ArchivedAt != nil
 }
 
 func (r *Restaurant) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID != uuid.Nil {
+		return
+	}
 	id, err := uuid.NewV7()
 	if err != nil {
 		return
@@ -63,6 +138,36 @@ func (r *Restaurant) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+// Terminal is a shared device, such as a POS, registered by an owner for one of their restaurants.
+// Staff sign in on terminals with their PIN.
+type Terminal struct {
+	gorm.Model
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey"`
+	RestaurantID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Name         string    `gorm:"not null"`
+	TokenHash    string    `gorm:"not null;uniqueIndex"`
+	LastSeenAt   *time.Time
+	RevokedAt    *time.Time
+	Restaurant   Restaurant `gorm:"foreignKey:RestaurantID;references:ID"`
+}
+
+func (t *Terminal) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	t.ID = id
+	return
+}
+
+// IsRevoked reports whether the terminal was revoked by the owner.
+func (t *Terminal) IsRevoked() bool {
+	return t.RevokedAt != nil
+}
+
 type Product struct {
 	gorm.Model
 	ID           uuid.UUID  `gorm:"type:uuid;primaryKey"`
@@ -70,10 +175,15 @@ type Product struct {
 	Title        string     `gorm:"not null"`
 	Description  string     `gorm:"not null"`
 	UnitPrice    float64    `gorm:"not null"`
+	Category     string     `gorm:"not null;default:''"`
+	Available    bool       `gorm:"not null;default:true"`
 	Restaurant   Restaurant `gorm:"foreignKey:RestaurantID;references:ID"`
 }
 
 func (p *Product) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID != uuid.Nil {
+		return
+	}
 	id, err := uuid.NewV7()
 	if err != nil {
 		return
@@ -82,29 +192,166 @@ func (p *Product) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+type Table struct {
+	gorm.Model
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey"`
+	RestaurantID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_tables_restaurant_number"`
+	Number       string    `gorm:"not null;uniqueIndex:idx_tables_restaurant_number"`
+	Seats        uint32    `gorm:"not null;default:0"`
+	// TokenVersion is embedded in the tokens of the table QR codes, incrementing it revokes printed codes.
+	TokenVersion uint32     `gorm:"not null;default:0"`
+	Restaurant   Restaurant `gorm:"foreignKey:RestaurantID;references:ID"`
+}
+
+func (t *Table) BeforeCreate(tx *gorm.DB) (err error) {
+	if t.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	t.ID = id
+	return
+}
+
 type OrderStatus string
 
 const (
-	OrderStatusPending   OrderStatus = "pending"
-	OrderStatusConfirmed OrderStatus = "confirmed"
-	OrderStatusPrepared  OrderStatus = "prepared"
-	OrderStatusCompleted OrderStatus = "completed"
-	OrderStatusCancelled OrderStatus = "cancelled"
+	// OrderStatusAwaitingApproval is the status of orders placed by guests until staff approve them.
+	OrderStatusAwaitingApproval OrderStatus = "awaiting_approval"
+	OrderStatusPending          OrderStatus = "pending"
+	OrderStatusConfirmed        OrderStatus = "confirmed"
+	OrderStatusPrepared         OrderStatus = "prepared"
+	OrderStatusCompleted        OrderStatus = "completed"
+	OrderStatusCancelled        OrderStatus = "cancelled"
+	// OrderStatusReadyForPickup is the status of prepared takeaway orders waiting for their customer.
+	OrderStatusReadyForPickup OrderStatus = "ready_for_pickup"
+	// OrderStatusOutForDelivery is the status of delivery orders on their way to the customer.
+	OrderStatusOutForDelivery OrderStatus = "out_for_delivery"
+)
+
+// orderStatusTransitions lists the statuses an order can move to from a given status.
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusAwaitingApproval: {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusPending:          {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusConfirmed:        {OrderStatusPrepared, OrderStatusCancelled},
+	OrderStatusPrepared:         {OrderStatusCompleted, OrderStatusCancelled},
+}
+
+// orderTypeStatusTransitions overrides orderStatusTransitions for orders that are not eaten in.
+var orderTypeStatusTransitions = map[OrderType]map[OrderStatus][]OrderStatus{
+	OrderTypeTakeaway: {
+		OrderStatusPrepared:       {OrderStatusReadyForPickup, OrderStatusCancelled},
+		OrderStatusReadyForPickup: {OrderStatusCompleted, OrderStatusCancelled},
+	},
+	OrderTypeDelivery: {
+		OrderStatusPrepared:       {OrderStatusOutForDelivery, OrderStatusCancelled},
+		OrderStatusOutForDelivery: {OrderStatusCompleted, OrderStatusCancelled},
+	},
+}
+
+// IsValid reports whether s is a known order status.
+func (s OrderStatus) IsValid() bool {
+	switch s {
+	case OrderStatusAwaitingApproval, OrderStatusPending, OrderStatusConfirmed, OrderStatusPrepared, OrderStatusCompleted, OrderStatusCancelled,
+		OrderStatusReadyForPickup, OrderStatusOutForDelivery:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether a dine-in order in status s can be moved to next.
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	return containsStatus(orderStatusTransitions[s], next)
+}
+
+func containsStatus(statuses []OrderStatus, status OrderStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOpen reports whether items can still be added to an order in status s.
+func (s OrderStatus) IsOpen() bool {
+	return s == OrderStatusPending || s == OrderStatusConfirmed
+}
+
+// OrderType is how an order is served.
+type OrderType string
+
+const (
+	OrderTypeDineIn   OrderType = "dine_in"
+	OrderTypeTakeaway OrderType = "takeaway"
+	OrderTypeDelivery OrderType = "delivery"
+)
+
+// IsScheduled reports whether orders of type t are scheduled in pickup slots.
+func (t OrderType) IsScheduled() bool {
+	return t == OrderTypeTakeaway || t == OrderTypeDelivery
+}
+
+// OrderSource is who placed an order.
+type OrderSource string
+
+const (
+	OrderSourceStaff OrderSource = "staff"
+	// OrderSourceGuest is for orders placed by guests from the QR code of their table.
+	OrderSourceGuest OrderSource = "guest"
+	// OrderSourceMarketplace is for orders received from delivery platforms.
+	OrderSourceMarketplace OrderSource = "marketplace"
 )
 
 type Order struct {
 	gorm.Model
-	ID           uuid.UUID   `gorm:"type:uuid;primaryKey"`
-	RestaurantID uuid.UUID   `gorm:"type:uuid;not null"`
-	StaffID      uuid.UUID   `gorm:"type:uuid;not null"`
-	TableNumber  string      `gorm:"not null"`
-	Status       OrderStatus `gorm:"not null;default:pending"`
-	TotalAmount  float64     `gorm:"not null;default:0.0"`
-	Restaurant   Restaurant  `gorm:"foreignKey:RestaurantID;references:ID"`
-	OrderItems   []OrderItem `gorm:"foreignKey:OrderID;references:ID"`
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey"`
+	RestaurantID uuid.UUID `gorm:"type:uuid;not null"`
+	StaffID      uuid.UUID `gorm:"type:uuid;not null"`
+	Type         OrderType `gorm:"not null;default:dine_in"`
+	// TableNumber is only set for dine-in orders.
+	TableNumber string      `gorm:"not null"`
+	Status      OrderStatus `gorm:"not null;default:pending"`
+	Source      OrderSource `gorm:"not null;default:staff"`
+	// IntegrationID and ExternalID identify orders received from delivery platforms.
+	IntegrationID *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_orders_external"`
+	ExternalID    string     `gorm:"not null;default:'';uniqueIndex:idx_orders_external"`
+	// ContactName and ContactPhone are who to call about takeaway and delivery orders.
+	ContactName  string `gorm:"not null;default:''"`
+	ContactPhone string `gorm:"not null;default:''"`
+	// PickupAt is the start of the slot takeaway orders are picked up, or delivery orders leave, in.
+	PickupAt        *time.Time `gorm:"index"`
+	DeliveryAddress string     `gorm:"not null;default:''"`
+	// DeliveryFee is included in the total amount.
+	DeliveryFee float64 `gorm:"not null;default:0.0"`
+	// TotalAmount is the amount due, after discounts and including taxes.
+	TotalAmount    float64 `gorm:"not null;default:0.0"`
+	DiscountAmount float64 `gorm:"not null;default:0.0"`
+	TaxAmount      float64 `gorm:"not null;default:0.0"`
+	// PaidAt is set once payments cover the total amount.
+	PaidAt *time.Time
+	// InvoiceNumber is assigned in the sales journal when the order is paid.
+	InvoiceNumber string     `gorm:"not null;default:''"`
+	CustomerID    *uuid.UUID `gorm:"type:uuid;index"`
+	// PromotionDiscount is the part of the discount given by promotions, recomputed when the order is
+	// priced again. The rest of the discount comes from loyalty points.
+	PromotionDiscount float64 `gorm:"not null;default:0.0"`
+	// CouponCode is the code of the coupon applied to the order, if any.
+	CouponCode string `gorm:"not null;default:''"`
+	// RedeemedPoints are the loyalty points of the customer included in the discount.
+	RedeemedPoints int64       `gorm:"not null;default:0"`
+	Restaurant     Restaurant  `gorm:"foreignKey:RestaurantID;references:ID"`
+	OrderItems     []OrderItem `gorm:"foreignKey:OrderID;references:ID"`
+	Payments       []Payment   `gorm:"foreignKey:OrderID;references:ID"`
 }
 
+// BeforeCreate keeps IDs generated by offline clients and only assigns one when missing.
 func (o *Order) BeforeCreate(tx *gorm.DB) (err error) {
+	if o.ID != uuid.Nil {
+		return
+	}
 	id, err := uuid.NewV7()
 	if err != nil {
 		return
@@ -119,10 +366,17 @@ type OrderItem struct {
 	OrderID   uuid.UUID `gorm:"type:uuid;not null"`
 	ProductID uuid.UUID `gorm:"type:uuid;not null"`
 	Quantity  uint32    `gorm:"not null"`
-	Product   Product   `gorm:"foreignKey:ProductID;references:ID"`
+	UnitPrice float64   `gorm:"not null;default:0.0"`
+	// Modifiers are the preparation instructions of the item, e.g. "no onions".
+	Modifiers []string `gorm:"serializer:json"`
+	Product   Product  `gorm:"foreignKey:ProductID;references:ID"`
 }
 
+// BeforeCreate keeps IDs generated by offline clients and only assigns one when missing.
 func (o *OrderItem) BeforeCreate(tx *gorm.DB) (err error) {
+	if o.ID != uuid.Nil {
+		return
+	}
 	id, err := uuid.NewV7()
 	if err != nil {
 		return
@@ -131,10 +385,63 @@ func (o *OrderItem) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+// CanTransitionTo reports whether the order can be moved to next. Takeaway orders go through
+// ready-for-pickup and delivery orders through out-for-delivery before being completed.
+func (o *Order) CanTransitionTo(next OrderStatus) bool {
+	if statuses, ok := orderTypeStatusTransitions[o.Type][o.Status]; ok {
+		return containsStatus(statuses, next)
+	}
+	return o.Status.CanTransitionTo(next)
+}
+
+// UpdateTotals computes the amounts of the order from its items, discount and delivery fee. Prices
+// include taxes, taxRate is the percentage of tax they include.
+func (o *Order) UpdateTotals(taxRate float64) {
+	total := RoundAmount(CalculateTotalAmount(o.OrderItems) - o.DiscountAmount)
+	if total < 0 {
+		total = 0
+	}
+	total = RoundAmount(total + o.DeliveryFee)
+	o.TotalAmount = total
+	o.TaxAmount = RoundAmount(total * taxRate / (100 + taxRate))
+}
+
+// IsPaid reports whether payments cover the total amount of the order.
+func (o *Order) IsPaid() bool {
+	return o.PaidAt != nil
+}
+
+// RoundAmount rounds a monetary amount to cents.
+func RoundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// CalculateTotalAmount sums the items using the unit price captured when each item was ordered.
 func CalculateTotalAmount(items []OrderItem) float64 {
 	totalAmount := 0.0
 	for _, item := range items {
-		totalAmount += float64(item.Quantity) * item.Product.UnitPrice
+		totalAmount += float64(item.Quantity) * item.UnitPrice
 	}
 	return totalAmount
 }
+
+type SyncMutationStatus string
+
+const (
+	SyncMutationApplied  SyncMutationStatus = "applied"
+	SyncMutationConflict SyncMutationStatus = "conflict"
+	SyncMutationRejected SyncMutationStatus = "rejected"
+)
+
+// SyncMutation records the outcome of a mutation pushed by an offline client so that
+// retried pushes are answered with the original result instead of being applied twice.
+type SyncMutation struct {
+	ID           uuid.UUID          `gorm:"type:uuid;primaryKey"`
+	CreatedAt    time.Time          `gorm:"not null"`
+	RestaurantID uuid.UUID          `gorm:"type:uuid;not null;index"`
+	StaffID      uuid.UUID          `gorm:"type:uuid;not null"`
+	Type         string             `gorm:"not null"`
+	OrderID      uuid.UUID          `gorm:"type:uuid"`
+	Status       SyncMutationStatus `gorm:"not null"`
+	Error        string
+}
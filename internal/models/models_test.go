@@ -0,0 +1,97 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderStatusCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		name string
+		from models.OrderStatus
+		to   models.OrderStatus
+		want bool
+	}{
+		{name: "pending to confirmed", from: models.OrderStatusPending, to: models.OrderStatusConfirmed, want: true},
+		{name: "pending to cancelled", from: models.OrderStatusPending, to: models.OrderStatusCancelled, want: true},
+		{name: "pending to completed", from: models.OrderStatusPending, to: models.OrderStatusCompleted, want: false},
+		{name: "confirmed to prepared", from: models.OrderStatusConfirmed, to: models.OrderStatusPrepared, want: true},
+		{name: "prepared to completed", from: models.OrderStatusPrepared, to: models.OrderStatusCompleted, want: true},
+		{name: "completed to cancelled", from: models.OrderStatusCompleted, to: models.OrderStatusCancelled, want: false},
+		{name: "cancelled to pending", from: models.OrderStatusCancelled, to: models.OrderStatusPending, want: false},
+		{name: "awaiting approval to confirmed", from: models.OrderStatusAwaitingApproval, to: models.OrderStatusConfirmed, want: true},
+		{name: "awaiting approval to prepared", from: models.OrderStatusAwaitingApproval, to: models.OrderStatusPrepared, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.from.CanTransitionTo(tt.to))
+		})
+	}
+}
+
+func TestOrderCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		name      string
+		orderType models.OrderType
+		from      models.OrderStatus
+		to        models.OrderStatus
+		want      bool
+	}{
+		{name: "dine-in prepared to completed", orderType: models.OrderTypeDineIn, from: models.OrderStatusPrepared, to: models.OrderStatusCompleted, want: true},
+		{name: "dine-in prepared to ready for pickup", orderType: models.OrderTypeDineIn, from: models.OrderStatusPrepared, to: models.OrderStatusReadyForPickup, want: false},
+		{name: "takeaway confirmed to prepared", orderType: models.OrderTypeTakeaway, from: models.OrderStatusConfirmed, to: models.OrderStatusPrepared, want: true},
+		{name: "takeaway prepared to completed", orderType: models.OrderTypeTakeaway, from: models.OrderStatusPrepared, to: models.OrderStatusCompleted, want: false},
+		{name: "takeaway prepared to ready for pickup", orderType: models.OrderTypeTakeaway, from: models.OrderStatusPrepared, to: models.OrderStatusReadyForPickup, want: true},
+		{name: "takeaway ready for pickup to completed", orderType: models.OrderTypeTakeaway, from: models.OrderStatusReadyForPickup, to: models.OrderStatusCompleted, want: true},
+		{name: "takeaway prepared to out for delivery", orderType: models.OrderTypeTakeaway, from: models.OrderStatusPrepared, to: models.OrderStatusOutForDelivery, want: false},
+		{name: "delivery prepared to out for delivery", orderType: models.OrderTypeDelivery, from: models.OrderStatusPrepared, to: models.OrderStatusOutForDelivery, want: true},
+		{name: "delivery out for delivery to completed", orderType: models.OrderTypeDelivery, from: models.OrderStatusOutForDelivery, to: models.OrderStatusCompleted, want: true},
+		{name: "delivery out for delivery to cancelled", orderType: models.OrderTypeDelivery, from: models.OrderStatusOutForDelivery, to: models.OrderStatusCancelled, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := models.Order{Type: tt.orderType, Status: tt.from}
+			assert.Equal(t, tt.want, order.CanTransitionTo(tt.to))
+		})
+	}
+}
+
+func TestCalculateTotalAmount(t *testing.T) {
+	items := []models.OrderItem{
+		{Quantity: 2, UnitPrice: 4.5},
+		{Quantity: 1, UnitPrice: 10},
+		// The current product price must not be used once the item is ordered
+		{Quantity: 3, UnitPrice: 1, Product: models.Product{UnitPrice: 100}},
+	}
+
+	assert.Equal(t, 22.0, models.CalculateTotalAmount(items))
+}
+
+func TestOrderUpdateTotals(t *testing.T) {
+	order := models.Order{
+		OrderItems:     []models.OrderItem{{Quantity: 2, UnitPrice: 6}},
+		DiscountAmount: 1,
+	}
+	order.UpdateTotals(10)
+
+	assert.Equal(t, 11.0, order.TotalAmount)
+	assert.Equal(t, 1.0, order.TaxAmount)
+
+	// Discounts never make the amount due negative
+	order.DiscountAmount = 20
+	order.UpdateTotals(10)
+
+	assert.Equal(t, 0.0, order.TotalAmount)
+	assert.Equal(t, 0.0, order.TaxAmount)
+
+	// Delivery fees are due even when the items are fully discounted
+	order.DeliveryFee = 3.5
+	order.UpdateTotals(10)
+
+	assert.Equal(t, 3.5, order.TotalAmount)
+	assert.Equal(t, 0.32, order.TaxAmount)
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type PaymentMethod string
+
+const (
+	PaymentMethodCash  PaymentMethod = "cash"
+	PaymentMethodCard  PaymentMethod = "card"
+	PaymentMethodOther PaymentMethod = "other"
+)
+
+// Payment is an amount paid towards an order. Tips are recorded separately from the amount
+// applied to the order.
+type Payment struct {
+	gorm.Model
+	ID           uuid.UUID     `gorm:"type:uuid;primaryKey"`
+	RestaurantID uuid.UUID     `gorm:"type:uuid;not null;index"`
+	OrderID      uuid.UUID     `gorm:"type:uuid;not null;index"`
+	StaffID      uuid.UUID     `gorm:"type:uuid;not null"`
+	Method       PaymentMethod `gorm:"not null"`
+	Amount       float64       `gorm:"not null"`
+	TipAmount    float64       `gorm:"not null;default:0.0"`
+	// CashSessionID is the cash drawer session cash payments were put in.
+	CashSessionID *uuid.UUID `gorm:"type:uuid;index"`
+}
+
+func (p *Payment) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	p.ID = id
+	return
+}
+
+// SumPayments returns the amount and tips of the payments.
+func SumPayments(payments []Payment) (amount float64, tips float64) {
+	for _, payment := range payments {
+		amount += payment.Amount
+		tips += payment.TipAmount
+	}
+	return RoundAmount(amount), RoundAmount(tips)
+}
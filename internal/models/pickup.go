@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// PickupRules are the scheduling rules of takeaway and delivery orders in a restaurant. Orders are
+// scheduled in slots during opening hours so that the kitchen isn't overloaded.
+type PickupRules struct {
+	// SlotMinutes is the length of pickup slots, 15 minutes when zero.
+	SlotMinutes int `json:"slot_minutes" gorm:"not null;default:15" validate:"omitempty,min=5,max=240"`
+	// SlotCapacity is the number of orders scheduled in a slot, unlimited when zero.
+	SlotCapacity int `json:"slot_capacity" gorm:"not null;default:0" validate:"gte=0"`
+	// LeadMinutes is the time the kitchen needs, orders can't be scheduled sooner.
+	LeadMinutes int `json:"lead_minutes" gorm:"not null;default:15" validate:"gte=0,max=1440"`
+}
+
+// SlotDuration returns the length of pickup slots.
+func (r PickupRules) SlotDuration() time.Duration {
+	if r.SlotMinutes <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(r.SlotMinutes) * time.Minute
+}
+
+// LeadTime returns the time the kitchen needs before the first available slot.
+func (r PickupRules) LeadTime() time.Duration {
+	return time.Duration(r.LeadMinutes) * time.Minute
+}
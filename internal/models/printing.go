@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type PrinterKind string
+
+const (
+	// PrinterKindKitchen prints the tickets of confirmed orders at a kitchen station.
+	PrinterKindKitchen PrinterKind = "kitchen"
+	// PrinterKindReceipt prints receipts for customers.
+	PrinterKindReceipt PrinterKind = "receipt"
+)
+
+// Printer is a network printer accepting raw data on a TCP port, usually 9100.
+type Printer struct {
+	gorm.Model
+	ID           uuid.UUID   `gorm:"type:uuid;primaryKey"`
+	RestaurantID uuid.UUID   `gorm:"type:uuid;not null;index"`
+	Name         string      `gorm:"not null"`
+	Kind         PrinterKind `gorm:"not null"`
+	// Address is the host and port of the printer, e.g. "192.168.1.20:9100".
+	Address string `gorm:"not null"`
+}
+
+func (p *Printer) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	p.ID = id
+	return
+}
+
+type PrintJobKind string
+
+const (
+	PrintJobKindKitchenTicket PrintJobKind = "kitchen_ticket"
+	PrintJobKindReceipt       PrintJobKind = "receipt"
+)
+
+type PrintJobStatus string
+
+const (
+	PrintJobStatusPending  PrintJobStatus = "pending"
+	PrintJobStatusPrinting PrintJobStatus = "printing"
+	PrintJobStatusPrinted  PrintJobStatus = "printed"
+	// PrintJobStatusFailed is set once all attempts to print failed.
+	PrintJobStatusFailed PrintJobStatus = "failed"
+)
+
+// PrintJob is data waiting to be sent to a printer. Jobs are retried until they are printed or run
+// out of attempts.
+type PrintJob struct {
+	gorm.Model
+	ID           uuid.UUID      `gorm:"type:uuid;primaryKey"`
+	RestaurantID uuid.UUID      `gorm:"type:uuid;not null;index"`
+	PrinterID    uuid.UUID      `gorm:"type:uuid;not null;index"`
+	OrderID      *uuid.UUID     `gorm:"type:uuid;index"`
+	Kind         PrintJobKind   `gorm:"not null"`
+	Status       PrintJobStatus `gorm:"not null;default:pending;index"`
+	// Data is sent as is to the printer, usually ESC/POS commands.
+	Data          []byte    `gorm:"not null"`
+	Attempts      int       `gorm:"not null;default:0"`
+	LastError     string    `gorm:"not null;default:''"`
+	NextAttemptAt time.Time `gorm:"not null;index"`
+	PrintedAt     *time.Time
+	Printer       Printer `gorm:"foreignKey:PrinterID;references:ID"`
+}
+
+func (j *PrintJob) BeforeCreate(tx *gorm.DB) (err error) {
+	if j.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	j.ID = id
+	return
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type PromotionKind string
+
+const (
+	// PromotionKindBuyXGetY gives GetQuantity eligible items for every BuyQuantity bought, e.g. 2-for-1.
+	// The cheapest eligible items are the free ones.
+	PromotionKindBuyXGetY PromotionKind = "buy_x_get_y"
+	// PromotionKindPercentage takes Percentage off the eligible items.
+	PromotionKindPercentage PromotionKind = "percentage"
+	// PromotionKindFixedAmount takes Amount off the order.
+	PromotionKindFixedAmount PromotionKind = "fixed_amount"
+)
+
+// IsValid reports whether k is a known promotion kind.
+func (k PromotionKind) IsValid() bool {
+	return k == PromotionKindBuyXGetY || k == PromotionKindPercentage || k == PromotionKindFixedAmount
+}
+
+// Promotion is a discount given on orders of a restaurant. Promotions with a code are coupons applied
+// on request, the others are deals applied automatically to every eligible order.
+type Promotion struct {
+	gorm.Model
+	ID           uuid.UUID     `gorm:"type:uuid;primaryKey"`
+	RestaurantID uuid.UUID     `gorm:"type:uuid;not null;index"`
+	Name         string        `gorm:"not null"`
+	Kind         PromotionKind `gorm:"not null"`
+	// Code is the coupon code, in upper case. Promotions without code are automatic.
+	Code string `gorm:"not null;default:'';index"`
+	// ProductID and Category restrict the eligible items, all items are eligible when both are unset.
+	ProductID *uuid.UUID `gorm:"type:uuid"`
+	Category  string     `gorm:"not null;default:''"`
+	// BuyQuantity and GetQuantity are the quantities of buy X get Y promotions.
+	BuyQuantity int `gorm:"not null;default:0"`
+	GetQuantity int `gorm:"not null;default:0"`
+	// Percentage is the discount percentage of percentage promotions.
+	Percentage float64 `gorm:"not null;default:0"`
+	// Amount is the discount of fixed amount promotions.
+	Amount float64 `gorm:"not null;default:0"`
+	// MinSubtotal is the amount of items orders must reach for the promotion to apply.
+	MinSubtotal float64 `gorm:"not null;default:0"`
+	// StartsAt and EndsAt bound the validity of the promotion, unbounded when unset.
+	StartsAt *time.Time
+	EndsAt   *time.Time
+	// Weekdays are the days, in the restaurant time zone, the promotion is valid on. Every day when empty.
+	Weekdays []time.Weekday `gorm:"serializer:json"`
+	// MaxUses and MaxUsesPerCustomer limit the redemptions of the promotion, unlimited when zero.
+	MaxUses            int `gorm:"not null;default:0"`
+	MaxUsesPerCustomer int `gorm:"not null;default:0"`
+}
+
+func (p *Promotion) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	p.ID = id
+	return
+}
+
+// IsAutomatic reports whether the promotion applies without coupon code.
+func (p *Promotion) IsAutomatic() bool {
+	return p.Code == ""
+}
+
+// PromotionRedemption records a promotion applied to an order. Redemptions count towards the usage
+// limits of promotions, they are removed when the order is re-priced or cancelled.
+type PromotionRedemption struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey"`
+	CreatedAt   time.Time  `gorm:"not null"`
+	PromotionID uuid.UUID  `gorm:"type:uuid;not null;index"`
+	OrderID     uuid.UUID  `gorm:"type:uuid;not null;index"`
+	CustomerID  *uuid.UUID `gorm:"type:uuid;index"`
+	Amount      float64    `gorm:"not null"`
+}
+
+func (r *PromotionRedemption) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	r.ID = id
+	return
+}
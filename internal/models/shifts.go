@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Shift is the time a staff member spent at work, from clock in to clock out.
+type Shift struct {
+	gorm.Model
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey"`
+	RestaurantID uuid.UUID `gorm:"type:uuid;not null;index"`
+	StaffID      uuid.UUID `gorm:"type:uuid;not null;index"`
+	ClockInAt    time.Time `gorm:"not null"`
+	ClockOutAt   *time.Time
+	Staff        Staff        `gorm:"foreignKey:StaffID;references:ID"`
+	Breaks       []ShiftBreak `gorm:"foreignKey:ShiftID;references:ID"`
+}
+
+func (s *Shift) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	s.ID = id
+	return
+}
+
+// IsOpen reports whether the staff member has not clocked out yet.
+func (s *Shift) IsOpen() bool {
+	return s.ClockOutAt == nil
+}
+
+// OpenBreak returns the break in progress, if any.
+func (s *Shift) OpenBreak() *ShiftBreak {
+	for i := range s.Breaks {
+		if s.Breaks[i].EndedAt == nil {
+			return &s.Breaks[i]
+		}
+	}
+	return nil
+}
+
+// BreakDuration returns the time spent on breaks, counting breaks in progress until now.
+func (s *Shift) BreakDuration(now time.Time) time.Duration {
+	var total time.Duration
+	for _, b := range s.Breaks {
+		end := now
+		if b.EndedAt != nil {
+			end = *b.EndedAt
+		}
+		total += end.Sub(b.StartedAt)
+	}
+	return total
+}
+
+// WorkedDuration returns the time worked, excluding breaks. Open shifts are counted until now.
+func (s *Shift) WorkedDuration(now time.Time) time.Duration {
+	end := now
+	if s.ClockOutAt != nil {
+		end = *s.ClockOutAt
+	}
+	return end.Sub(s.ClockInAt) - s.BreakDuration(now)
+}
+
+type ShiftBreak struct {
+	gorm.Model
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
+	ShiftID   uuid.UUID `gorm:"type:uuid;not null;index"`
+	StartedAt time.Time `gorm:"not null"`
+	EndedAt   *time.Time
+}
+
+func (b *ShiftBreak) BeforeCreate(tx *gorm.DB) (err error) {
+	if b.ID != uuid.Nil {
+		return
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return
+	}
+	b.ID = id
+	return
+}
@@ -0,0 +1,45 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShiftWorkedDuration(t *testing.T) {
+	clockIn := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := clockIn.Add(d)
+		return &t
+	}
+
+	t.Run("closed shift", func(t *testing.T) {
+		shift := models.Shift{
+			ClockInAt:  clockIn,
+			ClockOutAt: at(8 * time.Hour),
+			Breaks: []models.ShiftBreak{
+				{StartedAt: *at(3 * time.Hour), EndedAt: at(3*time.Hour + 30*time.Minute)},
+			},
+		}
+		now := clockIn.Add(24 * time.Hour)
+
+		assert.Equal(t, 30*time.Minute, shift.BreakDuration(now))
+		assert.Equal(t, 7*time.Hour+30*time.Minute, shift.WorkedDuration(now))
+	})
+
+	t.Run("open shift with break in progress", func(t *testing.T) {
+		shift := models.Shift{
+			ClockInAt: clockIn,
+			Breaks: []models.ShiftBreak{
+				{StartedAt: *at(2 * time.Hour)},
+			},
+		}
+		now := clockIn.Add(2*time.Hour + 15*time.Minute)
+
+		assert.NotNil(t, shift.OpenBreak())
+		assert.Equal(t, 15*time.Minute, shift.BreakDuration(now))
+		assert.Equal(t, 2*time.Hour, shift.WorkedDuration(now))
+	})
+}
@@ -0,0 +1,171 @@
+// Package pickup schedules takeaway and delivery orders in pickup slots. Slots follow the opening hours
+// of restaurants and hold a limited number of orders so that the kitchen isn't overloaded.
+package pickup
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/roushou/pocpoc/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSlotUnavailable = errors.New("pickup time is not in an available slot")
+	ErrSlotFull        = errors.New("pickup slot is full")
+	ErrNoSlot          = errors.New("no pickup slot available")
+)
+
+// searchDays is the number of days after today searched for the next available slot.
+const searchDays = 7
+
+// Slot is a period orders are scheduled in.
+type Slot struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Booked int       `json:"booked"`
+	// Remaining is the number of orders that can still be scheduled in the slot, -1 when unlimited.
+	Remaining int `json:"remaining"`
+}
+
+// IsAvailable reports whether orders can still be scheduled in the slot.
+func (s Slot) IsAvailable() bool {
+	return s.Remaining != 0
+}
+
+// Slots returns the slots starting on the date in the restaurant time zone, during its opening hours
+// and no sooner than its lead time from now. Restaurants without opening hours are open all day.
+func Slots(restaurant *models.Restaurant, date time.Time, now time.Time) []Slot {
+	location := restaurant.Location()
+	year, month, day := date.In(location).Date()
+	dayStart := time.Date(year, month, day, 0, 0, 0, 0, location)
+	dayEnd := time.Date(year, month, day+1, 0, 0, 0, 0, location)
+	earliest := now.Add(restaurant.Pickup.LeadTime())
+	duration := restaurant.Pickup.SlotDuration()
+
+	starts := make(map[time.Time]time.Time)
+	addRange := func(opens, closes time.Time) {
+		for start := opens; !start.Add(duration).After(closes); start = start.Add(duration) {
+			if start.Before(dayStart) || !start.Before(dayEnd) || start.Before(earliest) {
+				continue
+			}
+			starts[start.UTC()] = start.Add(duration).UTC()
+		}
+	}
+
+	if len(restaurant.OpeningHours) == 0 {
+		addRange(dayStart, dayEnd)
+	}
+	// Ranges of the previous day can end after midnight
+	for _, offset := range []int{-1, 0} {
+		rangeDay := time.Date(year, month, day+offset, 0, 0, 0, 0, location)
+		for _, hours := range restaurant.OpeningHours {
+			if hours.Weekday != rangeDay.Weekday() {
+				continue
+			}
+			opens, err := atClock(rangeDay, hours.Opens)
+			if err != nil {
+				continue
+			}
+			closes, err := atClock(rangeDay, hours.Closes)
+			if err != nil {
+				continue
+			}
+			if !closes.After(opens) {
+				closes = atNextDay(rangeDay, hours.Closes, closes)
+			}
+			addRange(opens, closes)
+		}
+	}
+
+	slots := make([]Slot, 0, len(starts))
+	for start, end := range starts {
+		slots = append(slots, Slot{Start: start, End: end, Remaining: -1})
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Start.Before(slots[j].Start) })
+	return slots
+}
+
+// atClock returns the time of the day at the "15:04" clock time.
+func atClock(day time.Time, clock string) (time.Time, error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), parsed.Hour(), parsed.Minute(), 0, 0, day.Location()), nil
+}
+
+// atNextDay returns the clock time on the day after day.
+func atNextDay(day time.Time, clock string, fallback time.Time) time.Time {
+	next, err := atClock(day.AddDate(0, 0, 1), clock)
+	if err != nil {
+		return fallback
+	}
+	return next
+}
+
+// Availability returns the slots of the date with the orders already scheduled in them.
+func Availability(tx *gorm.DB, restaurant *models.Restaurant, date time.Time, now time.Time) ([]Slot, error) {
+	slots := Slots(restaurant, date, now)
+	if len(slots) == 0 {
+		return slots, nil
+	}
+
+	pickups := make([]time.Time, 0)
+	if err := tx.
+		Model(&models.Order{}).
+		Where("restaurant_id = ? AND pickup_at >= ? AND pickup_at < ? AND status <> ?",
+			restaurant.ID, slots[0].Start, slots[len(slots)-1].End, models.OrderStatusCancelled).
+		Pluck("pickup_at", &pickups).Error; err != nil {
+		return nil, err
+	}
+
+	capacity := restaurant.Pickup.SlotCapacity
+	for i := range slots {
+		for _, pickup := range pickups {
+			if !pickup.Before(slots[i].Start) && pickup.Before(slots[i].End) {
+				slots[i].Booked++
+			}
+		}
+		if capacity > 0 {
+			slots[i].Remaining = max(capacity-slots[i].Booked, 0)
+		}
+	}
+	return slots, nil
+}
+
+// Book returns the start of the slot the time is in, if orders can still be scheduled in it. Orders
+// must be created in the same transaction for the capacity to hold.
+func Book(tx *gorm.DB, restaurant *models.Restaurant, at time.Time, now time.Time) (time.Time, error) {
+	slots, err := Availability(tx, restaurant, at, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, slot := range slots {
+		if at.Before(slot.Start) || !at.Before(slot.End) {
+			continue
+		}
+		if !slot.IsAvailable() {
+			return time.Time{}, ErrSlotFull
+		}
+		return slot.Start, nil
+	}
+	return time.Time{}, ErrSlotUnavailable
+}
+
+// Next returns the start of the first slot orders can be scheduled in.
+func Next(tx *gorm.DB, restaurant *models.Restaurant, now time.Time) (time.Time, error) {
+	for day := 0; day <= searchDays; day++ {
+		slots, err := Availability(tx, restaurant, now.In(restaurant.Location()).AddDate(0, 0, day), now)
+		if err != nil {
+			return time.Time{}, err
+		}
+		for _, slot := range slots {
+			if slot.IsAvailable() {
+				return slot.Start, nil
+			}
+		}
+	}
+	return time.Time{}, ErrNoSlot
+}
@@ -0,0 +1,119 @@
+package pickup_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/database/databasetest"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/pickup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func at(day, hour, minute int) time.Time {
+	return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+}
+
+func starts(slots []pickup.Slot) []time.Time {
+	result := make([]time.Time, 0, len(slots))
+	for _, slot := range slots {
+		result = append(result, slot.Start)
+	}
+	return result
+}
+
+func TestSlots(t *testing.T) {
+	restaurant := &models.Restaurant{
+		TimeZone: "UTC",
+		OpeningHours: []models.OpeningHours{
+			{Weekday: time.Monday, Opens: "11:00", Closes: "14:00"},
+			{Weekday: time.Friday, Opens: "22:00", Closes: "01:00"},
+		},
+		Pickup: models.PickupRules{SlotMinutes: 30, LeadMinutes: 15},
+	}
+
+	tests := []struct {
+		name   string
+		date   time.Time
+		now    time.Time
+		starts []time.Time
+	}{
+		{
+			name:   "lead time",
+			date:   at(19, 0, 0),
+			now:    at(19, 11, 20),
+			starts: []time.Time{at(19, 12, 0), at(19, 12, 30), at(19, 13, 0), at(19, 13, 30)},
+		},
+		{
+			name:   "closes after midnight",
+			date:   at(23, 0, 0),
+			now:    at(19, 0, 0),
+			starts: []time.Time{at(23, 22, 0), at(23, 22, 30), at(23, 23, 0), at(23, 23, 30)},
+		},
+		{
+			name:   "opened the previous day",
+			date:   at(24, 0, 0),
+			now:    at(19, 0, 0),
+			starts: []time.Time{at(24, 0, 0), at(24, 0, 30)},
+		},
+		{
+			name:   "closed",
+			date:   at(20, 0, 0),
+			now:    at(19, 0, 0),
+			starts: []time.Time{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.starts, starts(pickup.Slots(restaurant, tt.date, tt.now)))
+		})
+	}
+}
+
+func TestBook(t *testing.T) {
+	db := databasetest.New(t)
+	restaurant := &models.Restaurant{
+		ID:       uuid.New(),
+		TimeZone: "UTC",
+		OpeningHours: []models.OpeningHours{
+			{Weekday: time.Monday, Opens: "11:00", Closes: "14:00"},
+		},
+		Pickup: models.PickupRules{SlotMinutes: 30, SlotCapacity: 2, LeadMinutes: 15},
+	}
+	now := at(19, 11, 20)
+
+	start, err := pickup.Book(db, restaurant, at(19, 12, 10), now)
+	require.NoError(t, err)
+	assert.Equal(t, at(19, 12, 0), start)
+
+	for _, status := range []models.OrderStatus{models.OrderStatusPending, models.OrderStatusCancelled, models.OrderStatusPending} {
+		order := &models.Order{RestaurantID: restaurant.ID, Status: status, Type: models.OrderTypeTakeaway, PickupAt: &start}
+		require.NoError(t, db.Create(order).Error)
+	}
+
+	slots, err := pickup.Availability(db, restaurant, now, now)
+	require.NoError(t, err)
+	require.Len(t, slots, 4)
+	assert.Equal(t, 2, slots[0].Booked)
+	assert.Equal(t, 0, slots[0].Remaining)
+	assert.Equal(t, 2, slots[1].Remaining)
+
+	_, err = pickup.Book(db, restaurant, at(19, 12, 10), now)
+	assert.ErrorIs(t, err, pickup.ErrSlotFull)
+	_, err = pickup.Book(db, restaurant, at(19, 11, 30), now)
+	assert.ErrorIs(t, err, pickup.ErrSlotUnavailable)
+	_, err = pickup.Book(db, restaurant, at(20, 12, 0), now)
+	assert.ErrorIs(t, err, pickup.ErrSlotUnavailable)
+
+	next, err := pickup.Next(db, restaurant, now)
+	require.NoError(t, err)
+	assert.Equal(t, at(19, 12, 30), next)
+
+	// The next slot is on the following opening day
+	next, err = pickup.Next(db, restaurant, at(19, 14, 0))
+	require.NoError(t, err)
+	assert.Equal(t, at(26, 11, 0), next)
+}
@@ -0,0 +1,115 @@
+// Package printing queues print jobs for the network printers of restaurants and sends them.
+package printing
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/receipt"
+	"gorm.io/gorm"
+)
+
+// loadOrderContext loads what is printed about an order besides the order itself: its restaurant and
+// the staff member who took it, who may have been deleted since.
+func loadOrderContext(tx *gorm.DB, order *models.Order) (*models.Restaurant, *models.Staff, error) {
+	restaurant := &models.Restaurant{}
+	if err := tx.First(restaurant, "id = ?", order.RestaurantID).Error; err != nil {
+		return nil, nil, err
+	}
+	staff := &models.Staff{}
+	if err := tx.Unscoped().First(staff, "id = ?", order.StaffID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, err
+		}
+		staff = nil
+	}
+	return restaurant, staff, nil
+}
+
+func newJob(tx *gorm.DB, printer *models.Printer, order *models.Order, kind models.PrintJobKind, data []byte) *models.PrintJob {
+	return &models.PrintJob{
+		RestaurantID:  printer.RestaurantID,
+		PrinterID:     printer.ID,
+		OrderID:       &order.ID,
+		Kind:          kind,
+		Status:        models.PrintJobStatusPending,
+		Data:          data,
+		NextAttemptAt: tx.NowFunc(),
+	}
+}
+
+// EnqueueKitchenTickets queues the ticket of the order for every kitchen printer of its restaurant.
+func EnqueueKitchenTickets(tx *gorm.DB, order *models.Order) ([]models.PrintJob, error) {
+	printers := make([]models.Printer, 0)
+	if err := tx.
+		Where("restaurant_id = ? AND kind = ?", order.RestaurantID, models.PrinterKindKitchen).
+		Find(&printers).Error; err != nil {
+		return nil, err
+	}
+	if len(printers) == 0 {
+		return nil, nil
+	}
+
+	items := make([]models.OrderItem, 0)
+	if err := tx.Preload("Product").Where("order_id = ?", order.ID).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	restaurant, staff, err := loadOrderContext(tx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	ticketOrder := *order
+	ticketOrder.OrderItems = items
+	var buf bytes.Buffer
+	if err := receipt.NewKitchenTicket(&ticketOrder, restaurant, staff, tx.NowFunc()).RenderESCPOS(&buf); err != nil {
+		return nil, err
+	}
+
+	jobs := make([]models.PrintJob, 0, len(printers))
+	for _, printer := range printers {
+		jobs = append(jobs, *newJob(tx, &printer, order, models.PrintJobKindKitchenTicket, buf.Bytes()))
+	}
+	if err := tx.Create(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// EnqueueReceipt queues the receipt of the order for the printer. The order must be loaded with its
+// items, their product, and its payments.
+func EnqueueReceipt(tx *gorm.DB, order *models.Order, printer *models.Printer) (*models.PrintJob, error) {
+	restaurant, staff, err := loadOrderContext(tx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := receipt.New(order, restaurant, staff, tx.NowFunc()).RenderESCPOS(&buf); err != nil {
+		return nil, err
+	}
+
+	job := newJob(tx, printer, order, models.PrintJobKindReceipt, buf.Bytes())
+	if err := tx.Create(job).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Reprint queues the data of a job again, on the same printer.
+func Reprint(tx *gorm.DB, job *models.PrintJob) (*models.PrintJob, error) {
+	reprint := &models.PrintJob{
+		RestaurantID:  job.RestaurantID,
+		PrinterID:     job.PrinterID,
+		OrderID:       job.OrderID,
+		Kind:          job.Kind,
+		Status:        models.PrintJobStatusPending,
+		Data:          job.Data,
+		NextAttemptAt: tx.NowFunc(),
+	}
+	if err := tx.Create(reprint).Error; err != nil {
+		return nil, err
+	}
+	return reprint, nil
+}
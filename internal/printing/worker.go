@@ -0,0 +1,250 @@
+package printing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPollInterval  = 2 * time.Second
+	defaultMaxAttempts   = 10
+	defaultRetryDelay    = 5 * time.Second
+	defaultMaxRetryDelay = 5 * time.Minute
+	defaultTimeout       = 5 * time.Second
+	defaultBatchSize     = 50
+)
+
+// Option defines the function signature for worker options.
+type Option func(options *options) error
+
+type options struct {
+	pollInterval time.Duration
+	maxAttempts  int
+	retryDelay   time.Duration
+	timeout      time.Duration
+}
+
+// WithPollInterval sets how often the worker looks for jobs to print.
+func WithPollInterval(interval time.Duration) Option {
+	return func(options *options) error {
+		if interval <= 0 {
+			return errors.New("poll interval should be positive")
+		}
+		options.pollInterval = interval
+		return nil
+	}
+}
+
+// WithMaxAttempts sets the number of attempts after which a job is marked as failed.
+func WithMaxAttempts(attempts int) Option {
+	return func(options *options) error {
+		if attempts < 1 {
+			return errors.New("max attempts should be at least 1")
+		}
+		options.maxAttempts = attempts
+		return nil
+	}
+}
+
+// WithRetryDelay sets the delay before the first retry of a job. The delay doubles on each retry.
+func WithRetryDelay(delay time.Duration) Option {
+	return func(options *options) error {
+		if delay < 0 {
+			return errors.New("retry delay should not be negative")
+		}
+		options.retryDelay = delay
+		return nil
+	}
+}
+
+// WithTimeout sets the timeout for connecting to a printer and sending it a job.
+func WithTimeout(timeout time.Duration) Option {
+	return func(options *options) error {
+		if timeout <= 0 {
+			return errors.New("timeout should be positive")
+		}
+		options.timeout = timeout
+		return nil
+	}
+}
+
+// Worker sends queued jobs to printers over raw TCP connections.
+type Worker struct {
+	db           *gorm.DB
+	pollInterval time.Duration
+	maxAttempts  int
+	retryDelay   time.Duration
+	timeout      time.Duration
+}
+
+// NewWorker initializes a worker sending the jobs queued in the database.
+func NewWorker(db *gorm.DB, opts ...Option) (*Worker, error) {
+	options := &options{
+		pollInterval: defaultPollInterval,
+		maxAttempts:  defaultMaxAttempts,
+		retryDelay:   defaultRetryDelay,
+		timeout:      defaultTimeout,
+	}
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			return nil, err
+		}
+	}
+	return &Worker{
+		db:           db,
+		pollInterval: options.pollInterval,
+		maxAttempts:  options.maxAttempts,
+		retryDelay:   options.retryDelay,
+		timeout:      options.timeout,
+	}, nil
+}
+
+// Run sends due jobs until the context is cancelled. Jobs left printing by a previous run, which
+// stopped while sending them, are sent again.
+func (w *Worker) Run(ctx context.Context) error {
+	if err := w.db.WithContext(ctx).
+		Model(&models.PrintJob{}).
+		Where("status = ?", models.PrintJobStatusPrinting).
+		Update("status", models.PrintJobStatusPending).Error; err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.ProcessDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("failed to process print jobs: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue sends the jobs due for an attempt, oldest first, and returns how many were printed. Jobs
+// of a printer print in order: they wait while an older job of the printer is waiting for its retry
+// or being printed, and once a job fails the following ones wait for the next run.
+func (w *Worker) ProcessDue(ctx context.Context) (int, error) {
+	db := w.db.WithContext(ctx)
+	now := db.NowFunc()
+
+	// Job IDs are time ordered, the older jobs of a printer have lower IDs
+	blocked := db.
+		Table("print_jobs AS older").
+		Select("1").
+		Where("older.printer_id = print_jobs.printer_id AND older.id < print_jobs.id AND older.deleted_at IS NULL").
+		Where("older.status = ? OR (older.status = ? AND older.next_attempt_at > ?)", models.PrintJobStatusPrinting, models.PrintJobStatusPending, now)
+
+	jobs := make([]models.PrintJob, 0)
+	if err := db.
+		Preload("Printer").
+		Where("status = ? AND next_attempt_at <= ?", models.PrintJobStatusPending, now).
+		Where("NOT EXISTS (?)", blocked).
+		Order("id").
+		Limit(defaultBatchSize).
+		Find(&jobs).Error; err != nil {
+		return 0, err
+	}
+
+	printed := 0
+	failedPrinters := make(map[uuid.UUID]bool)
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return printed, ctx.Err()
+		}
+		if failedPrinters[job.PrinterID] {
+			continue
+		}
+
+		// Claim the job, another worker may have taken it
+		claim := db.
+			Model(&models.PrintJob{}).
+			Where("id = ? AND status = ?", job.ID, models.PrintJobStatusPending).
+			Update("status", models.PrintJobStatusPrinting)
+		if claim.Error != nil {
+			return printed, claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			continue
+		}
+
+		err := w.send(ctx, &job)
+		if err := w.complete(db, &job, err); err != nil {
+			return printed, err
+		}
+		if err != nil {
+			failedPrinters[job.PrinterID] = true
+			continue
+		}
+		printed++
+	}
+	return printed, nil
+}
+
+// send writes the data of the job to its printer.
+func (w *Worker) send(ctx context.Context, job *models.PrintJob) error {
+	// Deleted printers are not preloaded
+	if job.Printer.ID == uuid.Nil {
+		return errors.New("printer was removed")
+	}
+
+	dialer := net.Dialer{Timeout: w.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", job.Printer.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(w.timeout)); err != nil {
+		return err
+	}
+	if _, err := conn.Write(job.Data); err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// complete records the outcome of an attempt to print the job.
+func (w *Worker) complete(db *gorm.DB, job *models.PrintJob, sendErr error) error {
+	now := db.NowFunc()
+	job.Attempts++
+	updates := map[string]any{"attempts": job.Attempts}
+
+	switch {
+	case sendErr == nil:
+		job.Status = models.PrintJobStatusPrinted
+		job.PrintedAt = &now
+		job.LastError = ""
+		updates["printed_at"] = now
+	case job.Attempts >= w.maxAttempts:
+		job.Status = models.PrintJobStatusFailed
+		job.LastError = sendErr.Error()
+	default:
+		job.Status = models.PrintJobStatusPending
+		job.LastError = sendErr.Error()
+		job.NextAttemptAt = now.Add(w.backoff(job.Attempts))
+		updates["next_attempt_at"] = job.NextAttemptAt
+	}
+	updates["status"] = job.Status
+	updates["last_error"] = job.LastError
+
+	return db.Model(&models.PrintJob{}).Where("id = ?", job.ID).Updates(updates).Error
+}
+
+// backoff returns the delay before the next attempt, doubling with each attempt.
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.retryDelay
+	for i := 1; i < attempts && delay < defaultMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, defaultMaxRetryDelay)
+}
@@ -0,0 +1,199 @@
+package printing_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/database/databasetest"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/printing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakePrinter accepts raw print jobs over TCP like a port 9100 printer.
+type fakePrinter struct {
+	listener net.Listener
+	jobs     chan []byte
+}
+
+func newFakePrinter(t *testing.T) *fakePrinter {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	printer := &fakePrinter{listener: listener, jobs: make(chan []byte, 10)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			data, _ := io.ReadAll(conn)
+			conn.Close()
+			printer.jobs <- data
+		}
+	}()
+	return printer
+}
+
+func (p *fakePrinter) addr() string {
+	return p.listener.Addr().String()
+}
+
+// offlineAddr returns the address of a port nothing listens on.
+func offlineAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+	return addr
+}
+
+func newJob(t *testing.T, db *gorm.DB, printerAddr string, data string) *models.PrintJob {
+	printer := &models.Printer{Name: "Kitchen", Kind: models.PrinterKindKitchen, Address: printerAddr}
+	require.NoError(t, db.Create(printer).Error)
+	return queueJob(t, db, printer.ID, data)
+}
+
+// queueJob adds a job due now to the queue of the printer.
+func queueJob(t *testing.T, db *gorm.DB, printerID uuid.UUID, data string) *models.PrintJob {
+	job := &models.PrintJob{
+		PrinterID:     printerID,
+		Kind:          models.PrintJobKindKitchenTicket,
+		Status:        models.PrintJobStatusPending,
+		Data:          []byte(data),
+		NextAttemptAt: db.NowFunc(),
+	}
+	require.NoError(t, db.Create(job).Error)
+	return job
+}
+
+func reload(t *testing.T, db *gorm.DB, job *models.PrintJob) *models.PrintJob {
+	reloaded := &models.PrintJob{}
+	require.NoError(t, db.First(reloaded, "id = ?", job.ID).Error)
+	return reloaded
+}
+
+func TestWorkerPrints(t *testing.T) {
+	db := databasetest.New(t)
+	printer := newFakePrinter(t)
+	job := newJob(t, db, printer.addr(), "ticket")
+
+	worker, err := printing.NewWorker(db, printing.WithTimeout(time.Second))
+	require.NoError(t, err)
+
+	printed, err := worker.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, printed)
+
+	select {
+	case data := <-printer.jobs:
+		assert.Equal(t, "ticket", string(data))
+	case <-time.After(time.Second):
+		t.Fatal("printer received nothing")
+	}
+
+	job = reload(t, db, job)
+	assert.Equal(t, models.PrintJobStatusPrinted, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.NotNil(t, job.PrintedAt)
+}
+
+func TestWorkerRetries(t *testing.T) {
+	db := databasetest.New(t)
+	job := newJob(t, db, offlineAddr(t), "ticket")
+
+	worker, err := printing.NewWorker(db,
+		printing.WithTimeout(time.Second),
+		printing.WithRetryDelay(0),
+		printing.WithMaxAttempts(2),
+	)
+	require.NoError(t, err)
+
+	printed, err := worker.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, printed)
+
+	job = reload(t, db, job)
+	assert.Equal(t, models.PrintJobStatusPending, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.NotEmpty(t, job.LastError)
+
+	// The printer comes back online
+	printer := newFakePrinter(t)
+	require.NoError(t, db.Model(&models.Printer{}).Where("id = ?", job.PrinterID).Update("address", printer.addr()).Error)
+
+	printed, err = worker.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, printed)
+
+	job = reload(t, db, job)
+	assert.Equal(t, models.PrintJobStatusPrinted, job.Status)
+	assert.Equal(t, 2, job.Attempts)
+	assert.Empty(t, job.LastError)
+}
+
+func TestWorkerGivesUp(t *testing.T) {
+	db := databasetest.New(t)
+	job := newJob(t, db, offlineAddr(t), "ticket")
+
+	worker, err := printing.NewWorker(db,
+		printing.WithTimeout(time.Second),
+		printing.WithRetryDelay(0),
+		printing.WithMaxAttempts(2),
+	)
+	require.NoError(t, err)
+
+	for range 3 {
+		_, err := worker.ProcessDue(context.Background())
+		require.NoError(t, err)
+	}
+
+	job = reload(t, db, job)
+	assert.Equal(t, models.PrintJobStatusFailed, job.Status)
+	assert.Equal(t, 2, job.Attempts)
+}
+
+func TestWorkerPrintsInOrder(t *testing.T) {
+	db := databasetest.New(t)
+	first := newJob(t, db, offlineAddr(t), "first")
+
+	worker, err := printing.NewWorker(db,
+		printing.WithTimeout(time.Second),
+		printing.WithRetryDelay(time.Hour),
+	)
+	require.NoError(t, err)
+
+	_, err = worker.ProcessDue(context.Background())
+	require.NoError(t, err)
+
+	// The printer comes back online while the first job waits for its retry
+	printer := newFakePrinter(t)
+	require.NoError(t, db.Model(&models.Printer{}).Where("id = ?", first.PrinterID).Update("address", printer.addr()).Error)
+	second := queueJob(t, db, first.PrinterID, "second")
+
+	printed, err := worker.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, printed)
+	assert.Equal(t, models.PrintJobStatusPending, reload(t, db, second).Status)
+
+	require.NoError(t, db.Model(&models.PrintJob{}).Where("id = ?", first.ID).Update("next_attempt_at", db.NowFunc()).Error)
+	printed, err = worker.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, printed)
+
+	for _, expected := range []string{"first", "second"} {
+		select {
+		case data := <-printer.jobs:
+			assert.Equal(t, expected, string(data))
+		case <-time.After(time.Second):
+			t.Fatal("printer received nothing")
+		}
+	}
+}
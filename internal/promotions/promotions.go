@@ -0,0 +1,306 @@
+// Package promotions prices orders with the promotions of their restaurant, automatic deals and
+// coupons. Evaluating an order explains which promotions applied and why the others didn't, applying
+// them records redemptions counting towards the usage limits of the promotions.
+package promotions
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrUnknownCoupon = errors.New("unknown coupon code")
+
+// Outcome is the result of evaluating a promotion on an order.
+type Outcome struct {
+	PromotionID uuid.UUID            `json:"promotion_id"`
+	Name        string               `json:"name"`
+	Kind        models.PromotionKind `json:"kind"`
+	Code        string               `json:"code,omitempty"`
+	Applied     bool                 `json:"applied"`
+	Amount      float64              `json:"amount"`
+	// Reason explains why the promotion applied, or why it didn't.
+	Reason string `json:"reason"`
+}
+
+// Result is the evaluation of the promotions of a restaurant on an order.
+type Result struct {
+	// Discount is the sum of the applied promotions, it never exceeds the amount of the items.
+	Discount   float64   `json:"discount"`
+	Promotions []Outcome `json:"promotions"`
+}
+
+// NormalizeCode returns the code as stored on promotions. Codes are case-insensitive.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// FindCoupon returns the promotion of the restaurant with the coupon code.
+func FindCoupon(tx *gorm.DB, restaurantID uuid.UUID, code string) (*models.Promotion, error) {
+	code = NormalizeCode(code)
+	if code == "" {
+		return nil, ErrUnknownCoupon
+	}
+	promotion := &models.Promotion{}
+	if err := tx.First(promotion, "restaurant_id = ? AND code = ?", restaurantID, code).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnknownCoupon
+		}
+		return nil, err
+	}
+	return promotion, nil
+}
+
+// Evaluate returns the promotions of the restaurant applying to the order and why the others don't,
+// without recording anything. Automatic promotions are evaluated with the coupon of the order, they
+// are applied in the order they were created until the items are fully discounted.
+func Evaluate(tx *gorm.DB, restaurant *models.Restaurant, order *models.Order, now time.Time) (*Result, error) {
+	query := tx.Where("restaurant_id = ?", restaurant.ID)
+	if order.CouponCode != "" {
+		query = query.Where("code = '' OR code = ?", order.CouponCode)
+	} else {
+		query = query.Where("code = ''")
+	}
+	promotions := make([]models.Promotion, 0)
+	if err := query.Order("created_at, id").Find(&promotions).Error; err != nil {
+		return nil, err
+	}
+
+	result := &Result{Promotions: make([]Outcome, 0, len(promotions))}
+	if order.CouponCode != "" && !hasCoupon(promotions, order.CouponCode) {
+		// The coupon was removed since it was applied to the order
+		result.Promotions = append(result.Promotions, Outcome{Code: order.CouponCode, Reason: "unknown coupon code"})
+	}
+	if len(promotions) == 0 {
+		return result, nil
+	}
+
+	categories, err := productCategories(tx, order.OrderItems)
+	if err != nil {
+		return nil, err
+	}
+
+	subtotal := models.CalculateTotalAmount(order.OrderItems)
+	remaining := subtotal
+	for _, promotion := range promotions {
+		outcome := Outcome{
+			PromotionID: promotion.ID,
+			Name:        promotion.Name,
+			Kind:        promotion.Kind,
+			Code:        promotion.Code,
+		}
+
+		reason, err := checkConditions(tx, restaurant, order, &promotion, subtotal, now)
+		if err != nil {
+			return nil, err
+		}
+		if reason == "" {
+			outcome.Amount, reason = discount(&promotion, eligibleItems(&promotion, order.OrderItems, categories))
+		}
+		if outcome.Amount > remaining {
+			outcome.Amount = models.RoundAmount(remaining)
+			if outcome.Amount == 0 {
+				reason = "order is already fully discounted"
+			}
+		}
+		outcome.Applied = outcome.Amount > 0
+		outcome.Reason = reason
+
+		remaining = models.RoundAmount(remaining - outcome.Amount)
+		result.Discount = models.RoundAmount(result.Discount + outcome.Amount)
+		result.Promotions = append(result.Promotions, outcome)
+	}
+	return result, nil
+}
+
+func hasCoupon(promotions []models.Promotion, code string) bool {
+	for _, promotion := range promotions {
+		if promotion.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConditions returns why the promotion can't apply to the order, or an empty string if it can.
+func checkConditions(tx *gorm.DB, restaurant *models.Restaurant, order *models.Order, promotion *models.Promotion, subtotal float64, now time.Time) (string, error) {
+	location := restaurant.Location()
+	if promotion.StartsAt != nil && now.Before(*promotion.StartsAt) {
+		return "starts on " + promotion.StartsAt.In(location).Format(time.DateTime), nil
+	}
+	if promotion.EndsAt != nil && !now.Before(*promotion.EndsAt) {
+		return "ended on " + promotion.EndsAt.In(location).Format(time.DateTime), nil
+	}
+	if len(promotion.Weekdays) > 0 {
+		weekday := now.In(location).Weekday()
+		valid := false
+		for _, day := range promotion.Weekdays {
+			valid = valid || day == weekday
+		}
+		if !valid {
+			return "not valid on " + weekday.String(), nil
+		}
+	}
+	if subtotal < promotion.MinSubtotal {
+		return fmt.Sprintf("order subtotal %.2f is below %.2f", subtotal, promotion.MinSubtotal), nil
+	}
+
+	// Redemptions of the order itself are replaced when it is priced again
+	if promotion.MaxUses > 0 {
+		var uses int64
+		if err := tx.
+			Model(&models.PromotionRedemption{}).
+			Where("promotion_id = ? AND order_id <> ?", promotion.ID, order.ID).
+			Count(&uses).Error; err != nil {
+			return "", err
+		}
+		if uses >= int64(promotion.MaxUses) {
+			return "usage limit reached", nil
+		}
+	}
+	if promotion.MaxUsesPerCustomer > 0 {
+		if order.CustomerID == nil {
+			return "order has no customer", nil
+		}
+		var uses int64
+		if err := tx.
+			Model(&models.PromotionRedemption{}).
+			Where("promotion_id = ? AND customer_id = ? AND order_id <> ?", promotion.ID, *order.CustomerID, order.ID).
+			Count(&uses).Error; err != nil {
+			return "", err
+		}
+		if uses >= int64(promotion.MaxUsesPerCustomer) {
+			return "customer usage limit reached", nil
+		}
+	}
+	return "", nil
+}
+
+// productCategories returns the category of the products of the items.
+func productCategories(tx *gorm.DB, items []models.OrderItem) (map[uuid.UUID]string, error) {
+	productIDs := make([]uuid.UUID, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+	categories := make(map[uuid.UUID]string, len(productIDs))
+	if len(productIDs) == 0 {
+		return categories, nil
+	}
+
+	products := make([]models.Product, 0, len(productIDs))
+	if err := tx.Unscoped().Select("id", "category").Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	for _, product := range products {
+		categories[product.ID] = product.Category
+	}
+	return categories, nil
+}
+
+// eligibleItems returns the items the promotion applies to, cheapest first.
+func eligibleItems(promotion *models.Promotion, items []models.OrderItem, categories map[uuid.UUID]string) []models.OrderItem {
+	eligible := make([]models.OrderItem, 0, len(items))
+	for _, item := range items {
+		if promotion.ProductID != nil && item.ProductID != *promotion.ProductID {
+			continue
+		}
+		if promotion.Category != "" && !strings.EqualFold(categories[item.ProductID], promotion.Category) {
+			continue
+		}
+		eligible = append(eligible, item)
+	}
+	sort.SliceStable(eligible, func(i, j int) bool { return eligible[i].UnitPrice < eligible[j].UnitPrice })
+	return eligible
+}
+
+// discount returns the discount the promotion gives on the eligible items, and why.
+func discount(promotion *models.Promotion, eligible []models.OrderItem) (float64, string) {
+	var quantity uint64
+	for _, item := range eligible {
+		quantity += uint64(item.Quantity)
+	}
+	if quantity == 0 {
+		return 0, "no eligible items"
+	}
+	eligibleAmount := models.CalculateTotalAmount(eligible)
+
+	switch promotion.Kind {
+	case models.PromotionKindBuyXGetY:
+		group := uint64(promotion.BuyQuantity + promotion.GetQuantity)
+		if promotion.BuyQuantity <= 0 || promotion.GetQuantity <= 0 || quantity < group {
+			return 0, fmt.Sprintf("needs %d eligible items", group)
+		}
+		free := quantity / group * uint64(promotion.GetQuantity)
+		amount := 0.0
+		for _, item := range eligible {
+			units := min(free, uint64(item.Quantity))
+			amount += float64(units) * item.UnitPrice
+			free -= units
+			if free == 0 {
+				break
+			}
+		}
+		units := quantity / group * uint64(promotion.GetQuantity)
+		return models.RoundAmount(amount), fmt.Sprintf("buy %d get %d: %d free items", promotion.BuyQuantity, promotion.GetQuantity, units)
+	case models.PromotionKindPercentage:
+		amount := models.RoundAmount(eligibleAmount * promotion.Percentage / 100)
+		return amount, fmt.Sprintf("%g%% off %.2f of eligible items", promotion.Percentage, eligibleAmount)
+	case models.PromotionKindFixedAmount:
+		amount := models.RoundAmount(min(promotion.Amount, eligibleAmount))
+		return amount, fmt.Sprintf("%.2f off", amount)
+	}
+	return 0, "unknown promotion kind"
+}
+
+// Apply prices the order with the promotions applying to it, replacing the redemptions recorded when
+// it was last priced. The discount from loyalty points is kept.
+func Apply(tx *gorm.DB, restaurant *models.Restaurant, order *models.Order, now time.Time) (*Result, error) {
+	result, err := Evaluate(tx, restaurant, order, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Release(tx, order); err != nil {
+		return nil, err
+	}
+	for _, outcome := range result.Promotions {
+		if !outcome.Applied {
+			continue
+		}
+		redemption := &models.PromotionRedemption{
+			PromotionID: outcome.PromotionID,
+			OrderID:     order.ID,
+			CustomerID:  order.CustomerID,
+			Amount:      outcome.Amount,
+		}
+		if err := tx.Create(redemption).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	loyaltyDiscount := models.RoundAmount(order.DiscountAmount - order.PromotionDiscount)
+	order.PromotionDiscount = result.Discount
+	order.DiscountAmount = models.RoundAmount(loyaltyDiscount + result.Discount)
+	order.UpdateTotals(restaurant.TaxRate)
+	if err := tx.
+		Model(order).
+		Omit(clause.Associations).
+		Select("coupon_code", "promotion_discount", "discount_amount", "total_amount", "tax_amount").
+		Updates(order).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Release removes the redemptions of the order, e.g. once it is cancelled, so that they no longer
+// count towards usage limits.
+func Release(tx *gorm.DB, order *models.Order) error {
+	return tx.Where("order_id = ?", order.ID).Delete(&models.PromotionRedemption{}).Error
+}
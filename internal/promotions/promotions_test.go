@@ -0,0 +1,303 @@
+package promotions_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/database/databasetest"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/promotions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fixture is a restaurant in Paris with an order of 2 ramen at 12, 3 gyoza at 6 and a beer at 5.
+type fixture struct {
+	restaurant *models.Restaurant
+	ramen      *models.Product
+	gyoza      *models.Product
+	beer       *models.Product
+}
+
+func newFixture(t *testing.T, db *gorm.DB) *fixture {
+	restaurant := &models.Restaurant{Name: "r", OwnerID: uuid.New(), TaxRate: 10, TimeZone: "Europe/Paris"}
+	require.NoError(t, db.Create(restaurant).Error)
+
+	f := &fixture{restaurant: restaurant}
+	for _, product := range []**models.Product{&f.ramen, &f.gyoza, &f.beer} {
+		*product = &models.Product{RestaurantID: restaurant.ID, Available: true}
+	}
+	f.ramen.Title, f.ramen.Category, f.ramen.UnitPrice = "Ramen", "Mains", 12
+	f.gyoza.Title, f.gyoza.Category, f.gyoza.UnitPrice = "Gyoza", "Sides", 6
+	f.beer.Title, f.beer.Category, f.beer.UnitPrice = "Beer", "Drinks", 5
+	for _, product := range []*models.Product{f.ramen, f.gyoza, f.beer} {
+		require.NoError(t, db.Create(product).Error)
+	}
+	return f
+}
+
+func (f *fixture) newOrder(t *testing.T, db *gorm.DB) *models.Order {
+	order := &models.Order{
+		RestaurantID: f.restaurant.ID,
+		Type:         models.OrderTypeDineIn,
+		Status:       models.OrderStatusPending,
+		OrderItems: []models.OrderItem{
+			{ProductID: f.ramen.ID, Quantity: 2, UnitPrice: 12},
+			{ProductID: f.gyoza.ID, Quantity: 3, UnitPrice: 6},
+			{ProductID: f.beer.ID, Quantity: 1, UnitPrice: 5},
+		},
+	}
+	order.UpdateTotals(f.restaurant.TaxRate)
+	require.NoError(t, db.Create(order).Error)
+	return order
+}
+
+func TestEvaluate(t *testing.T) {
+	// Monday evening in UTC, already Tuesday in Paris
+	now := time.Date(2026, time.October, 19, 22, 30, 0, 0, time.UTC)
+	yesterday := now.AddDate(0, 0, -1)
+	tomorrow := now.AddDate(0, 0, 1)
+
+	type outcome struct {
+		Applied bool
+		Amount  float64
+		Reason  string
+	}
+
+	tests := []struct {
+		name       string
+		promotions func(f *fixture) []models.Promotion
+		coupon     string
+		discount   float64
+		outcomes   []outcome
+	}{
+		{
+			name: "buy 2 get 1 on a product",
+			promotions: func(f *fixture) []models.Promotion {
+				return []models.Promotion{{Kind: models.PromotionKindBuyXGetY, ProductID: &f.gyoza.ID, BuyQuantity: 2, GetQuantity: 1}}
+			},
+			discount: 6,
+			outcomes: []outcome{{Applied: true, Amount: 6, Reason: "buy 2 get 1: 1 free items"}},
+		},
+		{
+			name: "cheapest items are free",
+			promotions: func(f *fixture) []models.Promotion {
+				return []models.Promotion{{Kind: models.PromotionKindBuyXGetY, BuyQuantity: 1, GetQuantity: 1}}
+			},
+			discount: 17,
+			outcomes: []outcome{{Applied: true, Amount: 17, Reason: "buy 1 get 1: 3 free items"}},
+		},
+		{
+			name: "not enough items",
+			promotions: func(f *fixture) []models.Promotion {
+				return []models.Promotion{{Kind: models.PromotionKindBuyXGetY, ProductID: &f.ramen.ID, BuyQuantity: 2, GetQuantity: 1}}
+			},
+			outcomes: []outcome{{Reason: "needs 3 eligible items"}},
+		},
+		{
+			name: "percentage of a category",
+			promotions: func(f *fixture) []models.Promotion {
+				return []models.Promotion{{Kind: models.PromotionKindPercentage, Category: "mains", Percentage: 10}}
+			},
+			discount: 2.4,
+			outcomes: []outcome{{Applied: true, Amount: 2.4, Reason: "10% off 24.00 of eligible items"}},
+		},
+		{
+			name: "no eligible items",
+			promotions: func(f *fixture) []models.Promotion {
+				return []models.Promotion{{Kind: models.PromotionKindPercentage, Category: "Desserts", Percentage: 10}}
+			},
+			outcomes: []outcome{{Reason: "no eligible items"}},
+		},
+		{
+			name: "fixed amount over a threshold",
+			promotions: func(f *fixture) []models.Promotion {
+				return []models.Promotion{
+					{Kind: models.PromotionKindFixedAmount, Amount: 5, MinSubtotal: 40},
+					{Kind: models.PromotionKindFixedAmount, Amount: 10, MinSubtotal: 50},
+				}
+			},
+			discount: 5,
+			outcomes: []outcome{
+				{Applied: true, Amount: 5, Reason: "5.00 off"},
+				{Reason: "order subtotal 47.00 is below 50.00"},
+			},
+		},
+		{
+			name: "validity window",
+			promotions: func(f *fixture) []models.Promotion {
+				return []models.Promotion{
+					{Kind: models.PromotionKindFixedAmount, Amount: 1, StartsAt: &tomorrow},
+					{Kind: models.PromotionKindFixedAmount, Amount: 1, EndsAt: &yesterday},
+					{Kind: models.PromotionKindFixedAmount, Amount: 1, StartsAt: &yesterday, EndsAt: &tomorrow},
+				}
+			},
+			discount: 1,
+			outcomes: []outcome{
+				{Reason: "starts on 2026-10-21 00:30:00"},
+				{Reason: "ended on 2026-10-19 00:30:00"},
+				{Applied: true, Amount: 1, Reason: "1.00 off"},
+			},
+		},
+		{
+			name: "weekdays in the restaurant time zone",
+			promotions: func(f *fixture) []models.Promotion {
+				return []models.Promotion{
+					{Kind: models.PromotionKindFixedAmount, Amount: 1, Weekdays: []time.Weekday{time.Monday}},
+					{Kind: models.PromotionKindFixedAmount, Amount: 2, Weekdays: []time.Weekday{time.Tuesday, time.Wednesday}},
+				}
+			},
+			discount: 2,
+			outcomes: []outcome{
+				{Reason: "not valid on Tuesday"},
+				{Applied: true, Amount: 2, Reason: "2.00 off"},
+			},
+		},
+		{
+			name: "capped to the items",
+			promotions: func(f *fixture) []models.Promotion {
+				return []models.Promotion{
+					{Kind: models.PromotionKindFixedAmount, Amount: 40},
+					{Kind: models.PromotionKindPercentage, Percentage: 50},
+					{Kind: models.PromotionKindFixedAmount, Amount: 1},
+				}
+			},
+			discount: 47,
+			outcomes: []outcome{
+				{Applied: true, Amount: 40, Reason: "40.00 off"},
+				{Applied: true, Amount: 7, Reason: "50% off 47.00 of eligible items"},
+				{Reason: "order is already fully discounted"},
+			},
+		},
+		{
+			name: "coupon",
+			promotions: func(f *fixture) []models.Promotion {
+				return []models.Promotion{
+					{Kind: models.PromotionKindFixedAmount, Amount: 3, Code: "WELCOME"},
+					{Kind: models.PromotionKindFixedAmount, Amount: 4, Code: "OTHER"},
+				}
+			},
+			coupon:   "WELCOME",
+			discount: 3,
+			outcomes: []outcome{{Applied: true, Amount: 3, Reason: "3.00 off"}},
+		},
+		{
+			name: "coupons are not automatic",
+			promotions: func(f *fixture) []models.Promotion {
+				return []models.Promotion{{Kind: models.PromotionKindFixedAmount, Amount: 3, Code: "WELCOME"}}
+			},
+			outcomes: []outcome{},
+		},
+		{
+			name: "unknown coupon",
+			promotions: func(f *fixture) []models.Promotion {
+				return []models.Promotion{}
+			},
+			coupon:   "GONE",
+			outcomes: []outcome{{Reason: "unknown coupon code"}},
+		},
+		{
+			name: "limited per customer",
+			promotions: func(f *fixture) []models.Promotion {
+				return []models.Promotion{{Kind: models.PromotionKindFixedAmount, Amount: 3, MaxUsesPerCustomer: 1}}
+			},
+			outcomes: []outcome{{Reason: "order has no customer"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := databasetest.New(t)
+			f := newFixture(t, db)
+			for _, promotion := range tt.promotions(f) {
+				promotion.RestaurantID = f.restaurant.ID
+				promotion.Name = tt.name
+				require.NoError(t, db.Create(&promotion).Error)
+			}
+			order := f.newOrder(t, db)
+			order.CouponCode = tt.coupon
+
+			result, err := promotions.Evaluate(db, f.restaurant, order, now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.discount, result.Discount)
+
+			outcomes := make([]outcome, 0, len(result.Promotions))
+			for _, promotion := range result.Promotions {
+				outcomes = append(outcomes, outcome{Applied: promotion.Applied, Amount: promotion.Amount, Reason: promotion.Reason})
+			}
+			assert.Equal(t, tt.outcomes, outcomes)
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	db := databasetest.New(t)
+	f := newFixture(t, db)
+	now := time.Now()
+
+	customer := &models.Customer{OwnerID: f.restaurant.OwnerID, Name: "Ada"}
+	require.NoError(t, db.Create(customer).Error)
+	promotion := &models.Promotion{
+		RestaurantID: f.restaurant.ID,
+		Name:         "10% off",
+		Kind:         models.PromotionKindPercentage,
+		Percentage:   10,
+		MaxUses:      1,
+	}
+	require.NoError(t, db.Create(promotion).Error)
+
+	// The discount from loyalty points is kept
+	order := f.newOrder(t, db)
+	order.CustomerID = &customer.ID
+	order.DiscountAmount = 5
+	require.NoError(t, db.Model(order).Select("customer_id", "discount_amount").Updates(order).Error)
+
+	for range 2 {
+		result, err := promotions.Apply(db, f.restaurant, order, now)
+		require.NoError(t, err)
+		assert.Equal(t, 4.7, result.Discount)
+	}
+	reloaded := &models.Order{}
+	require.NoError(t, db.First(reloaded, "id = ?", order.ID).Error)
+	assert.Equal(t, 4.7, reloaded.PromotionDiscount)
+	assert.Equal(t, 9.7, reloaded.DiscountAmount)
+	assert.Equal(t, 37.3, reloaded.TotalAmount)
+	assert.Equal(t, 3.39, reloaded.TaxAmount)
+
+	// Pricing the order again replaces its redemptions
+	var redemptions int64
+	require.NoError(t, db.Model(&models.PromotionRedemption{}).Where("order_id = ?", order.ID).Count(&redemptions).Error)
+	assert.Equal(t, int64(1), redemptions)
+
+	other := f.newOrder(t, db)
+	result, err := promotions.Apply(db, f.restaurant, other, now)
+	require.NoError(t, err)
+	assert.Equal(t, "usage limit reached", result.Promotions[0].Reason)
+	assert.Equal(t, 0.0, other.DiscountAmount)
+
+	// Cancelled orders no longer count
+	require.NoError(t, promotions.Release(db, order))
+	result, err = promotions.Apply(db, f.restaurant, other, now)
+	require.NoError(t, err)
+	assert.True(t, result.Promotions[0].Applied)
+	assert.Equal(t, 42.3, other.TotalAmount)
+}
+
+func TestFindCoupon(t *testing.T) {
+	db := databasetest.New(t)
+	f := newFixture(t, db)
+
+	promotion := &models.Promotion{RestaurantID: f.restaurant.ID, Name: "Welcome", Kind: models.PromotionKindFixedAmount, Amount: 3, Code: "WELCOME"}
+	require.NoError(t, db.Create(promotion).Error)
+
+	found, err := promotions.FindCoupon(db, f.restaurant.ID, " welcome ")
+	require.NoError(t, err)
+	assert.Equal(t, promotion.ID, found.ID)
+
+	_, err = promotions.FindCoupon(db, uuid.New(), "WELCOME")
+	assert.ErrorIs(t, err, promotions.ErrUnknownCoupon)
+	_, err = promotions.FindCoupon(db, f.restaurant.ID, "")
+	assert.ErrorIs(t, err, promotions.ErrUnknownCoupon)
+}
@@ -0,0 +1,72 @@
+// Package qr renders QR codes as PNG and SVG images for printing.
+package qr
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Format is an image format of QR codes.
+type Format string
+
+const (
+	FormatPNG Format = "png"
+	FormatSVG Format = "svg"
+)
+
+// IsValid reports whether the format is known.
+func (f Format) IsValid() bool {
+	return f == FormatPNG || f == FormatSVG
+}
+
+// ContentType returns the media type of images in the format.
+func (f Format) ContentType() string {
+	if f == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// Write encodes the content as a QR code and writes it as a size x size pixels image. Codes use the
+// medium recovery level, which tolerates printed codes getting a bit worn.
+func Write(w io.Writer, content string, format Format, size int) error {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatPNG:
+		return code.Write(size, w)
+	case FormatSVG:
+		_, err := io.WriteString(w, svg(code.Bitmap(), size))
+		return err
+	}
+	return fmt.Errorf("unknown QR code format %q", format)
+}
+
+// svg draws the modules of the bitmap, including its quiet zone, as a path scaled to size. Runs of
+// dark modules are drawn as a single rectangle.
+func svg(bitmap [][]bool, size int) string {
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x+1 < len(row) && row[x+1] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start, y, x-start+1, x-start+1)
+		}
+	}
+
+	modules := len(bitmap)
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="%s"/></svg>`+"\n",
+		size, size, modules, modules, modules, modules, path.String())
+}
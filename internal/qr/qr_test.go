@@ -0,0 +1,39 @@
+package qr_test
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/roushou/pocpoc/internal/qr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	content := "https://order.example.com/t/AZWhssPUfl-KmwwdLj9KWwAAAAM"
+
+	t.Run("png", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, qr.Write(&buf, content, qr.FormatPNG, 256))
+
+		image, err := png.Decode(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, 256, image.Bounds().Dx())
+		assert.Equal(t, 256, image.Bounds().Dy())
+	})
+
+	t.Run("svg", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, qr.Write(&buf, content, qr.FormatSVG, 256))
+
+		svg := buf.String()
+		assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="256" height="256"`))
+		assert.Contains(t, svg, `<path fill="#000" d="M`)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		assert.Error(t, qr.Write(&bytes.Buffer{}, content, qr.Format("gif"), 256))
+	})
+}
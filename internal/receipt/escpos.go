@@ -0,0 +1,76 @@
+package receipt
+
+import (
+	"bytes"
+	"io"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// ESC/POS commands, see the Epson ESC/POS command reference.
+var (
+	escposInitialize = []byte{0x1b, '@'}
+	// escposCodePage858 selects the PC858 code page, which has accented latin letters and the euro sign.
+	escposCodePage858 = []byte{0x1b, 't', 19}
+	escposAlignLeft   = []byte{0x1b, 'a', 0}
+	escposAlignCenter = []byte{0x1b, 'a', 1}
+	escposEmphasisOn  = []byte{0x1b, 'E', 1}
+	escposEmphasisOff = []byte{0x1b, 'E', 0}
+	escposSizeNormal  = []byte{0x1d, '!', 0x00}
+	escposSizeDouble  = []byte{0x1d, '!', 0x11}
+	escposFeedLines   = []byte{0x1b, 'd', 4}
+	escposPartialCut  = []byte{0x1d, 'V', 1}
+	escposLineFeed    = []byte{'\n'}
+)
+
+// RenderESCPOS writes the receipt as ESC/POS commands for thermal printers. Characters missing from
+// the PC858 code page are replaced.
+func (r *Receipt) RenderESCPOS(w io.Writer) error {
+	return writeESCPOS(w, r.blocks())
+}
+
+// writeESCPOS writes the blocks as ESC/POS commands and cuts the paper after them.
+func writeESCPOS(w io.Writer, blocks []block) error {
+	// Encoders keep state, they can't be shared between renders
+	encoder := encoding.ReplaceUnsupported(charmap.CodePage858.NewEncoder())
+
+	var buf bytes.Buffer
+	buf.Write(escposInitialize)
+	buf.Write(escposCodePage858)
+
+	for _, block := range blocks {
+		if block.align == alignCenter {
+			buf.Write(escposAlignCenter)
+		}
+		if block.emphasis {
+			buf.Write(escposEmphasisOn)
+		}
+		if block.large {
+			buf.Write(escposSizeDouble)
+		}
+
+		text, err := encoder.String(block.text)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(text)
+		buf.Write(escposLineFeed)
+
+		if block.large {
+			buf.Write(escposSizeNormal)
+		}
+		if block.emphasis {
+			buf.Write(escposEmphasisOff)
+		}
+		if block.align == alignCenter {
+			buf.Write(escposAlignLeft)
+		}
+	}
+
+	buf.Write(escposFeedLines)
+	buf.Write(escposPartialCut)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,76 @@
+package receipt
+
+import (
+	"html/template"
+	"io"
+)
+
+var htmlTemplate = template.Must(template.New("receipt").Funcs(template.FuncMap{
+	"amount":  formatAmount,
+	"rate":    formatRate,
+	"payment": paymentLabel,
+	"neg":     func(amount float64) float64 { return -amount },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Receipt {{.RestaurantName}}</title>
+</head>
+<body style="font-family: sans-serif; max-width: 480px; margin: 0 auto; color: #222;">
+<header style="text-align: center;">
+<h1 style="margin-bottom: 4px;">{{.RestaurantName}}</h1>
+{{- if .Address}}
+<p style="margin: 0; white-space: pre-line;">{{.Address}}</p>
+{{- end}}
+{{- if .TaxID}}
+<p style="margin: 0;">Tax ID: {{.TaxID}}</p>
+{{- end}}
+</header>
+<p>{{if .InvoiceNumber}}<strong>Invoice {{.InvoiceNumber}}</strong><br>{{end}}Order {{.OrderID}}<br>{{.Label}}{{if .StaffName}}, served by {{.StaffName}}{{end}}<br>{{.IssuedAt.Format "2006-01-02 15:04"}}
+{{- range .Details "2006-01-02 15:04"}}<br>{{.}}{{end}}</p>
+<table style="width: 100%; border-collapse: collapse;">
+<tbody>
+{{- range .Lines}}
+<tr>
+<td>{{.Quantity}} &times; {{.Title}}
+{{- if gt .Quantity 1}}<br><small>@ {{amount .UnitPrice}}</small>{{end}}
+{{- range .Modifiers}}<br><small>+ {{.}}</small>{{end}}</td>
+<td style="text-align: right; vertical-align: top;">{{amount .Amount}}</td>
+</tr>
+{{- end}}
+</tbody>
+<tfoot style="border-top: 1px solid #222;">
+{{- if or (gt .Discount 0.0) (gt .DeliveryFee 0.0)}}
+<tr><td>Subtotal</td><td style="text-align: right;">{{amount .Subtotal}}</td></tr>
+{{- end}}
+{{- if gt .Discount 0.0}}
+<tr><td>Discount</td><td style="text-align: right;">{{amount (neg .Discount)}}</td></tr>
+{{- end}}
+{{- if gt .DeliveryFee 0.0}}
+<tr><td>Delivery fee</td><td style="text-align: right;">{{amount .DeliveryFee}}</td></tr>
+{{- end}}
+<tr><th style="text-align: left;">Total {{.Currency}}</th><th style="text-align: right;">{{amount .Total}}</th></tr>
+<tr><td>Incl. tax {{rate .TaxRate}}</td><td style="text-align: right;">{{amount .Tax}}</td></tr>
+<tr><td>Net</td><td style="text-align: right;">{{amount .Net}}</td></tr>
+{{- range .Payments}}
+<tr><td>{{payment .Method}}</td><td style="text-align: right;">{{amount .Amount}}</td></tr>
+{{- end}}
+{{- if gt .Tip 0.0}}
+<tr><td>Tip</td><td style="text-align: right;">{{amount .Tip}}</td></tr>
+{{- end}}
+{{- if gt .Due 0.0}}
+<tr><th style="text-align: left;">Amount due</th><th style="text-align: right;">{{amount .Due}}</th></tr>
+{{- end}}
+</tfoot>
+</table>
+{{- if .Footer}}
+<footer style="text-align: center; margin-top: 16px; white-space: pre-line;">{{.Footer}}</footer>
+{{- end}}
+</body>
+</html>
+`))
+
+// RenderHTML writes the receipt as an HTML document, to be sent by email.
+func (r *Receipt) RenderHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, r)
+}
@@ -0,0 +1,69 @@
+package receipt
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+)
+
+// KitchenTicket is what is printed at kitchen stations when an order is confirmed. It has no prices.
+type KitchenTicket struct {
+	OrderID uuid.UUID
+	Service
+	StaffName string
+	// ConfirmedAt is in the restaurant time zone.
+	ConfirmedAt time.Time
+	Lines       []Line
+}
+
+// NewKitchenTicket builds the kitchen ticket of an order. The order must be loaded with its items and
+// their product.
+func NewKitchenTicket(order *models.Order, restaurant *models.Restaurant, staff *models.Staff, now time.Time) *KitchenTicket {
+	ticket := &KitchenTicket{
+		OrderID:     order.ID,
+		Service:     newService(order, restaurant.Location()),
+		ConfirmedAt: now.In(restaurant.Location()),
+		Lines:       make([]Line, 0, len(order.OrderItems)),
+	}
+	if staff != nil {
+		ticket.StaffName = staff.DisplayName
+		if ticket.StaffName == "" {
+			ticket.StaffName = staff.Username
+		}
+	}
+	for _, item := range order.OrderItems {
+		ticket.Lines = append(ticket.Lines, Line{
+			Title:     item.Product.Title,
+			Quantity:  item.Quantity,
+			Modifiers: item.Modifiers,
+		})
+	}
+	return ticket
+}
+
+func (k *KitchenTicket) blocks() []block {
+	blocks := []block{
+		{text: k.Label(), align: alignCenter, emphasis: true, large: true},
+		{text: columns(k.ConfirmedAt.Format("15:04"), k.StaffName)},
+		{text: "Order " + k.OrderID.String()},
+	}
+	for _, detail := range k.Details("15:04") {
+		blocks = append(blocks, block{text: detail})
+	}
+	blocks = append(blocks, separator())
+	for _, line := range k.Lines {
+		blocks = append(blocks, block{text: fmt.Sprintf("%d x %s", line.Quantity, line.Title), emphasis: true})
+		for _, modifier := range line.Modifiers {
+			blocks = append(blocks, block{text: "  + " + modifier})
+		}
+	}
+	return blocks
+}
+
+// RenderESCPOS writes the ticket as ESC/POS commands for thermal printers.
+func (k *KitchenTicket) RenderESCPOS(w io.Writer) error {
+	return writeESCPOS(w, k.blocks())
+}
@@ -0,0 +1,239 @@
+// Package receipt renders the receipts of orders as plain text, HTML and ESC/POS commands for
+// thermal printers.
+package receipt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+)
+
+// Format is an output format of receipts.
+type Format string
+
+const (
+	FormatText   Format = "text"
+	FormatHTML   Format = "html"
+	FormatESCPOS Format = "escpos"
+)
+
+// IsValid reports whether the format is known.
+func (f Format) IsValid() bool {
+	switch f {
+	case FormatText, FormatHTML, FormatESCPOS:
+		return true
+	}
+	return false
+}
+
+// ContentType returns the media type of receipts rendered in the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	case FormatESCPOS:
+		return "application/octet-stream"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// Receipt is what is printed on the receipt of an order.
+type Receipt struct {
+	RestaurantName string
+	Address        string
+	TaxID          string
+	Currency       string
+	OrderID        uuid.UUID
+	InvoiceNumber  string
+	Service
+	StaffName string
+	// IssuedAt is in the restaurant time zone.
+	IssuedAt time.Time
+	Lines    []Line
+	Subtotal float64
+	Discount float64
+	// DeliveryFee is included in the total.
+	DeliveryFee float64
+	Total       float64
+	// TaxRate is the percentage of tax included in the total.
+	TaxRate  float64
+	Tax      float64
+	Net      float64
+	Payments []Payment
+	Tip      float64
+	// Due is what is left to pay.
+	Due    float64
+	Footer string
+}
+
+// Service is how an order is served: at a table, or picked up or delivered.
+type Service struct {
+	Type        models.OrderType
+	TableNumber string
+	// ContactName and ContactPhone are who to call about takeaway and delivery orders.
+	ContactName  string
+	ContactPhone string
+	// PickupAt is when takeaway orders are picked up, or delivery orders leave, in the restaurant time
+	// zone. It is nil when the order isn't scheduled.
+	PickupAt        *time.Time
+	DeliveryAddress string
+}
+
+func newService(order *models.Order, location *time.Location) Service {
+	service := Service{
+		Type:            order.Type,
+		TableNumber:     order.TableNumber,
+		ContactName:     order.ContactName,
+		ContactPhone:    order.ContactPhone,
+		DeliveryAddress: order.DeliveryAddress,
+	}
+	if order.PickupAt != nil {
+		pickupAt := order.PickupAt.In(location)
+		service.PickupAt = &pickupAt
+	}
+	return service
+}
+
+// Label returns the table of dine-in orders, or how other orders are served.
+func (s Service) Label() string {
+	switch s.Type {
+	case models.OrderTypeTakeaway:
+		return "Takeaway"
+	case models.OrderTypeDelivery:
+		return "Delivery"
+	}
+	return "Table " + s.TableNumber
+}
+
+// Details returns the lines telling when and to whom takeaway and delivery orders are handed over,
+// and where delivery orders go. Times are formatted with layout.
+func (s Service) Details(layout string) []string {
+	details := make([]string, 0)
+	if s.PickupAt != nil {
+		label := "Pickup "
+		if s.Type == models.OrderTypeDelivery {
+			label = "Departure "
+		}
+		details = append(details, label+s.PickupAt.Format(layout))
+	}
+	contact := make([]string, 0, 2)
+	for _, value := range []string{s.ContactName, s.ContactPhone} {
+		if value != "" {
+			contact = append(contact, value)
+		}
+	}
+	if len(contact) > 0 {
+		details = append(details, "Contact: "+strings.Join(contact, ", "))
+	}
+	if s.Type == models.OrderTypeDelivery && s.DeliveryAddress != "" {
+		details = append(details, strings.Split(s.DeliveryAddress, "\n")...)
+	}
+	return details
+}
+
+// Line is an ordered item.
+type Line struct {
+	Title     string
+	Quantity  uint32
+	UnitPrice float64
+	Amount    float64
+	Modifiers []string
+}
+
+// Payment is a payment made towards the order.
+type Payment struct {
+	Method models.PaymentMethod
+	Amount float64
+}
+
+// New builds the receipt of an order. The order must be loaded with its items, their product, and its
+// payments. Receipts are issued when the order is paid, or now when it isn't yet.
+func New(order *models.Order, restaurant *models.Restaurant, staff *models.Staff, now time.Time) *Receipt {
+	issuedAt := now
+	if order.PaidAt != nil {
+		issuedAt = *order.PaidAt
+	}
+
+	receipt := &Receipt{
+		RestaurantName: restaurant.Name,
+		Address:        restaurant.Address,
+		TaxID:          restaurant.TaxID,
+		Currency:       restaurant.Currency,
+		OrderID:        order.ID,
+		InvoiceNumber:  order.InvoiceNumber,
+		Service:        newService(order, restaurant.Location()),
+		IssuedAt:       issuedAt.In(restaurant.Location()),
+		Lines:          make([]Line, 0, len(order.OrderItems)),
+		Subtotal:       models.RoundAmount(models.CalculateTotalAmount(order.OrderItems)),
+		Discount:       order.DiscountAmount,
+		DeliveryFee:    order.DeliveryFee,
+		Total:          order.TotalAmount,
+		TaxRate:        restaurant.TaxRate,
+		Tax:            order.TaxAmount,
+		Net:            models.RoundAmount(order.TotalAmount - order.TaxAmount),
+		Payments:       make([]Payment, 0, len(order.Payments)),
+		Footer:         restaurant.ReceiptFooter,
+	}
+	if staff != nil {
+		receipt.StaffName = staff.DisplayName
+		if receipt.StaffName == "" {
+			receipt.StaffName = staff.Username
+		}
+	}
+
+	for _, item := range order.OrderItems {
+		receipt.Lines = append(receipt.Lines, Line{
+			Title:     item.Product.Title,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			Amount:    models.RoundAmount(float64(item.Quantity) * item.UnitPrice),
+			Modifiers: item.Modifiers,
+		})
+	}
+
+	for _, payment := range order.Payments {
+		receipt.Payments = append(receipt.Payments, Payment{Method: payment.Method, Amount: payment.Amount})
+	}
+	paid, tips := models.SumPayments(order.Payments)
+	receipt.Tip = tips
+	receipt.Due = models.RoundAmount(order.TotalAmount - paid)
+
+	return receipt
+}
+
+// Render writes the receipt in the format.
+func (r *Receipt) Render(w io.Writer, format Format) error {
+	switch format {
+	case FormatText:
+		return r.RenderText(w)
+	case FormatHTML:
+		return r.RenderHTML(w)
+	case FormatESCPOS:
+		return r.RenderESCPOS(w)
+	}
+	return fmt.Errorf("unknown receipt format %q", format)
+}
+
+func formatAmount(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+func formatRate(rate float64) string {
+	return fmt.Sprintf("%g%%", rate)
+}
+
+func paymentLabel(method models.PaymentMethod) string {
+	switch method {
+	case models.PaymentMethodCash:
+		return "Cash"
+	case models.PaymentMethodCard:
+		return "Card"
+	default:
+		return "Other"
+	}
+}
@@ -0,0 +1,151 @@
+package receipt_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/receipt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func newTestRestaurant() *models.Restaurant {
+	return &models.Restaurant{
+		Name:          "Café Crème",
+		Address:       "12 rue de la Paix\n75002 Paris",
+		TimeZone:      "Europe/Paris",
+		Currency:      "EUR",
+		TaxID:         "FR12345678901",
+		TaxRate:       10,
+		ReceiptFooter: "Merci et à bientôt !",
+	}
+}
+
+func newTestReceipt(t *testing.T) *receipt.Receipt {
+	paidAt := time.Date(2026, 3, 2, 11, 5, 0, 0, time.UTC)
+	restaurant := newTestRestaurant()
+	staff := &models.Staff{Username: "alice", DisplayName: "Alice"}
+	order := &models.Order{
+		ID:            uuid.MustParse("0195a1b2-c3d4-7e5f-8a9b-0c1d2e3f4a5b"),
+		TableNumber:   "12",
+		InvoiceNumber: "INV-000042",
+		OrderItems: []models.OrderItem{
+			{Quantity: 2, UnitPrice: 2.5, Product: models.Product{Title: "Espresso"}, Modifiers: []string{"no sugar"}},
+			{Quantity: 1, UnitPrice: 14, Product: models.Product{Title: "Croque-monsieur with a very long name"}},
+			{Quantity: 1, UnitPrice: 6.5, Product: models.Product{Title: "Crème brûlée"}, Modifiers: []string{"extra cream", "to share"}},
+		},
+		DiscountAmount: 2,
+		PaidAt:         &paidAt,
+		Payments: []models.Payment{
+			{Method: models.PaymentMethodCard, Amount: 15, TipAmount: 2},
+			{Method: models.PaymentMethodCash, Amount: 8.5},
+		},
+	}
+	order.UpdateTotals(restaurant.TaxRate)
+
+	return receipt.New(order, restaurant, staff, paidAt.Add(time.Hour))
+}
+
+// newTestDeliveryOrder is a delivery order of 2 ramen at 12 with a delivery fee of 3.5, leaving at
+// 19:30 in Paris and not paid yet.
+func newTestDeliveryOrder(restaurant *models.Restaurant) *models.Order {
+	pickupAt := time.Date(2026, 3, 2, 18, 30, 0, 0, time.UTC)
+	order := &models.Order{
+		ID:              uuid.MustParse("0195a1b2-c3d4-7e5f-8a9b-0c1d2e3f4a5c"),
+		Type:            models.OrderTypeDelivery,
+		ContactName:     "Jean Dupont",
+		ContactPhone:    "+33 6 12 34 56 78",
+		PickupAt:        &pickupAt,
+		DeliveryAddress: "4 rue Oberkampf\n75011 Paris",
+		DeliveryFee:     3.5,
+		OrderItems: []models.OrderItem{
+			{Quantity: 2, UnitPrice: 12, Product: models.Product{Title: "Ramen"}, Modifiers: []string{"extra egg"}},
+		},
+	}
+	order.UpdateTotals(restaurant.TaxRate)
+	return order
+}
+
+func newTestDeliveryReceipt(t *testing.T) *receipt.Receipt {
+	restaurant := newTestRestaurant()
+	order := newTestDeliveryOrder(restaurant)
+	return receipt.New(order, restaurant, nil, time.Date(2026, 3, 2, 18, 0, 0, 0, time.UTC))
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		receipt func(t *testing.T) *receipt.Receipt
+		format  receipt.Format
+		golden  string
+	}{
+		{receipt: newTestReceipt, format: receipt.FormatText, golden: "receipt.txt"},
+		{receipt: newTestReceipt, format: receipt.FormatHTML, golden: "receipt.html"},
+		{receipt: newTestReceipt, format: receipt.FormatESCPOS, golden: "receipt.escpos"},
+		{receipt: newTestDeliveryReceipt, format: receipt.FormatText, golden: "delivery.txt"},
+		{receipt: newTestDeliveryReceipt, format: receipt.FormatHTML, golden: "delivery.html"},
+		{receipt: newTestDeliveryReceipt, format: receipt.FormatESCPOS, golden: "delivery.escpos"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, tt.receipt(t).Render(&buf, tt.format))
+
+			golden := filepath.Join("testdata", tt.golden)
+			if *update {
+				require.NoError(t, os.WriteFile(golden, buf.Bytes(), 0o644))
+			}
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), buf.String())
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	r := newTestReceipt(t)
+
+	assert.Equal(t, 25.5, r.Subtotal)
+	assert.Equal(t, 23.5, r.Total)
+	assert.Equal(t, 2.14, r.Tax)
+	assert.Equal(t, 21.36, r.Net)
+	assert.Equal(t, 2.0, r.Tip)
+	assert.Equal(t, 0.0, r.Due)
+	assert.Equal(t, "Alice", r.StaffName)
+	// Receipts are dated in the restaurant time zone
+	assert.Equal(t, "2026-03-02 12:05", r.IssuedAt.Format("2006-01-02 15:04"))
+}
+
+func TestNewDelivery(t *testing.T) {
+	r := newTestDeliveryReceipt(t)
+
+	assert.Equal(t, "Delivery", r.Label())
+	assert.Equal(t, 24.0, r.Subtotal)
+	assert.Equal(t, 3.5, r.DeliveryFee)
+	assert.Equal(t, 27.5, r.Total)
+	assert.Equal(t, r.Total, r.Subtotal-r.Discount+r.DeliveryFee)
+	assert.Equal(t, 27.5, r.Due)
+	// Pickup times are in the restaurant time zone
+	assert.Equal(t, []string{"Departure 19:30", "Contact: Jean Dupont, +33 6 12 34 56 78", "4 rue Oberkampf", "75011 Paris"}, r.Details("15:04"))
+}
+
+func TestKitchenTicket(t *testing.T) {
+	restaurant := newTestRestaurant()
+	order := newTestDeliveryOrder(restaurant)
+	var buf bytes.Buffer
+	require.NoError(t, receipt.NewKitchenTicket(order, restaurant, nil, time.Date(2026, 3, 2, 18, 0, 0, 0, time.UTC)).RenderESCPOS(&buf))
+
+	ticket := buf.String()
+	assert.Contains(t, ticket, "Delivery")
+	assert.Contains(t, ticket, "Departure 19:30")
+	assert.Contains(t, ticket, "Contact: Jean Dupont, +33 6 12 34 56 78")
+	assert.NotContains(t, ticket, "Table")
+}
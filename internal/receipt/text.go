@@ -0,0 +1,132 @@
+package receipt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// textWidth is the number of characters in a line of 80mm thermal paper with the default font.
+const textWidth = 42
+
+type alignment int
+
+const (
+	alignLeft alignment = iota
+	alignCenter
+)
+
+// block is a line of the receipt with the styles printers can apply to it.
+type block struct {
+	text     string
+	align    alignment
+	emphasis bool
+	// large doubles the width and height of characters.
+	large bool
+}
+
+// separator returns a line separating sections of the receipt.
+func separator() block {
+	return block{text: strings.Repeat("-", textWidth)}
+}
+
+// columns lays out left and right aligned texts on a single line, truncating the left one if needed.
+func columns(left, right string) string {
+	space := textWidth - utf8.RuneCountInString(right) - 1
+	if utf8.RuneCountInString(left) > space {
+		left = string([]rune(left)[:space])
+	}
+	return left + strings.Repeat(" ", textWidth-utf8.RuneCountInString(left)-utf8.RuneCountInString(right)) + right
+}
+
+// blocks lays out the receipt for fixed width printers.
+func (r *Receipt) blocks() []block {
+	blocks := []block{{text: r.RestaurantName, align: alignCenter, emphasis: true, large: true}}
+	if r.Address != "" {
+		for _, line := range strings.Split(r.Address, "\n") {
+			blocks = append(blocks, block{text: line, align: alignCenter})
+		}
+	}
+	if r.TaxID != "" {
+		blocks = append(blocks, block{text: "Tax ID: " + r.TaxID, align: alignCenter})
+	}
+
+	blocks = append(blocks, separator())
+	if r.InvoiceNumber != "" {
+		blocks = append(blocks, block{text: "Invoice " + r.InvoiceNumber, emphasis: true})
+	}
+	blocks = append(blocks,
+		block{text: "Order " + r.OrderID.String()},
+		block{text: columns(r.Label(), r.StaffName)},
+		block{text: r.IssuedAt.Format("2006-01-02 15:04")},
+	)
+	for _, detail := range r.Details("2006-01-02 15:04") {
+		blocks = append(blocks, block{text: detail})
+	}
+	blocks = append(blocks, separator())
+
+	for _, line := range r.Lines {
+		blocks = append(blocks, block{text: columns(fmt.Sprintf("%d x %s", line.Quantity, line.Title), formatAmount(line.Amount))})
+		if line.Quantity > 1 {
+			blocks = append(blocks, block{text: "    @ " + formatAmount(line.UnitPrice)})
+		}
+		for _, modifier := range line.Modifiers {
+			blocks = append(blocks, block{text: "  + " + modifier})
+		}
+	}
+
+	blocks = append(blocks, separator())
+	if r.Discount > 0 || r.DeliveryFee > 0 {
+		blocks = append(blocks, block{text: columns("Subtotal", formatAmount(r.Subtotal))})
+		if r.Discount > 0 {
+			blocks = append(blocks, block{text: columns("Discount", formatAmount(-r.Discount))})
+		}
+		if r.DeliveryFee > 0 {
+			blocks = append(blocks, block{text: columns("Delivery fee", formatAmount(r.DeliveryFee))})
+		}
+	}
+	blocks = append(blocks,
+		block{text: columns("TOTAL "+r.Currency, formatAmount(r.Total)), emphasis: true},
+		block{text: columns("Incl. tax "+formatRate(r.TaxRate), formatAmount(r.Tax))},
+		block{text: columns("Net", formatAmount(r.Net))},
+	)
+
+	if len(r.Payments) > 0 || r.Due > 0 {
+		blocks = append(blocks, separator())
+		for _, payment := range r.Payments {
+			blocks = append(blocks, block{text: columns(paymentLabel(payment.Method), formatAmount(payment.Amount))})
+		}
+		if r.Tip > 0 {
+			blocks = append(blocks, block{text: columns("Tip", formatAmount(r.Tip))})
+		}
+		if r.Due > 0 {
+			blocks = append(blocks, block{text: columns("Amount due", formatAmount(r.Due)), emphasis: true})
+		}
+	}
+
+	if r.Footer != "" {
+		blocks = append(blocks, separator())
+		for _, line := range strings.Split(r.Footer, "\n") {
+			blocks = append(blocks, block{text: line, align: alignCenter})
+		}
+	}
+
+	return blocks
+}
+
+// RenderText writes the receipt as plain text.
+func (r *Receipt) RenderText(w io.Writer) error {
+	for _, block := range r.blocks() {
+		text := block.text
+		if block.align == alignCenter {
+			if padding := (textWidth - utf8.RuneCountInString(text)) / 2; padding > 0 {
+				text = strings.Repeat(" ", padding) + text
+			}
+		}
+		if _, err := io.WriteString(w, text+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
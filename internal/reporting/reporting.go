@@ -0,0 +1,372 @@
+// Package reporting aggregates the orders of restaurants into sales reports.
+//
+// Aggregations run in the database; only aggregated rows are loaded. Reports bucketed by time are
+// aggregated in 15 minutes UTC slots, which line up with every time zone offset, then regrouped in
+// the requested location.
+package reporting
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"gorm.io/gorm"
+)
+
+// Filter restricts the orders a report covers.
+type Filter struct {
+	RestaurantIDs []uuid.UUID
+	// From and To bound the creation time of orders, To is excluded.
+	From time.Time
+	To   time.Time
+	// Location is the time zone in which orders are grouped by day and hour.
+	Location *time.Location
+}
+
+// Report is a report that can be exported as a table.
+type Report interface {
+	Header() []string
+	Records() [][]string
+}
+
+// orders returns the orders matching the filter.
+func (f Filter) orders(db *gorm.DB) *gorm.DB {
+	return db.
+		Model(&models.Order{}).
+		Where("orders.restaurant_id IN ? AND orders.created_at >= ? AND orders.created_at < ?", f.RestaurantIDs, f.From.UTC(), f.To.UTC())
+}
+
+// sales returns the orders matching the filter that were not cancelled.
+func (f Filter) sales(db *gorm.DB) *gorm.DB {
+	return f.orders(db).Where("orders.status <> ?", models.OrderStatusCancelled)
+}
+
+func (f Filter) location() *time.Location {
+	if f.Location == nil {
+		return time.UTC
+	}
+	return f.Location
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+func formatRate(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', 4, 64)
+}
+
+func averageTicket(revenue float64, orders int64) float64 {
+	if orders == 0 {
+		return 0
+	}
+	return models.RoundAmount(revenue / float64(orders))
+}
+
+// Summary sums the sales of the period.
+type Summary struct {
+	Orders          int64   `json:"orders"`
+	Revenue         float64 `json:"revenue"`
+	AverageTicket   float64 `json:"average_ticket"`
+	Discounts       float64 `json:"discounts"`
+	Taxes           float64 `json:"taxes"`
+	CancelledOrders int64   `json:"cancelled_orders"`
+	CancelledAmount float64 `json:"cancelled_amount"`
+	// CancellationRate is the share of orders that were cancelled, between 0 and 1.
+	CancellationRate float64 `json:"cancellation_rate"`
+}
+
+func (s *Summary) Header() []string {
+	return []string{"orders", "revenue", "average_ticket", "discounts", "taxes", "cancelled_orders", "cancelled_amount", "cancellation_rate"}
+}
+
+func (s *Summary) Records() [][]string {
+	return [][]string{{
+		strconv.FormatInt(s.Orders, 10),
+		formatAmount(s.Revenue),
+		formatAmount(s.AverageTicket),
+		formatAmount(s.Discounts),
+		formatAmount(s.Taxes),
+		strconv.FormatInt(s.CancelledOrders, 10),
+		formatAmount(s.CancelledAmount),
+		formatRate(s.CancellationRate),
+	}}
+}
+
+// Summarize sums the sales, the average ticket size and the cancellations of the period.
+func Summarize(db *gorm.DB, filter Filter) (*Summary, error) {
+	row := struct {
+		Orders          int64
+		Revenue         float64
+		Discounts       float64
+		Taxes           float64
+		CancelledOrders int64
+		CancelledAmount float64
+	}{}
+	if err := filter.orders(db).
+		Select(`COUNT(CASE WHEN status <> @cancelled THEN 1 END) AS orders,
+			COALESCE(SUM(CASE WHEN status <> @cancelled THEN total_amount END), 0) AS revenue,
+			COALESCE(SUM(CASE WHEN status <> @cancelled THEN discount_amount END), 0) AS discounts,
+			COALESCE(SUM(CASE WHEN status <> @cancelled THEN tax_amount END), 0) AS taxes,
+			COUNT(CASE WHEN status = @cancelled THEN 1 END) AS cancelled_orders,
+			COALESCE(SUM(CASE WHEN status = @cancelled THEN total_amount END), 0) AS cancelled_amount`,
+			map[string]any{"cancelled": models.OrderStatusCancelled}).
+		Scan(&row).Error; err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{
+		Orders:          row.Orders,
+		Revenue:         models.RoundAmount(row.Revenue),
+		AverageTicket:   averageTicket(row.Revenue, row.Orders),
+		Discounts:       models.RoundAmount(row.Discounts),
+		Taxes:           models.RoundAmount(row.Taxes),
+		CancelledOrders: row.CancelledOrders,
+		CancelledAmount: models.RoundAmount(row.CancelledAmount),
+	}
+	if total := row.Orders + row.CancelledOrders; total > 0 {
+		summary.CancellationRate = float64(row.CancelledOrders) / float64(total)
+	}
+	return summary, nil
+}
+
+// RevenueBucket is the revenue of a day or an hour of the day.
+type RevenueBucket struct {
+	// Period is the date (2006-01-02) or the hour of the day (15:00).
+	Period        string  `json:"period"`
+	Orders        int64   `json:"orders"`
+	Revenue       float64 `json:"revenue"`
+	AverageTicket float64 `json:"average_ticket"`
+}
+
+type RevenueReport []RevenueBucket
+
+func (r RevenueReport) Header() []string {
+	return []string{"period", "orders", "revenue", "average_ticket"}
+}
+
+func (r RevenueReport) Records() [][]string {
+	records := make([][]string, 0, len(r))
+	for _, bucket := range r {
+		records = append(records, []string{
+			bucket.Period,
+			strconv.FormatInt(bucket.Orders, 10),
+			formatAmount(bucket.Revenue),
+			formatAmount(bucket.AverageTicket),
+		})
+	}
+	return records
+}
+
+// slotLayout is the layout of the 15 minutes UTC slots orders are aggregated in.
+const slotLayout = "2006-01-02 15:04"
+
+// revenueBySlot sums the sales in 15 minutes UTC slots and regroups them with the period function.
+func revenueBySlot(db *gorm.DB, filter Filter, period func(t time.Time) string) (RevenueReport, error) {
+	rows := make([]struct {
+		Slot    string
+		Orders  int64
+		Revenue float64
+	}, 0)
+	if err := filter.sales(db).
+		Select(`strftime('%Y-%m-%d %H:', created_at) || printf('%02d', CAST(strftime('%M', created_at) AS INTEGER) / 15 * 15) AS slot,
+			COUNT(*) AS orders,
+			COALESCE(SUM(total_amount), 0) AS revenue`).
+		Group("slot").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	buckets := make(map[string]*RevenueBucket)
+	for _, row := range rows {
+		slot, err := time.ParseInLocation(slotLayout, row.Slot, time.UTC)
+		if err != nil {
+			return nil, err
+		}
+		key := period(slot.In(filter.location()))
+		bucket, ok := buckets[key]
+		if !ok {
+			bucket = &RevenueBucket{Period: key}
+			buckets[key] = bucket
+		}
+		bucket.Orders += row.Orders
+		bucket.Revenue += row.Revenue
+	}
+
+	report := make(RevenueReport, 0, len(buckets))
+	for _, bucket := range buckets {
+		bucket.Revenue = models.RoundAmount(bucket.Revenue)
+		bucket.AverageTicket = averageTicket(bucket.Revenue, bucket.Orders)
+		report = append(report, *bucket)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Period < report[j].Period })
+	return report, nil
+}
+
+// RevenueByDay sums the sales of each day of the period that had any.
+func RevenueByDay(db *gorm.DB, filter Filter) (RevenueReport, error) {
+	return revenueBySlot(db, filter, func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+}
+
+// RevenueByHour sums the sales of the period by hour of the day, to find out the busiest hours.
+func RevenueByHour(db *gorm.DB, filter Filter) (RevenueReport, error) {
+	return revenueBySlot(db, filter, func(t time.Time) string {
+		return t.Format("15:00")
+	})
+}
+
+// ProductSales are the sales of a product.
+type ProductSales struct {
+	ProductID uuid.UUID `json:"product_id"`
+	Title     string    `json:"title"`
+	Quantity  int64     `json:"quantity"`
+	Revenue   float64   `json:"revenue"`
+	Orders    int64     `json:"orders"`
+}
+
+type ProductsReport []ProductSales
+
+func (r ProductsReport) Header() []string {
+	return []string{"product_id", "title", "quantity", "revenue", "orders"}
+}
+
+func (r ProductsReport) Records() [][]string {
+	records := make([][]string, 0, len(r))
+	for _, product := range r {
+		records = append(records, []string{
+			product.ProductID.String(),
+			product.Title,
+			strconv.FormatInt(product.Quantity, 10),
+			formatAmount(product.Revenue),
+			strconv.FormatInt(product.Orders, 10),
+		})
+	}
+	return records
+}
+
+// TopProducts returns the products that brought the most revenue, before order discounts.
+func TopProducts(db *gorm.DB, filter Filter, limit int) (ProductsReport, error) {
+	report := make(ProductsReport, 0)
+	if err := filter.sales(db).
+		Select(`order_items.product_id AS product_id,
+			COALESCE(products.title, '') AS title,
+			SUM(order_items.quantity) AS quantity,
+			SUM(order_items.quantity * order_items.unit_price) AS revenue,
+			COUNT(DISTINCT orders.id) AS orders`).
+		Joins("JOIN order_items ON order_items.order_id = orders.id AND order_items.deleted_at IS NULL").
+		Joins("LEFT JOIN products ON products.id = order_items.product_id").
+		Group("order_items.product_id").
+		Order("revenue DESC, quantity DESC").
+		Limit(limit).
+		Scan(&report).Error; err != nil {
+		return nil, err
+	}
+	for i := range report {
+		report[i].Revenue = models.RoundAmount(report[i].Revenue)
+	}
+	return report, nil
+}
+
+// TableSales are the sales served at a table. Orders don't record how many guests were served, each
+// order is counted as a cover.
+type TableSales struct {
+	RestaurantID  uuid.UUID `json:"restaurant_id"`
+	TableNumber   string    `json:"table_number"`
+	Covers        int64     `json:"covers"`
+	Revenue       float64   `json:"revenue"`
+	AverageTicket float64   `json:"average_ticket"`
+}
+
+type TablesReport []TableSales
+
+func (r TablesReport) Header() []string {
+	return []string{"restaurant_id", "table_number", "covers", "revenue", "average_ticket"}
+}
+
+func (r TablesReport) Records() [][]string {
+	records := make([][]string, 0, len(r))
+	for _, table := range r {
+		records = append(records, []string{
+			table.RestaurantID.String(),
+			table.TableNumber,
+			strconv.FormatInt(table.Covers, 10),
+			formatAmount(table.Revenue),
+			formatAmount(table.AverageTicket),
+		})
+	}
+	return records
+}
+
+// CoversByTable sums the sales of each table.
+func CoversByTable(db *gorm.DB, filter Filter) (TablesReport, error) {
+	report := make(TablesReport, 0)
+	if err := filter.sales(db).
+		Select("restaurant_id, table_number, COUNT(*) AS covers, COALESCE(SUM(total_amount), 0) AS revenue").
+		Group("restaurant_id, table_number").
+		Order("restaurant_id, table_number").
+		Scan(&report).Error; err != nil {
+		return nil, err
+	}
+	for i := range report {
+		report[i].AverageTicket = averageTicket(report[i].Revenue, report[i].Covers)
+		report[i].Revenue = models.RoundAmount(report[i].Revenue)
+	}
+	return report, nil
+}
+
+// StaffSales are the sales taken by a staff member.
+type StaffSales struct {
+	StaffID       uuid.UUID `json:"staff_id"`
+	Username      string    `json:"username"`
+	DisplayName   string    `json:"display_name"`
+	Orders        int64     `json:"orders"`
+	Revenue       float64   `json:"revenue"`
+	AverageTicket float64   `json:"average_ticket"`
+}
+
+type StaffReport []StaffSales
+
+func (r StaffReport) Header() []string {
+	return []string{"staff_id", "username", "display_name", "orders", "revenue", "average_ticket"}
+}
+
+func (r StaffReport) Records() [][]string {
+	records := make([][]string, 0, len(r))
+	for _, staff := range r {
+		records = append(records, []string{
+			staff.StaffID.String(),
+			staff.Username,
+			staff.DisplayName,
+			strconv.FormatInt(staff.Orders, 10),
+			formatAmount(staff.Revenue),
+			formatAmount(staff.AverageTicket),
+		})
+	}
+	return records
+}
+
+// StaffLeaderboard ranks the staff by the revenue of the orders they took.
+func StaffLeaderboard(db *gorm.DB, filter Filter) (StaffReport, error) {
+	report := make(StaffReport, 0)
+	if err := filter.sales(db).
+		Select(`orders.staff_id AS staff_id,
+			COALESCE(staffs.username, '') AS username,
+			COALESCE(staffs.display_name, '') AS display_name,
+			COUNT(*) AS orders,
+			COALESCE(SUM(orders.total_amount), 0) AS revenue`).
+		Joins("LEFT JOIN staffs ON staffs.id = orders.staff_id").
+		Group("orders.staff_id").
+		Order("revenue DESC, orders DESC").
+		Scan(&report).Error; err != nil {
+		return nil, err
+	}
+	for i := range report {
+		report[i].AverageTicket = averageTicket(report[i].Revenue, report[i].Orders)
+		report[i].Revenue = models.RoundAmount(report[i].Revenue)
+	}
+	return report, nil
+}
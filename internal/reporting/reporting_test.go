@@ -0,0 +1,140 @@
+package reporting_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/database"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/reporting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type fixture struct {
+	db         *gorm.DB
+	restaurant models.Restaurant
+	alice      models.Staff
+	bob        models.Staff
+	coffee     models.Product
+	cake       models.Product
+}
+
+func newFixture(t *testing.T) *fixture {
+	db, err := database.NewDatabase("file:" + t.Name() + "?mode=memory")
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate())
+
+	f := &fixture{db: db.Connection}
+	f.restaurant = models.Restaurant{Name: "Bistro"}
+	require.NoError(t, f.db.Create(&f.restaurant).Error)
+	f.alice = models.Staff{RestaurantID: f.restaurant.ID, Username: "alice", DisplayName: "Alice"}
+	f.bob = models.Staff{RestaurantID: f.restaurant.ID, Username: "bob", DisplayName: "Bob"}
+	require.NoError(t, f.db.Create(&[]*models.Staff{&f.alice, &f.bob}).Error)
+	f.coffee = models.Product{RestaurantID: f.restaurant.ID, Title: "Coffee", UnitPrice: 2}
+	f.cake = models.Product{RestaurantID: f.restaurant.ID, Title: "Cake", UnitPrice: 5}
+	require.NoError(t, f.db.Create(&[]*models.Product{&f.coffee, &f.cake}).Error)
+	return f
+}
+
+func (f *fixture) order(t *testing.T, staff models.Staff, table string, status models.OrderStatus, createdAt time.Time, items ...models.OrderItem) {
+	order := &models.Order{
+		RestaurantID: f.restaurant.ID,
+		StaffID:      staff.ID,
+		TableNumber:  table,
+		Status:       status,
+		OrderItems:   items,
+	}
+	order.CreatedAt = createdAt
+	order.UpdateTotals(0)
+	require.NoError(t, f.db.Create(order).Error)
+}
+
+func item(product models.Product, quantity uint32) models.OrderItem {
+	return models.OrderItem{ProductID: product.ID, Quantity: quantity, UnitPrice: product.UnitPrice}
+}
+
+func TestReports(t *testing.T) {
+	f := newFixture(t)
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+
+	// 23:30 UTC is already the next day in Paris
+	f.order(t, f.alice, "1", models.OrderStatusCompleted, time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC), item(f.coffee, 2), item(f.cake, 1))
+	f.order(t, f.alice, "1", models.OrderStatusCompleted, time.Date(2026, 3, 2, 11, 5, 0, 0, time.UTC), item(f.cake, 2))
+	f.order(t, f.bob, "2", models.OrderStatusCompleted, time.Date(2026, 3, 2, 11, 50, 0, 0, time.UTC), item(f.coffee, 1))
+	f.order(t, f.bob, "2", models.OrderStatusCancelled, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC), item(f.cake, 4))
+	// Outside of the period
+	f.order(t, f.bob, "3", models.OrderStatusCompleted, time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC), item(f.cake, 10))
+
+	filter := reporting.Filter{
+		RestaurantIDs: []uuid.UUID{f.restaurant.ID},
+		From:          time.Date(2026, 3, 1, 0, 0, 0, 0, paris),
+		To:            time.Date(2026, 3, 3, 0, 0, 0, 0, paris),
+		Location:      paris,
+	}
+
+	t.Run("summary", func(t *testing.T) {
+		summary, err := reporting.Summarize(f.db, filter)
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(3), summary.Orders)
+		assert.Equal(t, 21.0, summary.Revenue)
+		assert.Equal(t, 7.0, summary.AverageTicket)
+		assert.Equal(t, int64(1), summary.CancelledOrders)
+		assert.Equal(t, 20.0, summary.CancelledAmount)
+		assert.Equal(t, 0.25, summary.CancellationRate)
+	})
+
+	t.Run("revenue by day", func(t *testing.T) {
+		report, err := reporting.RevenueByDay(f.db, filter)
+		require.NoError(t, err)
+
+		assert.Equal(t, reporting.RevenueReport{
+			{Period: "2026-03-02", Orders: 3, Revenue: 21, AverageTicket: 7},
+		}, report)
+	})
+
+	t.Run("revenue by hour", func(t *testing.T) {
+		report, err := reporting.RevenueByHour(f.db, filter)
+		require.NoError(t, err)
+
+		assert.Equal(t, reporting.RevenueReport{
+			{Period: "00:00", Orders: 1, Revenue: 9, AverageTicket: 9},
+			{Period: "12:00", Orders: 2, Revenue: 12, AverageTicket: 6},
+		}, report)
+	})
+
+	t.Run("top products", func(t *testing.T) {
+		report, err := reporting.TopProducts(f.db, filter, 10)
+		require.NoError(t, err)
+
+		assert.Equal(t, reporting.ProductsReport{
+			{ProductID: f.cake.ID, Title: "Cake", Quantity: 3, Revenue: 15, Orders: 2},
+			{ProductID: f.coffee.ID, Title: "Coffee", Quantity: 3, Revenue: 6, Orders: 2},
+		}, report)
+	})
+
+	t.Run("covers by table", func(t *testing.T) {
+		report, err := reporting.CoversByTable(f.db, filter)
+		require.NoError(t, err)
+
+		assert.Equal(t, reporting.TablesReport{
+			{RestaurantID: f.restaurant.ID, TableNumber: "1", Covers: 2, Revenue: 19, AverageTicket: 9.5},
+			{RestaurantID: f.restaurant.ID, TableNumber: "2", Covers: 1, Revenue: 2, AverageTicket: 2},
+		}, report)
+	})
+
+	t.Run("staff leaderboard", func(t *testing.T) {
+		report, err := reporting.StaffLeaderboard(f.db, filter)
+		require.NoError(t, err)
+
+		assert.Equal(t, reporting.StaffReport{
+			{StaffID: f.alice.ID, Username: "alice", DisplayName: "Alice", Orders: 2, Revenue: 19, AverageTicket: 9.5},
+			{StaffID: f.bob.ID, Username: "bob", DisplayName: "Bob", Orders: 1, Revenue: 2, AverageTicket: 2},
+		}, report)
+		assert.Equal(t, []string{f.alice.ID.String(), "alice", "Alice", "2", "19.00", "9.50"}, report.Records()[0])
+	})
+}
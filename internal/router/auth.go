@@ -1,7 +1,6 @@
 package router
 
 import (
-	"errors"
 	"net/http"
 	"time"
 
@@ -10,7 +9,6 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/roushou/pocpoc/internal/models"
 	"github.com/roushou/pocpoc/internal/security"
-	"gorm.io/gorm"
 )
 
 // TODO: Load secret key and expiration time from config
@@ -19,50 +17,54 @@ const jwtSecretKey = "bigsecret"
 // Setting it high for simplicity
 const jwtExpiration = 24 * time.Hour
 
+// terminalIdleTimeout is the inactivity after which staff are signed out of a terminal.
+const terminalIdleTimeout = 5 * time.Minute
+
 func bindAuthRouter(router *echo.Group) {
 	group := router.Group("/auth")
 	group.POST("/owners/sign-up", signUpOwner)
 	group.POST("/owners/sign-in", signInOwner)
 	group.POST("/staff/sign-in", signInStaff)
+	group.POST("/sign-out", signOut)
 }
 
 type JWTClaims struct {
 	jwt.RegisteredClaims
 	UserID uuid.UUID   `json:"userID"`
 	Role   models.Role `json:"role"`
+	// TokenVersion must match the version of the staff member for the token to be accepted.
+	TokenVersion uint32 `json:"tokenVersion,omitempty"`
+	// TerminalID is set for sessions opened on a terminal, which expire after a short inactivity.
+	TerminalID *uuid.UUID `json:"terminalID,omitempty"`
 }
 
-func signInOwner(ctx echo.Context) error {
-	payload := struct {
-		Username string `json:"username" validate:"required"`
-		Password string `json:"password" validate:"required"`
-	}{}
-	if err := ctx.Bind(&payload); err != nil {
-		return echo.ErrBadRequest
-	}
-	if err := ctx.Validate(&payload); err != nil {
-		return echo.ErrBadRequest
-	}
-
-	db := ctx.(*routerContext).GetDatabase()
-
-	owner := &models.Owner{}
-	tx := db.Connection.Where(&models.Owner{Username: payload.Username}).First(owner)
-	if tx.Error != nil {
-		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
-			return echo.ErrNotFound
-		}
-		return echo.ErrInternalServerError
+func newJWTClaims(userID uuid.UUID, role models.Role) *JWTClaims {
+	now := time.Now()
+	return &JWTClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(jwtExpiration)),
+		},
+		UserID: userID,
+		Role:   role,
 	}
+}
 
-	if err := security.VerifyPasswordHash(payload.Password, owner.PasswordHash); err != nil {
-		return echo.ErrUnauthorized
-	}
+// newTerminalJWTClaims returns claims for a staff session on a terminal, which expire after
+// terminalIdleTimeout unless renewed.
+func newTerminalJWTClaims(staffID uuid.UUID, tokenVersion uint32, terminalID uuid.UUID) *JWTClaims {
+	claims := newJWTClaims(staffID, models.RoleStaff)
+	claims.ExpiresAt = jwt.NewNumericDate(claims.IssuedAt.Add(terminalIdleTimeout))
+	claims.TokenVersion = tokenVersion
+	claims.TerminalID = &terminalID
+	return claims
+}
 
-	claims := JWTClaims{UserID: owner.ID, Role: models.RoleOwner}
+// setAuthCookie signs the claims and stores the resulting token in the auth cookie.
+func setAuthCookie(ctx echo.Context, claims *JWTClaims) error {
 	token, err := security.NewJWT(claims, jwtSecretKey, jwtExpiration)
 	if err != nil {
-		return echo.ErrInternalServerError
+		return err
 	}
 
 	ctx.SetCookie(&http.Cookie{
@@ -71,58 +73,71 @@ func signInOwner(ctx echo.Context) error {
 		Path:     "/",
 		HttpOnly: true,
 	})
+	return nil
+}
 
-	return ctx.JSON(http.StatusOK, map[string]string{"message": "success"})
+type signInOwnerPayload struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
-func signInStaff(ctx echo.Context) error {
-	payload := struct {
-		Username string `json:"username" validate:"required"`
-		Password string `json:"password" validate:"required"`
-	}{}
+func signInOwner(ctx echo.Context) error {
+	payload := signInOwnerPayload{}
 	if err := ctx.Bind(&payload); err != nil {
 		return echo.ErrBadRequest
 	}
 	if err := ctx.Validate(&payload); err != nil {
-		return echo.ErrBadRequest
+		return err
 	}
 
-	db := ctx.(*routerContext).GetDatabase()
+	owner, err := ctx.(*routerContext).GetServices().Auth.SignInOwner(ctx.Request().Context(), payload.Username, payload.Password)
+	if err != nil {
+		return err
+	}
 
-	staff := &models.Staff{}
-	tx := db.Connection.Where(&models.Staff{Username: payload.Username}).First(staff)
-	if tx.Error != nil {
-		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
-			return echo.ErrNotFound
-		}
+	if err := setAuthCookie(ctx, newJWTClaims(owner.ID, models.RoleOwner)); err != nil {
 		return echo.ErrInternalServerError
 	}
 
-	if err := security.VerifyPasswordHash(payload.Password, staff.PasswordHash); err != nil {
-		return echo.ErrUnauthorized
+	return ctx.JSON(http.StatusOK, map[string]string{"message": "success"})
+}
+
+type signInStaffPayload struct {
+	RestaurantID uuid.UUID `json:"restaurant_id" validate:"required"`
+	Username     string    `json:"username" validate:"required"`
+	Password     string    `json:"password" validate:"required"`
+}
+
+func signInStaff(ctx echo.Context) error {
+	payload := signInStaffPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(&payload); err != nil {
+		return err
 	}
 
-	claims := JWTClaims{UserID: staff.ID, Role: models.RoleStaff}
-	token, err := security.NewJWT(claims, jwtSecretKey, jwtExpiration)
+	staff, err := ctx.(*routerContext).GetServices().Auth.SignInStaff(ctx.Request().Context(), payload.RestaurantID, payload.Username, payload.Password)
 	if err != nil {
-		return echo.ErrInternalServerError
+		return err
 	}
 
-	ctx.SetCookie(&http.Cookie{
-		Name:     jwtCookieName,
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-	})
+	claims := newJWTClaims(staff.ID, models.RoleStaff)
+	claims.TokenVersion = staff.TokenVersion
+	if err := setAuthCookie(ctx, claims); err != nil {
+		return echo.ErrInternalServerError
+	}
 
 	return ctx.JSON(http.StatusOK, map[string]string{"message": "success"})
 }
 
+type signUpOwnerPayload struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
 func signUpOwner(ctx echo.Context) error {
-	payload := struct {
-		Username string `json:"username" validate:"required"`
-		Password string `json:"password" validate:"required"`
-	}{}
+	payload := signUpOwnerPayload{}
 	if err := ctx.Bind(&payload); err != nil {
 		return echo.ErrBadRequest
 	}
@@ -130,37 +145,26 @@ func signUpOwner(ctx echo.Context) error {
 		return err
 	}
 
-	hashedPassword, err := security.HashPassword(payload.Password)
+	owner, err := ctx.(*routerContext).GetServices().Auth.SignUpOwner(ctx.Request().Context(), payload.Username, payload.Password)
 	if err != nil {
-		return echo.ErrInternalServerError
+		return err
 	}
 
-	db := ctx.(*routerContext).GetDatabase()
-
-	user := &models.Owner{
-		Username:     payload.Username,
-		PasswordHash: hashedPassword,
-	}
-	tx := db.Connection.Create(user)
-	if tx.Error != nil {
-		if errors.Is(tx.Error, gorm.ErrDuplicatedKey) {
-			return echo.ErrConflict
-		}
+	if err := setAuthCookie(ctx, newJWTClaims(owner.ID, models.RoleOwner)); err != nil {
 		return echo.ErrInternalServerError
 	}
 
-	claims := &JWTClaims{UserID: user.ID, Role: models.RoleOwner}
-	token, err := security.NewJWT(claims, jwtSecretKey, jwtExpiration)
-	if err != nil {
-		return echo.ErrInternalServerError
-	}
+	return ctx.JSON(http.StatusCreated, map[string]string{"message": "success"})
+}
 
+func signOut(ctx echo.Context) error {
 	ctx.SetCookie(&http.Cookie{
 		Name:     jwtCookieName,
-		Value:    token,
+		Value:    "",
 		Path:     "/",
 		HttpOnly: true,
+		MaxAge:   -1,
 	})
 
-	return ctx.JSON(http.StatusCreated, map[string]string{"message": "success"})
+	return ctx.JSON(http.StatusOK, map[string]string{"message": "success"})
 }
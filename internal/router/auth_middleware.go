@@ -1,11 +1,18 @@
 package router
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/database"
 	"github.com/roushou/pocpoc/internal/models"
 	"github.com/roushou/pocpoc/internal/security"
+	"github.com/roushou/pocpoc/internal/services"
+	"gorm.io/gorm"
 )
 
 type userIDContextKey string
@@ -18,6 +25,8 @@ const jwtCookieName = "token"
 type authUser struct {
 	UserID uuid.UUID
 	Role   models.Role
+	// TerminalID is set when the user signed in on a terminal.
+	TerminalID uuid.UUID
 }
 
 func AuthMiddleware(secret string) echo.MiddlewareFunc {
@@ -36,19 +45,85 @@ func AuthMiddleware(secret string) echo.MiddlewareFunc {
 			claims := &JWTClaims{}
 			_, err = security.ParseJWTWithClaims(cookie.Value, claims, secret)
 			if err != nil {
-				if err == jwt.ErrSignatureInvalid {
+				// Terminal sessions expire after a short inactivity, clients must sign in again
+				if errors.Is(err, jwt.ErrSignatureInvalid) || errors.Is(err, jwt.ErrTokenExpired) {
 					return echo.ErrUnauthorized
 				}
 				return echo.ErrBadRequest
 			}
 
-			if claims.UserID == uuid.Nil {
-				return echo.ErrUnauthorized
+			user, err := verifyJWTClaims(ctx.Request().Context(), rc.GetDatabase(), rc.GetServices(), claims, ctx.Request().TLS, rc.options.terminalCertificates)
+			if err != nil {
+				return err
+			}
+
+			if claims.TerminalID != nil {
+				// Terminal sessions are extended on activity so that they only expire when idle
+				renewed := newTerminalJWTClaims(claims.UserID, claims.TokenVersion, user.TerminalID)
+				if err := setAuthCookie(rc, renewed); err != nil {
+					return echo.ErrInternalServerError
+				}
 			}
 
 			// Set auth user in context for use in handlers
-			rc.Set(string(userIDKey), authUser{UserID: claims.UserID, Role: claims.Role})
+			rc.Set(string(userIDKey), user)
 			return next(rc)
 		}
 	}
 }
+
+// Authenticate returns the user a token issued by the API was issued to, so that other APIs, e.g. gRPC,
+// accept the same tokens. It returns services.ErrUnauthorized for invalid, expired or revoked tokens.
+// Unlike cookies, terminal sessions are not renewed. When terminalCertificates is set, terminal sessions
+// are only accepted on connections made with the client certificate of their terminal, as with
+// WithTerminalCertificates.
+func Authenticate(ctx context.Context, db *database.Database, svc *services.Services, token string, connection *tls.ConnectionState, terminalCertificates bool) (services.Actor, error) {
+	claims := &JWTClaims{}
+	if _, err := security.ParseJWTWithClaims(token, claims, jwtSecretKey); err != nil {
+		return services.Actor{}, services.ErrUnauthorized
+	}
+	user, err := verifyJWTClaims(ctx, db, svc, claims, connection, terminalCertificates)
+	if err != nil {
+		return services.Actor{}, err
+	}
+	return user.actor(), nil
+}
+
+// verifyJWTClaims returns the user of valid claims. It returns services.ErrUnauthorized if the token was
+// revoked: staff tokens when the staff member is deactivated or their password is reset, terminal
+// sessions when the terminal is revoked. Terminal sessions are also refused when terminalCertificates is
+// set and the connection wasn't made with the client certificate of the terminal, so that a session
+// token taken off a terminal can't be used from another device.
+func verifyJWTClaims(ctx context.Context, db *database.Database, svc *services.Services, claims *JWTClaims, connection *tls.ConnectionState, terminalCertificates bool) (authUser, error) {
+	if claims.UserID == uuid.Nil {
+		return authUser{}, services.ErrUnauthorized
+	}
+
+	if claims.Role == models.RoleStaff {
+		if err := svc.Auth.VerifyStaffToken(ctx, claims.UserID, claims.TokenVersion); err != nil {
+			return authUser{}, err
+		}
+	}
+
+	user := authUser{UserID: claims.UserID, Role: claims.Role}
+
+	if claims.TerminalID != nil {
+		terminal := &models.Terminal{}
+		if err := db.Connection.WithContext(ctx).
+			Select("id", "revoked_at").
+			First(terminal, "id = ?", *claims.TerminalID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return authUser{}, services.ErrUnauthorized
+			}
+			return authUser{}, err
+		}
+		if terminal.IsRevoked() {
+			return authUser{}, services.ErrUnauthorized
+		}
+		if terminalCertificates && !hasTerminalCertificate(connection, terminal.ID) {
+			return authUser{}, services.ErrUnauthorized
+		}
+		user.TerminalID = terminal.ID
+	}
+	return user, nil
+}
@@ -0,0 +1,349 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/services"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func bindCashSessionsRouter(router *echo.Group) {
+	group := router.Group("/restaurants/:restaurant_id/cash-sessions")
+	group.GET("", getCashSessions)
+	group.POST("", openCashSession)
+	group.GET("/:session_id", getCashSession)
+	group.POST("/:session_id/movements", createCashMovement)
+	group.POST("/:session_id/close", closeCashSession)
+}
+
+var (
+	errCashSessionClosed = errors.New("cash drawer session is closed")
+	errCashSessionOpen   = errors.New("a cash drawer session is already open")
+)
+
+type CashMovementResponse struct {
+	MovementID uuid.UUID               `json:"movement_id"`
+	StaffID    uuid.UUID               `json:"staff_id"`
+	Kind       models.CashMovementKind `json:"kind"`
+	Amount     float64                 `json:"amount"`
+	Reason     string                  `json:"reason"`
+	CreatedAt  time.Time               `json:"created_at"`
+}
+
+// CashSessionResponse maps fields of CashSession model we are willing to expose. While the session
+// is open, the expected amount is computed from what went in and out of the drawer so far.
+type CashSessionResponse struct {
+	SessionID      uuid.UUID              `json:"session_id"`
+	RestaurantID   uuid.UUID              `json:"restaurant_id"`
+	TerminalID     *uuid.UUID             `json:"terminal_id,omitempty"`
+	OpenedByID     uuid.UUID              `json:"opened_by_id"`
+	OpenedAt       time.Time              `json:"opened_at"`
+	OpeningFloat   float64                `json:"opening_float"`
+	ClosedByID     *uuid.UUID             `json:"closed_by_id,omitempty"`
+	ClosedAt       *time.Time             `json:"closed_at,omitempty"`
+	CashPayments   float64                `json:"cash_payments"`
+	ExpectedAmount float64                `json:"expected_amount"`
+	CountedAmount  *float64               `json:"counted_amount,omitempty"`
+	Variance       *float64               `json:"variance,omitempty"`
+	Movements      []CashMovementResponse `json:"movements"`
+}
+
+func newCashSessionResponse(session *models.CashSession) CashSessionResponse {
+	movements := make([]CashMovementResponse, 0, len(session.Movements))
+	for _, movement := range session.Movements {
+		movements = append(movements, CashMovementResponse{
+			MovementID: movement.ID,
+			StaffID:    movement.StaffID,
+			Kind:       movement.Kind,
+			Amount:     movement.Amount,
+			Reason:     movement.Reason,
+			CreatedAt:  movement.CreatedAt,
+		})
+	}
+	amount, tips := models.SumPayments(session.Payments)
+
+	response := CashSessionResponse{
+		SessionID:      session.ID,
+		RestaurantID:   session.RestaurantID,
+		TerminalID:     session.TerminalID,
+		OpenedByID:     session.OpenedByID,
+		OpenedAt:       session.OpenedAt,
+		OpeningFloat:   session.OpeningFloat,
+		ClosedByID:     session.ClosedByID,
+		ClosedAt:       session.ClosedAt,
+		CashPayments:   models.RoundAmount(amount + tips),
+		ExpectedAmount: session.CalculateExpectedAmount(),
+		Movements:      movements,
+	}
+	if !session.IsOpen() {
+		response.ExpectedAmount = session.ExpectedAmount
+		response.CountedAmount = &session.CountedAmount
+		response.Variance = &session.Variance
+	}
+	return response
+}
+
+// findCashSession returns the session of the restaurant with its movements and cash payments.
+func findCashSession(tx *gorm.DB, restaurantID uuid.UUID, sessionID uuid.UUID) (*models.CashSession, error) {
+	session := &models.CashSession{}
+	if err := tx.
+		Preload("Movements", func(tx *gorm.DB) *gorm.DB { return tx.Order("created_at") }).
+		Preload("Payments").
+		Where("id = ? AND restaurant_id = ?", sessionID, restaurantID).
+		First(session).Error; err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// cashSessionsList are the pages of cash drawer sessions opened between the `from` and `to` dates.
+var cashSessionsList = &listSpec{
+	sorts:       []string{"opened_at"},
+	defaultSort: "opened_at",
+	filters: []listFilter{
+		uuidFilter("terminal_id", "terminal_id", "Only list the sessions of the terminal."),
+		dateRangeFilter("opened_at", true),
+	},
+}
+
+func getCashSessions(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	restaurant, err := findAccessibleRestaurant(ctx, authUser, restaurantID)
+	if err != nil {
+		return err
+	}
+
+	query := db.Connection.
+		Preload("Movements", func(tx *gorm.DB) *gorm.DB { return tx.Order("created_at") }).
+		Preload("Payments").
+		Where("restaurant_id = ?", restaurantID)
+	rows, err := findPage[models.CashSession](ctx, cashSessionsList, query, restaurant.Location())
+	if err != nil {
+		return err
+	}
+
+	sessions := make([]CashSessionResponse, 0, len(rows))
+	for _, session := range rows {
+		sessions = append(sessions, newCashSessionResponse(&session))
+	}
+
+	return ctx.JSON(http.StatusOK, sessions)
+}
+
+func getCashSession(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	sessionID, err := uuid.Parse(ctx.Param("session_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findAccessibleRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	session, err := findCashSession(db.Connection, restaurantID, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.ErrNotFound
+		}
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, newCashSessionResponse(session))
+}
+
+type openCashSessionPayload struct {
+	OpeningFloat float64 `json:"opening_float" validate:"gte=0"`
+}
+
+// openCashSession opens a drawer session with the counted opening float. A terminal, or a staff
+// member not using a terminal, can only have one open session at a time.
+func openCashSession(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	payload := openCashSessionPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	// Only staff can open a cash drawer
+	staff, err := findRestaurantStaff(ctx, authUser, restaurantID)
+	if err != nil {
+		return err
+	}
+
+	session := &models.CashSession{
+		RestaurantID: restaurantID,
+		OpenedByID:   staff.ID,
+		OpenedAt:     db.Connection.NowFunc(),
+		OpeningFloat: models.RoundAmount(payload.OpeningFloat),
+	}
+	if authUser.TerminalID != uuid.Nil {
+		session.TerminalID = &authUser.TerminalID
+	}
+	err = db.Connection.Transaction(func(tx *gorm.DB) error {
+		payments := services.NewGormStore(tx).Payments()
+		if _, err := payments.FindOpenCashSession(ctx.Request().Context(), restaurantID, staff.ID, authUser.TerminalID); err == nil {
+			return errCashSessionOpen
+		} else if !errors.Is(err, services.ErrNotFound) {
+			return err
+		}
+		return tx.Create(session).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, newCashSessionResponse(session))
+}
+
+type createCashMovementPayload struct {
+	Kind   models.CashMovementKind `json:"kind" validate:"required,oneof=pay_in pay_out"`
+	Amount float64                 `json:"amount" validate:"gt=0"`
+	Reason string                  `json:"reason" validate:"required"`
+}
+
+// createCashMovement records cash put in or taken out of an open drawer, e.g. change brought from
+// the bank or a supplier paid in cash.
+func createCashMovement(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := createCashMovementPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	return updateCashSession(ctx, authUser, func(tx *gorm.DB, session *models.CashSession, staff *models.Staff) error {
+		movement := models.CashMovement{
+			CashSessionID: session.ID,
+			StaffID:       staff.ID,
+			Kind:          payload.Kind,
+			Amount:        models.RoundAmount(payload.Amount),
+			Reason:        payload.Reason,
+		}
+		if err := tx.Create(&movement).Error; err != nil {
+			return err
+		}
+		session.Movements = append(session.Movements, movement)
+		return nil
+	})
+}
+
+type closeCashSessionPayload struct {
+	CountedAmount *float64 `json:"counted_amount" validate:"required,gte=0"`
+}
+
+// closeCashSession closes a drawer with the amount counted in it. The variance is the difference
+// between the counted and the expected amounts.
+func closeCashSession(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := closeCashSessionPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	return updateCashSession(ctx, authUser, func(tx *gorm.DB, session *models.CashSession, staff *models.Staff) error {
+		now := tx.NowFunc()
+		session.ClosedAt = &now
+		session.ClosedByID = &staff.ID
+		session.ExpectedAmount = session.CalculateExpectedAmount()
+		session.CountedAmount = models.RoundAmount(*payload.CountedAmount)
+		session.Variance = models.RoundAmount(session.CountedAmount - session.ExpectedAmount)
+		return tx.Model(session).Omit(clause.Associations).Updates(map[string]any{
+			"closed_at":       session.ClosedAt,
+			"closed_by_id":    session.ClosedByID,
+			"expected_amount": session.ExpectedAmount,
+			"counted_amount":  session.CountedAmount,
+			"variance":        session.Variance,
+		}).Error
+	})
+}
+
+// updateCashSession applies the update to an open session of a restaurant the auth user works at.
+func updateCashSession(ctx echo.Context, user *authUser, update func(tx *gorm.DB, session *models.CashSession, staff *models.Staff) error) error {
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	sessionID, err := uuid.Parse(ctx.Param("session_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	staff, err := findRestaurantStaff(ctx, user, restaurantID)
+	if err != nil {
+		return err
+	}
+
+	var session *models.CashSession
+	err = db.Connection.Transaction(func(tx *gorm.DB) error {
+		session, err = findCashSession(tx, restaurantID, sessionID)
+		if err != nil {
+			return err
+		}
+		if !session.IsOpen() {
+			return errCashSessionClosed
+		}
+		return update(tx, session, staff)
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, newCashSessionResponse(session))
+}
@@ -0,0 +1,97 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCashSessions(t *testing.T) {
+	f := newFixture(t)
+	sessions := fmt.Sprintf("/api/restaurants/%s/cash-sessions", f.restaurantID)
+	zReports := fmt.Sprintf("/api/restaurants/%s/z-reports", f.restaurantID)
+
+	// expectCode sends the request and checks the code of the error it fails with
+	expectCode := func(t *testing.T, c *testClient, status int, method, path string, body any, code string) {
+		t.Helper()
+		response := c.expect(t, status, method, path, body)
+		errorBody := ErrorResponse{}
+		response.decode(t, &errorBody)
+		assert.Equal(t, code, errorBody.Code)
+	}
+	open := func(t *testing.T, c *testClient, openingFloat float64) uuid.UUID {
+		t.Helper()
+		response := c.expect(t, http.StatusCreated, http.MethodPost, sessions, openCashSessionPayload{OpeningFloat: openingFloat})
+		return createdID(t, response, "session_id")
+	}
+
+	// Staff members sign in on the terminal with their PIN
+	response := f.owner.expect(t, http.StatusCreated, http.MethodPost, "/api/restaurants/"+f.restaurantID.String()+"/terminals", registerTerminalPayload{Name: "Counter"})
+	terminal := struct {
+		DeviceToken string `json:"device_token"`
+	}{}
+	response.decode(t, &terminal)
+	header := http.Header{}
+	header.Set(terminalTokenHeader, terminal.DeviceToken)
+	signInOnTerminal := func(t *testing.T, staffID uuid.UUID) *testClient {
+		t.Helper()
+		f.owner.expect(t, http.StatusNoContent, http.MethodPut, fmt.Sprintf("/api/restaurants/%s/staff/%s/pin", f.restaurantID, staffID), setStaffPinPayload{Pin: "1234"})
+		c := f.server.client()
+		response := c.do(t, http.MethodPost, "/api/terminal/pin-sign-in", signInStaffWithPinPayload{StaffID: staffID, Pin: "1234"}, header)
+		require.Equal(t, http.StatusOK, response.Code, string(response.Body))
+		return c
+	}
+	managerOnTerminal := signInOnTerminal(t, f.managerID)
+	waiterOnTerminal := signInOnTerminal(t, f.waiterID)
+
+	var waiterSessionID, terminalSessionID uuid.UUID
+	t.Run("opens one session per staff member or terminal", func(t *testing.T) {
+		waiterSessionID = open(t, f.waiter, 100)
+		expectCode(t, f.waiter, http.StatusConflict, http.MethodPost, sessions, openCashSessionPayload{OpeningFloat: 100}, "cash_session_open")
+
+		// The drawer of the terminal is shared by the staff signed in on it
+		terminalSessionID = open(t, managerOnTerminal, 50)
+		expectCode(t, waiterOnTerminal, http.StatusConflict, http.MethodPost, sessions, openCashSessionPayload{OpeningFloat: 50}, "cash_session_open")
+	})
+
+	t.Run("refuses to close the day while a drawer is open", func(t *testing.T) {
+		expectCode(t, f.owner, http.StatusConflict, http.MethodPost, zReports, closeBusinessDayPayload{}, "cash_sessions_open")
+	})
+
+	t.Run("sums the business day in the Z report", func(t *testing.T) {
+		for _, payment := range []createPaymentPayload{
+			{Method: models.PaymentMethodCard, Amount: 10, TipAmount: 2},
+			{Method: models.PaymentMethodCash, Amount: 10, TipAmount: 1},
+		} {
+			orderID := f.waiter.createOrder(t, f.restaurantID, "1", f.productID)
+			f.waiter.expect(t, http.StatusCreated, http.MethodPost, "/api/orders/"+orderID.String()+"/payments", payment)
+		}
+		cancelledID := f.waiter.createOrder(t, f.restaurantID, "2", f.productID)
+		f.waiter.expect(t, http.StatusOK, http.MethodPut, "/api/orders/"+cancelledID.String()+"/status", updateOrderStatusPayload{Status: models.OrderStatusCancelled})
+
+		// The cash payment and its tip went in the drawer of the waiter, 1 is missing from it
+		waiterCounted, terminalCounted := 110.0, 50.0
+		f.waiter.expect(t, http.StatusOK, http.MethodPost, fmt.Sprintf("%s/%s/close", sessions, waiterSessionID), closeCashSessionPayload{CountedAmount: &waiterCounted})
+		managerOnTerminal.expect(t, http.StatusOK, http.MethodPost, fmt.Sprintf("%s/%s/close", sessions, terminalSessionID), closeCashSessionPayload{CountedAmount: &terminalCounted})
+
+		report := ZReportResponse{}
+		f.owner.expect(t, http.StatusCreated, http.MethodPost, zReports, closeBusinessDayPayload{}).decode(t, &report)
+		assert.Equal(t, models.ZReportSummary{
+			OrdersCount: 2,
+			GrossSales:  20,
+			NetSales:    20,
+			Tips:        3,
+			Payments: []models.ZReportPaymentSummary{
+				{Method: models.PaymentMethodCard, Count: 1, Amount: 10, Tips: 2},
+				{Method: models.PaymentMethodCash, Count: 1, Amount: 10, Tips: 1},
+			},
+			Voids: models.ZReportVoidSummary{Count: 1, Amount: 10},
+			Cash:  models.ZReportCashSummary{Sessions: 2, Expected: 161, Counted: 160, Variance: -1},
+		}, report.Summary)
+	})
+}
@@ -0,0 +1,467 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/database"
+	"github.com/roushou/pocpoc/internal/loyalty"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/promotions"
+	"github.com/roushou/pocpoc/internal/services"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func bindCustomersRouter(router *echo.Group) {
+	group := router.Group("/restaurants/:restaurant_id/customers")
+	group.GET("", getCustomers)
+	group.POST("", createCustomer)
+	group.GET("/:customer_id", getCustomer)
+	group.PUT("/:customer_id", updateCustomer)
+	group.GET("/:customer_id/orders", getCustomerOrders)
+	group.GET("/:customer_id/loyalty", getCustomerLoyaltyTransactions)
+
+	orders := router.Group("/orders/:order_id")
+	orders.PUT("/customer", setOrderCustomer)
+	orders.POST("/loyalty/redeem", redeemLoyaltyPoints)
+}
+
+// CustomerResponse maps fields of Customer model we are willing to expose.
+type CustomerResponse struct {
+	CustomerID       uuid.UUID  `json:"customer_id"`
+	Name             string     `json:"name"`
+	Phone            string     `json:"phone"`
+	Email            string     `json:"email"`
+	EmailConsent     bool       `json:"email_consent"`
+	SMSConsent       bool       `json:"sms_consent"`
+	ConsentUpdatedAt *time.Time `json:"consent_updated_at,omitempty"`
+	LoyaltyPoints    int64      `json:"loyalty_points"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+func newCustomerResponse(customer *models.Customer) CustomerResponse {
+	return CustomerResponse{
+		CustomerID:       customer.ID,
+		Name:             customer.Name,
+		Phone:            customer.Phone,
+		Email:            customer.Email,
+		EmailConsent:     customer.EmailConsent,
+		SMSConsent:       customer.SMSConsent,
+		ConsentUpdatedAt: customer.ConsentUpdatedAt,
+		LoyaltyPoints:    customer.LoyaltyPoints,
+		CreatedAt:        customer.CreatedAt,
+		UpdatedAt:        customer.UpdatedAt,
+	}
+}
+
+// LoyaltyTransactionResponse maps fields of LoyaltyTransaction model we are willing to expose.
+type LoyaltyTransactionResponse struct {
+	TransactionID uuid.UUID                     `json:"transaction_id"`
+	RestaurantID  uuid.UUID                     `json:"restaurant_id"`
+	OrderID       uuid.UUID                     `json:"order_id"`
+	Kind          models.LoyaltyTransactionKind `json:"kind"`
+	Points        int64                         `json:"points"`
+	CreatedAt     time.Time                     `json:"created_at"`
+}
+
+func newLoyaltyTransactionResponse(transaction *models.LoyaltyTransaction) LoyaltyTransactionResponse {
+	return LoyaltyTransactionResponse{
+		TransactionID: transaction.ID,
+		RestaurantID:  transaction.RestaurantID,
+		OrderID:       transaction.OrderID,
+		Kind:          transaction.Kind,
+		Points:        transaction.Points,
+		CreatedAt:     transaction.CreatedAt,
+	}
+}
+
+type customerInput struct {
+	Name         string `json:"name" validate:"required,max=100"`
+	Phone        string `json:"phone" validate:"omitempty,e164"`
+	Email        string `json:"email" validate:"omitempty,email"`
+	EmailConsent bool   `json:"email_consent"`
+	SMSConsent   bool   `json:"sms_consent"`
+}
+
+// findRestaurantCustomer returns the customer if they belong to the owner of the restaurant.
+func findRestaurantCustomer(db *database.Database, restaurant *models.Restaurant, customerID uuid.UUID) (*models.Customer, error) {
+	customer := &models.Customer{}
+	if err := db.Connection.
+		Where("id = ? AND owner_id = ?", customerID, restaurant.OwnerID).
+		First(customer).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.ErrNotFound
+		}
+		return nil, echo.ErrInternalServerError
+	}
+	return customer, nil
+}
+
+// findAccessibleCustomer returns the customer from the path if the auth user can access the restaurant
+// from the path, and the customer belongs to its owner.
+func findAccessibleCustomer(ctx echo.Context, user *authUser) (*models.Customer, error) {
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return nil, echo.ErrBadRequest
+	}
+	customerID, err := uuid.Parse(ctx.Param("customer_id"))
+	if err != nil {
+		return nil, echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	restaurant, err := findAccessibleRestaurant(ctx, user, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	return findRestaurantCustomer(db, restaurant, customerID)
+}
+
+// customersList are the pages of customers of an owner.
+var customersList = &listSpec{
+	sorts:       []string{"name", "loyalty_points"},
+	defaultSort: "name",
+	filters: []listFilter{
+		boolFilter("email_consent", "email_consent", "Only list the customers who agreed to be contacted by email, or not."),
+		boolFilter("sms_consent", "sms_consent", "Only list the customers who agreed to be contacted by SMS, or not."),
+	},
+}
+
+// customerOrdersList are the pages of the order history of a customer, the latest first.
+var customerOrdersList = &listSpec{sorts: []string{"total_amount"}, defaultSort: "-id", filters: []listFilter{orderStatusFilter}}
+
+// loyaltyTransactionsList are the pages of loyalty transactions of a customer, the latest first.
+var loyaltyTransactionsList = &listSpec{
+	defaultSort: "-id",
+	filters: []listFilter{
+		enumFilter("kind", "kind", "Only list the transactions of the kind.", enumValues[reflect.TypeOf(models.LoyaltyTransactionKind(""))]),
+	},
+}
+
+// getCustomers lists the customers of the owner of the restaurant, optionally searched by name, phone
+// or email with the `q` query parameter.
+func getCustomers(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	restaurant, err := findAccessibleRestaurant(ctx, authUser, restaurantID)
+	if err != nil {
+		return err
+	}
+
+	query := db.Connection.Where("owner_id = ?", restaurant.OwnerID)
+	if search := strings.TrimSpace(ctx.QueryParam("q")); search != "" {
+		pattern := "%" + strings.ToLower(search) + "%"
+		query = query.Where("LOWER(name) LIKE ? OR phone LIKE ? OR LOWER(email) LIKE ?", pattern, pattern, pattern)
+	}
+
+	rows, err := findPage[models.Customer](ctx, customersList, query, restaurant.Location())
+	if err != nil {
+		return err
+	}
+
+	customers := make([]CustomerResponse, 0, len(rows))
+	for _, customer := range rows {
+		customers = append(customers, newCustomerResponse(&customer))
+	}
+
+	return ctx.JSON(http.StatusOK, customers)
+}
+
+func createCustomer(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := customerInput{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	restaurant, err := findAccessibleRestaurant(ctx, authUser, restaurantID)
+	if err != nil {
+		return err
+	}
+
+	customer := &models.Customer{
+		OwnerID:      restaurant.OwnerID,
+		Name:         payload.Name,
+		Phone:        payload.Phone,
+		Email:        strings.ToLower(payload.Email),
+		EmailConsent: payload.EmailConsent,
+		SMSConsent:   payload.SMSConsent,
+	}
+	if customer.EmailConsent || customer.SMSConsent {
+		now := db.Connection.NowFunc()
+		customer.ConsentUpdatedAt = &now
+	}
+	if err := db.Connection.Create(customer).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusCreated, newCustomerResponse(customer))
+}
+
+func getCustomer(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	customer, err := findAccessibleCustomer(ctx, authUser)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, newCustomerResponse(customer))
+}
+
+// updateCustomer updates the details and consents of the customer. Loyalty points only change through
+// orders.
+func updateCustomer(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := customerInput{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	customer, err := findAccessibleCustomer(ctx, authUser)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if customer.EmailConsent != payload.EmailConsent || customer.SMSConsent != payload.SMSConsent {
+		now := db.Connection.NowFunc()
+		customer.ConsentUpdatedAt = &now
+	}
+	customer.Name = payload.Name
+	customer.Phone = payload.Phone
+	customer.Email = strings.ToLower(payload.Email)
+	customer.EmailConsent = payload.EmailConsent
+	customer.SMSConsent = payload.SMSConsent
+	if err := db.Connection.
+		Model(customer).
+		Select("name", "phone", "email", "email_consent", "sms_consent", "consent_updated_at").
+		Updates(customer).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, newCustomerResponse(customer))
+}
+
+// getCustomerOrders lists the most recent orders of the customer in any restaurant of the owner.
+func getCustomerOrders(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	customer, err := findAccessibleCustomer(ctx, authUser)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	rows, err := findPage[models.Order](ctx, customerOrdersList, db.Connection.Preload("OrderItems").Where("customer_id = ?", customer.ID), time.UTC)
+	if err != nil {
+		return err
+	}
+
+	orders := make([]OrderResponse, 0, len(rows))
+	for _, order := range rows {
+		orders = append(orders, newOrderResponse(&order))
+	}
+
+	return ctx.JSON(http.StatusOK, orders)
+}
+
+func getCustomerLoyaltyTransactions(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	customer, err := findAccessibleCustomer(ctx, authUser)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	rows, err := findPage[models.LoyaltyTransaction](ctx, loyaltyTransactionsList, db.Connection.Where("customer_id = ?", customer.ID), time.UTC)
+	if err != nil {
+		return err
+	}
+
+	transactions := make([]LoyaltyTransactionResponse, 0, len(rows))
+	for _, transaction := range rows {
+		transactions = append(transactions, newLoyaltyTransactionResponse(&transaction))
+	}
+
+	return ctx.JSON(http.StatusOK, transactions)
+}
+
+type setOrderCustomerPayload struct {
+	CustomerID *uuid.UUID `json:"customer_id"`
+}
+
+// setOrderCustomer attaches a customer to an order, or detaches it when the customer ID is null. The
+// customer can't be changed once the order is paid or points were redeemed on it.
+func setOrderCustomer(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := setOrderCustomerPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+
+	order, err := findAccessibleOrder(ctx, authUser)
+	if err != nil {
+		return err
+	}
+	if err := services.CheckPayable(order); err != nil {
+		return err
+	}
+	if order.RedeemedPoints > 0 {
+		return loyalty.ErrAlreadyRedeemed
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	restaurant := &models.Restaurant{}
+	if err := db.Connection.First(restaurant, "id = ?", order.RestaurantID).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+	if payload.CustomerID != nil {
+		if _, err := findRestaurantCustomer(db, restaurant, *payload.CustomerID); err != nil {
+			if errors.Is(err, echo.ErrNotFound) {
+				return services.ErrUnknownCustomer
+			}
+			return err
+		}
+	}
+
+	order.CustomerID = payload.CustomerID
+	err = db.Connection.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Model(order).
+			Omit(clause.Associations).
+			Update("customer_id", order.CustomerID).Error; err != nil {
+			return err
+		}
+		// Promotions limited per customer depend on the customer, payments already made must stay
+		// within the total
+		if len(order.Payments) > 0 {
+			return nil
+		}
+		_, err := promotions.Apply(tx, restaurant, order, time.Now())
+		return err
+	})
+	if err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, newOrderResponse(order))
+}
+
+type redeemLoyaltyPointsPayload struct {
+	Points int64 `json:"points" validate:"gt=0"`
+}
+
+// redeemLoyaltyPoints turns loyalty points of the customer of the order into a discount. Orders paid
+// entirely with points are paid right away.
+func redeemLoyaltyPoints(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	// Only staff can take payments
+	if authUser.Role != models.RoleStaff {
+		return echo.ErrUnauthorized
+	}
+
+	payload := redeemLoyaltyPointsPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	order, err := findAccessibleOrder(ctx, authUser)
+	if err != nil {
+		return err
+	}
+	// Payments already made must stay within the total
+	if err := services.CheckPayable(order); err != nil {
+		return err
+	}
+	if len(order.Payments) > 0 {
+		return errOrderHasPayments
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	err = db.Connection.Transaction(func(tx *gorm.DB) error {
+		restaurant := &models.Restaurant{}
+		if err := tx.First(restaurant, "id = ?", order.RestaurantID).Error; err != nil {
+			return err
+		}
+		if _, err := loyalty.Redeem(tx, order, restaurant, payload.Points); err != nil {
+			return err
+		}
+		if order.TotalAmount > 0 {
+			return nil
+		}
+		return services.NewPaymentService(services.NewGormStore(tx)).MarkPaid(ctx.Request().Context(), order)
+	})
+	if err != nil {
+		return err
+	}
+	if order.IsPaid() {
+		ctx.(*routerContext).GetServices().Orders.Publish(order)
+	}
+
+	return ctx.JSON(http.StatusOK, newOrderResponse(order))
+}
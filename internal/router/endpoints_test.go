@@ -0,0 +1,447 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/integrations"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Actors of the endpoint tests.
+const (
+	actorAnonymous  = "anonymous"
+	actorOwner      = "owner"
+	actorManager    = "manager"
+	actorWaiter     = "waiter"
+	actorOtherOwner = "other owner"
+	actorOtherStaff = "other staff"
+)
+
+// endpointTest calls an endpoint as an actor allowed to, after checking that the denied actors
+// can't. Tests run in order on the same fixture, each one building on the state left by the
+// previous ones.
+type endpointTest struct {
+	// route is the method and path of the route as registered, e.g. "GET /api/restaurants/:restaurant_id".
+	route string
+	// as is the actor of the happy path.
+	as    string
+	query string
+	body  func(t *testing.T, s *endpointState) any
+	// header is sent on the happy path only.
+	header func(t *testing.T, s *endpointState) http.Header
+	// denied are refused on top of anonymous clients on routes needing a session, and the other
+	// owner and staff on routes scoped to the restaurant.
+	denied []string
+	// public routes don't need a session.
+	public bool
+	// then saves what later tests need from the response.
+	then func(t *testing.T, s *endpointState, response *testResponse)
+}
+
+// endpointState is the fixture and the path params of the endpoint tests.
+type endpointState struct {
+	*fixture
+	params map[string]string
+	// values are strings saved by tests for later ones, e.g. device tokens.
+	values map[string]string
+}
+
+func (s *endpointState) client(actor string) *testClient {
+	switch actor {
+	case actorOwner:
+		return s.owner
+	case actorManager:
+		return s.manager
+	case actorWaiter:
+		return s.waiter
+	case actorOtherOwner:
+		return s.otherOwner
+	case actorOtherStaff:
+		return s.otherStaff
+	}
+	return s.server.client()
+}
+
+// path fills the params of the route path.
+func (s *endpointState) path(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if name, ok := strings.CutPrefix(segment, ":"); ok {
+			segments[i] = s.params[name]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// saveID saves the ID named key in the response as the path param.
+func saveID(key string) func(t *testing.T, s *endpointState, response *testResponse) {
+	return func(t *testing.T, s *endpointState, response *testResponse) {
+		s.params[key] = createdID(t, response, key).String()
+	}
+}
+
+func webhookBody(s *endpointState) []byte {
+	return []byte(`{"id":"ext-1","type":"delivery","customer":{"name":"Ada","phone":"+33600000000"},` +
+		`"delivery":{"address":"1 rue de Rivoli","fee":3},"items":[{"sku":"` + s.productID.String() + `","quantity":1}]}`)
+}
+
+func endpointTests() []endpointTest {
+	today := time.Now().UTC().Format(time.DateOnly)
+	available := false
+	counted := 20.0
+	pin := "1234"
+
+	return []endpointTest{
+		// Health and docs
+		{route: "GET /api/_health", public: true},
+		{route: "GET /api/_health/ready", public: true},
+		{route: "GET /api/openapi.json", public: true},
+		{route: "GET /api/docs", public: true},
+
+		// Auth
+		{route: "POST /api/auth/owners/sign-up", public: true, body: func(t *testing.T, s *endpointState) any {
+			return signUpOwnerPayload{Username: "new", Password: testPassword}
+		}},
+		{route: "POST /api/auth/owners/sign-in", public: true, body: func(t *testing.T, s *endpointState) any {
+			return signInOwnerPayload{Username: "owner", Password: testPassword}
+		}},
+		{route: "POST /api/auth/staff/sign-in", public: true, body: func(t *testing.T, s *endpointState) any {
+			return signInStaffPayload{RestaurantID: s.restaurantID, Username: "waiter", Password: testPassword}
+		}},
+		{route: "POST /api/auth/sign-out", public: true},
+
+		// Restaurants
+		{route: "GET /api/restaurants", as: actorOwner},
+		{route: "POST /api/restaurants", as: actorOwner, body: func(t *testing.T, s *endpointState) any {
+			return registerRestaurantPayload{Name: "Ramen Bar"}
+		}},
+		{route: "GET /api/restaurants/:restaurant_id", as: actorWaiter},
+		{route: "PATCH /api/restaurants/:restaurant_id", as: actorOwner, denied: []string{actorManager}, body: func(t *testing.T, s *endpointState) any {
+			return updateRestaurantPayload{Name: "Ramen House"}
+		}},
+		{route: "POST /api/restaurants/:restaurant_id/archive", as: actorOwner, denied: []string{actorManager}},
+		{route: "POST /api/restaurants/:restaurant_id/unarchive", as: actorOwner, denied: []string{actorManager}},
+		{route: "GET /api/restaurants/:restaurant_id/settings", as: actorWaiter},
+		{route: "PUT /api/restaurants/:restaurant_id/settings", as: actorOwner, denied: []string{actorManager}, body: func(t *testing.T, s *endpointState) any {
+			return updateRestaurantSettingsPayload{
+				TimeZone: "UTC",
+				Currency: "EUR",
+				TaxRate:  10,
+				Loyalty:  models.LoyaltyRules{PointsPerUnit: 1, PointValue: 0.1},
+			}
+		}},
+
+		// Staff
+		{route: "GET /api/restaurants/:restaurant_id/staff", as: actorOwner, denied: []string{actorManager}},
+		{route: "POST /api/restaurants/:restaurant_id/staff", as: actorOwner, denied: []string{actorManager}, body: func(t *testing.T, s *endpointState) any {
+			return registerStaffPayload{Username: "cook", Password: testPassword, Role: models.StaffRoleKitchen}
+		}, then: saveID("staff_id")},
+		{route: "GET /api/restaurants/:restaurant_id/staff/:staff_id", as: actorOwner, denied: []string{actorManager}},
+		{route: "PATCH /api/restaurants/:restaurant_id/staff/:staff_id", as: actorOwner, denied: []string{actorManager}, body: func(t *testing.T, s *endpointState) any {
+			displayName := "Cook"
+			return updateStaffMemberPayload{DisplayName: &displayName}
+		}},
+		{route: "POST /api/restaurants/:restaurant_id/staff/:staff_id/deactivate", as: actorOwner, denied: []string{actorManager}},
+		{route: "POST /api/restaurants/:restaurant_id/staff/:staff_id/reactivate", as: actorOwner, denied: []string{actorManager}},
+		{route: "POST /api/restaurants/:restaurant_id/staff/:staff_id/reset-password", as: actorOwner, denied: []string{actorManager}, body: func(t *testing.T, s *endpointState) any {
+			return resetStaffPasswordPayload{Password: testPassword}
+		}},
+		{route: "PUT /api/restaurants/:restaurant_id/staff/:staff_id/pin", as: actorOwner, denied: []string{actorManager}, body: func(t *testing.T, s *endpointState) any {
+			return setStaffPinPayload{Pin: pin}
+		}},
+
+		// Terminals
+		{route: "GET /api/restaurants/:restaurant_id/terminals", as: actorOwner, denied: []string{actorManager}},
+		{route: "POST /api/restaurants/:restaurant_id/terminals", as: actorOwner, denied: []string{actorManager}, body: func(t *testing.T, s *endpointState) any {
+			return registerTerminalPayload{Name: "Counter"}
+		}, then: func(t *testing.T, s *endpointState, response *testResponse) {
+			saveID("terminal_id")(t, s, response)
+			terminal := map[string]string{}
+			response.decode(t, &terminal)
+			s.values["device_token"] = terminal["device_token"]
+		}},
+		{route: "GET /api/terminal/staff", as: actorAnonymous, header: terminalHeader},
+		{route: "POST /api/terminal/pin-sign-in", as: actorAnonymous, header: terminalHeader, body: func(t *testing.T, s *endpointState) any {
+			return signInStaffWithPinPayload{StaffID: uuid.MustParse(s.params["staff_id"]), Pin: pin}
+		}},
+		{route: "POST /api/restaurants/:restaurant_id/terminals/:terminal_id/revoke", as: actorOwner, denied: []string{actorManager}},
+
+		// Shifts
+		{route: "POST /api/restaurants/:restaurant_id/shifts/clock-in", as: actorWaiter, denied: []string{actorOwner}},
+		{route: "GET /api/restaurants/:restaurant_id/shifts/current", as: actorWaiter, denied: []string{actorOwner}},
+		{route: "POST /api/restaurants/:restaurant_id/shifts/breaks/start", as: actorWaiter, denied: []string{actorOwner}},
+		{route: "POST /api/restaurants/:restaurant_id/shifts/breaks/end", as: actorWaiter, denied: []string{actorOwner}},
+		{route: "POST /api/restaurants/:restaurant_id/shifts/clock-out", as: actorWaiter, denied: []string{actorOwner}},
+		{route: "GET /api/restaurants/:restaurant_id/shifts", as: actorOwner, denied: []string{actorManager}},
+		{route: "GET /api/restaurants/:restaurant_id/timesheets", as: actorOwner, denied: []string{actorManager}},
+
+		// Products
+		{route: "GET /api/restaurants/:restaurant_id/products", as: actorWaiter},
+		{route: "GET /api/restaurants/:restaurant_id/products/search", as: actorWaiter, query: "?q=ram"},
+		{route: "POST /api/restaurants/:restaurant_id/products", as: actorOwner, denied: []string{actorManager}, body: func(t *testing.T, s *endpointState) any {
+			return registerProductPayload{Title: "Gyoza", Description: "Pork", Category: "sides", UnitPrice: 6}
+		}, then: saveID("product_id")},
+		{route: "PUT /api/restaurants/:restaurant_id/products/:product_id/availability", as: actorWaiter, body: func(t *testing.T, s *endpointState) any {
+			return updateProductAvailabilityPayload{Available: &available}
+		}},
+
+		// Tables
+		{route: "GET /api/restaurants/:restaurant_id/tables", as: actorWaiter},
+		{route: "POST /api/restaurants/:restaurant_id/tables", as: actorOwner, denied: []string{actorManager}, body: func(t *testing.T, s *endpointState) any {
+			return registerTablePayload{Number: "2", Seats: 2}
+		}, then: saveID("table_id")},
+		{route: "GET /api/restaurants/:restaurant_id/tables/:table_id/token", as: actorOwner, denied: []string{actorWaiter}},
+		{route: "POST /api/restaurants/:restaurant_id/tables/:table_id/token", as: actorOwner},
+		{route: "GET /api/restaurants/:restaurant_id/tables/:table_id/qr", as: actorWaiter},
+		{route: "DELETE /api/restaurants/:restaurant_id/tables/:table_id", as: actorOwner, denied: []string{actorManager}},
+
+		// Guests
+		{route: "GET /api/public/tables/:table_token/menu", public: true},
+		{route: "POST /api/public/tables/:table_token/orders", public: true, body: func(t *testing.T, s *endpointState) any {
+			return createGuestOrderPayload{Products: []orderItemInput{{ProductID: s.productID, Quantity: 1}}}
+		}, then: saveID("order_id")},
+		{route: "GET /api/public/tables/:table_token/orders/:order_id", public: true},
+
+		// Orders
+		{route: "POST /api/restaurants/:restaurant_id/orders", as: actorWaiter, denied: []string{actorOwner}, body: func(t *testing.T, s *endpointState) any {
+			return createOrderPayload{
+				orderTypeInput: orderTypeInput{TableNumber: "1"},
+				Products:       []orderItemInput{{ProductID: s.productID, Quantity: 3}},
+			}
+		}, then: saveID("order_id")},
+		{route: "GET /api/restaurants/:restaurant_id/orders", as: actorOwner, query: "?status=pending"},
+		{route: "GET /api/restaurants/:restaurant_id/orders/search", as: actorOwner, query: "?q=1"},
+		{route: "GET /api/restaurants/:restaurant_id/pickup-slots", as: actorWaiter},
+		{route: "PUT /api/orders/:order_id/status", as: actorWaiter, body: func(t *testing.T, s *endpointState) any {
+			return updateOrderStatusPayload{Status: models.OrderStatusConfirmed}
+		}},
+		{route: "GET /api/orders/:order_id/receipt", as: actorWaiter},
+
+		// Promotions
+		{route: "GET /api/restaurants/:restaurant_id/promotions", as: actorWaiter},
+		{route: "POST /api/restaurants/:restaurant_id/promotions", as: actorOwner, denied: []string{actorManager}, body: func(t *testing.T, s *endpointState) any {
+			return createPromotionPayload{Name: "Welcome", Kind: models.PromotionKindFixedAmount, Code: "WELCOME", Amount: 2}
+		}, then: saveID("promotion_id")},
+		{route: "PUT /api/orders/:order_id/coupon", as: actorWaiter, body: func(t *testing.T, s *endpointState) any {
+			return setOrderCouponPayload{Code: "WELCOME"}
+		}},
+		{route: "GET /api/orders/:order_id/promotions", as: actorWaiter},
+		{route: "DELETE /api/restaurants/:restaurant_id/promotions/:promotion_id", as: actorOwner, denied: []string{actorManager}},
+
+		// Customers
+		{route: "GET /api/restaurants/:restaurant_id/customers", as: actorWaiter},
+		{route: "POST /api/restaurants/:restaurant_id/customers", as: actorWaiter, body: func(t *testing.T, s *endpointState) any {
+			return customerInput{Name: "Ada", Phone: "+33600000000"}
+		}, then: func(t *testing.T, s *endpointState, response *testResponse) {
+			saveID("customer_id")(t, s, response)
+			// Points earned on earlier visits
+			require.NoError(t, s.server.db.Connection.
+				Model(&models.Customer{}).
+				Where("id = ?", s.params["customer_id"]).
+				Update("loyalty_points", 100).Error)
+		}},
+		{route: "GET /api/restaurants/:restaurant_id/customers/:customer_id", as: actorWaiter},
+		{route: "PUT /api/restaurants/:restaurant_id/customers/:customer_id", as: actorWaiter, body: func(t *testing.T, s *endpointState) any {
+			return customerInput{Name: "Ada Lovelace", Phone: "+33600000000"}
+		}},
+		{route: "PUT /api/orders/:order_id/customer", as: actorWaiter, body: func(t *testing.T, s *endpointState) any {
+			customerID := uuid.MustParse(s.params["customer_id"])
+			return setOrderCustomerPayload{CustomerID: &customerID}
+		}},
+		{route: "POST /api/orders/:order_id/loyalty/redeem", as: actorWaiter, denied: []string{actorOwner}, body: func(t *testing.T, s *endpointState) any {
+			return redeemLoyaltyPointsPayload{Points: 10}
+		}},
+		{route: "GET /api/restaurants/:restaurant_id/customers/:customer_id/orders", as: actorWaiter},
+		{route: "GET /api/restaurants/:restaurant_id/customers/:customer_id/loyalty", as: actorWaiter},
+
+		// Cash and payments
+		{route: "POST /api/restaurants/:restaurant_id/cash-sessions", as: actorWaiter, denied: []string{actorOwner}, body: func(t *testing.T, s *endpointState) any {
+			return openCashSessionPayload{OpeningFloat: 100}
+		}, then: saveID("session_id")},
+		{route: "POST /api/orders/:order_id/payments", as: actorWaiter, denied: []string{actorOwner}, body: func(t *testing.T, s *endpointState) any {
+			// Paid in full, so that the order is invoiced
+			order := &models.Order{}
+			require.NoError(t, s.server.db.Connection.First(order, "id = ?", s.params["order_id"]).Error)
+			return createPaymentPayload{Method: models.PaymentMethodCash, Amount: order.TotalAmount}
+		}},
+		{route: "GET /api/orders/:order_id/payments", as: actorOwner},
+		{route: "GET /api/restaurants/:restaurant_id/cash-sessions", as: actorOwner},
+		{route: "GET /api/restaurants/:restaurant_id/cash-sessions/:session_id", as: actorWaiter},
+		{route: "POST /api/restaurants/:restaurant_id/cash-sessions/:session_id/movements", as: actorWaiter, denied: []string{actorOwner}, body: func(t *testing.T, s *endpointState) any {
+			return createCashMovementPayload{Kind: models.CashMovementPayOut, Amount: 5, Reason: "Change"}
+		}},
+		{route: "POST /api/restaurants/:restaurant_id/cash-sessions/:session_id/close", as: actorWaiter, denied: []string{actorOwner}, body: func(t *testing.T, s *endpointState) any {
+			return closeCashSessionPayload{CountedAmount: &counted}
+		}},
+
+		// Journal
+		{route: "POST /api/orders/:order_id/credit-notes", as: actorManager, denied: []string{actorWaiter}, body: func(t *testing.T, s *endpointState) any {
+			return createCreditNotePayload{Amount: 2, Reason: "Cold ramen"}
+		}},
+		{route: "GET /api/restaurants/:restaurant_id/journal", as: actorOwner, denied: []string{actorManager}},
+		{route: "GET /api/restaurants/:restaurant_id/journal/verify", as: actorOwner, denied: []string{actorManager}},
+
+		// Z reports
+		{route: "POST /api/restaurants/:restaurant_id/z-reports", as: actorManager, denied: []string{actorWaiter}, body: func(t *testing.T, s *endpointState) any {
+			return closeBusinessDayPayload{BusinessDate: today}
+		}, then: func(t *testing.T, s *endpointState, response *testResponse) {
+			s.params["business_date"] = today
+		}},
+		{route: "GET /api/restaurants/:restaurant_id/z-reports", as: actorManager, denied: []string{actorWaiter}},
+		{route: "GET /api/restaurants/:restaurant_id/z-reports/:business_date", as: actorOwner, denied: []string{actorWaiter}},
+
+		// Reports
+		{route: "GET /api/reports/:report", as: actorOwner, denied: []string{actorManager}},
+
+		// Printers
+		{route: "POST /api/restaurants/:restaurant_id/printers", as: actorOwner, denied: []string{actorManager}, body: func(t *testing.T, s *endpointState) any {
+			return registerPrinterPayload{Name: "Counter", Kind: models.PrinterKindReceipt, Address: "192.0.2.10:9100"}
+		}, then: saveID("printer_id")},
+		{route: "GET /api/restaurants/:restaurant_id/printers", as: actorWaiter},
+		{route: "POST /api/orders/:order_id/receipt/print", as: actorWaiter, body: func(t *testing.T, s *endpointState) any {
+			return printOrderReceiptPayload{}
+		}, then: saveID("job_id")},
+		{route: "GET /api/restaurants/:restaurant_id/print-jobs", as: actorWaiter},
+		{route: "POST /api/restaurants/:restaurant_id/print-jobs/:job_id/reprint", as: actorWaiter},
+		{route: "DELETE /api/restaurants/:restaurant_id/printers/:printer_id", as: actorOwner, denied: []string{actorManager}},
+
+		// Offline sync
+		{route: "POST /api/restaurants/:restaurant_id/sync/push", as: actorWaiter, denied: []string{actorOwner}, body: func(t *testing.T, s *endpointState) any {
+			payload, err := json.Marshal(syncCreateOrderPayload{
+				OrderID:     uuid.Must(uuid.NewV7()),
+				TableNumber: "1",
+				Items:       []syncOrderItemInput{{orderItemInput: orderItemInput{ProductID: s.productID, Quantity: 1}}},
+			})
+			require.NoError(t, err)
+			return pushSyncMutationsPayload{Mutations: []syncMutation{
+				{MutationID: uuid.New(), Type: syncMutationCreateOrder, Payload: payload},
+			}}
+		}},
+		{route: "GET /api/restaurants/:restaurant_id/sync/pull", as: actorWaiter},
+
+		// Delivery platforms
+		{route: "POST /api/restaurants/:restaurant_id/integrations", as: actorOwner, denied: []string{actorManager}, body: func(t *testing.T, s *endpointState) any {
+			return registerIntegrationPayload{
+				Platform:      integrations.PlatformGeneric,
+				StoreID:       "store-1",
+				Endpoint:      "https://marketplace.example.com/v1",
+				APIKey:        "api-key",
+				WebhookSecret: "webhook-secret-16",
+			}
+		}, then: saveID("integration_id")},
+		{route: "GET /api/restaurants/:restaurant_id/integrations", as: actorOwner, denied: []string{actorManager}},
+		{route: "POST /api/restaurants/:restaurant_id/integrations/:integration_id/menu/push", as: actorOwner, denied: []string{actorManager}},
+		{route: "POST /api/webhooks/integrations/:integration_id", as: actorAnonymous, body: func(t *testing.T, s *endpointState) any {
+			return webhookBody(s)
+		}, header: func(t *testing.T, s *endpointState) http.Header {
+			now := time.Now()
+			header := http.Header{}
+			header.Set(integrations.HeaderWebhookTimestamp, strconv.FormatInt(now.Unix(), 10))
+			header.Set(integrations.HeaderWebhookSignature, integrations.SignWebhook(webhookBody(s), "webhook-secret-16", now))
+			return header
+		}},
+		{route: "DELETE /api/restaurants/:restaurant_id/integrations/:integration_id", as: actorOwner, denied: []string{actorManager}},
+
+		// GraphQL
+		{route: "POST /api/graphql", as: actorWaiter, body: func(t *testing.T, s *endpointState) any {
+			return graphQLPayload{Query: "{ restaurants { name products { title } orders { status items { quantity } } } }"}
+		}},
+	}
+}
+
+func terminalHeader(t *testing.T, s *endpointState) http.Header {
+	header := http.Header{}
+	header.Set(terminalTokenHeader, s.values["device_token"])
+	return header
+}
+
+// TestEndpoints calls every endpoint, checking that it succeeds for an allowed actor and that it is
+// refused to others.
+func TestEndpoints(t *testing.T) {
+	f := newFixture(t)
+	s := &endpointState{
+		fixture: f,
+		params: map[string]string{
+			"restaurant_id": f.restaurantID.String(),
+			"staff_id":      f.waiterID.String(),
+			"product_id":    f.productID.String(),
+			"table_id":      f.tableID.String(),
+			"report":        "summary",
+		},
+		values: make(map[string]string),
+	}
+
+	statuses := make(map[string]int)
+	for _, op := range apiOperations() {
+		statuses[op.method+" /api"+op.path] = op.status
+	}
+
+	tested := make(map[string]bool)
+	for _, tt := range endpointTests() {
+		t.Run(tt.route, func(t *testing.T) {
+			require.False(t, tested[tt.route], "tested twice")
+			tested[tt.route] = true
+
+			method, path, _ := strings.Cut(tt.route, " ")
+			if strings.Contains(path, ":table_token") {
+				s.params["table_token"] = tableToken(t, s)
+			}
+			path = s.path(path) + tt.query
+			var body any
+			if tt.body != nil {
+				body = tt.body(t, s)
+			}
+
+			denied := tt.denied
+			if !tt.public {
+				denied = append([]string{actorAnonymous}, denied...)
+			}
+			if !tt.public && (strings.Contains(path, "/restaurants/") || strings.Contains(path, "/orders/")) {
+				denied = append(denied, actorOtherOwner, actorOtherStaff)
+			}
+			for _, actor := range denied {
+				response := s.client(actor).do(t, method, path, body, nil)
+				if actor == actorAnonymous {
+					assert.Equal(t, http.StatusUnauthorized, response.Code, "%s: %s", actor, response.Body)
+					continue
+				}
+				assert.Contains(t, []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound}, response.Code, "%s: %s", actor, response.Body)
+			}
+
+			var header http.Header
+			if tt.header != nil {
+				header = tt.header(t, s)
+			}
+			// Succeeds with the status documented in the OpenAPI document
+			response := s.client(tt.as).do(t, method, path, body, header)
+			require.Equal(t, statuses[tt.route], response.Code, "%s: %s", tt.as, response.Body)
+			if tt.then != nil {
+				tt.then(t, s, response)
+			}
+		})
+	}
+
+	for _, route := range f.server.router.Routes() {
+		// Echo registers not found routes for groups with middlewares
+		if !strings.HasPrefix(route.Path, "/api") || strings.HasPrefix(route.Method, "echo_") {
+			continue
+		}
+		assert.True(t, tested[route.Method+" "+route.Path], "%s %s is not tested", route.Method, route.Path)
+	}
+}
+
+// tableToken returns the token of the first table, which guests scan.
+func tableToken(t *testing.T, s *endpointState) string {
+	response := s.owner.expect(t, http.StatusOK, http.MethodGet, "/api/restaurants/"+s.restaurantID.String()+"/tables/"+s.tableID.String()+"/token", nil)
+	token := TableTokenResponse{}
+	response.decode(t, &token)
+	return token.Token
+}
@@ -0,0 +1,260 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	entranslations "github.com/go-playground/validator/v10/translations/en"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/integrations"
+	"github.com/roushou/pocpoc/internal/journal"
+	"github.com/roushou/pocpoc/internal/loyalty"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/pickup"
+	"github.com/roushou/pocpoc/internal/promotions"
+	"github.com/roushou/pocpoc/internal/services"
+	"gorm.io/gorm"
+)
+
+// Codes of error responses which are not derived from the status.
+const (
+	errorCodeValidationFailed = "validation_failed"
+	errorCodeInternal         = "internal_error"
+)
+
+// ErrorResponse is the body of every error response.
+type ErrorResponse struct {
+	// Code is a stable machine-readable code, e.g. "not_found" or "pickup_slot_full".
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Fields are the fields of the payload which failed validation.
+	Fields []FieldError `json:"fields,omitempty"`
+	// RequestID is the ID of the request in the logs, also sent in the X-Request-Id header.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// FieldError is a field of the payload which failed validation.
+type FieldError struct {
+	// Field is the path of the field in the payload, e.g. "products[0].quantity".
+	Field string `json:"field"`
+	// Code is the failed validation rule, e.g. "required" or "max".
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// domainError is how an error of the domain is reported to clients.
+type domainError struct {
+	err    error
+	status int
+	code   string
+}
+
+// domainErrors maps errors of the domain to responses, so that handlers can return them as is.
+var domainErrors = []domainError{
+	{err: gorm.ErrRecordNotFound, status: http.StatusNotFound, code: "not_found"},
+	{err: gorm.ErrDuplicatedKey, status: http.StatusConflict, code: "conflict"},
+	{err: models.ErrImmutable, status: http.StatusConflict, code: "immutable"},
+
+	{err: services.ErrUnauthorized, status: http.StatusUnauthorized, code: "unauthorized"},
+	{err: services.ErrNotFound, status: http.StatusNotFound, code: "not_found"},
+	{err: services.ErrInvalidCredentials, status: http.StatusUnauthorized, code: "invalid_credentials"},
+	{err: services.ErrStaffDeactivated, status: http.StatusForbidden, code: "staff_deactivated"},
+	{err: services.ErrInvalidPin, status: http.StatusBadRequest, code: "invalid_pin"},
+	{err: services.ErrAlreadyArchived, status: http.StatusConflict, code: "already_archived"},
+	{err: services.ErrNotArchived, status: http.StatusConflict, code: "not_archived"},
+	{err: services.ErrAlreadyActive, status: http.StatusConflict, code: "already_active"},
+	{err: services.ErrAlreadyInactive, status: http.StatusConflict, code: "already_inactive"},
+	{err: services.ErrEmptyOrder, status: http.StatusBadRequest, code: "empty_order"},
+	{err: services.ErrUnknownProduct, status: http.StatusBadRequest, code: "unknown_product"},
+	{err: services.ErrUnknownCustomer, status: http.StatusBadRequest, code: "unknown_customer"},
+	{err: services.ErrInvalidOrderType, status: http.StatusBadRequest, code: "invalid_order_type"},
+	{err: services.ErrInvalidOrderStatus, status: http.StatusBadRequest, code: "invalid_order_status"},
+	{err: services.ErrInvalidStatusTransition, status: http.StatusConflict, code: "invalid_status_transition"},
+	{err: services.ErrOrderPaid, status: http.StatusConflict, code: "order_paid"},
+	{err: services.ErrNotClockedIn, status: http.StatusForbidden, code: "not_clocked_in"},
+	{err: services.ErrPinNotSet, status: http.StatusForbidden, code: "pin_not_set"},
+	{err: services.ErrPinLocked, status: http.StatusTooManyRequests, code: "pin_locked"},
+	{err: services.ErrTooManyGuestOrders, status: http.StatusTooManyRequests, code: "too_many_guest_orders"},
+	{err: services.ErrOrderCancelled, status: http.StatusConflict, code: "order_cancelled"},
+	{err: services.ErrOverpayment, status: http.StatusConflict, code: "overpayment"},
+	{err: services.ErrNoOpenCashDrawer, status: http.StatusConflict, code: "no_open_cash_drawer"},
+	{err: errCashSessionClosed, status: http.StatusConflict, code: "cash_session_closed"},
+	{err: errCashSessionOpen, status: http.StatusConflict, code: "cash_session_open"},
+	{err: errCashSessionsOpen, status: http.StatusConflict, code: "cash_sessions_open"},
+	{err: errOrderHasPayments, status: http.StatusConflict, code: "order_has_payments"},
+	{err: errAlreadyClockedIn, status: http.StatusConflict, code: "already_clocked_in"},
+	{err: errOnBreak, status: http.StatusConflict, code: "on_break"},
+	{err: errNotOnBreak, status: http.StatusConflict, code: "not_on_break"},
+	{err: errCouponExists, status: http.StatusConflict, code: "coupon_exists"},
+
+	{err: pickup.ErrSlotUnavailable, status: http.StatusBadRequest, code: "pickup_slot_unavailable"},
+	{err: pickup.ErrSlotFull, status: http.StatusConflict, code: "pickup_slot_full"},
+	{err: pickup.ErrNoSlot, status: http.StatusConflict, code: "no_pickup_slot"},
+
+	{err: promotions.ErrUnknownCoupon, status: http.StatusBadRequest, code: "unknown_coupon"},
+
+	{err: loyalty.ErrNoCustomer, status: http.StatusConflict, code: "no_customer"},
+	{err: loyalty.ErrRedemptionDisabled, status: http.StatusConflict, code: "redemption_disabled"},
+	{err: loyalty.ErrAlreadyRedeemed, status: http.StatusConflict, code: "already_redeemed"},
+	{err: loyalty.ErrInsufficientPoints, status: http.StatusConflict, code: "insufficient_points"},
+	{err: loyalty.ErrBelowMinimum, status: http.StatusBadRequest, code: "below_minimum_redemption"},
+	{err: loyalty.ErrRedemptionExceeded, status: http.StatusBadRequest, code: "redemption_exceeded"},
+
+	{err: journal.ErrNotInvoiced, status: http.StatusConflict, code: "not_invoiced"},
+	{err: journal.ErrAlreadyInvoiced, status: http.StatusConflict, code: "already_invoiced"},
+	{err: journal.ErrCreditExceeded, status: http.StatusConflict, code: "credit_exceeded"},
+
+	{err: integrations.ErrUnknownPlatform, status: http.StatusBadRequest, code: "unknown_platform"},
+	{err: integrations.ErrInvalidStoreID, status: http.StatusBadRequest, code: "invalid_store_id"},
+	{err: integrations.ErrInvalidSignature, status: http.StatusUnauthorized, code: "invalid_signature"},
+	{err: integrations.ErrInvalidOrder, status: http.StatusBadRequest, code: "invalid_order"},
+	{err: integrations.ErrUnknownProduct, status: http.StatusBadRequest, code: "unknown_product"},
+	{err: integrations.ErrProductUnavailable, status: http.StatusConflict, code: "product_unavailable"},
+}
+
+// Validator validates payloads with the `validate` struct tags. Fields are named after their JSON
+// name in validation errors.
+type Validator struct {
+	validator  *validator.Validate
+	translator ut.Translator
+}
+
+func NewValidator() (*Validator, error) {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	locale := en.New()
+	translator, _ := ut.New(locale, locale).GetTranslator(locale.Locale())
+	if err := entranslations.RegisterDefaultTranslations(validate, translator); err != nil {
+		return nil, err
+	}
+	return &Validator{validator: validate, translator: translator}, nil
+}
+
+// Validate returns a validationError listing the invalid fields of the payload.
+func (v *Validator) Validate(i interface{}) error {
+	err := v.validator.Struct(i)
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+
+	// Namespaces start with the name of the payload type, except for anonymous structs
+	prefix := ""
+	if name := reflect.Indirect(reflect.ValueOf(i)).Type().Name(); name != "" {
+		prefix = name + "."
+	}
+	fields := make([]FieldError, 0, len(errs))
+	for _, err := range errs {
+		fields = append(fields, FieldError{
+			Field:   strings.TrimPrefix(err.Namespace(), prefix),
+			Code:    err.Tag(),
+			Message: err.Translate(v.translator),
+		})
+	}
+	return &validationError{fields: fields}
+}
+
+// validationError is returned by Validator when the payload is invalid.
+type validationError struct {
+	fields []FieldError
+}
+
+func (e *validationError) Error() string {
+	messages := make([]string, 0, len(e.fields))
+	for _, field := range e.fields {
+		messages = append(messages, field.Message)
+	}
+	return "invalid payload: " + strings.Join(messages, ", ")
+}
+
+// errorHandler writes errors returned by handlers as an ErrorResponse. Domain errors are mapped with
+// domainErrors, unexpected errors are logged and reported as internal errors without details.
+func errorHandler() echo.HTTPErrorHandler {
+	return func(err error, ctx echo.Context) {
+		if ctx.Response().Committed {
+			return
+		}
+
+		status, response := newErrorResponse(err)
+		if status == http.StatusInternalServerError {
+			ctx.Logger().Errorf("request %s failed: %v", requestID(ctx), err)
+		}
+		response.RequestID = requestID(ctx)
+
+		if ctx.Request().Method == http.MethodHead {
+			err = ctx.NoContent(status)
+		} else {
+			err = ctx.JSON(status, response)
+		}
+		if err != nil {
+			ctx.Logger().Error(err)
+		}
+	}
+}
+
+func newErrorResponse(err error) (int, ErrorResponse) {
+	var validationErr *validationError
+	if errors.As(err, &validationErr) {
+		return http.StatusBadRequest, ErrorResponse{
+			Code:    errorCodeValidationFailed,
+			Message: "Invalid payload",
+			Fields:  validationErr.fields,
+		}
+	}
+
+	for _, domainError := range domainErrors {
+		if errors.Is(err, domainError.err) {
+			return domainError.status, ErrorResponse{Code: domainError.code, Message: domainError.err.Error()}
+		}
+	}
+
+	var httpError *echo.HTTPError
+	if errors.As(err, &httpError) {
+		message := http.StatusText(httpError.Code)
+		if m, ok := httpError.Message.(string); ok && m != "" {
+			message = m
+		}
+		return httpError.Code, ErrorResponse{Code: statusCode(httpError.Code), Message: message}
+	}
+
+	return http.StatusInternalServerError, ErrorResponse{
+		Code:    errorCodeInternal,
+		Message: http.StatusText(http.StatusInternalServerError),
+	}
+}
+
+// statusCode returns the code of errors reported with a bare status, e.g. "not_found" for 404.
+func statusCode(status int) string {
+	if status == http.StatusInternalServerError {
+		return errorCodeInternal
+	}
+	text := http.StatusText(status)
+	if text == "" {
+		return fmt.Sprintf("status_%d", status)
+	}
+	return strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(strings.ToLower(text))
+}
+
+// requestID returns the ID assigned to the request by the RequestID middleware.
+func requestID(ctx echo.Context) string {
+	if id := ctx.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return ctx.Request().Header.Get(echo.HeaderXRequestID)
+}
@@ -0,0 +1,115 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/roushou/pocpoc/internal/pickup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestErrorHandler(t *testing.T) {
+	validator, err := NewValidator()
+	require.NoError(t, err)
+
+	type item struct {
+		ProductID string `json:"product_id" validate:"required"`
+		Quantity  int    `json:"quantity" validate:"gt=0"`
+	}
+	validate := func(ctx echo.Context) error {
+		payload := struct {
+			Name     string `json:"name" validate:"required,max=5"`
+			Products []item `json:"products" validate:"dive"`
+		}{}
+		if err := ctx.Bind(&payload); err != nil {
+			return echo.ErrBadRequest
+		}
+		return ctx.Validate(payload)
+	}
+
+	tests := []struct {
+		name     string
+		handler  echo.HandlerFunc
+		body     string
+		status   int
+		response ErrorResponse
+	}{
+		{
+			name:     "http error",
+			handler:  func(ctx echo.Context) error { return echo.ErrNotFound },
+			status:   http.StatusNotFound,
+			response: ErrorResponse{Code: "not_found", Message: "Not Found"},
+		},
+		{
+			name:     "http error with message",
+			handler:  func(ctx echo.Context) error { return echo.NewHTTPError(http.StatusTooManyRequests, "slow down") },
+			status:   http.StatusTooManyRequests,
+			response: ErrorResponse{Code: "too_many_requests", Message: "slow down"},
+		},
+		{
+			name:     "domain error",
+			handler:  func(ctx echo.Context) error { return fmt.Errorf("booking: %w", pickup.ErrSlotFull) },
+			status:   http.StatusConflict,
+			response: ErrorResponse{Code: "pickup_slot_full", Message: "pickup slot is full"},
+		},
+		{
+			name:     "record not found",
+			handler:  func(ctx echo.Context) error { return gorm.ErrRecordNotFound },
+			status:   http.StatusNotFound,
+			response: ErrorResponse{Code: "not_found", Message: "record not found"},
+		},
+		{
+			name:     "unexpected error",
+			handler:  func(ctx echo.Context) error { return errors.New("database is locked") },
+			status:   http.StatusInternalServerError,
+			response: ErrorResponse{Code: "internal_error", Message: "Internal Server Error"},
+		},
+		{
+			name:    "validation",
+			handler: validate,
+			body:    `{"name":"too long","products":[{"product_id":"a","quantity":1},{"quantity":0}]}`,
+			status:  http.StatusBadRequest,
+			response: ErrorResponse{
+				Code:    "validation_failed",
+				Message: "Invalid payload",
+				Fields: []FieldError{
+					{Field: "name", Code: "max", Message: "name must be a maximum of 5 characters in length"},
+					{Field: "products[1].product_id", Code: "required", Message: "product_id is a required field"},
+					{Field: "products[1].quantity", Code: "gt", Message: "quantity must be greater than 0"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := echo.New()
+			router.Validator = validator
+			router.HTTPErrorHandler = errorHandler()
+			router.Use(middleware.RequestID())
+			router.POST("/", tt.handler)
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			response := ErrorResponse{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			assert.NotEmpty(t, response.RequestID)
+			assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), response.RequestID)
+			tt.response.RequestID = response.RequestID
+			assert.Equal(t, tt.response, response)
+		})
+	}
+}
@@ -0,0 +1,402 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/services"
+)
+
+// Limits of GraphQL queries, so that a single request can't load the whole database.
+const (
+	graphQLMaxDepth = 6
+	// graphQLMaxComplexity is the maximum estimated cost of queries, see graphQLComplexity.
+	graphQLMaxComplexity = 5000
+	// graphQLMaxParallelism is how many resolvers run at once, which bounds the size of the batches of
+	// loaders too.
+	graphQLMaxParallelism = 50
+)
+
+// graphQLSchema is a read API over restaurants, for dashboards to load nested data in one request.
+// Restaurants are the entry points, with the same access rules as the REST API: owners see their
+// restaurants and staff the one they work at.
+const graphQLSchema = `
+schema {
+	query: Query
+}
+
+scalar Time
+
+type Query {
+	"""Restaurants the user owns, or works at."""
+	restaurants(includeArchived: Boolean = false): [Restaurant!]!
+	restaurant(id: ID!): Restaurant
+}
+
+type Restaurant {
+	id: ID!
+	name: String!
+	timeZone: String!
+	currency: String!
+	archivedAt: Time
+	createdAt: Time!
+	"""Staff of the restaurant, only visible to its owner."""
+	staff(includeInactive: Boolean = false): [Staff!]
+	products: [Product!]!
+	"""Orders taken on the date, formatted as 2006-01-02 in the time zone of the restaurant, today by default."""
+	orders(date: String, status: String): [Order!]!
+}
+
+type Staff {
+	id: ID!
+	username: String!
+	displayName: String!
+	role: String!
+	active: Boolean!
+	createdAt: Time!
+}
+
+type Product {
+	id: ID!
+	title: String!
+	description: String!
+	category: String!
+	unitPrice: Float!
+	available: Boolean!
+}
+
+type Order {
+	id: ID!
+	type: String!
+	tableNumber: String!
+	status: String!
+	source: String!
+	totalAmount: Float!
+	discountAmount: Float!
+	taxAmount: Float!
+	paidAt: Time
+	createdAt: Time!
+	staffId: ID
+	"""Staff member who took the order, only visible to the owner of the restaurant."""
+	staff: Staff
+	items: [OrderItem!]!
+}
+
+type OrderItem {
+	id: ID!
+	quantity: Int!
+	unitPrice: Float!
+	modifiers: [String!]!
+	product: Product!
+}
+`
+
+var errInvalidGraphQLDate = errors.New("date should be formatted as 2006-01-02")
+
+// newGraphQLSchema parses the schema with its resolvers.
+func newGraphQLSchema() (*graphql.Schema, error) {
+	return graphql.ParseSchema(graphQLSchema, &graphQLQuery{},
+		graphql.UseStringDescriptions(),
+		graphql.MaxDepth(graphQLMaxDepth),
+		graphql.MaxParallelism(graphQLMaxParallelism),
+	)
+}
+
+func bindGraphQLRouter(router *echo.Group) {
+	router.POST("/graphql", postGraphQL)
+}
+
+type graphQLPayload struct {
+	Query         string         `json:"query" validate:"required"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// postGraphQL runs a GraphQL query on behalf of the auth user. Errors of the query are reported in the
+// response rather than with the status, as GraphQL clients expect.
+func postGraphQL(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := graphQLPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	rc := ctx.(*routerContext)
+	schema := rc.options.graphQLSchema
+
+	if errs := schema.Validate(payload.Query); len(errs) > 0 {
+		return ctx.JSON(http.StatusOK, &graphql.Response{Errors: errs})
+	}
+	complexity, err := graphQLComplexity(schema.ASTSchema(), payload.Query, payload.OperationName)
+	if err != nil {
+		return ctx.JSON(http.StatusOK, &graphql.Response{Errors: []*gqlerrors.QueryError{gqlerrors.Errorf("%s", err)}})
+	}
+	if complexity > graphQLMaxComplexity {
+		return ctx.JSON(http.StatusOK, &graphql.Response{Errors: []*gqlerrors.QueryError{
+			gqlerrors.Errorf("query is too complex: %d exceeds the limit of %d", complexity, graphQLMaxComplexity),
+		}})
+	}
+
+	request := &graphQLRequest{
+		actor:    authUser.actor(),
+		services: rc.GetServices(),
+		loaders:  newGraphQLLoaders(rc.GetDatabase()),
+	}
+	queryCtx := context.WithValue(ctx.Request().Context(), graphQLRequestKey{}, request)
+	return ctx.JSON(http.StatusOK, schema.Exec(queryCtx, payload.Query, payload.OperationName, payload.Variables))
+}
+
+type graphQLRequestKey struct{}
+
+// graphQLRequest is what resolvers of a query share: who asks, and loaders batching the queries of
+// sibling fields so that nested lists don't run a query per parent.
+type graphQLRequest struct {
+	actor    services.Actor
+	services *services.Services
+	loaders  *graphQLLoaders
+}
+
+func graphQLRequestFrom(ctx context.Context) *graphQLRequest {
+	return ctx.Value(graphQLRequestKey{}).(*graphQLRequest)
+}
+
+// requireOwner returns services.ErrUnauthorized unless the user is an owner. Resolvers are only reached
+// through restaurants the user can access, so owners own them.
+func (r *graphQLRequest) requireOwner() error {
+	if r.actor.Role != models.RoleOwner {
+		return services.ErrUnauthorized
+	}
+	return nil
+}
+
+// graphQLQuery resolves the entry points of the schema.
+type graphQLQuery struct{}
+
+func (q *graphQLQuery) Restaurants(ctx context.Context, args struct{ IncludeArchived bool }) ([]*graphQLRestaurant, error) {
+	request := graphQLRequestFrom(ctx)
+	rows, err := request.services.Restaurants.List(ctx, request.actor, args.IncludeArchived)
+	if err != nil {
+		return nil, err
+	}
+
+	restaurants := make([]*graphQLRestaurant, 0, len(rows))
+	for i := range rows {
+		restaurants = append(restaurants, &graphQLRestaurant{&rows[i]})
+	}
+	return restaurants, nil
+}
+
+func (q *graphQLQuery) Restaurant(ctx context.Context, args struct{ ID graphql.ID }) (*graphQLRestaurant, error) {
+	id, err := uuid.Parse(string(args.ID))
+	if err != nil {
+		return nil, services.ErrNotFound
+	}
+
+	request := graphQLRequestFrom(ctx)
+	restaurant, err := request.services.Restaurants.Get(ctx, request.actor, id)
+	if err != nil {
+		return nil, err
+	}
+	return &graphQLRestaurant{restaurant}, nil
+}
+
+type graphQLRestaurant struct {
+	restaurant *models.Restaurant
+}
+
+func (r *graphQLRestaurant) ID() graphql.ID            { return graphql.ID(r.restaurant.ID.String()) }
+func (r *graphQLRestaurant) Name() string              { return r.restaurant.Name }
+func (r *graphQLRestaurant) TimeZone() string          { return r.restaurant.TimeZone }
+func (r *graphQLRestaurant) Currency() string          { return r.restaurant.Currency }
+func (r *graphQLRestaurant) ArchivedAt() *graphql.Time { return graphQLTime(r.restaurant.ArchivedAt) }
+func (r *graphQLRestaurant) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.restaurant.CreatedAt}
+}
+
+func (r *graphQLRestaurant) Staff(ctx context.Context, args struct{ IncludeInactive bool }) (*[]*graphQLStaff, error) {
+	request := graphQLRequestFrom(ctx)
+	if err := request.requireOwner(); err != nil {
+		return nil, err
+	}
+	rows, err := loadGraphQL[[]models.Staff](ctx, request.loaders.staffByRestaurant, r.restaurant.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	staff := make([]*graphQLStaff, 0, len(rows))
+	for i := range rows {
+		if args.IncludeInactive || rows[i].IsActive() {
+			staff = append(staff, &graphQLStaff{&rows[i]})
+		}
+	}
+	return &staff, nil
+}
+
+func (r *graphQLRestaurant) Products(ctx context.Context) ([]*graphQLProduct, error) {
+	rows, err := loadGraphQL[[]models.Product](ctx, graphQLRequestFrom(ctx).loaders.productsByRestaurant, r.restaurant.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	products := make([]*graphQLProduct, 0, len(rows))
+	for i := range rows {
+		products = append(products, &graphQLProduct{&rows[i]})
+	}
+	return products, nil
+}
+
+func (r *graphQLRestaurant) Orders(ctx context.Context, args struct {
+	Date   *string
+	Status *string
+}) ([]*graphQLOrder, error) {
+	location := r.restaurant.Location()
+	day := time.Now().In(location)
+	if args.Date != nil {
+		var err error
+		day, err = time.ParseInLocation(dateLayout, *args.Date, location)
+		if err != nil {
+			return nil, errInvalidGraphQLDate
+		}
+	}
+	if args.Status != nil && !models.OrderStatus(*args.Status).IsValid() {
+		return nil, services.ErrInvalidOrderStatus
+	}
+
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, location)
+	key := ordersDayKey{restaurantID: r.restaurant.ID, from: from, to: from.AddDate(0, 0, 1)}
+	rows, err := graphQLRequestFrom(ctx).loaders.ordersByDay.Load(ctx, key)()
+	if err != nil {
+		return nil, err
+	}
+
+	dayOrders := rows.([]models.Order)
+	orders := make([]*graphQLOrder, 0, len(dayOrders))
+	for i := range dayOrders {
+		if args.Status == nil || dayOrders[i].Status == models.OrderStatus(*args.Status) {
+			orders = append(orders, &graphQLOrder{&dayOrders[i]})
+		}
+	}
+	return orders, nil
+}
+
+type graphQLStaff struct {
+	staff *models.Staff
+}
+
+func (s *graphQLStaff) ID() graphql.ID          { return graphql.ID(s.staff.ID.String()) }
+func (s *graphQLStaff) Username() string        { return s.staff.Username }
+func (s *graphQLStaff) DisplayName() string     { return s.staff.DisplayName }
+func (s *graphQLStaff) Role() string            { return string(s.staff.Role) }
+func (s *graphQLStaff) Active() bool            { return s.staff.IsActive() }
+func (s *graphQLStaff) CreatedAt() graphql.Time { return graphql.Time{Time: s.staff.CreatedAt} }
+
+type graphQLProduct struct {
+	product *models.Product
+}
+
+func (p *graphQLProduct) ID() graphql.ID      { return graphql.ID(p.product.ID.String()) }
+func (p *graphQLProduct) Title() string       { return p.product.Title }
+func (p *graphQLProduct) Description() string { return p.product.Description }
+func (p *graphQLProduct) Category() string    { return p.product.Category }
+func (p *graphQLProduct) UnitPrice() float64  { return p.product.UnitPrice }
+func (p *graphQLProduct) Available() bool     { return p.product.Available }
+
+type graphQLOrder struct {
+	order *models.Order
+}
+
+func (o *graphQLOrder) ID() graphql.ID          { return graphql.ID(o.order.ID.String()) }
+func (o *graphQLOrder) Type() string            { return string(o.order.Type) }
+func (o *graphQLOrder) TableNumber() string     { return o.order.TableNumber }
+func (o *graphQLOrder) Status() string          { return string(o.order.Status) }
+func (o *graphQLOrder) Source() string          { return string(o.order.Source) }
+func (o *graphQLOrder) TotalAmount() float64    { return o.order.TotalAmount }
+func (o *graphQLOrder) DiscountAmount() float64 { return o.order.DiscountAmount }
+func (o *graphQLOrder) TaxAmount() float64      { return o.order.TaxAmount }
+func (o *graphQLOrder) PaidAt() *graphql.Time   { return graphQLTime(o.order.PaidAt) }
+func (o *graphQLOrder) CreatedAt() graphql.Time { return graphql.Time{Time: o.order.CreatedAt} }
+
+// StaffID is nil for orders staff didn't take, e.g. guest and marketplace orders.
+func (o *graphQLOrder) StaffID() *graphql.ID {
+	if o.order.StaffID == uuid.Nil {
+		return nil
+	}
+	id := graphql.ID(o.order.StaffID.String())
+	return &id
+}
+
+func (o *graphQLOrder) Staff(ctx context.Context) (*graphQLStaff, error) {
+	request := graphQLRequestFrom(ctx)
+	if err := request.requireOwner(); err != nil {
+		return nil, err
+	}
+	if o.order.StaffID == uuid.Nil {
+		return nil, nil
+	}
+	staff, err := loadGraphQL[*models.Staff](ctx, request.loaders.staff, o.order.StaffID)
+	if err != nil || staff == nil {
+		return nil, err
+	}
+	return &graphQLStaff{staff}, nil
+}
+
+func (o *graphQLOrder) Items(ctx context.Context) ([]*graphQLOrderItem, error) {
+	rows, err := loadGraphQL[[]models.OrderItem](ctx, graphQLRequestFrom(ctx).loaders.itemsByOrder, o.order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*graphQLOrderItem, 0, len(rows))
+	for i := range rows {
+		items = append(items, &graphQLOrderItem{&rows[i]})
+	}
+	return items, nil
+}
+
+type graphQLOrderItem struct {
+	item *models.OrderItem
+}
+
+func (i *graphQLOrderItem) ID() graphql.ID     { return graphql.ID(i.item.ID.String()) }
+func (i *graphQLOrderItem) Quantity() int32    { return int32(i.item.Quantity) }
+func (i *graphQLOrderItem) UnitPrice() float64 { return i.item.UnitPrice }
+
+func (i *graphQLOrderItem) Modifiers() []string {
+	if i.item.Modifiers == nil {
+		return make([]string, 0)
+	}
+	return i.item.Modifiers
+}
+
+// Product is the product of the item, even if it was deleted since.
+func (i *graphQLOrderItem) Product(ctx context.Context) (*graphQLProduct, error) {
+	product, err := loadGraphQL[*models.Product](ctx, graphQLRequestFrom(ctx).loaders.products, i.item.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, services.ErrNotFound
+	}
+	return &graphQLProduct{product}, nil
+}
+
+func graphQLTime(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t}
+}
@@ -0,0 +1,366 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/graph-gophers/graphql-go/types"
+)
+
+// graphQLListSize is the number of elements lists are assumed to have when estimating the cost of
+// queries, e.g. the orders of a day.
+const graphQLListSize = 10
+
+// graphQLComplexity estimates the cost of running the operation of the query. Each field costs 1, and
+// fields under a list are counted graphQLListSize times, so that the cost grows with every level of
+// nested lists. Queries are expected to be valid, see graphql.Schema.Validate.
+func graphQLComplexity(schema *types.Schema, query string, operationName string) (int, error) {
+	document, err := parseGraphQLDocument(query)
+	if err != nil {
+		return 0, err
+	}
+
+	var operation *graphQLOperation
+	for i := range document.operations {
+		if document.operations[i].name == operationName || (operationName == "" && len(document.operations) == 1) {
+			operation = &document.operations[i]
+			break
+		}
+	}
+	if operation == nil {
+		return 0, fmt.Errorf("no operation %q in the query", operationName)
+	}
+
+	estimator := &graphQLEstimator{schema: schema, fragments: document.fragments, visiting: make(map[string]bool)}
+	return estimator.cost(operation.selections, schema.EntryPoints[operation.kind]), nil
+}
+
+type graphQLEstimator struct {
+	schema    *types.Schema
+	fragments map[string]graphQLFragment
+	// visiting are the fragments being estimated, to stop on cycles.
+	visiting map[string]bool
+}
+
+// cost returns the cost of the selections on the parent type, which is nil if unknown.
+func (e *graphQLEstimator) cost(selections []graphQLSelection, parent types.NamedType) int {
+	cost := 0
+	for _, selection := range selections {
+		switch {
+		case selection.fragment != "":
+			fragment, ok := e.fragments[selection.fragment]
+			if !ok || e.visiting[selection.fragment] {
+				continue
+			}
+			e.visiting[selection.fragment] = true
+			cost += e.cost(fragment.selections, e.schema.Types[fragment.typeCondition])
+			delete(e.visiting, selection.fragment)
+		case selection.field == "":
+			typ := parent
+			if selection.typeCondition != "" {
+				typ = e.schema.Types[selection.typeCondition]
+			}
+			cost += e.cost(selection.selections, typ)
+		default:
+			fieldType, isList := e.fieldType(parent, selection.field)
+			children := e.cost(selection.selections, fieldType)
+			if isList {
+				children *= graphQLListSize
+			}
+			cost += 1 + children
+		}
+	}
+	return cost
+}
+
+// fieldType returns the named type of the field of the parent type, and whether the field is a list.
+func (e *graphQLEstimator) fieldType(parent types.NamedType, name string) (types.NamedType, bool) {
+	var fields types.FieldsDefinition
+	switch parent := parent.(type) {
+	case *types.ObjectTypeDefinition:
+		fields = parent.Fields
+	case *types.InterfaceTypeDefinition:
+		fields = parent.Fields
+	}
+	field := fields.Get(name)
+	if field == nil {
+		return nil, false
+	}
+
+	isList := false
+	typ := field.Type
+	for {
+		switch wrapper := typ.(type) {
+		case *types.NonNull:
+			typ = wrapper.OfType
+		case *types.List:
+			isList = true
+			typ = wrapper.OfType
+		case types.NamedType:
+			return wrapper, isList
+		default:
+			return nil, isList
+		}
+	}
+}
+
+// graphQLDocument is what estimating costs needs of a GraphQL query: the selections of its operations
+// and fragments, without arguments, variables nor directives.
+type graphQLDocument struct {
+	operations []graphQLOperation
+	fragments  map[string]graphQLFragment
+}
+
+type graphQLOperation struct {
+	// kind is query, mutation or subscription.
+	kind       string
+	name       string
+	selections []graphQLSelection
+}
+
+type graphQLFragment struct {
+	typeCondition string
+	selections    []graphQLSelection
+}
+
+// graphQLSelection is a field when field is set, a fragment spread when fragment is set, and an inline
+// fragment otherwise.
+type graphQLSelection struct {
+	field         string
+	fragment      string
+	typeCondition string
+	selections    []graphQLSelection
+}
+
+var errInvalidGraphQLQuery = errors.New("invalid query")
+
+// graphQLParser is a recursive descent parser of GraphQL queries, see https://spec.graphql.org/October2021/#sec-Document.
+type graphQLParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseGraphQLDocument(query string) (*graphQLDocument, error) {
+	tokens, err := lexGraphQL(query)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &graphQLParser{tokens: tokens}
+	document := &graphQLDocument{fragments: make(map[string]graphQLFragment)}
+	for !parser.done() {
+		switch token := parser.next(); token {
+		case "{":
+			parser.pos--
+			selections, err := parser.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			document.operations = append(document.operations, graphQLOperation{kind: "query", selections: selections})
+		case "query", "mutation", "subscription":
+			operation := graphQLOperation{kind: token}
+			if isGraphQLName(parser.peek()) {
+				operation.name = parser.next()
+			}
+			if parser.peek() == "(" {
+				parser.skipBalanced()
+			}
+			parser.skipDirectives()
+			selections, err := parser.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			operation.selections = selections
+			document.operations = append(document.operations, operation)
+		case "fragment":
+			name := parser.next()
+			if parser.next() != "on" {
+				return nil, errInvalidGraphQLQuery
+			}
+			fragment := graphQLFragment{typeCondition: parser.next()}
+			parser.skipDirectives()
+			selections, err := parser.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			fragment.selections = selections
+			document.fragments[name] = fragment
+		default:
+			return nil, errInvalidGraphQLQuery
+		}
+	}
+	return document, nil
+}
+
+func (p *graphQLParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *graphQLParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *graphQLParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *graphQLParser) selectionSet() ([]graphQLSelection, error) {
+	if p.next() != "{" {
+		return nil, errInvalidGraphQLQuery
+	}
+
+	selections := make([]graphQLSelection, 0)
+	for p.peek() != "}" {
+		if p.done() {
+			return nil, errInvalidGraphQLQuery
+		}
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+	p.pos++
+	return selections, nil
+}
+
+func (p *graphQLParser) selection() (graphQLSelection, error) {
+	selection := graphQLSelection{}
+	if p.peek() == "..." {
+		p.pos++
+		switch token := p.peek(); {
+		case token == "on":
+			p.pos++
+			selection.typeCondition = p.next()
+		case isGraphQLName(token):
+			selection.fragment = p.next()
+			p.skipDirectives()
+			return selection, nil
+		}
+		p.skipDirectives()
+		selections, err := p.selectionSet()
+		selection.selections = selections
+		return selection, err
+	}
+
+	selection.field = p.next()
+	if !isGraphQLName(selection.field) {
+		return selection, errInvalidGraphQLQuery
+	}
+	// The name before the colon is an alias
+	if p.peek() == ":" {
+		p.pos++
+		selection.field = p.next()
+	}
+	if p.peek() == "(" {
+		p.skipBalanced()
+	}
+	p.skipDirectives()
+	if p.peek() == "{" {
+		selections, err := p.selectionSet()
+		if err != nil {
+			return selection, err
+		}
+		selection.selections = selections
+	}
+	return selection, nil
+}
+
+// skipBalanced skips the tokens up to the parenthesis closing the current one, e.g. arguments.
+func (p *graphQLParser) skipBalanced() {
+	depth := 0
+	for !p.done() {
+		switch p.next() {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+func (p *graphQLParser) skipDirectives() {
+	for p.peek() == "@" {
+		p.pos += 2
+		if p.peek() == "(" {
+			p.skipBalanced()
+		}
+	}
+}
+
+func isGraphQLName(token string) bool {
+	return token != "" && (token[0] == '_' || isLetter(token[0]))
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// lexGraphQL splits the query into tokens, skipping whitespace, commas and comments. Strings and numbers
+// are kept as single tokens.
+func lexGraphQL(query string) ([]string, error) {
+	tokens := make([]string, 0)
+	query = strings.TrimPrefix(query, "\uFEFF")
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(query) && query[i] != '\n' && query[i] != '\r' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], "..."):
+			tokens = append(tokens, "...")
+			i += 3
+		case strings.HasPrefix(query[i:], `"""`):
+			end := strings.Index(strings.ReplaceAll(query[i+3:], `\"""`, `xxxx`), `"""`)
+			if end < 0 {
+				return nil, errInvalidGraphQLQuery
+			}
+			tokens = append(tokens, query[i:i+3+end+3])
+			i += 3 + end + 3
+		case c == '"':
+			start := i
+			for i++; i < len(query) && query[i] != '"'; i++ {
+				if query[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(query) {
+				return nil, errInvalidGraphQLQuery
+			}
+			i++
+			tokens = append(tokens, query[start:i])
+		case c == '_' || isLetter(c):
+			start := i
+			for i++; i < len(query) && (query[i] == '_' || isLetter(query[i]) || isDigit(query[i])); i++ {
+			}
+			tokens = append(tokens, query[start:i])
+		case c == '-' || isDigit(c):
+			start := i
+			for i++; i < len(query) && (query[i] == '.' || query[i] == '+' || query[i] == '-' || isLetter(query[i]) || isDigit(query[i])); i++ {
+			}
+			tokens = append(tokens, query[start:i])
+		case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			return nil, errInvalidGraphQLQuery
+		}
+	}
+	return tokens, nil
+}
@@ -0,0 +1,172 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/graph-gophers/dataloader"
+	"github.com/roushou/pocpoc/internal/database"
+	"github.com/roushou/pocpoc/internal/models"
+	"gorm.io/gorm"
+)
+
+// graphQLBatchWait is how long loaders wait for sibling fields to request their keys before querying
+// them all at once.
+const graphQLBatchWait = 5 * time.Millisecond
+
+// graphQLLoaders batch the queries of a GraphQL request by parent, e.g. the items of every order in the
+// response are loaded with a single query. Loaders cache what they load and are not shared across
+// requests, so that results never outlive the request.
+type graphQLLoaders struct {
+	staffByRestaurant    *dataloader.Loader
+	productsByRestaurant *dataloader.Loader
+	ordersByDay          *dataloader.Loader
+	itemsByOrder         *dataloader.Loader
+	// staff and products are loaded by ID including deleted rows, which orders still reference.
+	staff    *dataloader.Loader
+	products *dataloader.Loader
+}
+
+func newGraphQLLoaders(db *database.Database) *graphQLLoaders {
+	return &graphQLLoaders{
+		staffByRestaurant: newGraphQLLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID][]models.Staff, error) {
+			rows := []models.Staff{}
+			err := db.Connection.WithContext(ctx).Where("restaurant_id IN ?", ids).Order("created_at").Find(&rows).Error
+			return groupBy(rows, func(staff models.Staff) uuid.UUID { return staff.RestaurantID }), err
+		}),
+		productsByRestaurant: newGraphQLLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID][]models.Product, error) {
+			rows := []models.Product{}
+			err := db.Connection.WithContext(ctx).Where("restaurant_id IN ?", ids).Order("created_at").Find(&rows).Error
+			return groupBy(rows, func(product models.Product) uuid.UUID { return product.RestaurantID }), err
+		}),
+		ordersByDay: newOrdersByDayLoader(db.Connection),
+		itemsByOrder: newGraphQLLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID][]models.OrderItem, error) {
+			rows := []models.OrderItem{}
+			err := db.Connection.WithContext(ctx).Where("order_id IN ?", ids).Order("created_at").Find(&rows).Error
+			return groupBy(rows, func(item models.OrderItem) uuid.UUID { return item.OrderID }), err
+		}),
+		staff: newGraphQLLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.Staff, error) {
+			rows := []models.Staff{}
+			err := db.Connection.WithContext(ctx).Unscoped().Where("id IN ?", ids).Find(&rows).Error
+			return indexBy(rows, func(staff *models.Staff) uuid.UUID { return staff.ID }), err
+		}),
+		products: newGraphQLLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.Product, error) {
+			rows := []models.Product{}
+			err := db.Connection.WithContext(ctx).Unscoped().Where("id IN ?", ids).Find(&rows).Error
+			return indexBy(rows, func(product *models.Product) uuid.UUID { return product.ID }), err
+		}),
+	}
+}
+
+// uuidKey is the key of rows loaded by ID, or by the ID of their parent.
+type uuidKey uuid.UUID
+
+func (k uuidKey) String() string { return uuid.UUID(k).String() }
+func (k uuidKey) Raw() any       { return uuid.UUID(k) }
+
+// newGraphQLLoader returns a loader fetching the values of a batch of IDs at once. IDs missing from the
+// fetched values load the zero value, e.g. no products for a restaurant without any.
+func newGraphQLLoader[T any](fetch func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]T, error)) *dataloader.Loader {
+	return dataloader.NewBatchedLoader(func(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+		ids := make([]uuid.UUID, 0, len(keys))
+		for _, key := range keys {
+			ids = append(ids, key.Raw().(uuid.UUID))
+		}
+
+		values, err := fetch(ctx, ids)
+		results := make([]*dataloader.Result, 0, len(keys))
+		for _, id := range ids {
+			if err != nil {
+				results = append(results, &dataloader.Result{Error: err})
+				continue
+			}
+			results = append(results, &dataloader.Result{Data: values[id]})
+		}
+		return results
+	}, dataloader.WithWait(graphQLBatchWait))
+}
+
+// loadGraphQL loads the value of the ID with a loader created by newGraphQLLoader.
+func loadGraphQL[T any](ctx context.Context, loader *dataloader.Loader, id uuid.UUID) (T, error) {
+	var value T
+	data, err := loader.Load(ctx, uuidKey(id))()
+	if err != nil {
+		return value, err
+	}
+	value, _ = data.(T)
+	return value, nil
+}
+
+// ordersDayKey is the key of the orders taken by a restaurant over a day, from midnight to midnight in
+// the time zone of the restaurant.
+type ordersDayKey struct {
+	restaurantID uuid.UUID
+	from, to     time.Time
+}
+
+func (k ordersDayKey) String() string {
+	return fmt.Sprintf("%s/%d/%d", k.restaurantID, k.from.Unix(), k.to.Unix())
+}
+
+func (k ordersDayKey) Raw() any { return k }
+
+// newOrdersByDayLoader returns a loader of the orders of restaurants by day. Restaurants in different
+// time zones, or dashboards comparing days, ask for different ranges, so the orders of the ranges of
+// all keys are loaded at once and then split by key.
+func newOrdersByDayLoader(db *gorm.DB) *dataloader.Loader {
+	return dataloader.NewBatchedLoader(func(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+		days := make([]ordersDayKey, 0, len(keys))
+		ranges := db.Session(&gorm.Session{NewDB: true})
+		for i, key := range keys {
+			day := key.Raw().(ordersDayKey)
+			days = append(days, day)
+			if i == 0 {
+				ranges = ranges.Where("restaurant_id = ? AND created_at >= ? AND created_at < ?", day.restaurantID, day.from.UTC(), day.to.UTC())
+			} else {
+				ranges = ranges.Or("restaurant_id = ? AND created_at >= ? AND created_at < ?", day.restaurantID, day.from.UTC(), day.to.UTC())
+			}
+		}
+
+		rows := []models.Order{}
+		err := db.WithContext(ctx).
+			Where(ranges).
+			Order("created_at").
+			Find(&rows).Error
+
+		results := make([]*dataloader.Result, 0, len(keys))
+		for _, day := range days {
+			if err != nil {
+				results = append(results, &dataloader.Result{Error: err})
+				continue
+			}
+			orders := make([]models.Order, 0)
+			for _, order := range rows {
+				if order.RestaurantID == day.restaurantID && !order.CreatedAt.Before(day.from) && order.CreatedAt.Before(day.to) {
+					orders = append(orders, order)
+				}
+			}
+			results = append(results, &dataloader.Result{Data: orders})
+		}
+		return results
+	}, dataloader.WithWait(graphQLBatchWait))
+}
+
+// groupBy groups rows by the key returned by key.
+func groupBy[T any](rows []T, key func(T) uuid.UUID) map[uuid.UUID][]T {
+	groups := make(map[uuid.UUID][]T)
+	for _, row := range rows {
+		groups[key(row)] = append(groups[key(row)], row)
+	}
+	return groups
+}
+
+// indexBy indexes rows by the key returned by key.
+func indexBy[T any](rows []T, key func(*T) uuid.UUID) map[uuid.UUID]*T {
+	index := make(map[uuid.UUID]*T, len(rows))
+	for i := range rows {
+		index[key(&rows[i])] = &rows[i]
+	}
+	return index
+}
@@ -0,0 +1,218 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type testGraphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// graphQL runs the query and decodes its data into v.
+func (c *testClient) graphQL(t *testing.T, query string, v any) []string {
+	t.Helper()
+	response := c.expect(t, http.StatusOK, http.MethodPost, "/api/graphql", graphQLPayload{Query: query})
+	result := testGraphQLResponse{}
+	response.decode(t, &result)
+	if v != nil && len(result.Data) > 0 {
+		require.NoError(t, json.Unmarshal(result.Data, v))
+	}
+
+	errors := make([]string, 0, len(result.Errors))
+	for _, err := range result.Errors {
+		errors = append(errors, err.Message)
+	}
+	return errors
+}
+
+func TestGraphQL(t *testing.T) {
+	f := newFixture(t)
+	gyozaID := f.owner.createProduct(t, f.restaurantID, "Gyoza", 6)
+	for range 3 {
+		f.waiter.createOrder(t, f.restaurantID, "1", f.productID, gyozaID)
+	}
+
+	type dashboard struct {
+		Restaurant *struct {
+			Name  string `json:"name"`
+			Staff []struct {
+				Username string `json:"username"`
+			} `json:"staff"`
+			Products []struct {
+				Title string `json:"title"`
+			} `json:"products"`
+			Orders []struct {
+				TotalAmount float64 `json:"totalAmount"`
+				Staff       *struct {
+					Username string `json:"username"`
+				} `json:"staff"`
+				Items []struct {
+					Quantity int `json:"quantity"`
+					Product  struct {
+						Title string `json:"title"`
+					} `json:"product"`
+				} `json:"items"`
+			} `json:"orders"`
+		} `json:"restaurant"`
+	}
+	// restaurant queries the fields of the restaurant of the fixture
+	restaurant := func(fields string) string {
+		return fmt.Sprintf(`{ restaurant(id: "%s") { %s } }`, f.restaurantID, fields)
+	}
+	query := restaurant(`
+		name
+		staff { username }
+		products { title }
+		orders { totalAmount staff { username } items { quantity product { title } } }
+	`)
+
+	t.Run("loads the dashboard of the owner in one request", func(t *testing.T) {
+		result := dashboard{}
+		assert.Empty(t, f.owner.graphQL(t, query, &result))
+		require.NotNil(t, result.Restaurant)
+		assert.Equal(t, "Ramen House", result.Restaurant.Name)
+		assert.Len(t, result.Restaurant.Staff, 2)
+		assert.Len(t, result.Restaurant.Products, 2)
+		require.Len(t, result.Restaurant.Orders, 3)
+		for _, order := range result.Restaurant.Orders {
+			assert.Equal(t, 16.0, order.TotalAmount)
+			require.NotNil(t, order.Staff)
+			assert.Equal(t, "waiter", order.Staff.Username)
+			require.Len(t, order.Items, 2)
+			assert.Equal(t, "Ramen", order.Items[0].Product.Title)
+			assert.Equal(t, "Gyoza", order.Items[1].Product.Title)
+		}
+	})
+
+	t.Run("batches the queries of nested lists", func(t *testing.T) {
+		queries := atomic.Int32{}
+		require.NoError(t, f.server.db.Connection.Callback().Query().After("gorm:query").Register("test:count", func(*gorm.DB) {
+			queries.Add(1)
+		}))
+		t.Cleanup(func() { f.server.db.Connection.Callback().Query().Remove("test:count") })
+
+		count := func(query string) int32 {
+			queries.Store(0)
+			assert.Empty(t, f.owner.graphQL(t, query, nil))
+			return queries.Load()
+		}
+		orders := count(`{ restaurants { orders { id } } }`)
+		items := count(`{ restaurants { orders { id items { quantity product { title } } } } }`)
+		// One query for the items of every order, and one for their products
+		assert.Equal(t, orders+2, items)
+	})
+
+	t.Run("scopes data like the REST API", func(t *testing.T) {
+		result := dashboard{}
+		errors := f.waiter.graphQL(t, query, &result)
+		require.NotNil(t, result.Restaurant)
+		assert.Nil(t, result.Restaurant.Staff)
+		assert.Len(t, result.Restaurant.Orders, 3)
+		assert.Contains(t, errors, "unauthorized")
+
+		result = dashboard{}
+		assert.Equal(t, []string{"not found"}, f.otherOwner.graphQL(t, restaurant(`name`), &result))
+		assert.Nil(t, result.Restaurant)
+		assert.Equal(t, []string{"not found"}, f.otherStaff.graphQL(t, restaurant(`name`), &result))
+
+		restaurants := struct {
+			Restaurants []struct {
+				Name string `json:"name"`
+			} `json:"restaurants"`
+		}{}
+		assert.Empty(t, f.otherOwner.graphQL(t, `{ restaurants { name } }`, &restaurants))
+		require.Len(t, restaurants.Restaurants, 1)
+		assert.Equal(t, "Pizzeria", restaurants.Restaurants[0].Name)
+	})
+
+	t.Run("filters orders by day and status", func(t *testing.T) {
+		result := dashboard{}
+		assert.Empty(t, f.owner.graphQL(t, restaurant(`orders(date: "2020-01-01") { id }`), &result))
+		assert.Empty(t, result.Restaurant.Orders)
+		assert.Empty(t, f.owner.graphQL(t, restaurant(`orders(status: "cancelled") { id }`), &result))
+		assert.Empty(t, result.Restaurant.Orders)
+
+		assert.Equal(t, []string{errInvalidGraphQLDate.Error()}, f.owner.graphQL(t, restaurant(`orders(date: "yesterday") { id }`), nil))
+		assert.Equal(t, []string{"unknown order status"}, f.owner.graphQL(t, restaurant(`orders(status: "lost") { id }`), nil))
+	})
+
+	t.Run("loads the orders of the days asked for only", func(t *testing.T) {
+		// An order of a day between the days asked for
+		orderID := f.waiter.createOrder(t, f.restaurantID, "2", f.productID)
+		require.NoError(t, f.server.db.Connection.Model(&models.Order{}).Where("id = ?", orderID).
+			UpdateColumn("created_at", time.Date(2022, time.June, 1, 12, 0, 0, 0, time.UTC)).Error)
+
+		loaded := atomic.Int64{}
+		require.NoError(t, f.server.db.Connection.Callback().Query().After("gorm:query").Register("test:orders", func(db *gorm.DB) {
+			if db.Statement.Table == "orders" {
+				loaded.Add(db.Statement.RowsAffected)
+			}
+		}))
+		t.Cleanup(func() { f.server.db.Connection.Callback().Query().Remove("test:orders") })
+
+		result := struct {
+			Restaurant struct {
+				Old   []struct{ ID string } `json:"old"`
+				Today []struct{ ID string } `json:"today"`
+			} `json:"restaurant"`
+		}{}
+		assert.Empty(t, f.owner.graphQL(t, restaurant(`old: orders(date: "2020-01-01") { id } today: orders { id }`), &result))
+		assert.Empty(t, result.Restaurant.Old)
+		assert.Len(t, result.Restaurant.Today, 3)
+		assert.EqualValues(t, 3, loaded.Load())
+	})
+
+	t.Run("limits queries", func(t *testing.T) {
+		errors := f.owner.graphQL(t, `{ __schema { types { fields { type { ofType { ofType { name } } } } } } }`, nil)
+		require.Len(t, errors, 1)
+		assert.Contains(t, errors[0], "exceeds max depth")
+
+		nested := `restaurants { orders { items { product { title } } } }`
+		errors = f.owner.graphQL(t, "{ a: "+nested+" b: "+nested+" c: "+nested+" }", nil)
+		require.Len(t, errors, 1)
+		assert.Contains(t, errors[0], "query is too complex")
+
+		response := f.owner.do(t, http.MethodPost, "/api/graphql", []byte(`{"query":`), nil)
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Equal(t, http.StatusUnauthorized, f.server.client().do(t, http.MethodPost, "/api/graphql", graphQLPayload{Query: "{ restaurants { name } }"}, nil).Code)
+	})
+}
+
+func TestGraphQLComplexity(t *testing.T) {
+	schema, err := newGraphQLSchema()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		query     string
+		operation string
+		expected  int
+	}{
+		{name: "fields", query: `{ restaurant(id: "1") { name currency } }`, expected: 3},
+		{name: "lists", query: `{ restaurants { name orders { id } } }`, expected: 1 + 10*(1+1+10)},
+		{name: "aliases and arguments", query: `{ a: restaurant(id: "1") { name } b: restaurant(id: "2") { name @include(if: true) } }`, expected: 4},
+		{name: "fragments", query: `query { restaurants { ...Names } } fragment Names on Restaurant { name products { title } }`, expected: 1 + 10*(1+1+10)},
+		{name: "inline fragments", query: `{ restaurants { ... on Restaurant { name } } }`, expected: 11},
+		{name: "named operation", query: `query A { restaurants { name } } query B($id: ID!) { restaurant(id: $id) { name } }`, operation: "B", expected: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			complexity, err := graphQLComplexity(schema.ASTSchema(), tt.query, tt.operation)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, complexity)
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/database"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+// testPassword is the password of the owners and staff created by the test helpers.
+const testPassword = "password"
+
+// testServer is the API served by NewRouter over an in-memory SQLite database.
+type testServer struct {
+	db     *database.Database
+	router *echo.Echo
+}
+
+func newTestServer(t *testing.T, opts ...Option) *testServer {
+	// The cache is shared so that every connection of the pool sees the same database
+	db, err := database.NewDatabase("file:" + t.Name() + "?mode=memory&cache=shared")
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate())
+	t.Cleanup(func() {
+		if sqlDB, err := db.Connection.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	router, err := NewRouter(db, opts...)
+	require.NoError(t, err)
+	return &testServer{db: db, router: router}
+}
+
+// client returns an anonymous client.
+func (s *testServer) client() *testClient {
+	return &testClient{server: s, cookies: make(map[string]*http.Cookie)}
+}
+
+// testClient sends requests to the server and keeps the cookies it sets, like a browser.
+type testClient struct {
+	server  *testServer
+	cookies map[string]*http.Cookie
+}
+
+// testResponse is a recorded response.
+type testResponse struct {
+	Code   int
+	Header http.Header
+	Body   []byte
+}
+
+// decode unmarshals the JSON body of the response into v.
+func (r *testResponse) decode(t *testing.T, v any) {
+	t.Helper()
+	require.NoError(t, json.Unmarshal(r.Body, v), string(r.Body))
+}
+
+// do sends a request with body encoded as JSON, or as is when it is a []byte.
+func (c *testClient) do(t *testing.T, method, path string, body any, header http.Header) *testResponse {
+	t.Helper()
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(body)
+	default:
+		encoded, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(encoded)
+	}
+
+	request := httptest.NewRequest(method, path, reader)
+	request.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	for _, cookie := range c.cookies {
+		request.AddCookie(cookie)
+	}
+
+	recorder := httptest.NewRecorder()
+	c.server.router.ServeHTTP(recorder, request)
+
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(c.cookies, cookie.Name)
+			continue
+		}
+		c.cookies[cookie.Name] = cookie
+	}
+	return &testResponse{Code: recorder.Code, Header: recorder.Header(), Body: recorder.Body.Bytes()}
+}
+
+// expect sends a request and fails the test unless it gets the status.
+func (c *testClient) expect(t *testing.T, status int, method, path string, body any) *testResponse {
+	t.Helper()
+	response := c.do(t, method, path, body, nil)
+	require.Equal(t, status, response.Code, "%s %s: %s", method, path, response.Body)
+	return response
+}
+
+// signUpOwner returns a client signed in as a new owner.
+func (s *testServer) signUpOwner(t *testing.T, username string) *testClient {
+	t.Helper()
+	client := s.client()
+	client.expect(t, http.StatusCreated, http.MethodPost, "/api/auth/owners/sign-up", signUpOwnerPayload{
+		Username: username,
+		Password: testPassword,
+	})
+	return client
+}
+
+// signInStaff returns a client signed in as the staff member.
+func (s *testServer) signInStaff(t *testing.T, restaurantID uuid.UUID, username string) *testClient {
+	t.Helper()
+	client := s.client()
+	client.expect(t, http.StatusOK, http.MethodPost, "/api/auth/staff/sign-in", signInStaffPayload{
+		RestaurantID: restaurantID,
+		Username:     username,
+		Password:     testPassword,
+	})
+	return client
+}
+
+// createdID returns the ID named key of a created resource.
+func createdID(t *testing.T, response *testResponse, key string) uuid.UUID {
+	t.Helper()
+	ids := map[string]any{}
+	response.decode(t, &ids)
+	id, ok := ids[key].(string)
+	require.True(t, ok, "no %s in %s", key, response.Body)
+	return uuid.MustParse(id)
+}
+
+func (c *testClient) createRestaurant(t *testing.T, name string) uuid.UUID {
+	t.Helper()
+	response := c.expect(t, http.StatusCreated, http.MethodPost, "/api/restaurants", registerRestaurantPayload{Name: name})
+	return createdID(t, response, "restaurant_id")
+}
+
+func (c *testClient) createStaff(t *testing.T, restaurantID uuid.UUID, username string, role models.StaffRole) uuid.UUID {
+	t.Helper()
+	response := c.expect(t, http.StatusCreated, http.MethodPost, "/api/restaurants/"+restaurantID.String()+"/staff", registerStaffPayload{
+		Username: username,
+		Password: testPassword,
+		Role:     role,
+	})
+	return createdID(t, response, "staff_id")
+}
+
+func (c *testClient) createProduct(t *testing.T, restaurantID uuid.UUID, title string, unitPrice float64) uuid.UUID {
+	t.Helper()
+	response := c.expect(t, http.StatusCreated, http.MethodPost, "/api/restaurants/"+restaurantID.String()+"/products", registerProductPayload{
+		Title:       title,
+		Description: title,
+		Category:    "mains",
+		UnitPrice:   unitPrice,
+	})
+	return createdID(t, response, "product_id")
+}
+
+func (c *testClient) createTable(t *testing.T, restaurantID uuid.UUID, number string) uuid.UUID {
+	t.Helper()
+	response := c.expect(t, http.StatusCreated, http.MethodPost, "/api/restaurants/"+restaurantID.String()+"/tables", registerTablePayload{
+		Number: number,
+		Seats:  4,
+	})
+	return createdID(t, response, "table_id")
+}
+
+// createOrder takes a dine-in order of the products, one of each, at the table.
+func (c *testClient) createOrder(t *testing.T, restaurantID uuid.UUID, tableNumber string, productIDs ...uuid.UUID) uuid.UUID {
+	t.Helper()
+	payload := createOrderPayload{orderTypeInput: orderTypeInput{TableNumber: tableNumber}}
+	for _, productID := range productIDs {
+		payload.Products = append(payload.Products, orderItemInput{ProductID: productID, Quantity: 1})
+	}
+	response := c.expect(t, http.StatusCreated, http.MethodPost, "/api/restaurants/"+restaurantID.String()+"/orders", payload)
+	return createdID(t, response, "order_id")
+}
+
+// fixture is a restaurant with a manager, a waiter, a product at 10 and table 1, and a second
+// restaurant of another owner with its own staff member. Clients are signed in for each of them.
+type fixture struct {
+	server *testServer
+
+	owner   *testClient
+	manager *testClient
+	waiter  *testClient
+
+	otherOwner *testClient
+	otherStaff *testClient
+
+	restaurantID uuid.UUID
+	managerID    uuid.UUID
+	waiterID     uuid.UUID
+	productID    uuid.UUID
+	tableID      uuid.UUID
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	server := newTestServer(t)
+	f := &fixture{server: server}
+
+	f.owner = server.signUpOwner(t, "owner")
+	f.restaurantID = f.owner.createRestaurant(t, "Ramen House")
+	f.managerID = f.owner.createStaff(t, f.restaurantID, "manager", models.StaffRoleManager)
+	f.waiterID = f.owner.createStaff(t, f.restaurantID, "waiter", models.StaffRoleWaiter)
+	f.productID = f.owner.createProduct(t, f.restaurantID, "Ramen", 10)
+	f.tableID = f.owner.createTable(t, f.restaurantID, "1")
+	f.manager = server.signInStaff(t, f.restaurantID, "manager")
+	f.waiter = server.signInStaff(t, f.restaurantID, "waiter")
+
+	f.otherOwner = server.signUpOwner(t, "other")
+	otherRestaurantID := f.otherOwner.createRestaurant(t, "Pizzeria")
+	f.otherOwner.createStaff(t, otherRestaurantID, "other", models.StaffRoleManager)
+	f.otherStaff = server.signInStaff(t, otherRestaurantID, "other")
+	return f
+}
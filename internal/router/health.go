@@ -2,15 +2,42 @@ package router
 
 import (
 	"net/http"
+	"sync/atomic"
 
 	"github.com/labstack/echo/v4"
 )
 
+// Readiness tells whether the API is ready to serve requests, so that clients and load balancers stop
+// sending requests to a server which is shutting down. The zero value is ready.
+type Readiness struct {
+	draining atomic.Bool
+}
+
+// Drain reports the API is not ready anymore, e.g. when the gateway starts shutting down.
+func (r *Readiness) Drain() {
+	r.draining.Store(true)
+}
+
+// Draining reports whether the API was drained.
+func (r *Readiness) Draining() bool {
+	return r.draining.Load()
+}
+
 func bindHealthRouter(router *echo.Group) {
 	group := router.Group("/_health")
 	group.GET("", healthCheck)
+	group.GET("/ready", readinessCheck)
 }
 
 func healthCheck(ctx echo.Context) error {
 	return ctx.String(http.StatusOK, "OK")
 }
+
+// readinessCheck responds with 503 Service Unavailable once the API is draining, unlike healthCheck
+// which only tells it is up.
+func readinessCheck(ctx echo.Context) error {
+	if ctx.(*routerContext).options.readiness.Draining() {
+		return ctx.String(http.StatusServiceUnavailable, "draining")
+	}
+	return ctx.String(http.StatusOK, "ready")
+}
@@ -0,0 +1,21 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadiness(t *testing.T) {
+	readiness := &Readiness{}
+	client := newTestServer(t, WithReadiness(readiness)).client()
+
+	response := client.expect(t, http.StatusOK, http.MethodGet, "/api/_health/ready", nil)
+	assert.Equal(t, "ready", string(response.Body))
+
+	readiness.Drain()
+	response = client.expect(t, http.StatusServiceUnavailable, http.MethodGet, "/api/_health/ready", nil)
+	assert.Equal(t, "draining", string(response.Body))
+	client.expect(t, http.StatusOK, http.MethodGet, "/api/_health", nil)
+}
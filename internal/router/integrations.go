@@ -0,0 +1,295 @@
+package router
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/integrations"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/security"
+	"gorm.io/gorm"
+)
+
+func bindIntegrationsRouter(router *echo.Group) {
+	group := router.Group("/restaurants/:restaurant_id/integrations")
+	group.GET("", getIntegrations)
+	group.POST("", registerIntegration)
+	group.DELETE("/:integration_id", deleteIntegration)
+	group.POST("/:integration_id/menu/push", pushIntegrationMenu)
+}
+
+// bindWebhooksRouter binds the endpoints delivery platforms send orders to. They don't need auth,
+// webhooks are signed with the secret of the integration.
+func bindWebhooksRouter(router *echo.Group) {
+	router.POST("/webhooks/integrations/:integration_id", receiveIntegrationWebhook)
+}
+
+// maxWebhookSize is the size of the largest webhook body accepted.
+const maxWebhookSize = 1 << 20
+
+// IntegrationResponse maps fields of Integration model we are willing to expose, without its secrets.
+type IntegrationResponse struct {
+	IntegrationID uuid.UUID `json:"integration_id"`
+	RestaurantID  uuid.UUID `json:"restaurant_id"`
+	Platform      string    `json:"platform"`
+	StoreID       string    `json:"store_id"`
+	Endpoint      string    `json:"endpoint"`
+	// WebhookPath is where the platform sends orders to.
+	WebhookPath string    `json:"webhook_path"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newIntegrationResponse(integration *models.Integration) IntegrationResponse {
+	return IntegrationResponse{
+		IntegrationID: integration.ID,
+		RestaurantID:  integration.RestaurantID,
+		Platform:      integration.Platform,
+		StoreID:       integration.StoreID,
+		Endpoint:      integration.Endpoint,
+		WebhookPath:   "/api/webhooks/integrations/" + integration.ID.String(),
+		CreatedAt:     integration.CreatedAt,
+	}
+}
+
+// integrationsList are the pages of delivery platforms a restaurant is connected to.
+var integrationsList = &listSpec{
+	sorts:       []string{"platform"},
+	defaultSort: "id",
+	filters:     []listFilter{stringFilter("platform", "platform", "Only list the integrations with the platform.")},
+}
+
+func getIntegrations(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	rows, err := findPage[models.Integration](ctx, integrationsList, db.Connection.Where("restaurant_id = ?", restaurantID), time.UTC)
+	if err != nil {
+		return err
+	}
+
+	integrations := make([]IntegrationResponse, 0, len(rows))
+	for _, integration := range rows {
+		integrations = append(integrations, newIntegrationResponse(&integration))
+	}
+
+	return ctx.JSON(http.StatusOK, integrations)
+}
+
+type registerIntegrationPayload struct {
+	Platform      string `json:"platform" validate:"required"`
+	StoreID       string `json:"store_id" validate:"required,max=200"`
+	Endpoint      string `json:"endpoint" validate:"required,http_url"`
+	APIKey        string `json:"api_key" validate:"required,max=500"`
+	WebhookSecret string `json:"webhook_secret" validate:"omitempty,min=16,max=500"`
+}
+
+// registerIntegration connects the restaurant to its store on a delivery platform. The webhook secret
+// is generated when the platform doesn't provide one, it is only returned once.
+func registerIntegration(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := registerIntegrationPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+	if err := integrations.ValidateStore(payload.Platform, payload.StoreID); err != nil {
+		return err
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	// Only owners can connect their restaurant to platforms
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	if payload.WebhookSecret == "" {
+		payload.WebhookSecret, err = security.GenerateToken()
+		if err != nil {
+			return echo.ErrInternalServerError
+		}
+	}
+
+	integration := &models.Integration{
+		RestaurantID:  restaurantID,
+		Platform:      payload.Platform,
+		StoreID:       payload.StoreID,
+		Endpoint:      payload.Endpoint,
+		APIKey:        payload.APIKey,
+		WebhookSecret: payload.WebhookSecret,
+	}
+	err = db.Connection.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(integration).Error; err != nil {
+			return err
+		}
+		// The platform gets the menu as soon as the store is connected
+		_, err := integrations.EnqueueIntegrationMenu(tx, integration)
+		return err
+	})
+	if err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusCreated, struct {
+		IntegrationResponse
+		WebhookSecret string `json:"webhook_secret"`
+	}{
+		IntegrationResponse: newIntegrationResponse(integration),
+		WebhookSecret:       integration.WebhookSecret,
+	})
+}
+
+// deleteIntegration disconnects the restaurant from a platform. Its pending events fail on their next
+// attempt and its webhooks are rejected.
+func deleteIntegration(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	integrationID, err := uuid.Parse(ctx.Param("integration_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	tx := db.Connection.Where("id = ? AND restaurant_id = ?", integrationID, restaurantID).Delete(&models.Integration{})
+	if tx.Error != nil {
+		return echo.ErrInternalServerError
+	}
+	if tx.RowsAffected == 0 {
+		return echo.ErrNotFound
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// pushIntegrationMenu queues a push of the menu to the platform, e.g. after fixing a failed push.
+func pushIntegrationMenu(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	integrationID, err := uuid.Parse(ctx.Param("integration_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	integration := &models.Integration{}
+	if err := db.Connection.First(integration, "id = ? AND restaurant_id = ?", integrationID, restaurantID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.ErrNotFound
+		}
+		return echo.ErrInternalServerError
+	}
+
+	if _, err := integrations.EnqueueIntegrationMenu(db.Connection, integration); err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.NoContent(http.StatusAccepted)
+}
+
+// receiveIntegrationWebhook creates the order sent by a delivery platform. Orders already received
+// are returned as is so that platforms can safely retry webhooks.
+func receiveIntegrationWebhook(ctx echo.Context) error {
+	integrationID, err := uuid.Parse(ctx.Param("integration_id"))
+	if err != nil {
+		return echo.ErrNotFound
+	}
+
+	body, err := io.ReadAll(io.LimitReader(ctx.Request().Body, maxWebhookSize+1))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	if len(body) > maxWebhookSize {
+		return echo.ErrStatusRequestEntityTooLarge
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	integration := &models.Integration{}
+	if err := db.Connection.First(integration, "id = ?", integrationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.ErrNotFound
+		}
+		return echo.ErrInternalServerError
+	}
+	restaurant := &models.Restaurant{}
+	if err := db.Connection.First(restaurant, "id = ?", integration.RestaurantID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.ErrNotFound
+		}
+		return echo.ErrInternalServerError
+	}
+	if restaurant.IsArchived() {
+		return echo.ErrNotFound
+	}
+
+	var order *models.Order
+	var created bool
+	err = db.Connection.Transaction(func(tx *gorm.DB) error {
+		order, created, err = integrations.Receive(tx, integration, restaurant, ctx.Request().Header, body, time.Now())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	status := http.StatusOK
+	if created {
+		ctx.(*routerContext).GetServices().Orders.Publish(order)
+		status = http.StatusCreated
+	}
+	return ctx.JSON(status, map[string]string{
+		"order_id": order.ID.String(),
+	})
+}
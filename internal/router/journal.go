@@ -0,0 +1,167 @@
+package router
+
+import (
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/journal"
+	"github.com/roushou/pocpoc/internal/models"
+	"gorm.io/gorm"
+)
+
+func bindJournalRouter(router *echo.Group) {
+	group := router.Group("/restaurants/:restaurant_id/journal")
+	group.GET("", getJournalEntries)
+	group.GET("/verify", verifyJournal)
+
+	router.POST("/orders/:order_id/credit-notes", createCreditNote)
+}
+
+// JournalEntryResponse maps fields of JournalEntry model we are willing to expose.
+type JournalEntryResponse struct {
+	EntryID         uuid.UUID               `json:"entry_id"`
+	RestaurantID    uuid.UUID               `json:"restaurant_id"`
+	Sequence        int64                   `json:"sequence"`
+	Kind            models.JournalEntryKind `json:"kind"`
+	DocumentNumber  string                  `json:"document_number"`
+	OrderID         uuid.UUID               `json:"order_id"`
+	CreditedEntryID *uuid.UUID              `json:"credited_entry_id,omitempty"`
+	Amount          float64                 `json:"amount"`
+	TaxAmount       float64                 `json:"tax_amount"`
+	Currency        string                  `json:"currency"`
+	Lines           []models.JournalLine    `json:"lines"`
+	Reason          string                  `json:"reason,omitempty"`
+	PreviousHash    string                  `json:"previous_hash"`
+	Hash            string                  `json:"hash"`
+	CreatedAt       time.Time               `json:"created_at"`
+}
+
+func newJournalEntryResponse(entry *models.JournalEntry) JournalEntryResponse {
+	return JournalEntryResponse{
+		EntryID:         entry.ID,
+		RestaurantID:    entry.RestaurantID,
+		Sequence:        entry.Sequence,
+		Kind:            entry.Kind,
+		DocumentNumber:  entry.DocumentNumber(),
+		OrderID:         entry.OrderID,
+		CreditedEntryID: entry.CreditedEntryID,
+		Amount:          entry.Amount,
+		TaxAmount:       entry.TaxAmount,
+		Currency:        entry.Currency,
+		Lines:           entry.Lines,
+		Reason:          entry.Reason,
+		PreviousHash:    entry.PreviousHash,
+		Hash:            entry.Hash,
+		CreatedAt:       entry.CreatedAt,
+	}
+}
+
+// journalEntriesList are the pages of entries of the journal of a restaurant, in sequence order.
+var journalEntriesList = &listSpec{
+	sorts:       []string{"sequence"},
+	defaultSort: "sequence",
+	filters:     []listFilter{enumFilter("kind", "kind", "Only list the entries of the kind.", enumValues[reflect.TypeOf(models.JournalEntryKind(""))])},
+}
+
+func getJournalEntries(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	rows, err := findPage[models.JournalEntry](ctx, journalEntriesList, db.Connection.Where("restaurant_id = ?", restaurantID), time.UTC)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]JournalEntryResponse, 0, len(rows))
+	for _, entry := range rows {
+		entries = append(entries, newJournalEntryResponse(&entry))
+	}
+
+	return ctx.JSON(http.StatusOK, entries)
+}
+
+func verifyJournal(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	verification, err := journal.Verify(db.Connection, restaurantID)
+	if err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, verification)
+}
+
+type createCreditNotePayload struct {
+	Amount float64 `json:"amount" validate:"gt=0"`
+	Reason string  `json:"reason" validate:"required"`
+}
+
+// createCreditNote refunds part or all of an invoiced order. Invoices are never edited, refunds are
+// recorded in the journal as credit notes.
+func createCreditNote(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := createCreditNotePayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	order, err := findAccessibleOrder(ctx, authUser)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	// Refunds are restricted to those who can close the business day
+	if _, err := findDayClosingRestaurant(ctx, authUser, order.RestaurantID); err != nil {
+		return err
+	}
+
+	var entry *models.JournalEntry
+	err = db.Connection.Transaction(func(tx *gorm.DB) error {
+		entry, err = journal.AppendCreditNote(tx, order, payload.Amount, payload.Reason)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, newJournalEntryResponse(entry))
+}
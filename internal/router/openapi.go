@@ -0,0 +1,519 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// openAPIVersion is the version of the OpenAPI specification the document follows.
+const openAPIVersion = "3.1.0"
+
+// Security schemes of the API.
+const (
+	// securitySession is the JWT set as a cookie when owners and staff sign in.
+	securitySession = "session"
+	// securityTerminal is the device token terminals were issued at registration.
+	securityTerminal = "terminal"
+	// securityWebhook is the signature of webhooks sent by delivery platforms.
+	securityWebhook = "webhookSignature"
+)
+
+// schema is a JSON schema written as is in the document.
+type schema map[string]any
+
+// oneOf documents responses whose body is one of the types.
+type oneOf []any
+
+// parameter is a query parameter of an operation.
+type parameter struct {
+	name        string
+	description string
+	schema      schema
+}
+
+// operation documents a route of the API. Every route registered by NewRouter must be documented,
+// TestOpenAPIDocumentsRoutes fails otherwise.
+type operation struct {
+	method string
+	// path is the path of the route under /api, with echo parameters e.g. "/orders/:order_id".
+	path string
+	// handler is the handler of the route, its name is the ID of the operation.
+	handler echo.HandlerFunc
+	tag     string
+	summary string
+	// security are the schemes accepted by the operation, the operation is public when empty.
+	security []string
+	query    []parameter
+	// list is the spec of the pages of list operations, whose parameters are documented on top of
+	// query.
+	list *listSpec
+	// request is a value of the type of the JSON body of requests, nil without body.
+	request any
+	// status is the status of successful responses.
+	status int
+	// response is a value of the type of the JSON body of responses, a schema or oneOf, nil without
+	// body.
+	response any
+	// contentTypes are the media types of responses which are not JSON, e.g. CSV exports.
+	contentTypes []string
+}
+
+// bindOpenAPIRouter serves the OpenAPI document of the API and a page to browse it.
+func bindOpenAPIRouter(router *echo.Group) {
+	router.GET("/openapi.json", getOpenAPIDocument)
+	router.GET("/docs", getDocs)
+}
+
+func getOpenAPIDocument(ctx echo.Context) error {
+	return ctx.JSONBlob(http.StatusOK, ctx.(*routerContext).options.openAPIDocument)
+}
+
+func getDocs(ctx echo.Context) error {
+	return ctx.HTML(http.StatusOK, ctx.(*routerContext).options.docsPage)
+}
+
+// redocScript is the Redoc bundle the docs page loads when it is not served with WithDocsBundle. The
+// version is pinned so that the page doesn't change under the API.
+const redocScript = "https://cdn.jsdelivr.net/npm/redoc@2.1.5/bundles/redoc.standalone.js"
+
+// closingScriptTag matches the sequences which would end a script inlined in a page.
+var closingScriptTag = regexp.MustCompile(`(?i)</script`)
+
+// newDocsPage returns the page rendering the OpenAPI document with Redoc. The bundle is inlined when
+// given, so that the page works offline, and loaded from redocScript otherwise.
+func newDocsPage(bundle []byte) string {
+	script := `<script src="` + redocScript + `"></script>`
+	if bundle != nil {
+		inlined := closingScriptTag.ReplaceAllStringFunc(string(bundle), func(tag string) string { return `<\/` + tag[2:] })
+		script = "<script>" + inlined + "</script>"
+	}
+	return strings.Replace(docsPage, "{{script}}", script, 1)
+}
+
+// docsPage is the page rendering the OpenAPI document, with the Redoc script in place of {{script}}.
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>pocpoc API</title>
+</head>
+<body>
+  <redoc spec-url="openapi.json"></redoc>
+  {{script}}
+</body>
+</html>
+`
+
+// newOpenAPIDocument returns the OpenAPI document describing the operations.
+func newOpenAPIDocument(operations []operation) map[string]any {
+	generator := &schemaGenerator{components: make(map[string]any), types: make(map[string]reflect.Type)}
+
+	errorResponse := generator.schema(reflect.TypeOf(ErrorResponse{}))
+	paths := make(map[string]map[string]any)
+	for _, op := range operations {
+		path, parameters := openAPIPath(op.path)
+		query := op.query
+		if op.list != nil {
+			query = append(op.list.parameters(), query...)
+		}
+		for _, query := range query {
+			parameters = append(parameters, schema{
+				"name":        query.name,
+				"in":          "query",
+				"description": query.description,
+				"schema":      query.schema,
+			})
+		}
+
+		security := make([]schema, 0, len(op.security))
+		for _, scheme := range op.security {
+			security = append(security, schema{scheme: []string{}})
+		}
+
+		item := schema{
+			"operationId": handlerName(op.handler),
+			"tags":        []string{op.tag},
+			"summary":     op.summary,
+			"security":    security,
+			"responses": schema{
+				strconv.Itoa(op.status): generator.response(op),
+				"default":               schema{"$ref": "#/components/responses/Error"},
+			},
+		}
+		if len(parameters) > 0 {
+			item["parameters"] = parameters
+		}
+		if op.request != nil {
+			item["requestBody"] = schema{
+				"required": true,
+				"content": schema{
+					echo.MIMEApplicationJSON: schema{"schema": generator.schema(reflect.TypeOf(op.request))},
+				},
+			}
+		}
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(op.method)] = item
+	}
+
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": schema{
+			"title":   "pocpoc API",
+			"version": "1.0.0",
+		},
+		"servers": []schema{{"url": "/api"}},
+		"paths":   paths,
+		"components": schema{
+			"schemas": generator.components,
+			"responses": schema{
+				"Error": schema{
+					"description": "Error",
+					"headers": schema{
+						echo.HeaderXRequestID: schema{"schema": schema{"type": "string"}},
+					},
+					"content": schema{
+						echo.MIMEApplicationJSON: schema{"schema": errorResponse},
+					},
+				},
+			},
+			"securitySchemes": schema{
+				securitySession: schema{
+					"type":        "apiKey",
+					"in":          "cookie",
+					"name":        jwtCookieName,
+					"description": "JWT set by the sign-in endpoints.",
+				},
+				securityTerminal: schema{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        terminalTokenHeader,
+					"description": "Device token issued when the terminal was registered.",
+				},
+				securityWebhook: schema{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        "X-Webhook-Signature",
+					"description": "Hex HMAC-SHA256 of the X-Webhook-Timestamp header, a dot and the body, keyed with the webhook secret. Deliveroo signs the X-Deliveroo-Sequence-Guid header, a space and the body in the X-Deliveroo-Hmac-Sha256 header instead.",
+				},
+			},
+		},
+	}
+}
+
+// marshalOpenAPIDocument returns the OpenAPI document of the operations as JSON.
+func marshalOpenAPIDocument(operations []operation) ([]byte, error) {
+	return json.Marshal(newOpenAPIDocument(operations))
+}
+
+var pathParameterPattern = regexp.MustCompile(`:(\w+)`)
+
+// openAPIPath returns the path of the route in the OpenAPI format, e.g. "/orders/{order_id}", and
+// its parameters.
+func openAPIPath(path string) (string, []schema) {
+	parameters := make([]schema, 0)
+	for _, match := range pathParameterPattern.FindAllStringSubmatch(path, -1) {
+		name := match[1]
+		parameter := schema{"name": name, "in": "path", "required": true, "schema": schema{"type": "string"}}
+		switch {
+		case strings.HasSuffix(name, "_id"):
+			parameter["schema"] = schema{"type": "string", "format": "uuid"}
+		case name == "business_date":
+			parameter["schema"] = schema{"type": "string", "format": "date"}
+		case name == "report":
+			parameter["schema"] = schema{"type": "string", "enum": reportNames()}
+		case name == "table_token":
+			parameter["description"] = "Signed token of the table, encoded in its QR code."
+		}
+		parameters = append(parameters, parameter)
+	}
+	return pathParameterPattern.ReplaceAllString(path, "{$1}"), parameters
+}
+
+// handlerName returns the name of the handler function, e.g. "createOrder".
+func handlerName(handler echo.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// schemaGenerator generates JSON schemas from Go types. Named structs are added to the components
+// of the document and referenced.
+type schemaGenerator struct {
+	components map[string]any
+	types      map[string]reflect.Type
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	uuidType    = reflect.TypeOf(uuid.UUID{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+	weekdayType = reflect.TypeOf(time.Weekday(0))
+)
+
+func (g *schemaGenerator) response(op operation) schema {
+	response := schema{"description": http.StatusText(op.status)}
+	content := schema{}
+	switch body := op.response.(type) {
+	case nil:
+	case schema:
+		content[echo.MIMEApplicationJSON] = schema{"schema": body}
+	case oneOf:
+		schemas := make([]schema, 0, len(body))
+		for _, value := range body {
+			schemas = append(schemas, g.schema(reflect.TypeOf(value)))
+		}
+		content[echo.MIMEApplicationJSON] = schema{"schema": schema{"oneOf": schemas}}
+	default:
+		content[echo.MIMEApplicationJSON] = schema{"schema": g.schema(reflect.TypeOf(body))}
+	}
+	for _, contentType := range op.contentTypes {
+		body := schema{"type": "string"}
+		if !strings.HasPrefix(contentType, "text/") && contentType != "image/svg+xml" {
+			body["contentEncoding"] = "binary"
+		}
+		content[contentType] = schema{"schema": body}
+	}
+	if len(content) > 0 {
+		response["content"] = content
+	}
+	if op.list != nil {
+		response["headers"] = schema{
+			"Link":           schema{"description": `Link to the next page with rel="next", when there is one.`, "schema": schema{"type": "string"}},
+			headerNextCursor: schema{"description": "Cursor of the next page, when there is one.", "schema": schema{"type": "string"}},
+		}
+	}
+	return response
+}
+
+// schema returns the schema of values of the type.
+func (g *schemaGenerator) schema(t reflect.Type) schema {
+	switch t {
+	case timeType:
+		return schema{"type": "string", "format": "date-time"}
+	case uuidType:
+		return schema{"type": "string", "format": "uuid"}
+	case rawJSONType:
+		return schema{}
+	case weekdayType:
+		return schema{"type": "integer", "minimum": 0, "maximum": 6, "description": "0 is Sunday"}
+	}
+	if values, ok := enumValues[t]; ok {
+		return schema{"type": "string", "enum": values}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return schema{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schema{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return schema{"type": "string", "contentEncoding": "base64"}
+		}
+		return schema{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return schema{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := g.componentName(t)
+		if _, ok := g.components[name]; !ok {
+			// Registered before generating fields for recursive types
+			g.components[name] = schema{}
+			g.components[name] = g.object(t)
+		}
+		return schema{"$ref": "#/components/schemas/" + name}
+	}
+	return schema{}
+}
+
+// componentName returns the name of the named type in the components of the document. Types of
+// other packages are prefixed with their package when the name is taken.
+func (g *schemaGenerator) componentName(t reflect.Type) string {
+	name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	if other, ok := g.types[name]; ok && other != t {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	g.types[name] = t
+	return name
+}
+
+// object returns the schema of the struct, fields are named after their JSON name.
+func (g *schemaGenerator) object(t reflect.Type) schema {
+	properties := make(map[string]any)
+	required := make([]string, 0)
+	g.fields(t, properties, &required)
+
+	object := schema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		object["required"] = required
+	}
+	return object
+}
+
+func (g *schemaGenerator) fields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		// Fields of embedded structs are promoted
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			g.fields(fieldType, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.schema(field.Type)
+		if applyValidation(property, field.Type, field.Tag.Get("validate")) {
+			*required = append(*required, name)
+		}
+		if field.Type.Kind() == reflect.Pointer {
+			property = nullable(property)
+		}
+		properties[name] = property
+	}
+}
+
+// nullable returns the schema also accepting null.
+func nullable(s schema) schema {
+	if typ, ok := s["type"].(string); ok {
+		s["type"] = []string{typ, "null"}
+		return s
+	}
+	return schema{"anyOf": []schema{s, {"type": "null"}}}
+}
+
+// applyValidation adds the rules of the validate tag to the schema of values of the type, and reports
+// whether the value is required. Rules following dive apply to the items.
+func applyValidation(s schema, t reflect.Type, rules string) bool {
+	required := false
+	for _, rule := range strings.Split(rules, ",") {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		key, value, _ := strings.Cut(rule, "=")
+		switch key {
+		case "required":
+			required = true
+		case "dive":
+			items, ok := s["items"].(schema)
+			if !ok {
+				items, ok = s["additionalProperties"].(schema)
+			}
+			if !ok {
+				return required
+			}
+			s, t = items, t.Elem()
+		case "min", "max", "len", "gt", "gte", "lt", "lte":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			for _, keyword := range validationKeywords(t, key) {
+				s[keyword] = n
+			}
+		case "oneof":
+			values := make([]any, 0)
+			for _, v := range strings.Fields(value) {
+				if n, err := strconv.ParseFloat(v, 64); err == nil && t.Kind() != reflect.String {
+					values = append(values, n)
+				} else {
+					values = append(values, v)
+				}
+			}
+			s["enum"] = values
+		case "email":
+			s["format"] = "email"
+		case "url", "http_url":
+			s["format"] = "uri"
+		case "uuid", "uuid4", "uuid7":
+			s["format"] = "uuid"
+		case "alphanum":
+			s["pattern"] = "^[a-zA-Z0-9]+$"
+		case "numeric":
+			s["pattern"] = "^[0-9]+$"
+		case "e164":
+			s["pattern"] = `^\+[1-9][0-9]{1,14}$`
+		case "iso4217":
+			s["pattern"] = "^[A-Z]{3}$"
+		case "timezone":
+			s["description"] = "IANA time zone, e.g. Europe/Paris"
+		}
+	}
+	return required
+}
+
+// validationKeywords returns the keywords of the validation rule for values of the type.
+func validationKeywords(t reflect.Type, rule string) []string {
+	switch t.Kind() {
+	case reflect.String:
+		switch rule {
+		case "min", "gte":
+			return []string{"minLength"}
+		case "max", "lte":
+			return []string{"maxLength"}
+		case "len":
+			return []string{"minLength", "maxLength"}
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		switch rule {
+		case "min", "gte":
+			return []string{"minItems"}
+		case "max", "lte":
+			return []string{"maxItems"}
+		case "len":
+			return []string{"minItems", "maxItems"}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		switch rule {
+		case "min", "gte":
+			return []string{"minimum"}
+		case "max", "lte":
+			return []string{"maximum"}
+		case "gt":
+			return []string{"exclusiveMinimum"}
+		case "lt":
+			return []string{"exclusiveMaximum"}
+		case "len":
+			return []string{"minimum", "maximum"}
+		}
+	}
+	return nil
+}
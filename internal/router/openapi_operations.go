@@ -0,0 +1,280 @@
+package router
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/journal"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/pickup"
+	"github.com/roushou/pocpoc/internal/promotions"
+	"github.com/roushou/pocpoc/internal/reporting"
+)
+
+// enumValues are the values of the enum types of the models.
+var enumValues = map[reflect.Type][]string{
+	reflect.TypeOf(models.Role("")):                   enum(models.RoleOwner, models.RoleStaff),
+	reflect.TypeOf(models.StaffRole("")):              enum(models.StaffRoleWaiter, models.StaffRoleCashier, models.StaffRoleKitchen, models.StaffRoleManager),
+	reflect.TypeOf(models.OrderType("")):              enum(models.OrderTypeDineIn, models.OrderTypeTakeaway, models.OrderTypeDelivery),
+	reflect.TypeOf(models.OrderSource("")):            enum(models.OrderSourceStaff, models.OrderSourceGuest, models.OrderSourceMarketplace),
+	reflect.TypeOf(models.PaymentMethod("")):          enum(models.PaymentMethodCash, models.PaymentMethodCard, models.PaymentMethodOther),
+	reflect.TypeOf(models.PrinterKind("")):            enum(models.PrinterKindKitchen, models.PrinterKindReceipt),
+	reflect.TypeOf(models.PrintJobKind("")):           enum(models.PrintJobKindKitchenTicket, models.PrintJobKindReceipt),
+	reflect.TypeOf(models.PrintJobStatus("")):         enum(models.PrintJobStatusPending, models.PrintJobStatusPrinting, models.PrintJobStatusPrinted, models.PrintJobStatusFailed),
+	reflect.TypeOf(models.PromotionKind("")):          enum(models.PromotionKindBuyXGetY, models.PromotionKindPercentage, models.PromotionKindFixedAmount),
+	reflect.TypeOf(models.CashMovementKind("")):       enum(models.CashMovementPayIn, models.CashMovementPayOut),
+	reflect.TypeOf(models.LoyaltyTransactionKind("")): enum(models.LoyaltyTransactionEarn, models.LoyaltyTransactionRedeem, models.LoyaltyTransactionRestore),
+	reflect.TypeOf(models.JournalEntryKind("")):       enum(models.JournalEntryInvoice, models.JournalEntryCreditNote),
+	reflect.TypeOf(models.SyncMutationStatus("")):     enum(models.SyncMutationApplied, models.SyncMutationConflict, models.SyncMutationRejected),
+	reflect.TypeOf(models.OrderStatus("")): enum(
+		models.OrderStatusAwaitingApproval,
+		models.OrderStatusPending,
+		models.OrderStatusConfirmed,
+		models.OrderStatusPrepared,
+		models.OrderStatusReadyForPickup,
+		models.OrderStatusOutForDelivery,
+		models.OrderStatusCompleted,
+		models.OrderStatusCancelled,
+	),
+}
+
+func enum[T ~string](values ...T) []string {
+	strings := make([]string, 0, len(values))
+	for _, value := range values {
+		strings = append(strings, string(value))
+	}
+	return strings
+}
+
+// Schemas of responses built from maps in handlers.
+var (
+	messageResponse = schema{
+		"type":       "object",
+		"properties": schema{"message": schema{"type": "string"}},
+		"required":   []string{"message"},
+	}
+	uuidSchema = schema{"type": "string", "format": "uuid"}
+	dateSchema = schema{"type": "string", "format": "date"}
+	// graphQLResponse is the result of GraphQL queries, whose data follows the GraphQL schema.
+	graphQLResponse = schema{
+		"type": "object",
+		"properties": schema{
+			"data":   schema{"type": "object"},
+			"errors": schema{"type": "array", "items": schema{"type": "object"}},
+		},
+	}
+)
+
+// idsResponse returns the schema of responses holding the IDs of created resources.
+func idsResponse(names ...string) schema {
+	properties := schema{}
+	for _, name := range names {
+		properties[name] = uuidSchema
+	}
+	return schema{"type": "object", "properties": properties, "required": names}
+}
+
+// Query parameters shared by operations.
+var (
+	fromParameter = parameter{name: "from", description: "First day of the period, defaults to today.", schema: dateSchema}
+	toParameter   = parameter{name: "to", description: "Last day of the period, included, defaults to today.", schema: dateSchema}
+)
+
+// reportNames returns the names of the reports, sorted.
+func reportNames() []string {
+	names := make([]string, 0, len(reportBuilders))
+	for name := range reportBuilders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// apiOperations documents the routes registered by NewRouter.
+func apiOperations() []operation {
+	session := []string{securitySession}
+
+	return []operation{
+		// Health
+		{method: http.MethodGet, path: "/_health", handler: healthCheck, tag: "health", summary: "Check the API is up", status: http.StatusOK, contentTypes: []string{"text/plain"}},
+		{method: http.MethodGet, path: "/_health/ready", handler: readinessCheck, tag: "health", summary: "Check the API is ready to serve requests, 503 while it drains before shutting down", status: http.StatusOK, contentTypes: []string{"text/plain"}},
+
+		// Docs
+		{method: http.MethodGet, path: "/openapi.json", handler: getOpenAPIDocument, tag: "docs", summary: "OpenAPI document of the API", status: http.StatusOK, response: schema{"type": "object"}},
+		{method: http.MethodGet, path: "/docs", handler: getDocs, tag: "docs", summary: "Browse the OpenAPI document", status: http.StatusOK, contentTypes: []string{"text/html"}},
+
+		// Auth
+		{method: http.MethodPost, path: "/auth/owners/sign-up", handler: signUpOwner, tag: "auth", summary: "Sign up as restaurant owner", request: signUpOwnerPayload{}, status: http.StatusCreated, response: messageResponse},
+		{method: http.MethodPost, path: "/auth/owners/sign-in", handler: signInOwner, tag: "auth", summary: "Sign in as owner, sets the session cookie", request: signInOwnerPayload{}, status: http.StatusOK, response: messageResponse},
+		{method: http.MethodPost, path: "/auth/staff/sign-in", handler: signInStaff, tag: "auth", summary: "Sign in as staff, sets the session cookie", request: signInStaffPayload{}, status: http.StatusOK, response: messageResponse},
+		{method: http.MethodPost, path: "/auth/sign-out", handler: signOut, tag: "auth", summary: "Sign out, clears the session cookie", status: http.StatusOK, response: messageResponse},
+
+		// Terminals
+		{method: http.MethodGet, path: "/terminal/staff", handler: getTerminalStaff, tag: "terminals", summary: "List the staff who can sign in on the terminal", security: []string{securityTerminal}, list: terminalStaffList, status: http.StatusOK, response: []TerminalStaffResponse{}},
+		{method: http.MethodPost, path: "/terminal/pin-sign-in", handler: signInStaffWithPin, tag: "terminals", summary: "Sign in on the terminal with a PIN", security: []string{securityTerminal}, request: signInStaffWithPinPayload{}, status: http.StatusOK, response: messageResponse},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/terminals", handler: getTerminals, tag: "terminals", summary: "List the terminals of a restaurant", security: session, list: terminalsList, status: http.StatusOK, response: []TerminalResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/terminals", handler: registerTerminal, tag: "terminals", summary: "Register a terminal, its device token is only returned once", security: session, request: registerTerminalPayload{}, status: http.StatusCreated, response: schema{
+			"type":       "object",
+			"properties": schema{"terminal_id": uuidSchema, "device_token": schema{"type": "string"}},
+			"required":   []string{"terminal_id", "device_token"},
+		}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/terminals/:terminal_id/revoke", handler: revokeTerminal, tag: "terminals", summary: "Revoke a terminal", security: session, status: http.StatusOK, response: TerminalResponse{}},
+
+		// Public
+		{method: http.MethodGet, path: "/public/tables/:table_token/menu", handler: getTableMenu, tag: "public", summary: "Menu of the restaurant of the table", status: http.StatusOK, response: TableMenuResponse{}},
+		{method: http.MethodPost, path: "/public/tables/:table_token/orders", handler: createGuestOrder, tag: "public", summary: "Order from the table, awaiting approval by staff", request: createGuestOrderPayload{}, status: http.StatusCreated, response: GuestOrderResponse{}},
+		{method: http.MethodGet, path: "/public/tables/:table_token/orders/:order_id", handler: getGuestOrder, tag: "public", summary: "Follow an order placed from the table", status: http.StatusOK, response: GuestOrderResponse{}},
+
+		// Webhooks
+		{method: http.MethodPost, path: "/webhooks/integrations/:integration_id", handler: receiveIntegrationWebhook, tag: "integrations", summary: "Receive an order from a delivery platform, 201 when created and 200 when already received", security: []string{securityWebhook}, request: schema{"type": "object"}, status: http.StatusCreated, response: idsResponse("order_id")},
+
+		// Restaurants
+		{method: http.MethodGet, path: "/restaurants", handler: getRestaurants, tag: "restaurants", summary: "List the restaurants of the owner", security: session, list: restaurantsList, status: http.StatusOK, response: []RestaurantResponse{}},
+		{method: http.MethodPost, path: "/restaurants", handler: registerRestaurant, tag: "restaurants", summary: "Register a restaurant", security: session, request: registerRestaurantPayload{}, status: http.StatusCreated, response: idsResponse("restaurant_id")},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id", handler: getRestaurantById, tag: "restaurants", summary: "Get a restaurant", security: session, status: http.StatusOK, response: RestaurantResponse{}},
+		{method: http.MethodPatch, path: "/restaurants/:restaurant_id", handler: updateRestaurant, tag: "restaurants", summary: "Update a restaurant", security: session, request: updateRestaurantPayload{}, status: http.StatusOK, response: RestaurantResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/archive", handler: archiveRestaurant, tag: "restaurants", summary: "Archive a restaurant", security: session, status: http.StatusOK, response: RestaurantResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/unarchive", handler: unarchiveRestaurant, tag: "restaurants", summary: "Restore an archived restaurant", security: session, status: http.StatusOK, response: RestaurantResponse{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/settings", handler: getRestaurantSettings, tag: "restaurants", summary: "Get the settings of a restaurant", security: session, status: http.StatusOK, response: RestaurantSettingsResponse{}},
+		{method: http.MethodPut, path: "/restaurants/:restaurant_id/settings", handler: updateRestaurantSettings, tag: "restaurants", summary: "Update the settings of a restaurant", security: session, request: updateRestaurantSettingsPayload{}, status: http.StatusOK, response: RestaurantSettingsResponse{}},
+
+		// Staff
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/staff", handler: getStaffMembers, tag: "staff", summary: "List the staff of a restaurant", security: session, list: staffList, status: http.StatusOK, response: []StaffResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/staff", handler: registerStaff, tag: "staff", summary: "Register a staff member", security: session, request: registerStaffPayload{}, status: http.StatusCreated, response: idsResponse("restaurant_id", "staff_id")},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/staff/:staff_id", handler: getStaffMember, tag: "staff", summary: "Get a staff member", security: session, status: http.StatusOK, response: StaffResponse{}},
+		{method: http.MethodPatch, path: "/restaurants/:restaurant_id/staff/:staff_id", handler: updateStaffMember, tag: "staff", summary: "Update a staff member", security: session, request: updateStaffMemberPayload{}, status: http.StatusOK, response: StaffResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/staff/:staff_id/deactivate", handler: deactivateStaffMember, tag: "staff", summary: "Deactivate a staff member and revoke their sessions", security: session, status: http.StatusOK, response: StaffResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/staff/:staff_id/reactivate", handler: reactivateStaffMember, tag: "staff", summary: "Reactivate a staff member", security: session, status: http.StatusOK, response: StaffResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/staff/:staff_id/reset-password", handler: resetStaffPassword, tag: "staff", summary: "Reset the password of a staff member and revoke their sessions", security: session, request: resetStaffPasswordPayload{}, status: http.StatusNoContent},
+		{method: http.MethodPut, path: "/restaurants/:restaurant_id/staff/:staff_id/pin", handler: setStaffPin, tag: "staff", summary: "Set the terminal PIN of a staff member", security: session, request: setStaffPinPayload{}, status: http.StatusNoContent},
+
+		// Shifts
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/shifts", handler: getShifts, tag: "shifts", summary: "List the shifts over a period", security: session, list: shiftsList, status: http.StatusOK, response: []ShiftResponse{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/shifts/current", handler: getCurrentShift, tag: "shifts", summary: "Get the open shift of the staff member", security: session, status: http.StatusOK, response: ShiftResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/shifts/clock-in", handler: clockIn, tag: "shifts", summary: "Clock in", security: session, status: http.StatusCreated, response: ShiftResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/shifts/clock-out", handler: clockOut, tag: "shifts", summary: "Clock out", security: session, status: http.StatusOK, response: ShiftResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/shifts/breaks/start", handler: startBreak, tag: "shifts", summary: "Start a break", security: session, status: http.StatusOK, response: ShiftResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/shifts/breaks/end", handler: endBreak, tag: "shifts", summary: "End the break", security: session, status: http.StatusOK, response: ShiftResponse{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/timesheets", handler: getTimesheets, tag: "shifts", summary: "Time worked by each staff member over a pay period", security: session, query: []parameter{
+			fromParameter,
+			toParameter,
+			{name: "format", description: "Export as CSV.", schema: schema{"type": "string", "enum": []string{"json", "csv"}}},
+		}, status: http.StatusOK, response: TimesheetResponse{}, contentTypes: []string{"text/csv"}},
+
+		// Products
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/products/search", handler: searchProducts, tag: "products", summary: "Search the products of a restaurant by title and description, best match first", security: session, query: searchParameters, status: http.StatusOK, response: []ProductResponse{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/products", handler: getProducts, tag: "products", summary: "List the products of a restaurant", security: session, list: productsList, status: http.StatusOK, response: []ProductResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/products", handler: registerProduct, tag: "products", summary: "Register a product", security: session, request: registerProductPayload{}, status: http.StatusCreated, response: idsResponse("product_id")},
+		{method: http.MethodPut, path: "/restaurants/:restaurant_id/products/:product_id/availability", handler: updateProductAvailability, tag: "products", summary: "Mark a product as available or sold out", security: session, request: updateProductAvailabilityPayload{}, status: http.StatusOK, response: ProductResponse{}},
+
+		// Tables
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/tables", handler: getTables, tag: "tables", summary: "List the tables of a restaurant", security: session, list: tablesList, status: http.StatusOK, response: []TableResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/tables", handler: registerTable, tag: "tables", summary: "Register a table", security: session, request: registerTablePayload{}, status: http.StatusCreated, response: idsResponse("table_id")},
+		{method: http.MethodDelete, path: "/restaurants/:restaurant_id/tables/:table_id", handler: deleteTable, tag: "tables", summary: "Delete a table", security: session, status: http.StatusNoContent},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/tables/:table_id/token", handler: getTableToken, tag: "tables", summary: "Get the token guests order with", security: session, status: http.StatusOK, response: TableTokenResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/tables/:table_id/token", handler: rotateTableToken, tag: "tables", summary: "Rotate the token of a table, previous QR codes stop working", security: session, status: http.StatusOK, response: TableTokenResponse{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/tables/:table_id/qr", handler: getTableQRCode, tag: "tables", summary: "QR code guests scan to order", security: session, query: []parameter{
+			{name: "format", description: "Image format, defaults to png.", schema: schema{"type": "string", "enum": []string{"png", "svg"}}},
+			{name: "size", description: "Size of the image in pixels.", schema: schema{"type": "integer", "minimum": 64, "maximum": maxQRCodeSize}},
+		}, status: http.StatusOK, contentTypes: []string{"image/png", "image/svg+xml"}},
+
+		// Orders
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/orders/search", handler: searchOrders, tag: "orders", summary: "Search the orders of a restaurant by table, contact, invoice number and items, best match first", security: session, query: searchParameters, status: http.StatusOK, response: []OrderResponse{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/orders", handler: getOrders, tag: "orders", summary: "List the orders of a restaurant", security: session, list: ordersList, status: http.StatusOK, response: []OrderResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/orders", handler: createOrder, tag: "orders", summary: "Take an order, priced with the promotions of the restaurant", security: session, request: createOrderPayload{}, status: http.StatusCreated, response: struct {
+			OrderID    uuid.UUID            `json:"order_id"`
+			Promotions []promotions.Outcome `json:"promotions"`
+		}{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/pickup-slots", handler: getPickupSlots, tag: "orders", summary: "Pickup slots of a day and how many orders they can still take", security: session, query: []parameter{
+			{name: "date", description: "Day of the slots, defaults to today.", schema: dateSchema},
+		}, status: http.StatusOK, response: []pickup.Slot{}},
+		{method: http.MethodPut, path: "/orders/:order_id/status", handler: updateOrderStatus, tag: "orders", summary: "Change the status of an order", security: session, request: updateOrderStatusPayload{}, status: http.StatusOK, response: OrderResponse{}},
+		{method: http.MethodGet, path: "/orders/:order_id/receipt", handler: getOrderReceipt, tag: "orders", summary: "Render the receipt of an order", security: session, query: []parameter{
+			{name: "format", description: "Format of the receipt, defaults to text.", schema: schema{"type": "string", "enum": []string{"text", "html", "escpos"}}},
+		}, status: http.StatusOK, contentTypes: []string{"text/plain", "text/html", "application/octet-stream"}},
+
+		// Promotions
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/promotions", handler: getPromotions, tag: "promotions", summary: "List the promotions of a restaurant", security: session, list: promotionsList, status: http.StatusOK, response: []PromotionResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/promotions", handler: createPromotion, tag: "promotions", summary: "Create an automatic deal, or a coupon when a code is set", security: session, request: createPromotionPayload{}, status: http.StatusCreated, response: PromotionResponse{}},
+		{method: http.MethodDelete, path: "/restaurants/:restaurant_id/promotions/:promotion_id", handler: deletePromotion, tag: "promotions", summary: "End a promotion", security: session, status: http.StatusNoContent},
+		{method: http.MethodGet, path: "/orders/:order_id/promotions", handler: evaluateOrderPromotions, tag: "promotions", summary: "Explain which promotions apply to an order", security: session, status: http.StatusOK, response: OrderPromotionsResponse{}},
+		{method: http.MethodPut, path: "/orders/:order_id/coupon", handler: setOrderCoupon, tag: "promotions", summary: "Apply or remove the coupon of an order", security: session, request: setOrderCouponPayload{}, status: http.StatusOK, response: OrderPromotionsResponse{}},
+
+		// Customers
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/customers", handler: getCustomers, tag: "customers", summary: "List or search the customers", security: session, list: customersList, query: []parameter{
+			{name: "q", description: "Search by name, email or phone.", schema: schema{"type": "string"}},
+		}, status: http.StatusOK, response: []CustomerResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/customers", handler: createCustomer, tag: "customers", summary: "Register a customer", security: session, request: customerInput{}, status: http.StatusCreated, response: CustomerResponse{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/customers/:customer_id", handler: getCustomer, tag: "customers", summary: "Get a customer", security: session, status: http.StatusOK, response: CustomerResponse{}},
+		{method: http.MethodPut, path: "/restaurants/:restaurant_id/customers/:customer_id", handler: updateCustomer, tag: "customers", summary: "Update a customer", security: session, request: customerInput{}, status: http.StatusOK, response: CustomerResponse{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/customers/:customer_id/orders", handler: getCustomerOrders, tag: "customers", summary: "Order history of a customer", security: session, list: customerOrdersList, status: http.StatusOK, response: []OrderResponse{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/customers/:customer_id/loyalty", handler: getCustomerLoyaltyTransactions, tag: "customers", summary: "Loyalty points earned and redeemed by a customer", security: session, list: loyaltyTransactionsList, status: http.StatusOK, response: []LoyaltyTransactionResponse{}},
+		{method: http.MethodPut, path: "/orders/:order_id/customer", handler: setOrderCustomer, tag: "customers", summary: "Set or remove the customer of an order", security: session, request: setOrderCustomerPayload{}, status: http.StatusOK, response: OrderResponse{}},
+		{method: http.MethodPost, path: "/orders/:order_id/loyalty/redeem", handler: redeemLoyaltyPoints, tag: "customers", summary: "Turn loyalty points of the customer into a discount", security: session, request: redeemLoyaltyPointsPayload{}, status: http.StatusOK, response: OrderResponse{}},
+
+		// Payments
+		{method: http.MethodGet, path: "/orders/:order_id/payments", handler: getOrderPayments, tag: "payments", summary: "List the payments of an order", security: session, list: paymentsList, status: http.StatusOK, response: []PaymentResponse{}},
+		{method: http.MethodPost, path: "/orders/:order_id/payments", handler: createPayment, tag: "payments", summary: "Take a payment", security: session, request: createPaymentPayload{}, status: http.StatusCreated, response: PaymentResponse{}},
+
+		// Cash sessions
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/cash-sessions", handler: getCashSessions, tag: "cash", summary: "List the cash drawer sessions over a period", security: session, list: cashSessionsList, status: http.StatusOK, response: []CashSessionResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/cash-sessions", handler: openCashSession, tag: "cash", summary: "Open a cash drawer session", security: session, request: openCashSessionPayload{}, status: http.StatusCreated, response: CashSessionResponse{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/cash-sessions/:session_id", handler: getCashSession, tag: "cash", summary: "Get a cash drawer session", security: session, status: http.StatusOK, response: CashSessionResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/cash-sessions/:session_id/movements", handler: createCashMovement, tag: "cash", summary: "Record cash put in or taken out of the drawer", security: session, request: createCashMovementPayload{}, status: http.StatusOK, response: CashSessionResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/cash-sessions/:session_id/close", handler: closeCashSession, tag: "cash", summary: "Count the drawer and close the session", security: session, request: closeCashSessionPayload{}, status: http.StatusOK, response: CashSessionResponse{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/z-reports", handler: getZReports, tag: "cash", summary: "List the end of day reports", security: session, list: zReportsList, status: http.StatusOK, response: []ZReportResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/z-reports", handler: closeBusinessDay, tag: "cash", summary: "Close the business day", security: session, request: closeBusinessDayPayload{}, status: http.StatusCreated, response: ZReportResponse{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/z-reports/:business_date", handler: getZReport, tag: "cash", summary: "Get the report of a business day", security: session, status: http.StatusOK, response: ZReportResponse{}},
+
+		// Journal
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/journal", handler: getJournalEntries, tag: "journal", summary: "List the entries of the sales journal", security: session, list: journalEntriesList, status: http.StatusOK, response: []JournalEntryResponse{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/journal/verify", handler: verifyJournal, tag: "journal", summary: "Verify the hash chain of the sales journal", security: session, status: http.StatusOK, response: journal.Verification{}},
+		{method: http.MethodPost, path: "/orders/:order_id/credit-notes", handler: createCreditNote, tag: "journal", summary: "Issue a credit note for an invoiced order", security: session, request: createCreditNotePayload{}, status: http.StatusCreated, response: JournalEntryResponse{}},
+
+		// Reports
+		{method: http.MethodGet, path: "/reports/:report", handler: getReport, tag: "reports", summary: "Build a sales report over the restaurants of the owner", security: session, query: []parameter{
+			{name: "restaurant_id", description: "Restaurants to report on, every restaurant of the owner by default.", schema: schema{"type": "array", "items": uuidSchema}},
+			fromParameter,
+			toParameter,
+			{name: "time_zone", description: "Time zone of the dates.", schema: schema{"type": "string"}},
+			{name: "limit", description: "Number of products of the top-products report.", schema: schema{"type": "integer", "minimum": 1}},
+			{name: "format", description: "Export as CSV.", schema: schema{"type": "string", "enum": []string{"json", "csv"}}},
+		}, status: http.StatusOK, response: oneOf{
+			reporting.Summary{},
+			reporting.RevenueReport{},
+			reporting.ProductsReport{},
+			reporting.TablesReport{},
+			reporting.StaffReport{},
+		}, contentTypes: []string{"text/csv"}},
+
+		// Printing
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/printers", handler: getPrinters, tag: "printing", summary: "List the printers of a restaurant", security: session, list: printersList, status: http.StatusOK, response: []PrinterResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/printers", handler: registerPrinter, tag: "printing", summary: "Register a printer", security: session, request: registerPrinterPayload{}, status: http.StatusCreated, response: PrinterResponse{}},
+		{method: http.MethodDelete, path: "/restaurants/:restaurant_id/printers/:printer_id", handler: deletePrinter, tag: "printing", summary: "Delete a printer", security: session, status: http.StatusNoContent},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/print-jobs", handler: getPrintJobs, tag: "printing", summary: "List the latest print jobs", security: session, list: printJobsList, status: http.StatusOK, response: []PrintJobResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/print-jobs/:job_id/reprint", handler: reprintJob, tag: "printing", summary: "Print a job again", security: session, status: http.StatusCreated, response: PrintJobResponse{}},
+		{method: http.MethodPost, path: "/orders/:order_id/receipt/print", handler: printOrderReceipt, tag: "printing", summary: "Print the receipt of an order", security: session, request: printOrderReceiptPayload{}, status: http.StatusCreated, response: PrintJobResponse{}},
+
+		// Sync
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/sync/push", handler: pushSyncMutations, tag: "sync", summary: "Apply the changes made offline", security: session, request: pushSyncMutationsPayload{}, status: http.StatusOK, response: struct {
+			Results []SyncMutationResult `json:"results"`
+		}{}},
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/sync/pull", handler: pullSyncChanges, tag: "sync", summary: "Changes since the cursor of the client", security: session, query: []parameter{
+			{name: "cursor", description: "Cursor returned by the previous pull, everything is returned without. Changes shortly before the cursor are returned again, clients apply changes by ID.", schema: schema{"type": "string"}},
+		}, status: http.StatusOK, response: SyncPullResponse{}},
+
+		// Integrations
+		{method: http.MethodGet, path: "/restaurants/:restaurant_id/integrations", handler: getIntegrations, tag: "integrations", summary: "List the delivery platforms the restaurant is connected to", security: session, list: integrationsList, status: http.StatusOK, response: []IntegrationResponse{}},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/integrations", handler: registerIntegration, tag: "integrations", summary: "Connect the restaurant to a delivery platform, the webhook secret is only returned once", security: session, request: registerIntegrationPayload{}, status: http.StatusCreated, response: struct {
+			IntegrationResponse
+			WebhookSecret string `json:"webhook_secret"`
+		}{}},
+		{method: http.MethodDelete, path: "/restaurants/:restaurant_id/integrations/:integration_id", handler: deleteIntegration, tag: "integrations", summary: "Disconnect a delivery platform", security: session, status: http.StatusNoContent},
+		{method: http.MethodPost, path: "/restaurants/:restaurant_id/integrations/:integration_id/menu/push", handler: pushIntegrationMenu, tag: "integrations", summary: "Push the menu to the delivery platform", security: session, status: http.StatusAccepted},
+
+		// GraphQL
+		{method: http.MethodPost, path: "/graphql", handler: postGraphQL, tag: "graphql", summary: "Query restaurants with their staff, products and orders in one request", security: session, request: graphQLPayload{}, status: http.StatusOK, response: graphQLResponse},
+	}
+}
@@ -0,0 +1,83 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/roushou/pocpoc/internal/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPIDocumentsRoutes(t *testing.T) {
+	db, err := database.NewDatabase("file:" + t.Name() + "?mode=memory")
+	require.NoError(t, err)
+	router, err := NewRouter(db)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	document := struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &document))
+	assert.Equal(t, openAPIVersion, document.OpenAPI)
+
+	documented := 0
+	for _, route := range router.Routes() {
+		path, found := strings.CutPrefix(route.Path, "/api")
+		// Echo registers not found routes for groups with middlewares
+		if !found || strings.HasPrefix(route.Method, "echo_") {
+			continue
+		}
+		path, _ = openAPIPath(path)
+		operation, ok := document.Paths[path][strings.ToLower(route.Method)]
+		if !assert.True(t, ok, "%s %s is not documented", route.Method, route.Path) {
+			continue
+		}
+		assert.True(t, strings.HasSuffix(route.Name, "."+operation.OperationID), "%s %s is handled by %s", route.Method, route.Path, route.Name)
+		documented++
+	}
+
+	operations := 0
+	for _, methods := range document.Paths {
+		operations += len(methods)
+	}
+	assert.Equal(t, documented, operations, "documented operations without route")
+}
+
+func TestDocsPage(t *testing.T) {
+	server := newTestServer(t)
+	request := func(t *testing.T, opts ...Option) string {
+		router, err := NewRouter(server.db, opts...)
+		require.NoError(t, err)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/docs", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec.Body.String()
+	}
+
+	page := request(t)
+	assert.Contains(t, page, `<script src="`+redocScript+`"></script>`)
+
+	// The bundle is inlined, without closing the script early
+	bundle := filepath.Join(t.TempDir(), "redoc.standalone.js")
+	require.NoError(t, os.WriteFile(bundle, []byte(`document.write("</SCRIPT>")`), 0o600))
+	page = request(t, WithDocsBundle(bundle))
+	assert.NotContains(t, page, redocScript)
+	assert.Contains(t, page, `<script>document.write("<\/SCRIPT>")</script>`)
+
+	_, err := NewRouter(server.db, WithDocsBundle(filepath.Join(t.TempDir(), "missing.js")))
+	assert.Error(t, err)
+}
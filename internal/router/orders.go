@@ -1,44 +1,203 @@
 package router
 
 import (
-	"errors"
 	"net/http"
+	"reflect"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/roushou/pocpoc/internal/models"
-	"gorm.io/gorm"
+	"github.com/roushou/pocpoc/internal/pickup"
+	"github.com/roushou/pocpoc/internal/services"
 )
 
 func bindOrdersRouter(router *echo.Group) {
-	group := router.Group("/restaurants/:restaurant_id/products")
+	group := router.Group("/restaurants/:restaurant_id/orders")
+	group.GET("", getOrders)
 	group.POST("", createOrder)
+	router.GET("/restaurants/:restaurant_id/pickup-slots", getPickupSlots)
+
+	orders := router.Group("/orders")
+	orders.PUT("/:order_id/status", updateOrderStatus)
+}
+
+type OrderItemResponse struct {
+	ItemID    uuid.UUID `json:"item_id"`
+	ProductID uuid.UUID `json:"product_id"`
+	Quantity  uint32    `json:"quantity"`
+	UnitPrice float64   `json:"unit_price"`
+	Modifiers []string  `json:"modifiers"`
 }
 
 type OrderResponse struct {
-	OrderID      uuid.UUID          `json:"id"`
-	RestaurantID uuid.UUID          `json:"restaurant_id"`
-	StaffID      uuid.UUID          `json:"staff_id"`
-	TableNumber  string             `json:"table_number"`
-	Status       models.OrderStatus `json:"status"`
-	TotalAmount  float64            `json:"total_amount"`
-	CreatedAt    time.Time          `json:"created_at"`
-	UpdatedAt    time.Time          `json:"updated_at"`
-	Items        struct {
-		ItemID    uuid.UUID `json:"item_id"`
-		ProductID uuid.UUID `json:"product_id"`
-		Quantity  uint32    `json:"quantity"`
-	} `json:"items"`
+	OrderID           uuid.UUID           `json:"id"`
+	RestaurantID      uuid.UUID           `json:"restaurant_id"`
+	StaffID           uuid.UUID           `json:"staff_id"`
+	Type              models.OrderType    `json:"type"`
+	TableNumber       string              `json:"table_number"`
+	Status            models.OrderStatus  `json:"status"`
+	Source            models.OrderSource  `json:"source"`
+	ExternalID        string              `json:"external_id,omitempty"`
+	ContactName       string              `json:"contact_name,omitempty"`
+	ContactPhone      string              `json:"contact_phone,omitempty"`
+	PickupAt          *time.Time          `json:"pickup_at,omitempty"`
+	DeliveryAddress   string              `json:"delivery_address,omitempty"`
+	DeliveryFee       float64             `json:"delivery_fee"`
+	TotalAmount       float64             `json:"total_amount"`
+	DiscountAmount    float64             `json:"discount_amount"`
+	PromotionDiscount float64             `json:"promotion_discount"`
+	CouponCode        string              `json:"coupon_code,omitempty"`
+	TaxAmount         float64             `json:"tax_amount"`
+	PaidAt            *time.Time          `json:"paid_at,omitempty"`
+	InvoiceNumber     string              `json:"invoice_number,omitempty"`
+	CustomerID        *uuid.UUID          `json:"customer_id,omitempty"`
+	RedeemedPoints    int64               `json:"redeemed_points"`
+	CreatedAt         time.Time           `json:"created_at"`
+	UpdatedAt         time.Time           `json:"updated_at"`
+	Items             []OrderItemResponse `json:"items"`
 }
 
-func createOrder(ctx echo.Context) error {
+func newOrderResponse(order *models.Order) OrderResponse {
+	items := make([]OrderItemResponse, 0, len(order.OrderItems))
+	for _, item := range order.OrderItems {
+		modifiers := item.Modifiers
+		if modifiers == nil {
+			modifiers = make([]string, 0)
+		}
+		items = append(items, OrderItemResponse{
+			ItemID:    item.ID,
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			Modifiers: modifiers,
+		})
+	}
+	return OrderResponse{
+		OrderID:           order.ID,
+		RestaurantID:      order.RestaurantID,
+		StaffID:           order.StaffID,
+		Type:              order.Type,
+		TableNumber:       order.TableNumber,
+		Status:            order.Status,
+		Source:            order.Source,
+		ExternalID:        order.ExternalID,
+		ContactName:       order.ContactName,
+		ContactPhone:      order.ContactPhone,
+		PickupAt:          order.PickupAt,
+		DeliveryAddress:   order.DeliveryAddress,
+		DeliveryFee:       order.DeliveryFee,
+		TotalAmount:       order.TotalAmount,
+		DiscountAmount:    order.DiscountAmount,
+		PromotionDiscount: order.PromotionDiscount,
+		CouponCode:        order.CouponCode,
+		TaxAmount:         order.TaxAmount,
+		PaidAt:            order.PaidAt,
+		InvoiceNumber:     order.InvoiceNumber,
+		CustomerID:        order.CustomerID,
+		RedeemedPoints:    order.RedeemedPoints,
+		CreatedAt:         order.CreatedAt,
+		UpdatedAt:         order.UpdatedAt,
+		Items:             items,
+	}
+}
+
+type orderItemInput struct {
+	ProductID uuid.UUID `json:"product_id" validate:"required"`
+	Quantity  uint32    `json:"quantity" validate:"required"`
+	Modifiers []string  `json:"modifiers" validate:"max=10,dive,required,max=100"`
+}
+
+func newOrderItems(inputs []orderItemInput) []services.OrderItem {
+	items := make([]services.OrderItem, 0, len(inputs))
+	for _, input := range inputs {
+		items = append(items, services.OrderItem{
+			ProductID: input.ProductID,
+			Quantity:  input.Quantity,
+			Modifiers: input.Modifiers,
+		})
+	}
+	return items
+}
+
+// orderTypeInput are the fields of orders that depend on their type. Dine-in orders are served at a
+// table, takeaway and delivery orders have a contact and are scheduled in a pickup slot.
+type orderTypeInput struct {
+	Type            models.OrderType `json:"type"`
+	TableNumber     string           `json:"table_number"`
+	ContactName     string           `json:"contact_name" validate:"max=100"`
+	ContactPhone    string           `json:"contact_phone" validate:"max=30"`
+	PickupAt        *time.Time       `json:"pickup_at"`
+	DeliveryAddress string           `json:"delivery_address" validate:"max=500"`
+	// DeliveryFee overrides the delivery fee of the restaurant.
+	DeliveryFee *float64 `json:"delivery_fee" validate:"omitempty,gte=0"`
+}
+
+// orderStatusFilter lists the orders with the status in the status parameter.
+var orderStatusFilter = equalFilter(parameter{name: "status", description: "Only list orders with the status.", schema: schema{"type": "string", "enum": enumValues[reflect.TypeOf(models.OrderStatus(""))]}}, "status", func(value string) (any, error) {
+	if status := models.OrderStatus(value); !status.IsValid() {
+		return nil, services.ErrInvalidOrderStatus
+	}
+	return value, nil
+})
+
+// ordersList are the pages of orders of a restaurant, the latest first.
+var ordersList = &listSpec{
+	sorts:       []string{"total_amount"},
+	defaultSort: "-id",
+	filters: []listFilter{
+		orderStatusFilter,
+		enumFilter("type", "type", "Only list orders of the type.", enumValues[reflect.TypeOf(models.OrderType(""))]),
+		enumFilter("source", "source", "Only list orders from the source.", enumValues[reflect.TypeOf(models.OrderSource(""))]),
+		stringFilter("table", "table_number", "Only list orders of the table number."),
+		uuidFilter("staff_id", "staff_id", "Only list orders taken by the staff member."),
+		dateRangeFilter("created_at", false),
+	},
+}
+
+// getOrders lists the most recent orders of the restaurant, optionally filtered by status, e.g. guest
+// orders awaiting approval.
+func getOrders(ctx echo.Context) error {
 	authUser, err := getAuthUser(ctx)
 	if err != nil {
 		return echo.ErrUnauthorized
 	}
-	// Only staff can create orders
-	if authUser.Role != models.RoleStaff {
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	// Staff can only list the orders of their own restaurant
+	restaurant, err := findAccessibleRestaurant(ctx, authUser, restaurantID)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+	rows, err := findPage[models.Order](ctx, ordersList, db.Connection.Preload("OrderItems").Where("restaurant_id = ?", restaurantID), restaurant.Location())
+	if err != nil {
+		return err
+	}
+
+	orders := make([]OrderResponse, 0, len(rows))
+	for _, order := range rows {
+		orders = append(orders, newOrderResponse(&order))
+	}
+
+	return ctx.JSON(http.StatusOK, orders)
+}
+
+type createOrderPayload struct {
+	orderTypeInput
+	Products   []orderItemInput `json:"products" validate:"required,dive"`
+	CustomerID *uuid.UUID       `json:"customer_id"`
+	CouponCode string           `json:"coupon_code" validate:"max=32"`
+}
+
+func createOrder(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
 		return echo.ErrUnauthorized
 	}
 
@@ -47,58 +206,94 @@ func createOrder(ctx echo.Context) error {
 		return echo.ErrBadRequest
 	}
 
-	payload := struct {
-		Products []struct {
-			ProductID uuid.UUID `json:"product_id" validate:"required"`
-			Quantity  uint32    `json:"quantity" validate:"required"`
-		} `json:"products" validate:"required"`
-		TableNumber string `json:"table_number" validate:"required"`
-	}{}
+	payload := createOrderPayload{}
 	if err := ctx.Bind(&payload); err != nil {
 		return echo.ErrBadRequest
 	}
 	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	order, result, err := ctx.(*routerContext).GetServices().Orders.Create(ctx.Request().Context(), authUser.actor(), restaurantID, services.NewOrder{
+		OrderDetails: services.OrderDetails(payload.orderTypeInput),
+		Items:        newOrderItems(payload.Products),
+		CustomerID:   payload.CustomerID,
+		CouponCode:   payload.CouponCode,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, map[string]any{
+		"order_id":   order.ID.String(),
+		"promotions": result.Promotions,
+	})
+}
+
+type updateOrderStatusPayload struct {
+	Status models.OrderStatus `json:"status" validate:"required"`
+}
+
+func updateOrderStatus(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	orderID, err := uuid.Parse(ctx.Param("order_id"))
+	if err != nil {
 		return echo.ErrBadRequest
 	}
-	if len(payload.Products) == 0 {
+
+	payload := updateOrderStatusPayload{}
+	if err := ctx.Bind(&payload); err != nil {
 		return echo.ErrBadRequest
 	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
 
-	db := ctx.(*routerContext).GetDatabase()
+	order, err := ctx.(*routerContext).GetServices().Orders.ChangeStatus(ctx.Request().Context(), authUser.actor(), orderID, payload.Status)
+	if err != nil {
+		return err
+	}
 
-	// check if staff is creating the order for their own restaurant
-	if err := db.Connection.
-		First(&models.Staff{
-			ID:           authUser.UserID,
-			RestaurantID: restaurantID,
-		}).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return echo.ErrUnauthorized
-		}
-		return echo.ErrInternalServerError
+	return ctx.JSON(http.StatusOK, newOrderResponse(order))
+}
+
+// getPickupSlots lists the pickup slots of the restaurant on the `date` query param, today by default,
+// with the number of orders that can still be scheduled in them.
+func getPickupSlots(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
 	}
 
-	orderItems := make([]models.OrderItem, 0, len(payload.Products))
-	for _, product := range payload.Products {
-		orderItems = append(orderItems, models.OrderItem{
-			ProductID: product.ProductID,
-			Quantity:  product.Quantity,
-		})
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	restaurant, err := findAccessibleRestaurant(ctx, authUser, restaurantID)
+	if err != nil {
+		return err
 	}
 
-	order := &models.Order{
-		RestaurantID: restaurantID,
-		StaffID:      authUser.UserID,
-		TableNumber:  payload.TableNumber,
-		TotalAmount:  models.CalculateTotalAmount(orderItems),
-		OrderItems:   orderItems,
+	now := time.Now()
+	date := now.In(restaurant.Location())
+	if param := ctx.QueryParam("date"); param != "" {
+		date, err = time.ParseInLocation(time.DateOnly, param, restaurant.Location())
+		if err != nil {
+			return echo.ErrBadRequest
+		}
 	}
 
-	if err := db.Connection.Create(order).Error; err != nil {
+	slots, err := pickup.Availability(db.Connection, restaurant, date, now)
+	if err != nil {
 		return echo.ErrInternalServerError
 	}
 
-	return ctx.JSON(http.StatusCreated, map[string]string{
-		"order_id": order.ID.String(),
-	})
+	return ctx.JSON(http.StatusOK, slots)
 }
@@ -0,0 +1,142 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/services"
+	"gorm.io/gorm"
+)
+
+func bindPaymentsRouter(router *echo.Group) {
+	group := router.Group("/orders/:order_id/payments")
+	group.GET("", getOrderPayments)
+	group.POST("", createPayment)
+}
+
+// errOrderHasPayments is returned when changing the amount due of an order which is partly paid.
+var errOrderHasPayments = errors.New("order already has payments")
+
+// PaymentResponse maps fields of Payment model we are willing to expose.
+type PaymentResponse struct {
+	PaymentID     uuid.UUID            `json:"payment_id"`
+	OrderID       uuid.UUID            `json:"order_id"`
+	StaffID       uuid.UUID            `json:"staff_id"`
+	Method        models.PaymentMethod `json:"method"`
+	Amount        float64              `json:"amount"`
+	TipAmount     float64              `json:"tip_amount"`
+	CashSessionID *uuid.UUID           `json:"cash_session_id,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+}
+
+func newPaymentResponse(payment *models.Payment) PaymentResponse {
+	return PaymentResponse{
+		PaymentID:     payment.ID,
+		OrderID:       payment.OrderID,
+		StaffID:       payment.StaffID,
+		Method:        payment.Method,
+		Amount:        payment.Amount,
+		TipAmount:     payment.TipAmount,
+		CashSessionID: payment.CashSessionID,
+		CreatedAt:     payment.CreatedAt,
+	}
+}
+
+// findAccessibleOrder returns the order, with its items, their product, and its payments, if the auth
+// user can access its restaurant.
+func findAccessibleOrder(ctx echo.Context, user *authUser) (*models.Order, error) {
+	orderID, err := uuid.Parse(ctx.Param("order_id"))
+	if err != nil {
+		return nil, echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	order := &models.Order{}
+	if err := db.Connection.
+		Preload("OrderItems.Product").
+		Preload("Payments", func(tx *gorm.DB) *gorm.DB { return tx.Order("created_at") }).
+		First(order, "id = ?", orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.ErrNotFound
+		}
+		return nil, echo.ErrInternalServerError
+	}
+	if _, err := findAccessibleRestaurant(ctx, user, order.RestaurantID); err != nil {
+		return nil, echo.ErrNotFound
+	}
+	return order, nil
+}
+
+// paymentsList are the pages of payments of an order.
+var paymentsList = &listSpec{
+	sorts:       []string{"amount"},
+	defaultSort: "id",
+	filters:     []listFilter{enumFilter("method", "method", "Only list the payments with the method.", enumValues[reflect.TypeOf(models.PaymentMethod(""))])},
+}
+
+func getOrderPayments(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	order, err := findAccessibleOrder(ctx, authUser)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+	rows, err := findPage[models.Payment](ctx, paymentsList, db.Connection.Where("order_id = ?", order.ID), time.UTC)
+	if err != nil {
+		return err
+	}
+
+	payments := make([]PaymentResponse, 0, len(rows))
+	for _, payment := range rows {
+		payments = append(payments, newPaymentResponse(&payment))
+	}
+
+	return ctx.JSON(http.StatusOK, payments)
+}
+
+type createPaymentPayload struct {
+	Method    models.PaymentMethod `json:"method" validate:"required,oneof=cash card other"`
+	Amount    float64              `json:"amount" validate:"gt=0"`
+	TipAmount float64              `json:"tip_amount" validate:"gte=0"`
+}
+
+// createPayment records a payment towards an order. Cash payments go in the cash drawer session open
+// on the terminal, or the one opened by the staff member when not signed in on a terminal. The order
+// is invoiced once fully paid.
+func createPayment(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := createPaymentPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	orderID, err := uuid.Parse(ctx.Param("order_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	payment, err := ctx.(*routerContext).GetServices().Payments.Create(ctx.Request().Context(), authUser.actor(), orderID, services.NewPayment(payload))
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, newPaymentResponse(payment))
+}
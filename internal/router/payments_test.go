@@ -0,0 +1,33 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayments(t *testing.T) {
+	f := newFixture(t)
+	orderID := f.waiter.createOrder(t, f.restaurantID, "1", f.productID)
+	path := "/api/orders/" + orderID.String() + "/payments"
+
+	order := &models.Order{}
+	require.NoError(t, f.server.db.Connection.First(order, "id = ?", orderID).Error)
+
+	pay := func(t *testing.T, status int, method models.PaymentMethod, amount float64) string {
+		response := f.waiter.expect(t, status, http.MethodPost, path, createPaymentPayload{Method: method, Amount: amount})
+		body := ErrorResponse{}
+		if status != http.StatusCreated {
+			response.decode(t, &body)
+		}
+		return body.Code
+	}
+
+	assert.Equal(t, "overpayment", pay(t, http.StatusConflict, models.PaymentMethodCard, order.TotalAmount+1))
+	assert.Equal(t, "no_open_cash_drawer", pay(t, http.StatusConflict, models.PaymentMethodCash, 1))
+	pay(t, http.StatusCreated, models.PaymentMethodCard, order.TotalAmount)
+	assert.Equal(t, "order_paid", pay(t, http.StatusConflict, models.PaymentMethodCard, 1))
+}
@@ -0,0 +1,318 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/printing"
+	"gorm.io/gorm"
+)
+
+func bindPrintersRouter(router *echo.Group) {
+	printers := router.Group("/restaurants/:restaurant_id/printers")
+	printers.GET("", getPrinters)
+	printers.POST("", registerPrinter)
+	printers.DELETE("/:printer_id", deletePrinter)
+
+	jobs := router.Group("/restaurants/:restaurant_id/print-jobs")
+	jobs.GET("", getPrintJobs)
+	jobs.POST("/:job_id/reprint", reprintJob)
+
+	router.POST("/orders/:order_id/receipt/print", printOrderReceipt)
+}
+
+// PrinterResponse maps fields of Printer model we are willing to expose.
+type PrinterResponse struct {
+	PrinterID    uuid.UUID          `json:"printer_id"`
+	RestaurantID uuid.UUID          `json:"restaurant_id"`
+	Name         string             `json:"name"`
+	Kind         models.PrinterKind `json:"kind"`
+	Address      string             `json:"address"`
+	CreatedAt    time.Time          `json:"created_at"`
+}
+
+func newPrinterResponse(printer *models.Printer) PrinterResponse {
+	return PrinterResponse{
+		PrinterID:    printer.ID,
+		RestaurantID: printer.RestaurantID,
+		Name:         printer.Name,
+		Kind:         printer.Kind,
+		Address:      printer.Address,
+		CreatedAt:    printer.CreatedAt,
+	}
+}
+
+// PrintJobResponse maps fields of PrintJob model we are willing to expose, without the printed data.
+type PrintJobResponse struct {
+	JobID         uuid.UUID             `json:"job_id"`
+	PrinterID     uuid.UUID             `json:"printer_id"`
+	OrderID       *uuid.UUID            `json:"order_id,omitempty"`
+	Kind          models.PrintJobKind   `json:"kind"`
+	Status        models.PrintJobStatus `json:"status"`
+	Attempts      int                   `json:"attempts"`
+	LastError     string                `json:"last_error,omitempty"`
+	NextAttemptAt time.Time             `json:"next_attempt_at"`
+	PrintedAt     *time.Time            `json:"printed_at,omitempty"`
+	CreatedAt     time.Time             `json:"created_at"`
+}
+
+func newPrintJobResponse(job *models.PrintJob) PrintJobResponse {
+	return PrintJobResponse{
+		JobID:         job.ID,
+		PrinterID:     job.PrinterID,
+		OrderID:       job.OrderID,
+		Kind:          job.Kind,
+		Status:        job.Status,
+		Attempts:      job.Attempts,
+		LastError:     job.LastError,
+		NextAttemptAt: job.NextAttemptAt,
+		PrintedAt:     job.PrintedAt,
+		CreatedAt:     job.CreatedAt,
+	}
+}
+
+// printersList are the pages of printers of a restaurant.
+var printersList = &listSpec{
+	sorts:       []string{"name"},
+	defaultSort: "name",
+	filters:     []listFilter{enumFilter("kind", "kind", "Only list the printers of the kind.", enumValues[reflect.TypeOf(models.PrinterKind(""))])},
+}
+
+func getPrinters(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findAccessibleRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	rows, err := findPage[models.Printer](ctx, printersList, db.Connection.Where("restaurant_id = ?", restaurantID), time.UTC)
+	if err != nil {
+		return err
+	}
+
+	printers := make([]PrinterResponse, 0, len(rows))
+	for _, printer := range rows {
+		printers = append(printers, newPrinterResponse(&printer))
+	}
+
+	return ctx.JSON(http.StatusOK, printers)
+}
+
+type registerPrinterPayload struct {
+	Name    string             `json:"name" validate:"required"`
+	Kind    models.PrinterKind `json:"kind" validate:"required,oneof=kitchen receipt"`
+	Address string             `json:"address" validate:"required,hostname_port"`
+}
+
+func registerPrinter(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := registerPrinterPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	// Only owners can register printers for their own restaurant
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	printer := &models.Printer{
+		RestaurantID: restaurantID,
+		Name:         payload.Name,
+		Kind:         payload.Kind,
+		Address:      payload.Address,
+	}
+	if err := db.Connection.Create(printer).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusCreated, newPrinterResponse(printer))
+}
+
+// deletePrinter removes a printer. Its pending jobs fail on their next attempt.
+func deletePrinter(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	printerID, err := uuid.Parse(ctx.Param("printer_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	tx := db.Connection.Where("id = ? AND restaurant_id = ?", printerID, restaurantID).Delete(&models.Printer{})
+	if tx.Error != nil {
+		return echo.ErrInternalServerError
+	}
+	if tx.RowsAffected == 0 {
+		return echo.ErrNotFound
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// printJobsList are the pages of print jobs of a restaurant, the latest first.
+var printJobsList = &listSpec{
+	defaultSort: "-id",
+	filters: []listFilter{
+		enumFilter("status", "status", "Only list jobs with the status.", enumValues[reflect.TypeOf(models.PrintJobStatus(""))]),
+		enumFilter("kind", "kind", "Only list jobs of the kind.", enumValues[reflect.TypeOf(models.PrintJobKind(""))]),
+		uuidFilter("printer_id", "printer_id", "Only list the jobs of the printer."),
+		uuidFilter("order_id", "order_id", "Only list the jobs of the order."),
+	},
+}
+
+// getPrintJobs lists the latest print jobs of a restaurant.
+func getPrintJobs(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findAccessibleRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	rows, err := findPage[models.PrintJob](ctx, printJobsList, db.Connection.Omit("data").Where("restaurant_id = ?", restaurantID), time.UTC)
+	if err != nil {
+		return err
+	}
+
+	jobs := make([]PrintJobResponse, 0, len(rows))
+	for _, job := range rows {
+		jobs = append(jobs, newPrintJobResponse(&job))
+	}
+
+	return ctx.JSON(http.StatusOK, jobs)
+}
+
+// reprintJob queues a copy of a job, e.g. when a ticket got lost or the printer ran out of paper.
+func reprintJob(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	jobID, err := uuid.Parse(ctx.Param("job_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findAccessibleRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	job := &models.PrintJob{}
+	if err := db.Connection.
+		Where("id = ? AND restaurant_id = ?", jobID, restaurantID).
+		First(job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.ErrNotFound
+		}
+		return echo.ErrInternalServerError
+	}
+
+	reprint, err := printing.Reprint(db.Connection, job)
+	if err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusCreated, newPrintJobResponse(reprint))
+}
+
+type printOrderReceiptPayload struct {
+	PrinterID uuid.UUID `json:"printer_id"`
+}
+
+// printOrderReceipt queues the receipt of an order on the given receipt printer, or on the first
+// receipt printer of the restaurant.
+func printOrderReceipt(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := printOrderReceiptPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+
+	order, err := findAccessibleOrder(ctx, authUser)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	query := db.Connection.Where("restaurant_id = ? AND kind = ?", order.RestaurantID, models.PrinterKindReceipt)
+	if payload.PrinterID != uuid.Nil {
+		query = query.Where("id = ?", payload.PrinterID)
+	}
+	printer := &models.Printer{}
+	if err := query.Order("name").First(printer).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.ErrNotFound
+		}
+		return echo.ErrInternalServerError
+	}
+
+	job, err := printing.EnqueueReceipt(db.Connection, order, printer)
+	if err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusCreated, newPrintJobResponse(job))
+}
@@ -1,20 +1,20 @@
 package router
 
 import (
-	"errors"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/roushou/pocpoc/internal/models"
-	"gorm.io/gorm"
+	"github.com/roushou/pocpoc/internal/services"
 )
 
 func bindProductsRouter(router *echo.Group) {
 	group := router.Group("/restaurants/:restaurant_id/products")
 	group.GET("", getProducts)
 	group.POST("", registerProduct)
+	group.PUT("/:product_id/availability", updateProductAvailability)
 }
 
 // ProductResponse maps fields of Product model we are willing to expose.
@@ -23,11 +23,37 @@ type ProductResponse struct {
 	RestaurantID uuid.UUID `json:"restaurant_id"`
 	Title        string    `json:"title"`
 	Description  string    `json:"description"`
+	Category     string    `json:"category"`
 	UnitPrice    float64   `json:"unit_price"`
+	Available    bool      `json:"available"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+func newProductResponse(product *models.Product) ProductResponse {
+	return ProductResponse{
+		ProductID:    product.ID,
+		RestaurantID: product.RestaurantID,
+		Title:        product.Title,
+		Description:  product.Description,
+		Category:     product.Category,
+		UnitPrice:    product.UnitPrice,
+		Available:    product.Available,
+		CreatedAt:    product.CreatedAt,
+		UpdatedAt:    product.UpdatedAt,
+	}
+}
+
+// productsList are the pages of products of a restaurant.
+var productsList = &listSpec{
+	sorts:       []string{"title", "category", "unit_price"},
+	defaultSort: "id",
+	filters: []listFilter{
+		stringFilter("category", "category", "Only list the products of the category."),
+		boolFilter("available", "available", "Only list the products which are available, or sold out."),
+	},
+}
+
 func getProducts(ctx echo.Context) error {
 	authUser, err := getAuthUser(ctx)
 	if err != nil {
@@ -39,65 +65,45 @@ func getProducts(ctx echo.Context) error {
 		return echo.ErrBadRequest
 	}
 
-	db := ctx.(*routerContext).GetDatabase()
-
 	// Staff can only retrieve products of their own restaurant
-	staff := &models.Staff{ID: authUser.UserID, RestaurantID: restaurantID}
-	if err := db.Connection.First(staff).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return echo.ErrNotFound
-		}
-		return echo.ErrInternalServerError
-	}
-
-	rows := make([]models.Product, 0)
-	if err := db.
-		Connection.
-		Select("id", "restaurant_id", "title", "description").
-		Where("restaurant_id = ?", restaurantID).
-		Find(&rows).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return echo.ErrNotFound
-		}
-		return echo.ErrInternalServerError
+	if _, err := findAccessibleRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+	rows, err := findPage[models.Product](ctx, productsList, db.Connection.Where("restaurant_id = ?", restaurantID), time.UTC)
+	if err != nil {
+		return err
 	}
 
 	products := make([]ProductResponse, 0, len(rows))
 
 	for _, product := range rows {
-		products = append(products, ProductResponse{
-			ProductID:    product.ID,
-			RestaurantID: product.RestaurantID,
-			Title:        product.Title,
-			Description:  product.Description,
-			CreatedAt:    product.CreatedAt,
-			UpdatedAt:    product.UpdatedAt,
-		})
+		products = append(products, newProductResponse(&product))
 	}
 
 	return ctx.JSON(http.StatusOK, products)
 }
 
+type registerProductPayload struct {
+	Title       string  `json:"title" validate:"required"`
+	Description string  `json:"description" validate:"required"`
+	Category    string  `json:"category" validate:"max=50"`
+	UnitPrice   float64 `json:"unit_price" validate:"required,gte=0"`
+}
+
 func registerProduct(ctx echo.Context) error {
 	authUser, err := getAuthUser(ctx)
 	if err != nil {
 		return echo.ErrUnauthorized
 	}
-	// Only owners can create product
-	if authUser.Role != models.RoleOwner {
-		return echo.ErrUnauthorized
-	}
 
-	payload := struct {
-		Title       string  `json:"title" validate:"required"`
-		Description string  `json:"description" validate:"required"`
-		UnitPrice   float64 `json:"unit_price" validate:"required,gte=0"`
-	}{}
+	payload := registerProductPayload{}
 	if err := ctx.Bind(&payload); err != nil {
 		return echo.ErrBadRequest
 	}
 	if err := ctx.Validate(payload); err != nil {
-		return echo.ErrBadRequest
+		return err
 	}
 
 	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
@@ -105,34 +111,50 @@ func registerProduct(ctx echo.Context) error {
 		return echo.ErrBadRequest
 	}
 
-	db := ctx.(*routerContext).GetDatabase()
+	// Only owners can create products
+	product, err := ctx.(*routerContext).GetServices().Products.Register(ctx.Request().Context(), authUser.actor(), restaurantID, services.NewProduct(payload))
+	if err != nil {
+		return err
+	}
 
-	// check if owner is registering staff for their own restaurant
-	restaurant := &models.Restaurant{
-		ID:      restaurantID,
-		OwnerID: authUser.UserID,
+	return ctx.JSON(http.StatusCreated, map[string]string{
+		"product_id": string(product.ID.String()),
+	})
+}
+
+type updateProductAvailabilityPayload struct {
+	Available *bool `json:"available" validate:"required"`
+}
+
+// updateProductAvailability marks a product as sold out, or available again. Staff can change it
+// during service, delivery platforms get the updated menu.
+func updateProductAvailability(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
 	}
-	if err := db.Connection.First(restaurant).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return echo.ErrUnauthorized
-		}
-		return echo.ErrInternalServerError
+
+	payload := updateProductAvailabilityPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
 	}
 
-	product := &models.Product{
-		RestaurantID: restaurantID,
-		Title:        payload.Title,
-		Description:  payload.Description,
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
 	}
-	tx := db.Connection.Create(product)
-	if tx.Error != nil {
-		if errors.Is(tx.Error, gorm.ErrDuplicatedKey) {
-			return echo.ErrConflict
-		}
-		return echo.ErrInternalServerError
+	productID, err := uuid.Parse(ctx.Param("product_id"))
+	if err != nil {
+		return echo.ErrBadRequest
 	}
 
-	return ctx.JSON(http.StatusCreated, map[string]string{
-		"product_id": string(product.ID.String()),
-	})
+	product, err := ctx.(*routerContext).GetServices().Products.SetAvailability(ctx.Request().Context(), authUser.actor(), restaurantID, productID, *payload.Available)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, newProductResponse(product))
 }
@@ -0,0 +1,354 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/promotions"
+	"github.com/roushou/pocpoc/internal/services"
+	"gorm.io/gorm"
+)
+
+func bindPromotionsRouter(router *echo.Group) {
+	group := router.Group("/restaurants/:restaurant_id/promotions")
+	group.GET("", getPromotions)
+	group.POST("", createPromotion)
+	group.DELETE("/:promotion_id", deletePromotion)
+
+	orders := router.Group("/orders/:order_id")
+	orders.GET("/promotions", evaluateOrderPromotions)
+	orders.PUT("/coupon", setOrderCoupon)
+}
+
+var errCouponExists = errors.New("another promotion has the coupon code")
+
+// PromotionResponse maps fields of Promotion model we are willing to expose.
+type PromotionResponse struct {
+	PromotionID        uuid.UUID            `json:"promotion_id"`
+	RestaurantID       uuid.UUID            `json:"restaurant_id"`
+	Name               string               `json:"name"`
+	Kind               models.PromotionKind `json:"kind"`
+	Code               string               `json:"code,omitempty"`
+	ProductID          *uuid.UUID           `json:"product_id,omitempty"`
+	Category           string               `json:"category,omitempty"`
+	BuyQuantity        int                  `json:"buy_quantity,omitempty"`
+	GetQuantity        int                  `json:"get_quantity,omitempty"`
+	Percentage         float64              `json:"percentage,omitempty"`
+	Amount             float64              `json:"amount,omitempty"`
+	MinSubtotal        float64              `json:"min_subtotal"`
+	StartsAt           *time.Time           `json:"starts_at,omitempty"`
+	EndsAt             *time.Time           `json:"ends_at,omitempty"`
+	Weekdays           []time.Weekday       `json:"weekdays"`
+	MaxUses            int                  `json:"max_uses"`
+	MaxUsesPerCustomer int                  `json:"max_uses_per_customer"`
+	CreatedAt          time.Time            `json:"created_at"`
+}
+
+func newPromotionResponse(promotion *models.Promotion) PromotionResponse {
+	weekdays := promotion.Weekdays
+	if weekdays == nil {
+		weekdays = make([]time.Weekday, 0)
+	}
+	return PromotionResponse{
+		PromotionID:        promotion.ID,
+		RestaurantID:       promotion.RestaurantID,
+		Name:               promotion.Name,
+		Kind:               promotion.Kind,
+		Code:               promotion.Code,
+		ProductID:          promotion.ProductID,
+		Category:           promotion.Category,
+		BuyQuantity:        promotion.BuyQuantity,
+		GetQuantity:        promotion.GetQuantity,
+		Percentage:         promotion.Percentage,
+		Amount:             promotion.Amount,
+		MinSubtotal:        promotion.MinSubtotal,
+		StartsAt:           promotion.StartsAt,
+		EndsAt:             promotion.EndsAt,
+		Weekdays:           weekdays,
+		MaxUses:            promotion.MaxUses,
+		MaxUsesPerCustomer: promotion.MaxUsesPerCustomer,
+		CreatedAt:          promotion.CreatedAt,
+	}
+}
+
+// OrderPromotionsResponse is an order priced with promotions, and which of them applied and why.
+type OrderPromotionsResponse struct {
+	Order      OrderResponse        `json:"order"`
+	Promotions []promotions.Outcome `json:"promotions"`
+}
+
+// promotionsList are the pages of promotions of a restaurant.
+var promotionsList = &listSpec{
+	sorts:       []string{"name"},
+	defaultSort: "id",
+	filters: []listFilter{
+		enumFilter("kind", "kind", "Only list the promotions of the kind.", enumValues[reflect.TypeOf(models.PromotionKind(""))]),
+		stringFilter("code", "code", "Only list the promotions with the coupon code."),
+	},
+}
+
+// getPromotions lists the promotions of the restaurant. Staff can see them to tell customers.
+func getPromotions(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findAccessibleRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	rows, err := findPage[models.Promotion](ctx, promotionsList, db.Connection.Where("restaurant_id = ?", restaurantID), time.UTC)
+	if err != nil {
+		return err
+	}
+
+	response := make([]PromotionResponse, 0, len(rows))
+	for _, promotion := range rows {
+		response = append(response, newPromotionResponse(&promotion))
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+type createPromotionPayload struct {
+	Name               string               `json:"name" validate:"required,max=100"`
+	Kind               models.PromotionKind `json:"kind" validate:"required,oneof=buy_x_get_y percentage fixed_amount"`
+	Code               string               `json:"code" validate:"omitempty,alphanum,max=32"`
+	ProductID          *uuid.UUID           `json:"product_id"`
+	Category           string               `json:"category" validate:"max=50"`
+	BuyQuantity        int                  `json:"buy_quantity" validate:"gte=0,max=100"`
+	GetQuantity        int                  `json:"get_quantity" validate:"gte=0,max=100"`
+	Percentage         float64              `json:"percentage" validate:"gte=0,lte=100"`
+	Amount             float64              `json:"amount" validate:"gte=0"`
+	MinSubtotal        float64              `json:"min_subtotal" validate:"gte=0"`
+	StartsAt           *time.Time           `json:"starts_at"`
+	EndsAt             *time.Time           `json:"ends_at"`
+	Weekdays           []time.Weekday       `json:"weekdays" validate:"max=7,dive,min=0,max=6"`
+	MaxUses            int                  `json:"max_uses" validate:"gte=0"`
+	MaxUsesPerCustomer int                  `json:"max_uses_per_customer" validate:"gte=0"`
+}
+
+func createPromotion(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := createPromotionPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+	switch payload.Kind {
+	case models.PromotionKindBuyXGetY:
+		if payload.BuyQuantity == 0 || payload.GetQuantity == 0 {
+			return echo.ErrBadRequest
+		}
+	case models.PromotionKindPercentage:
+		if payload.Percentage == 0 {
+			return echo.ErrBadRequest
+		}
+	case models.PromotionKindFixedAmount:
+		if payload.Amount == 0 {
+			return echo.ErrBadRequest
+		}
+	}
+	if payload.StartsAt != nil && payload.EndsAt != nil && !payload.EndsAt.After(*payload.StartsAt) {
+		return echo.ErrBadRequest
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	// Only owners can create promotions for their own restaurant
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	if payload.ProductID != nil {
+		if err := db.Connection.First(&models.Product{}, "id = ? AND restaurant_id = ?", *payload.ProductID, restaurantID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return services.ErrUnknownProduct
+			}
+			return echo.ErrInternalServerError
+		}
+	}
+
+	promotion := &models.Promotion{
+		RestaurantID:       restaurantID,
+		Name:               payload.Name,
+		Kind:               payload.Kind,
+		Code:               promotions.NormalizeCode(payload.Code),
+		ProductID:          payload.ProductID,
+		Category:           payload.Category,
+		BuyQuantity:        payload.BuyQuantity,
+		GetQuantity:        payload.GetQuantity,
+		Percentage:         payload.Percentage,
+		Amount:             payload.Amount,
+		MinSubtotal:        payload.MinSubtotal,
+		StartsAt:           payload.StartsAt,
+		EndsAt:             payload.EndsAt,
+		Weekdays:           payload.Weekdays,
+		MaxUses:            payload.MaxUses,
+		MaxUsesPerCustomer: payload.MaxUsesPerCustomer,
+	}
+
+	if promotion.Code != "" {
+		if _, err := promotions.FindCoupon(db.Connection, restaurantID, promotion.Code); err == nil {
+			return errCouponExists
+		} else if !errors.Is(err, promotions.ErrUnknownCoupon) {
+			return echo.ErrInternalServerError
+		}
+	}
+
+	if err := db.Connection.Create(promotion).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusCreated, newPromotionResponse(promotion))
+}
+
+// deletePromotion ends a promotion. Orders it was applied to keep their discount until they are
+// priced again.
+func deletePromotion(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	promotionID, err := uuid.Parse(ctx.Param("promotion_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	tx := db.Connection.Where("id = ? AND restaurant_id = ?", promotionID, restaurantID).Delete(&models.Promotion{})
+	if tx.Error != nil {
+		return echo.ErrInternalServerError
+	}
+	if tx.RowsAffected == 0 {
+		return echo.ErrNotFound
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// evaluateOrderPromotions explains which promotions apply to the order as it is now, and why the
+// others don't, without pricing it again.
+func evaluateOrderPromotions(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	order, err := findAccessibleOrder(ctx, authUser)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	restaurant := &models.Restaurant{}
+	if err := db.Connection.First(restaurant, "id = ?", order.RestaurantID).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	result, err := promotions.Evaluate(db.Connection, restaurant, order, time.Now())
+	if err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, OrderPromotionsResponse{
+		Order:      newOrderResponse(order),
+		Promotions: result.Promotions,
+	})
+}
+
+type setOrderCouponPayload struct {
+	Code string `json:"code" validate:"max=32"`
+}
+
+// setOrderCoupon applies a coupon to the order, or removes it when the code is empty, and prices the
+// order again.
+func setOrderCoupon(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := setOrderCouponPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	order, err := findAccessibleOrder(ctx, authUser)
+	if err != nil {
+		return err
+	}
+	// Payments already made must stay within the total
+	if err := services.CheckPayable(order); err != nil {
+		return err
+	}
+	if len(order.Payments) > 0 {
+		return errOrderHasPayments
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	var result *promotions.Result
+	err = db.Connection.Transaction(func(tx *gorm.DB) error {
+		restaurant := &models.Restaurant{}
+		if err := tx.First(restaurant, "id = ?", order.RestaurantID).Error; err != nil {
+			return err
+		}
+		order.CouponCode = ""
+		if payload.Code != "" {
+			coupon, err := promotions.FindCoupon(tx, restaurant.ID, payload.Code)
+			if err != nil {
+				return err
+			}
+			order.CouponCode = coupon.Code
+		}
+		result, err = promotions.Apply(tx, restaurant, order, time.Now())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, OrderPromotionsResponse{
+		Order:      newOrderResponse(order),
+		Promotions: result.Promotions,
+	})
+}
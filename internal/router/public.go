@@ -0,0 +1,199 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/security"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+// bindPublicRouter binds the endpoints guests use to order from the QR code of their table. They don't
+// need auth, the signed table token identifies the table, and requests are rate-limited by IP.
+func bindPublicRouter(router *echo.Group) {
+	group := router.Group("/public/tables/:table_token")
+	group.Use(middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+			Rate:      guestRequestRate,
+			Burst:     guestRequestBurst,
+			ExpiresIn: 3 * time.Minute,
+		}),
+	}))
+	group.GET("/menu", getTableMenu)
+	group.POST("/orders", createGuestOrder)
+	group.GET("/orders/:order_id", getGuestOrder)
+}
+
+const (
+	// guestRequestRate and guestRequestBurst limit the requests of each guest IP address.
+	guestRequestRate  = rate.Limit(1)
+	guestRequestBurst = 30
+	// maxGuestItemQuantity is the quantity of a product guests can order at once.
+	maxGuestItemQuantity = 20
+)
+
+// TableMenuResponse is what guests see after scanning the QR code of a table.
+type TableMenuResponse struct {
+	RestaurantName string                `json:"restaurant_name"`
+	Currency       string                `json:"currency"`
+	TableNumber    string                `json:"table_number"`
+	Products       []MenuProductResponse `json:"products"`
+}
+
+// MenuProductResponse maps fields of Product model guests can see.
+type MenuProductResponse struct {
+	ProductID   uuid.UUID `json:"product_id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	UnitPrice   float64   `json:"unit_price"`
+}
+
+// GuestOrderResponse maps fields of Order model guests can follow.
+type GuestOrderResponse struct {
+	OrderID     uuid.UUID           `json:"order_id"`
+	TableNumber string              `json:"table_number"`
+	Status      models.OrderStatus  `json:"status"`
+	TotalAmount float64             `json:"total_amount"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+	Items       []OrderItemResponse `json:"items"`
+}
+
+func newGuestOrderResponse(order *models.Order) GuestOrderResponse {
+	response := newOrderResponse(order)
+	return GuestOrderResponse{
+		OrderID:     response.OrderID,
+		TableNumber: response.TableNumber,
+		Status:      response.Status,
+		TotalAmount: response.TotalAmount,
+		CreatedAt:   response.CreatedAt,
+		UpdatedAt:   response.UpdatedAt,
+		Items:       response.Items,
+	}
+}
+
+// findTokenTable returns the table, with its restaurant, identified by the token in the path. Tokens
+// of deleted tables, rotated tokens and tables of archived restaurants are not found.
+func findTokenTable(ctx echo.Context) (*models.Table, error) {
+	tableID, version, err := security.ParseTableToken(ctx.Param("table_token"), ctx.(*routerContext).GetTableTokenKey())
+	if err != nil {
+		return nil, echo.ErrNotFound
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	table := &models.Table{}
+	if err := db.Connection.
+		Preload("Restaurant").
+		First(table, "id = ?", tableID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.ErrNotFound
+		}
+		return nil, echo.ErrInternalServerError
+	}
+	if table.TokenVersion != version || table.Restaurant.IsArchived() {
+		return nil, echo.ErrNotFound
+	}
+	return table, nil
+}
+
+func getTableMenu(ctx echo.Context) error {
+	table, err := findTokenTable(ctx)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	rows := make([]models.Product, 0)
+	if err := db.Connection.
+		Where("restaurant_id = ? AND available = ?", table.RestaurantID, true).
+		Order("title").
+		Find(&rows).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	products := make([]MenuProductResponse, 0, len(rows))
+	for _, product := range rows {
+		products = append(products, MenuProductResponse{
+			ProductID:   product.ID,
+			Title:       product.Title,
+			Description: product.Description,
+			UnitPrice:   product.UnitPrice,
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, TableMenuResponse{
+		RestaurantName: table.Restaurant.Name,
+		Currency:       table.Restaurant.Currency,
+		TableNumber:    table.Number,
+		Products:       products,
+	})
+}
+
+type createGuestOrderPayload struct {
+	Products []orderItemInput `json:"products" validate:"required,min=1,max=50,dive"`
+}
+
+// createGuestOrder places an order for the table. Guest orders await the approval of the staff before
+// being sent to the kitchen.
+func createGuestOrder(ctx echo.Context) error {
+	payload := createGuestOrderPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+	for i := range payload.Products {
+		if payload.Products[i].Quantity > maxGuestItemQuantity {
+			return echo.ErrBadRequest
+		}
+	}
+
+	table, err := findTokenTable(ctx)
+	if err != nil {
+		return err
+	}
+
+	order, err := ctx.(*routerContext).GetServices().Orders.CreateGuestOrder(ctx.Request().Context(), table, newOrderItems(payload.Products))
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, newGuestOrderResponse(order))
+}
+
+// getGuestOrder returns an order guests placed at the table, to follow its status.
+func getGuestOrder(ctx echo.Context) error {
+	orderID, err := uuid.Parse(ctx.Param("order_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	table, err := findTokenTable(ctx)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	order := &models.Order{}
+	if err := db.Connection.
+		Preload("OrderItems").
+		Where("id = ? AND restaurant_id = ? AND table_number = ? AND source = ?", orderID, table.RestaurantID, table.Number, models.OrderSourceGuest).
+		First(order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.ErrNotFound
+		}
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, newGuestOrderResponse(order))
+}
@@ -0,0 +1,60 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/roushou/pocpoc/internal/security"
+	"github.com/roushou/pocpoc/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuestOrders(t *testing.T) {
+	f := newFixture(t)
+	// Requests share a single connection, as when SQLite serializes the writers, while the handlers
+	// still interleave
+	sqlDB, err := f.server.db.Connection.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	token := TableTokenResponse{}
+	f.owner.expect(t, http.StatusOK, http.MethodGet, "/api/restaurants/"+f.restaurantID.String()+"/tables/"+f.tableID.String()+"/token", nil).decode(t, &token)
+
+	t.Run("limits the orders awaiting approval", func(t *testing.T) {
+		const attempts = 10
+		codes := make(chan int, attempts)
+		var wg sync.WaitGroup
+		for range attempts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codes <- f.server.client().do(t, http.MethodPost, "/api/public/tables/"+token.Token+"/orders", createGuestOrderPayload{
+					Products: []orderItemInput{{ProductID: f.productID, Quantity: 1}},
+				}, nil).Code
+			}()
+		}
+		wg.Wait()
+		close(codes)
+
+		counts := map[int]int{}
+		for code := range codes {
+			counts[code]++
+		}
+		assert.Equal(t, map[int]int{
+			http.StatusCreated:         services.MaxGuestOrdersAwaiting,
+			http.StatusTooManyRequests: attempts - services.MaxGuestOrdersAwaiting,
+		}, counts)
+	})
+
+	t.Run("signs tokens with the configured key", func(t *testing.T) {
+		forged := security.NewTableToken(f.tableID, 0, strings.Repeat("k", minTableTokenKeySize))
+		f.server.client().expect(t, http.StatusNotFound, http.MethodGet, "/api/public/tables/"+forged+"/menu", nil)
+		f.server.client().expect(t, http.StatusOK, http.MethodGet, "/api/public/tables/"+token.Token+"/menu", nil)
+
+		_, err := NewRouter(f.server.db, WithTableTokenKey("short"))
+		assert.Error(t, err)
+	})
+}
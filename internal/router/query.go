@@ -0,0 +1,330 @@
+package router
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	gormschema "gorm.io/gorm/schema"
+)
+
+// Limits of the pages of lists.
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// headerNextCursor is the cursor of the next page of lists, also linked in the Link header.
+const headerNextCursor = "X-Next-Cursor"
+
+// listSpec declares the sort orders and filters a list endpoint accepts on top of its page. Lists are
+// paginated with cursors rather than offsets so that pages don't shift as rows are added, e.g. orders
+// taken while the manager scrolls through the day.
+type listSpec struct {
+	// sorts are the columns lists can be sorted by on top of id. IDs are UUIDv7, so sorting by id sorts
+	// by creation.
+	sorts []string
+	// defaultSort is the sort of lists without the sort parameter, prefixed with "-" when descending.
+	defaultSort string
+	filters     []listFilter
+}
+
+// listFilter narrows lists down with query parameters.
+type listFilter struct {
+	parameters []parameter
+	// apply adds the conditions of the parameters to the query. Dates are in the location, the time
+	// zone of the restaurant of the list.
+	apply func(ctx echo.Context, query *gorm.DB, location *time.Location) (*gorm.DB, error)
+}
+
+// parameters returns the query parameters of the list, for the OpenAPI document.
+func (spec *listSpec) parameters() []parameter {
+	sorts := make([]string, 0, 2*len(spec.sorts)+2)
+	for _, column := range append([]string{"id"}, spec.sorts...) {
+		sorts = append(sorts, column, "-"+column)
+	}
+
+	parameters := []parameter{
+		{name: "limit", description: fmt.Sprintf("Maximum number of rows, %d by default.", defaultPageLimit), schema: schema{"type": "integer", "minimum": 1, "maximum": maxPageLimit}},
+		{name: "cursor", description: "Cursor of the page, returned in the X-Next-Cursor header of the previous page.", schema: schema{"type": "string"}},
+		{name: "sort", description: fmt.Sprintf("Sort order, descending when prefixed with a dash, %s by default. Sorting by id sorts by creation.", spec.defaultSort), schema: schema{"type": "string", "enum": sorts}},
+	}
+	for _, filter := range spec.filters {
+		parameters = append(parameters, filter.parameters...)
+	}
+	return parameters
+}
+
+// listCursor is the position of the last row of a page, encoded in the cursor parameter. Rows are
+// sorted by id after the sort column, so the value of the column and the ID identify the position. The
+// sort is kept so that cursors can't be reused with another order.
+type listCursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v,omitempty"`
+	ID    uuid.UUID       `json:"id"`
+}
+
+func (c *listCursor) encode() (string, error) {
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+func decodeListCursor(value string) (*listCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	cursor := &listCursor{}
+	if err := json.Unmarshal(decoded, cursor); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// findPage finds the page of rows asked for by the limit, cursor and sort query parameters, filtered
+// by the filters of the spec. When there are more rows, the next page is linked in the Link and
+// X-Next-Cursor headers of the response.
+func findPage[T any](ctx echo.Context, spec *listSpec, query *gorm.DB, location *time.Location) ([]T, error) {
+	limit := defaultPageLimit
+	if value := ctx.QueryParam("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return nil, invalidQueryParameter("limit", "max", fmt.Sprintf("limit should be 1 to %d", maxPageLimit))
+		}
+	}
+
+	sort := spec.defaultSort
+	if value := ctx.QueryParam("sort"); value != "" {
+		column := strings.TrimPrefix(value, "-")
+		if column != "id" && !slices.Contains(spec.sorts, column) {
+			return nil, invalidQueryParameter("sort", "oneof", fmt.Sprintf("sort should be one of id %s", strings.Join(spec.sorts, " ")))
+		}
+		sort = value
+	}
+	column, descending := strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+
+	for _, filter := range spec.filters {
+		var err error
+		if query, err = filter.apply(ctx, query, location); err != nil {
+			return nil, err
+		}
+	}
+
+	statement := &gorm.Statement{DB: query}
+	if err := statement.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	sortField, idField := statement.Schema.LookUpField(column), statement.Schema.LookUpField("id")
+	if sortField == nil || idField == nil {
+		return nil, fmt.Errorf("%s can't be sorted by %s", statement.Schema.Name, column)
+	}
+
+	direction, operator := "ASC", ">"
+	if descending {
+		direction, operator = "DESC", "<"
+	}
+	if value := ctx.QueryParam("cursor"); value != "" {
+		cursor, err := decodeListCursor(value)
+		if err != nil || cursor.Sort != sort {
+			return nil, invalidQueryParameter("cursor", "cursor", "cursor is invalid or was returned for another sort")
+		}
+		if column == "id" {
+			query = query.Where(fmt.Sprintf("id %s ?", operator), cursor.ID)
+		} else {
+			last := reflect.New(sortField.FieldType)
+			if err := json.Unmarshal(cursor.Value, last.Interface()); err != nil {
+				return nil, invalidQueryParameter("cursor", "cursor", "cursor is invalid or was returned for another sort")
+			}
+			value := last.Elem().Interface()
+			// Times are stored in UTC, see database.NewDatabase
+			if at, ok := value.(time.Time); ok {
+				value = at.UTC()
+			}
+			query = query.Where(
+				fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", sortField.DBName, operator),
+				value, value, cursor.ID,
+			)
+		}
+	}
+	if column != "id" {
+		query = query.Order(sortField.DBName + " " + direction)
+	}
+
+	// One more row tells whether there is a next page
+	rows := make([]T, 0)
+	if err := query.Order("id " + direction).Limit(limit + 1).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) <= limit {
+		return rows, nil
+	}
+
+	rows = rows[:limit]
+	next, err := newListCursor(ctx, sort, sortField, idField, reflect.ValueOf(&rows[limit-1]).Elem())
+	if err != nil {
+		return nil, err
+	}
+	link := *ctx.Request().URL
+	params := link.Query()
+	params.Set("cursor", next)
+	link.RawQuery = params.Encode()
+
+	header := ctx.Response().Header()
+	header.Set(headerNextCursor, next)
+	header.Set("Link", fmt.Sprintf(`<%s>; rel="next"`, link.RequestURI()))
+	return rows, nil
+}
+
+// newListCursor returns the encoded cursor of the position of the row.
+func newListCursor(ctx echo.Context, sort string, sortField, idField *gormschema.Field, row reflect.Value) (string, error) {
+	id, _ := idField.ValueOf(ctx.Request().Context(), row)
+	cursor := &listCursor{Sort: sort, ID: id.(uuid.UUID)}
+	if sortField != idField {
+		value, _ := sortField.ValueOf(ctx.Request().Context(), row)
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		cursor.Value = encoded
+	}
+	return cursor.encode()
+}
+
+// invalidQueryParameter reports an invalid query parameter like an invalid field of a payload.
+func invalidQueryParameter(name, code, message string) error {
+	return &validationError{fields: []FieldError{{Field: name, Code: code, Message: message}}}
+}
+
+// equalFilter lists the rows whose column equals the parameter, parsed with parse. Errors of parse are
+// returned as is, e.g. from invalidQueryParameter.
+func equalFilter(param parameter, column string, parse func(value string) (any, error)) listFilter {
+	return listFilter{
+		parameters: []parameter{param},
+		apply: func(ctx echo.Context, query *gorm.DB, _ *time.Location) (*gorm.DB, error) {
+			value := ctx.QueryParam(param.name)
+			if value == "" {
+				return query, nil
+			}
+			parsed, err := parse(value)
+			if err != nil {
+				return nil, err
+			}
+			return query.Where(column+" = ?", parsed), nil
+		},
+	}
+}
+
+// stringFilter lists the rows whose column is the parameter.
+func stringFilter(name, column, description string) listFilter {
+	return equalFilter(parameter{name: name, description: description, schema: schema{"type": "string"}}, column, func(value string) (any, error) {
+		return value, nil
+	})
+}
+
+// uuidFilter lists the rows whose column is the ID in the parameter.
+func uuidFilter(name, column, description string) listFilter {
+	return equalFilter(parameter{name: name, description: description, schema: uuidSchema}, column, func(value string) (any, error) {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, invalidQueryParameter(name, "uuid", name+" should be a UUID")
+		}
+		return id, nil
+	})
+}
+
+// boolFilter lists the rows whose column is the boolean in the parameter.
+func boolFilter(name, column, description string) listFilter {
+	return equalFilter(parameter{name: name, description: description, schema: schema{"type": "boolean"}}, column, func(value string) (any, error) {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, invalidQueryParameter(name, "boolean", name+" should be true or false")
+		}
+		return parsed, nil
+	})
+}
+
+// enumFilter lists the rows whose column is the value in the parameter, one of values.
+func enumFilter(name, column, description string, values []string) listFilter {
+	return equalFilter(parameter{name: name, description: description, schema: schema{"type": "string", "enum": values}}, column, func(value string) (any, error) {
+		if !slices.Contains(values, value) {
+			return nil, invalidQueryParameter(name, "oneof", fmt.Sprintf("%s should be one of %s", name, strings.Join(values, " ")))
+		}
+		return value, nil
+	})
+}
+
+// includeFilter leaves out the rows whose column is set, e.g. archived restaurants, unless the
+// parameter is true.
+func includeFilter(name, column, description string) listFilter {
+	return listFilter{
+		parameters: []parameter{{name: name, description: description, schema: schema{"type": "boolean"}}},
+		apply: func(ctx echo.Context, query *gorm.DB, _ *time.Location) (*gorm.DB, error) {
+			include := false
+			if value := ctx.QueryParam(name); value != "" {
+				var err error
+				if include, err = strconv.ParseBool(value); err != nil {
+					return nil, invalidQueryParameter(name, "boolean", name+" should be true or false")
+				}
+			}
+			if include {
+				return query, nil
+			}
+			return query.Where(column + " IS NULL"), nil
+		},
+	}
+}
+
+// dateRangeFilter lists the rows whose column is between the `from` and `to` dates, see
+// parseDateRange. Lists of the day, e.g. shifts, default to today, others are only filtered on the
+// dates which are set.
+func dateRangeFilter(column string, defaultToday bool) listFilter {
+	parameters := []parameter{fromParameter, toParameter}
+	if !defaultToday {
+		parameters = []parameter{
+			{name: "from", description: "First day of the period.", schema: dateSchema},
+			{name: "to", description: "Last day of the period, included.", schema: dateSchema},
+		}
+	}
+
+	return listFilter{
+		parameters: parameters,
+		apply: func(ctx echo.Context, query *gorm.DB, location *time.Location) (*gorm.DB, error) {
+			if defaultToday {
+				from, to, err := parseDateRange(ctx, location, query.NowFunc())
+				if err != nil {
+					return nil, invalidQueryParameter("from", "datetime", "from and to should be dates, from first")
+				}
+				return query.Where(column+" >= ? AND "+column+" < ?", from.UTC(), to.UTC()), nil
+			}
+
+			for _, name := range []string{"from", "to"} {
+				value := ctx.QueryParam(name)
+				if value == "" {
+					continue
+				}
+				day, err := time.ParseInLocation(dateLayout, value, location)
+				if err != nil {
+					return nil, invalidQueryParameter(name, "datetime", name+" should be a date formatted as 2006-01-02")
+				}
+				if name == "from" {
+					query = query.Where(column+" >= ?", day.UTC())
+				} else {
+					query = query.Where(column+" < ?", day.AddDate(0, 0, 1).UTC())
+				}
+			}
+			return query, nil
+		},
+	}
+}
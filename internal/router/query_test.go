@@ -0,0 +1,157 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var nextLinkPattern = regexp.MustCompile(`^<(.+)>; rel="next"$`)
+
+func TestListPages(t *testing.T) {
+	f := newFixture(t)
+	for i, price := range []float64{8, 12, 8, 15} {
+		f.owner.createProduct(t, f.restaurantID, fmt.Sprintf("Dish %d", i), price)
+	}
+
+	// titles follows the Link headers from the first page and returns the titles of every page
+	titles := func(t *testing.T, path string) ([]string, int) {
+		titles, pages := []string{}, 0
+		for path != "" {
+			response := f.waiter.expect(t, http.StatusOK, http.MethodGet, path, nil)
+			products := []ProductResponse{}
+			response.decode(t, &products)
+			for _, product := range products {
+				titles = append(titles, product.Title)
+			}
+			pages++
+
+			path = ""
+			if link := response.Header.Get("Link"); link != "" {
+				match := nextLinkPattern.FindStringSubmatch(link)
+				require.NotNil(t, match, link)
+				path = match[1]
+				assert.Contains(t, path, "cursor="+response.Header.Get(headerNextCursor))
+			}
+		}
+		return titles, pages
+	}
+	products := fmt.Sprintf("/api/restaurants/%s/products", f.restaurantID)
+
+	t.Run("pages through lists in the order of creation", func(t *testing.T) {
+		got, pages := titles(t, products+"?limit=2")
+		assert.Equal(t, []string{"Ramen", "Dish 0", "Dish 1", "Dish 2", "Dish 3"}, got)
+		assert.Equal(t, 3, pages)
+
+		got, pages = titles(t, products)
+		assert.Len(t, got, 5)
+		assert.Equal(t, 1, pages)
+	})
+
+	t.Run("sorts pages by a column then by creation", func(t *testing.T) {
+		got, _ := titles(t, products+"?limit=2&sort=-unit_price")
+		assert.Equal(t, []string{"Dish 3", "Dish 1", "Ramen", "Dish 2", "Dish 0"}, got)
+		got, _ = titles(t, products+"?limit=1&sort=unit_price")
+		assert.Equal(t, []string{"Dish 0", "Dish 2", "Ramen", "Dish 1", "Dish 3"}, got)
+
+		// Cursors keep the time of the last row when sorted by a time
+		sushiID := f.owner.createRestaurant(t, "Sushi Bar")
+		restaurants := []RestaurantResponse{}
+		response := f.owner.expect(t, http.StatusOK, http.MethodGet, "/api/restaurants?sort=-created_at&limit=1", nil)
+		response.decode(t, &restaurants)
+		require.Len(t, restaurants, 1)
+		assert.Equal(t, sushiID, restaurants[0].RestaurantID)
+		f.owner.expect(t, http.StatusOK, http.MethodGet, "/api/restaurants?sort=-created_at&limit=1&cursor="+response.Header.Get(headerNextCursor), nil).decode(t, &restaurants)
+		require.Len(t, restaurants, 1)
+		assert.Equal(t, f.restaurantID, restaurants[0].RestaurantID)
+	})
+
+	t.Run("filters lists", func(t *testing.T) {
+		f.waiter.createOrder(t, f.restaurantID, "1", f.productID)
+		f.waiter.createOrder(t, f.restaurantID, "2", f.productID)
+		orders := fmt.Sprintf("/api/restaurants/%s/orders", f.restaurantID)
+
+		list := func(query string) []OrderResponse {
+			rows := []OrderResponse{}
+			f.owner.expect(t, http.StatusOK, http.MethodGet, orders+query, nil).decode(t, &rows)
+			return rows
+		}
+		assert.Len(t, list(""), 2)
+		require.Len(t, list("?table=2"), 1)
+		assert.Equal(t, "2", list("?table=2")[0].TableNumber)
+		assert.Empty(t, list("?status=cancelled"))
+		assert.Empty(t, list("?from=2999-01-01"))
+		assert.Len(t, list("?to=2999-01-01"), 2)
+		assert.Len(t, list("?staff_id="+f.waiterID.String()), 2)
+	})
+
+	t.Run("rejects invalid parameters", func(t *testing.T) {
+		response := f.waiter.expect(t, http.StatusOK, http.MethodGet, products+"?limit=1", nil)
+		cursor := response.Header.Get(headerNextCursor)
+		require.NotEmpty(t, cursor)
+
+		tests := map[string]string{
+			"?limit=0":                   "limit",
+			"?limit=1000":                "limit",
+			"?sort=description":          "sort",
+			"?cursor=nope":               "cursor",
+			"?sort=-id&cursor=" + cursor: "cursor",
+			"?available=maybe":           "available",
+		}
+		for query, field := range tests {
+			response := f.waiter.expect(t, http.StatusBadRequest, http.MethodGet, products+query, nil)
+			body := ErrorResponse{}
+			response.decode(t, &body)
+			assert.Equal(t, "validation_failed", body.Code, query)
+			require.Len(t, body.Fields, 1, query)
+			assert.Equal(t, field, body.Fields[0].Field, query)
+		}
+
+		response = f.owner.expect(t, http.StatusBadRequest, http.MethodGet, fmt.Sprintf("/api/restaurants/%s/orders?status=lost", f.restaurantID), nil)
+		body := ErrorResponse{}
+		response.decode(t, &body)
+		assert.Equal(t, "invalid_order_status", body.Code)
+	})
+
+	t.Run("scopes lists", func(t *testing.T) {
+		restaurants := []RestaurantResponse{}
+		f.waiter.expect(t, http.StatusOK, http.MethodGet, "/api/restaurants", nil).decode(t, &restaurants)
+		require.Len(t, restaurants, 1)
+		assert.Equal(t, f.restaurantID, restaurants[0].RestaurantID)
+
+		f.otherStaff.expect(t, http.StatusNotFound, http.MethodGet, products, nil)
+	})
+
+	t.Run("pages the journal in sequence order", func(t *testing.T) {
+		for table := range 3 {
+			orderID := f.waiter.createOrder(t, f.restaurantID, fmt.Sprint(table), f.productID)
+			order := &models.Order{}
+			require.NoError(t, f.server.db.Connection.First(order, "id = ?", orderID).Error)
+			f.waiter.expect(t, http.StatusCreated, http.MethodPost, "/api/orders/"+orderID.String()+"/payments", createPaymentPayload{Method: models.PaymentMethodCard, Amount: order.TotalAmount})
+		}
+
+		sequences, pages := []int64{}, 0
+		for path := fmt.Sprintf("/api/restaurants/%s/journal?limit=2", f.restaurantID); path != ""; pages++ {
+			response := f.owner.expect(t, http.StatusOK, http.MethodGet, path, nil)
+			entries := []JournalEntryResponse{}
+			response.decode(t, &entries)
+			for _, entry := range entries {
+				sequences = append(sequences, entry.Sequence)
+			}
+
+			path = ""
+			if link := response.Header.Get("Link"); link != "" {
+				match := nextLinkPattern.FindStringSubmatch(link)
+				require.NotNil(t, match, link)
+				path = match[1]
+			}
+		}
+		assert.Equal(t, []int64{1, 2, 3}, sequences)
+		assert.Equal(t, 2, pages)
+	})
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/receipt"
+	"gorm.io/gorm"
+)
+
+func bindReceiptsRouter(router *echo.Group) {
+	router.GET("/orders/:order_id/receipt", getOrderReceipt)
+}
+
+// getOrderReceipt renders the receipt of an order as plain text, HTML or ESC/POS commands depending on
+// `format`, which defaults to text.
+func getOrderReceipt(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	format := receipt.FormatText
+	if param := ctx.QueryParam("format"); param != "" {
+		format = receipt.Format(param)
+	}
+	if !format.IsValid() {
+		return echo.ErrBadRequest
+	}
+
+	order, err := findAccessibleOrder(ctx, authUser)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	restaurant := &models.Restaurant{}
+	if err := db.Connection.First(restaurant, "id = ?", order.RestaurantID).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	// Receipts still name staff members who left
+	staff := &models.Staff{}
+	if err := db.Connection.Unscoped().First(staff, "id = ?", order.StaffID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.ErrInternalServerError
+		}
+		staff = nil
+	}
+
+	var buf bytes.Buffer
+	if err := receipt.New(order, restaurant, staff, db.Connection.NowFunc()).Render(&buf, format); err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.Blob(http.StatusOK, format.ContentType(), buf.Bytes())
+}
@@ -0,0 +1,162 @@
+package router
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/reporting"
+	"gorm.io/gorm"
+)
+
+func bindReportsRouter(router *echo.Group) {
+	group := router.Group("/reports")
+	group.GET("/:report", getReport)
+}
+
+// defaultTopProductsLimit is the number of products listed in the top products report by default.
+const defaultTopProductsLimit = 10
+
+// reportBuilders builds the reports by name.
+var reportBuilders = map[string]func(ctx echo.Context, db *gorm.DB, filter reporting.Filter) (reporting.Report, error){
+	"summary": func(ctx echo.Context, db *gorm.DB, filter reporting.Filter) (reporting.Report, error) {
+		return reporting.Summarize(db, filter)
+	},
+	"revenue-by-day": func(ctx echo.Context, db *gorm.DB, filter reporting.Filter) (reporting.Report, error) {
+		return reporting.RevenueByDay(db, filter)
+	},
+	"revenue-by-hour": func(ctx echo.Context, db *gorm.DB, filter reporting.Filter) (reporting.Report, error) {
+		return reporting.RevenueByHour(db, filter)
+	},
+	"top-products": func(ctx echo.Context, db *gorm.DB, filter reporting.Filter) (reporting.Report, error) {
+		limit := defaultTopProductsLimit
+		if param := ctx.QueryParam("limit"); param != "" {
+			var err error
+			limit, err = strconv.Atoi(param)
+			if err != nil || limit < 1 || limit > 100 {
+				return nil, echo.ErrBadRequest
+			}
+		}
+		return reporting.TopProducts(db, filter, limit)
+	},
+	"tables": func(ctx echo.Context, db *gorm.DB, filter reporting.Filter) (reporting.Report, error) {
+		return reporting.CoversByTable(db, filter)
+	},
+	"staff": func(ctx echo.Context, db *gorm.DB, filter reporting.Filter) (reporting.Report, error) {
+		return reporting.StaffLeaderboard(db, filter)
+	},
+}
+
+// getReport builds a sales report over the restaurants of the owner, or the ones given in
+// `restaurant_id`, for the `from` and `to` dates. Dates are in the `time_zone` query parameter, which
+// defaults to the time zone of the restaurant when reporting on a single one and to UTC otherwise.
+// Reports are exported as CSV when `format=csv`.
+func getReport(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+	// Only owners can see the sales of their restaurants
+	if authUser.Role != models.RoleOwner {
+		return echo.ErrUnauthorized
+	}
+
+	name := ctx.Param("report")
+	build, ok := reportBuilders[name]
+	if !ok {
+		return echo.ErrNotFound
+	}
+
+	format := ctx.QueryParam("format")
+	if format != "" && format != "json" && format != "csv" {
+		return echo.ErrBadRequest
+	}
+
+	restaurantIDs := make([]uuid.UUID, 0)
+	for _, param := range ctx.QueryParams()["restaurant_id"] {
+		restaurantID, err := uuid.Parse(param)
+		if err != nil {
+			return echo.ErrBadRequest
+		}
+		// Restaurants repeated in the query are only counted once
+		if !slices.Contains(restaurantIDs, restaurantID) {
+			restaurantIDs = append(restaurantIDs, restaurantID)
+		}
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	query := db.Connection.Where("owner_id = ?", authUser.UserID)
+	if len(restaurantIDs) > 0 {
+		query = query.Where("id IN ?", restaurantIDs)
+	}
+	restaurants := make([]models.Restaurant, 0)
+	if err := query.Find(&restaurants).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+	// Every requested restaurant must be owned
+	if len(restaurantIDs) > 0 && len(restaurants) != len(restaurantIDs) {
+		return echo.ErrNotFound
+	}
+
+	location := time.UTC
+	if param := ctx.QueryParam("time_zone"); param != "" {
+		location, err = time.LoadLocation(param)
+		if err != nil {
+			return echo.ErrBadRequest
+		}
+	} else if len(restaurants) == 1 {
+		location = restaurants[0].Location()
+	}
+
+	from, to, err := parseDateRange(ctx, location, db.Connection.NowFunc())
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	filter := reporting.Filter{
+		RestaurantIDs: make([]uuid.UUID, 0, len(restaurants)),
+		From:          from,
+		To:            to,
+		Location:      location,
+	}
+	for _, restaurant := range restaurants {
+		filter.RestaurantIDs = append(filter.RestaurantIDs, restaurant.ID)
+	}
+
+	report, err := build(ctx, db.Connection, filter)
+	if err != nil {
+		if httpError, ok := err.(*echo.HTTPError); ok {
+			return httpError
+		}
+		return echo.ErrInternalServerError
+	}
+
+	if format == "csv" {
+		filename := fmt.Sprintf("%s-%s-%s.csv", name, from.Format(dateLayout), to.AddDate(0, 0, -1).Format(dateLayout))
+		return writeReportCSV(ctx, filename, report)
+	}
+	return ctx.JSON(http.StatusOK, report)
+}
+
+func writeReportCSV(ctx echo.Context, filename string, report reporting.Report) error {
+	res := ctx.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+	res.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(res)
+	if err := w.Write(report.Header()); err != nil {
+		return err
+	}
+	if err := w.WriteAll(report.Records()); err != nil {
+		return err
+	}
+	return w.Error()
+}
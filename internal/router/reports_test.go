@@ -0,0 +1,28 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/roushou/pocpoc/internal/reporting"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReports(t *testing.T) {
+	f := newFixture(t)
+	f.waiter.createOrder(t, f.restaurantID, "1", f.productID)
+	otherRestaurantID := f.owner.createRestaurant(t, "Sushi Bar")
+
+	summarize := func(query string) reporting.Summary {
+		summary := reporting.Summary{}
+		f.owner.expect(t, http.StatusOK, http.MethodGet, "/api/reports/summary?"+query, nil).decode(t, &summary)
+		return summary
+	}
+	assert.Equal(t, int64(1), summarize("").Orders)
+	assert.Equal(t, int64(0), summarize("restaurant_id="+otherRestaurantID.String()).Orders)
+	assert.Equal(t, int64(1), summarize(fmt.Sprintf("restaurant_id=%s&restaurant_id=%s", f.restaurantID, f.restaurantID)).Orders)
+
+	// Every restaurant must be owned by the caller
+	f.otherOwner.expect(t, http.StatusNotFound, http.MethodGet, "/api/reports/summary?restaurant_id="+f.restaurantID.String(), nil)
+}
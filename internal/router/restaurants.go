@@ -1,35 +1,131 @@
 package router
 
 import (
-	"errors"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/roushou/pocpoc/internal/models"
-	"github.com/roushou/pocpoc/internal/security"
-	"gorm.io/gorm"
+	"github.com/roushou/pocpoc/internal/services"
 )
 
 func bindRestaurantsRouter(router *echo.Group) {
 	group := router.Group("/restaurants")
+	group.GET("", getRestaurants)
 	group.GET("/:restaurant_id", getRestaurantById)
 	group.POST("", registerRestaurant)
-	group.POST("/:restaurant_id/staff", registerStaff)
+	group.PATCH("/:restaurant_id", updateRestaurant)
+	group.POST("/:restaurant_id/archive", archiveRestaurant)
+	group.POST("/:restaurant_id/unarchive", unarchiveRestaurant)
+	group.GET("/:restaurant_id/settings", getRestaurantSettings)
+	group.PUT("/:restaurant_id/settings", updateRestaurantSettings)
 }
 
 // RestaurantResponse maps fields of Restaurant model we are willing to expose.
 type RestaurantResponse struct {
-	RestaurantID uuid.UUID `json:"restaurant_id"`
-	OwnerID      uuid.UUID `json:"owner_id"`
-	Name         string    `json:"name"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	RestaurantID uuid.UUID  `json:"restaurant_id"`
+	OwnerID      uuid.UUID  `json:"owner_id"`
+	Name         string     `json:"name"`
+	ArchivedAt   *time.Time `json:"archived_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func newRestaurantResponse(restaurant *models.Restaurant) RestaurantResponse {
+	return RestaurantResponse{
+		RestaurantID: restaurant.ID,
+		OwnerID:      restaurant.OwnerID,
+		Name:         restaurant.Name,
+		ArchivedAt:   restaurant.ArchivedAt,
+		CreatedAt:    restaurant.CreatedAt,
+		UpdatedAt:    restaurant.UpdatedAt,
+	}
+}
+
+// RestaurantSettingsResponse maps the settings of a restaurant.
+type RestaurantSettingsResponse struct {
+	Address      string                `json:"address"`
+	TimeZone     string                `json:"time_zone"`
+	Currency     string                `json:"currency"`
+	TaxID        string                `json:"tax_id"`
+	OpeningHours []models.OpeningHours `json:"opening_hours"`
+	// ReceiptFooter is printed at the bottom of receipts.
+	ReceiptFooter string `json:"receipt_footer"`
+	// TaxRate is the percentage of tax included in prices.
+	TaxRate float64 `json:"tax_rate"`
+	// RequireClockIn prevents staff who are not clocked in from creating orders.
+	RequireClockIn bool `json:"require_clock_in"`
+	// Loyalty are the earning and redemption rules of loyalty points.
+	Loyalty models.LoyaltyRules `json:"loyalty"`
+	// Pickup are the scheduling rules of takeaway and delivery orders.
+	Pickup models.PickupRules `json:"pickup"`
+	// DeliveryFee is added to delivery orders.
+	DeliveryFee float64 `json:"delivery_fee"`
+}
+
+func newRestaurantSettingsResponse(restaurant *models.Restaurant) RestaurantSettingsResponse {
+	openingHours := restaurant.OpeningHours
+	if openingHours == nil {
+		openingHours = make([]models.OpeningHours, 0)
+	}
+	return RestaurantSettingsResponse{
+		Address:        restaurant.Address,
+		TimeZone:       restaurant.TimeZone,
+		Currency:       restaurant.Currency,
+		TaxID:          restaurant.TaxID,
+		OpeningHours:   openingHours,
+		ReceiptFooter:  restaurant.ReceiptFooter,
+		TaxRate:        restaurant.TaxRate,
+		RequireClockIn: restaurant.RequireClockIn,
+		Loyalty:        restaurant.Loyalty,
+		Pickup:         restaurant.Pickup,
+		DeliveryFee:    restaurant.DeliveryFee,
+	}
+}
+
+// restaurantsList are the pages of restaurants, archived restaurants are left out unless asked for.
+var restaurantsList = &listSpec{
+	sorts:       []string{"name", "created_at"},
+	defaultSort: "name",
+	filters:     []listFilter{includeFilter("include_archived", "archived_at", "Include archived restaurants.")},
+}
+
+// getRestaurants lists the restaurants of the auth user: the ones they own for owners and their
+// employer for staff. Archived restaurants are only listed when `include_archived` is set.
+func getRestaurants(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	// Owners list their restaurants, staff the restaurant they work at
+	db := ctx.(*routerContext).GetDatabase()
+	query := db.Connection.Model(&models.Restaurant{})
+	switch authUser.Role {
+	case models.RoleOwner:
+		query = query.Where("owner_id = ?", authUser.UserID)
+	case models.RoleStaff:
+		query = query.Where("id IN (?)", db.Connection.Model(&models.Staff{}).Select("restaurant_id").Where("id = ?", authUser.UserID))
+	default:
+		return echo.ErrUnauthorized
+	}
+
+	rows, err := findPage[models.Restaurant](ctx, restaurantsList, query, time.UTC)
+	if err != nil {
+		return err
+	}
+
+	restaurants := make([]RestaurantResponse, 0, len(rows))
+	for _, restaurant := range rows {
+		restaurants = append(restaurants, newRestaurantResponse(&restaurant))
+	}
+
+	return ctx.JSON(http.StatusOK, restaurants)
 }
 
 func getRestaurantById(ctx echo.Context) error {
-	_, err := getAuthUser(ctx)
+	authUser, err := getAuthUser(ctx)
 	if err != nil {
 		return echo.ErrUnauthorized
 	}
@@ -39,27 +135,16 @@ func getRestaurantById(ctx echo.Context) error {
 		return echo.ErrBadRequest
 	}
 
-	row := &models.Restaurant{}
-
-	db := ctx.(*routerContext).GetDatabase()
-	// Need to do this way to prevent SQL injections
-	tx := db.Connection.First(row, "id = ?", restaurantID)
-	if tx.Error != nil {
-		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
-			return echo.ErrNotFound
-		}
-		return echo.ErrInternalServerError
+	restaurant, err := findAccessibleRestaurant(ctx, authUser, restaurantID)
+	if err != nil {
+		return err
 	}
 
-	restaurant := &RestaurantResponse{
-		RestaurantID: row.ID,
-		OwnerID:      row.OwnerID,
-		Name:         row.Name,
-		CreatedAt:    row.CreatedAt,
-		UpdatedAt:    row.UpdatedAt,
-	}
+	return ctx.JSON(http.StatusOK, newRestaurantResponse(restaurant))
+}
 
-	return ctx.JSON(http.StatusOK, restaurant)
+type registerRestaurantPayload struct {
+	Name string `json:"name"`
 }
 
 func registerRestaurant(ctx echo.Context) error {
@@ -68,9 +153,7 @@ func registerRestaurant(ctx echo.Context) error {
 		return echo.ErrUnauthorized
 	}
 
-	payload := struct {
-		Name string `json:"name"`
-	}{}
+	payload := registerRestaurantPayload{}
 	if err := ctx.Bind(&payload); err != nil {
 		return echo.ErrBadRequest
 	}
@@ -78,18 +161,10 @@ func registerRestaurant(ctx echo.Context) error {
 		return echo.ErrBadRequest
 	}
 
-	db := ctx.(*routerContext).GetDatabase()
-
-	restaurant := &models.Restaurant{
-		Name:    payload.Name,
-		OwnerID: authUser.UserID,
-	}
-	tx := db.Connection.Create(restaurant)
-	if tx.Error != nil {
-		if errors.Is(tx.Error, gorm.ErrDuplicatedKey) {
-			return echo.ErrConflict
-		}
-		return echo.ErrInternalServerError
+	// Only owners can register restaurants
+	restaurant, err := ctx.(*routerContext).GetServices().Restaurants.Register(ctx.Request().Context(), authUser.actor(), payload.Name)
+	if err != nil {
+		return err
 	}
 
 	return ctx.JSON(http.StatusCreated, map[string]string{
@@ -97,24 +172,21 @@ func registerRestaurant(ctx echo.Context) error {
 	})
 }
 
-func registerStaff(ctx echo.Context) error {
+type updateRestaurantPayload struct {
+	Name string `json:"name" validate:"required"`
+}
+
+func updateRestaurant(ctx echo.Context) error {
 	authUser, err := getAuthUser(ctx)
 	if err != nil {
 		return echo.ErrUnauthorized
 	}
-	// Only owners can register staff
-	if authUser.Role != models.RoleOwner {
-		return echo.ErrUnauthorized
-	}
 
-	payload := struct {
-		Username string `json:"username" validate:"required"`
-		Password string `json:"password" validate:"required"`
-	}{}
+	payload := updateRestaurantPayload{}
 	if err := ctx.Bind(&payload); err != nil {
 		return echo.ErrBadRequest
 	}
-	if err := ctx.Validate(&payload); err != nil {
+	if err := ctx.Validate(payload); err != nil {
 		return err
 	}
 
@@ -123,52 +195,99 @@ func registerStaff(ctx echo.Context) error {
 		return echo.ErrBadRequest
 	}
 
-	db := ctx.(*routerContext).GetDatabase()
+	restaurant, err := ctx.(*routerContext).GetServices().Restaurants.Rename(ctx.Request().Context(), authUser.actor(), restaurantID, payload.Name)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, newRestaurantResponse(restaurant))
+}
+
+func archiveRestaurant(ctx echo.Context) error {
+	return setRestaurantArchived(ctx, true)
+}
 
-	// check if owner is registering staff for their own restaurant
-	restaurant := &models.Restaurant{
-		ID:      restaurantID,
-		OwnerID: authUser.UserID,
+func unarchiveRestaurant(ctx echo.Context) error {
+	return setRestaurantArchived(ctx, false)
+}
+
+// setRestaurantArchived archives or restores a restaurant. Archived restaurants are kept with all
+// their data but are hidden from listings.
+func setRestaurantArchived(ctx echo.Context, archived bool) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
 	}
-	if err := db.Connection.First(restaurant).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return echo.ErrUnauthorized
-		}
-		return echo.ErrInternalServerError
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
 	}
 
-	hashedPassword, err := security.HashPassword(payload.Password)
+	restaurant, err := ctx.(*routerContext).GetServices().Restaurants.SetArchived(ctx.Request().Context(), authUser.actor(), restaurantID, archived)
 	if err != nil {
-		return echo.ErrInternalServerError
+		return err
 	}
 
-	staff := &models.Staff{
-		RestaurantID: restaurantID,
-		Username:     payload.Username,
-		PasswordHash: hashedPassword,
+	return ctx.JSON(http.StatusOK, newRestaurantResponse(restaurant))
+}
+
+func getRestaurantSettings(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
 	}
-	tx := db.Connection.Create(staff)
-	if tx.Error != nil {
-		if errors.Is(tx.Error, gorm.ErrDuplicatedKey) {
-			return echo.ErrConflict
-		}
-		return echo.ErrInternalServerError
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
 	}
 
-	claims := &JWTClaims{UserID: staff.ID, Role: models.RoleStaff}
-	token, err := security.NewJWT(claims, jwtSecretKey, jwtExpiration)
+	restaurant, err := findAccessibleRestaurant(ctx, authUser, restaurantID)
 	if err != nil {
-		return echo.ErrInternalServerError
+		return err
 	}
 
-	ctx.SetCookie(&http.Cookie{
-		Name:     jwtCookieName,
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-	})
+	return ctx.JSON(http.StatusOK, newRestaurantSettingsResponse(restaurant))
+}
 
-	return ctx.JSON(http.StatusCreated, map[string]string{
-		"restaurant_id": restaurantID.String(),
-	})
+type updateRestaurantSettingsPayload struct {
+	Address        string                `json:"address"`
+	TimeZone       string                `json:"time_zone" validate:"required,timezone"`
+	Currency       string                `json:"currency" validate:"required,iso4217"`
+	TaxID          string                `json:"tax_id"`
+	OpeningHours   []models.OpeningHours `json:"opening_hours" validate:"dive"`
+	ReceiptFooter  string                `json:"receipt_footer" validate:"max=500"`
+	TaxRate        float64               `json:"tax_rate" validate:"gte=0,lt=100"`
+	RequireClockIn bool                  `json:"require_clock_in"`
+	Loyalty        models.LoyaltyRules   `json:"loyalty"`
+	Pickup         models.PickupRules    `json:"pickup"`
+	DeliveryFee    float64               `json:"delivery_fee" validate:"gte=0"`
+}
+
+func updateRestaurantSettings(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := updateRestaurantSettingsPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	restaurant, err := ctx.(*routerContext).GetServices().Restaurants.UpdateSettings(ctx.Request().Context(), authUser.actor(), restaurantID, services.RestaurantSettings(payload))
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, newRestaurantSettingsResponse(restaurant))
 }
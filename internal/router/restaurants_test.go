@@ -0,0 +1,89 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestaurants(t *testing.T) {
+	f := newFixture(t)
+	path := "/api/restaurants/" + f.restaurantID.String()
+
+	// names lists the names of the restaurants of the owner
+	names := func(t *testing.T, query string) []string {
+		restaurants := []RestaurantResponse{}
+		f.owner.expect(t, http.StatusOK, http.MethodGet, "/api/restaurants"+query, nil).decode(t, &restaurants)
+		names := []string{}
+		for _, restaurant := range restaurants {
+			names = append(names, restaurant.Name)
+		}
+		return names
+	}
+	errorCode := func(t *testing.T, response *testResponse) string {
+		body := ErrorResponse{}
+		response.decode(t, &body)
+		return body.Code
+	}
+
+	t.Run("renames restaurants", func(t *testing.T) {
+		restaurant := RestaurantResponse{}
+		f.owner.expect(t, http.StatusOK, http.MethodPatch, path, updateRestaurantPayload{Name: "Ramen Bar"}).decode(t, &restaurant)
+		assert.Equal(t, "Ramen Bar", restaurant.Name)
+
+		f.waiter.expect(t, http.StatusOK, http.MethodGet, path, nil).decode(t, &restaurant)
+		assert.Equal(t, "Ramen Bar", restaurant.Name)
+
+		response := f.owner.expect(t, http.StatusBadRequest, http.MethodPatch, path, updateRestaurantPayload{})
+		assert.Equal(t, errorCodeValidationFailed, errorCode(t, response))
+		f.otherOwner.expect(t, http.StatusNotFound, http.MethodPatch, path, updateRestaurantPayload{Name: "Mine"})
+		f.otherOwner.expect(t, http.StatusNotFound, http.MethodGet, path, nil)
+	})
+
+	t.Run("archives restaurants", func(t *testing.T) {
+		f.owner.createRestaurant(t, "Sushi Bar")
+
+		restaurant := RestaurantResponse{}
+		f.owner.expect(t, http.StatusOK, http.MethodPost, path+"/archive", nil).decode(t, &restaurant)
+		assert.NotNil(t, restaurant.ArchivedAt)
+		assert.Equal(t, []string{"Sushi Bar"}, names(t, ""))
+		assert.Equal(t, []string{"Ramen Bar", "Sushi Bar"}, names(t, "?include_archived=true"))
+		response := f.owner.expect(t, http.StatusConflict, http.MethodPost, path+"/archive", nil)
+		assert.Equal(t, "already_archived", errorCode(t, response))
+
+		restaurant = RestaurantResponse{}
+		f.owner.expect(t, http.StatusOK, http.MethodPost, path+"/unarchive", nil).decode(t, &restaurant)
+		assert.Nil(t, restaurant.ArchivedAt)
+		assert.Equal(t, []string{"Ramen Bar", "Sushi Bar"}, names(t, ""))
+		response = f.owner.expect(t, http.StatusConflict, http.MethodPost, path+"/unarchive", nil)
+		assert.Equal(t, "not_archived", errorCode(t, response))
+	})
+
+	t.Run("updates settings", func(t *testing.T) {
+		settings := RestaurantSettingsResponse{}
+		f.owner.expect(t, http.StatusOK, http.MethodPut, path+"/settings", updateRestaurantSettingsPayload{
+			Address:  "1 Rue de la Paix",
+			TimeZone: "Europe/Paris",
+			Currency: "EUR",
+			TaxRate:  10,
+		}).decode(t, &settings)
+		assert.Equal(t, "Europe/Paris", settings.TimeZone)
+
+		settings = RestaurantSettingsResponse{}
+		f.waiter.expect(t, http.StatusOK, http.MethodGet, path+"/settings", nil).decode(t, &settings)
+		assert.Equal(t, "1 Rue de la Paix", settings.Address)
+		assert.Equal(t, "EUR", settings.Currency)
+		assert.Equal(t, 10.0, settings.TaxRate)
+		assert.NotNil(t, settings.OpeningHours)
+
+		body := ErrorResponse{}
+		f.owner.expect(t, http.StatusBadRequest, http.MethodPut, path+"/settings", updateRestaurantSettingsPayload{
+			TimeZone: "Mars/Olympus",
+			Currency: "EUR",
+		}).decode(t, &body)
+		require.Len(t, body.Fields, 1)
+		assert.Equal(t, "time_zone", body.Fields[0].Field)
+	})
+}
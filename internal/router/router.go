@@ -1,12 +1,19 @@
 package router
 
 import (
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"strings"
 
-	"github.com/go-playground/validator/v10"
+	graphql "github.com/graph-gophers/graphql-go"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/roushou/pocpoc/internal/database"
+	"github.com/roushou/pocpoc/internal/services"
 )
 
 var defaultAllowedOrigins = []string{}
@@ -14,19 +21,35 @@ var defaultAllowedOrigins = []string{}
 type routerContext struct {
 	echo.Context
 	database *database.Database
+	services *services.Services
+	options  *options
 }
 
 func (ctx *routerContext) GetDatabase() *database.Database {
 	return ctx.database
 }
 
+func (ctx *routerContext) GetServices() *services.Services {
+	return ctx.services
+}
+
+// GetGuestOrderingURL returns the base URL of the app guests order from, empty if there is none.
+func (ctx *routerContext) GetGuestOrderingURL() string {
+	return ctx.options.guestOrderingURL
+}
+
+// GetTableTokenKey returns the key table tokens are signed with.
+func (ctx *routerContext) GetTableTokenKey() string {
+	return ctx.options.tableTokenKey
+}
+
 // withRouterContext extends echo.Context by setting up Services into it.
 //
 // IMPORTANT: This middleware should be called before any other middlewares and routers.
-func withRouterContext(database *database.Database) echo.MiddlewareFunc {
+func withRouterContext(database *database.Database, services *services.Services, options *options) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(ctx echo.Context) error {
-			rc := &routerContext{Context: ctx, database: database}
+			rc := &routerContext{Context: ctx, database: database, services: services, options: options}
 			return next(rc)
 		}
 	}
@@ -36,7 +59,24 @@ func withRouterContext(database *database.Database) echo.MiddlewareFunc {
 type Option func(options *options) error
 
 type options struct {
-	allowedOrigins []string
+	allowedOrigins   []string
+	guestOrderingURL string
+	// tableTokenKey signs the tokens of the table QR codes, random when not set.
+	tableTokenKey string
+	// services are shared with the other APIs of the gateway, created by NewRouter when not set.
+	services *services.Services
+	// openAPIDocument is the OpenAPI document of the API, generated once by NewRouter.
+	openAPIDocument []byte
+	// docsBundle is the Redoc bundle inlined in the docs page, loaded from a CDN when nil.
+	docsBundle []byte
+	// docsPage is the page browsing the OpenAPI document, rendered once by NewRouter.
+	docsPage string
+	// graphQLSchema is the schema of the GraphQL API with its resolvers, parsed once by NewRouter.
+	graphQLSchema *graphql.Schema
+	// readiness is reported by the readiness check, ready until drained.
+	readiness *Readiness
+	// terminalCertificates requires terminals to present their client certificate with their device token.
+	terminalCertificates bool
 }
 
 func WithAllowedOrigins(origins []string) Option {
@@ -46,9 +86,86 @@ func WithAllowedOrigins(origins []string) Option {
 	}
 }
 
+// WithGuestOrderingURL sets the base URL of the app guests order from. Table QR codes link to this
+// URL followed by the table token.
+func WithGuestOrderingURL(rawURL string) Option {
+	return func(options *options) error {
+		if rawURL == "" {
+			options.guestOrderingURL = ""
+			return nil
+		}
+		parsed, err := url.Parse(rawURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid guest ordering URL %q", rawURL)
+		}
+		options.guestOrderingURL = strings.TrimSuffix(rawURL, "/")
+		return nil
+	}
+}
+
+// minTableTokenKeySize is the minimum size of the key table tokens are signed with.
+const minTableTokenKeySize = 32
+
+// WithTableTokenKey sets the key table tokens are signed with. It must be kept across restarts, or the
+// QR codes printed for the tables stop working.
+func WithTableTokenKey(key string) Option {
+	return func(options *options) error {
+		if len(key) < minTableTokenKeySize {
+			return fmt.Errorf("table token key should be at least %d bytes", minTableTokenKeySize)
+		}
+		options.tableTokenKey = key
+		return nil
+	}
+}
+
+// WithDocsBundle inlines the Redoc bundle of the file, redoc.standalone.js, in the docs page so that
+// it doesn't load it from a CDN, e.g. on restaurant networks without internet access.
+func WithDocsBundle(file string) Option {
+	return func(options *options) error {
+		bundle, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read docs bundle: %w", err)
+		}
+		options.docsBundle = bundle
+		return nil
+	}
+}
+
+// WithServices sets the services handlers call, so that they are shared with other APIs, e.g. for
+// orders taken over REST to be streamed to gRPC watchers.
+func WithServices(services *services.Services) Option {
+	return func(options *options) error {
+		options.services = services
+		return nil
+	}
+}
+
+// WithReadiness reports the readiness in the readiness check, so that draining it, e.g. from the
+// gateway, tells clients the API is shutting down.
+func WithReadiness(readiness *Readiness) Option {
+	return func(options *options) error {
+		if readiness == nil {
+			return errors.New("readiness should not be nil")
+		}
+		options.readiness = readiness
+		return nil
+	}
+}
+
+// WithTerminalCertificates requires terminals to authenticate with a client certificate, on top of
+// their device token, whose common name is their ID. Certificates are verified by the TLS config of
+// the server, e.g. the client CA of the gateway.
+func WithTerminalCertificates() Option {
+	return func(options *options) error {
+		options.terminalCertificates = true
+		return nil
+	}
+}
+
 func NewRouter(database *database.Database, opts ...Option) (*echo.Echo, error) {
 	options := &options{
 		allowedOrigins: defaultAllowedOrigins,
+		readiness:      &Readiness{},
 	}
 	for _, opt := range opts {
 		err := opt(options)
@@ -57,18 +174,49 @@ func NewRouter(database *database.Database, opts ...Option) (*echo.Echo, error)
 		}
 	}
 
+	if options.services == nil {
+		options.services = services.New(services.NewGormStore(database.Connection))
+	}
+	if options.tableTokenKey == "" {
+		key := make([]byte, minTableTokenKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		options.tableTokenKey = string(key)
+	}
+
+	validator, err := NewValidator()
+	if err != nil {
+		return nil, err
+	}
+
+	options.openAPIDocument, err = marshalOpenAPIDocument(apiOperations())
+	if err != nil {
+		return nil, err
+	}
+
+	options.docsPage = newDocsPage(options.docsBundle)
+
+	options.graphQLSchema, err = newGraphQLSchema()
+	if err != nil {
+		return nil, err
+	}
+
 	router := echo.New()
-	router.Validator = &Validator{validator: validator.New()}
+	router.Validator = validator
+	router.HTTPErrorHandler = errorHandler()
+	router.Use(middleware.RequestID())
 
 	group := router.Group("/api")
 
 	// Middlewares
-	group.Use(withRouterContext(database)) // !!! This middleware should be called before anything else
+	group.Use(withRouterContext(database, options.services, options)) // !!! This middleware should be called before anything else
 	group.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:     options.allowedOrigins,
-		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
-		AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
+		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, terminalTokenHeader},
+		AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions},
 		AllowCredentials: true,
+		ExposeHeaders:    []string{echo.HeaderXRequestID, "Link", headerNextCursor},
 	}))
 	group.Use(middleware.Logger())
 	group.Use(middleware.Recover())
@@ -76,24 +224,34 @@ func NewRouter(database *database.Database, opts ...Option) (*echo.Echo, error)
 	// Routers
 	bindHealthRouter(group)
 	bindAuthRouter(group)
+	bindTerminalRouter(group)
+	bindPublicRouter(group)
+	bindWebhooksRouter(group)
+	bindOpenAPIRouter(group)
 
 	// Need auth
 	restricted := group.Group("")
 	restricted.Use(AuthMiddleware(jwtSecretKey))
 	bindRestaurantsRouter(restricted)
+	bindStaffRouter(restricted)
+	bindTerminalsRouter(restricted)
+	bindShiftsRouter(restricted)
 	bindProductsRouter(restricted)
 	bindOrdersRouter(restricted)
+	bindTablesRouter(restricted)
+	bindSyncRouter(restricted)
+	bindPaymentsRouter(restricted)
+	bindCashSessionsRouter(restricted)
+	bindZReportsRouter(restricted)
+	bindReportsRouter(restricted)
+	bindReceiptsRouter(restricted)
+	bindPrintersRouter(restricted)
+	bindJournalRouter(restricted)
+	bindCustomersRouter(restricted)
+	bindIntegrationsRouter(restricted)
+	bindPromotionsRouter(restricted)
+	bindSearchRouter(restricted)
+	bindGraphQLRouter(restricted)
 
 	return router, nil
 }
-
-type Validator struct {
-	validator *validator.Validate
-}
-
-func (v *Validator) Validate(i interface{}) error {
-	if err := v.validator.Struct(i); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
-	}
-	return nil
-}
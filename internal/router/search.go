@@ -0,0 +1,148 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/search"
+	"gorm.io/gorm"
+)
+
+// Number of results of searches, which are ranked rather than paginated.
+const (
+	defaultSearchResults = 20
+	maxSearchResults     = 50
+)
+
+func bindSearchRouter(router *echo.Group) {
+	group := router.Group("/restaurants/:restaurant_id")
+	group.GET("/products/search", searchProducts)
+	group.GET("/orders/search", searchOrders)
+}
+
+// searchParameters are the query parameters of searches.
+var searchParameters = []parameter{
+	{name: "q", description: "Words to search, required, matched as prefixes regardless of case and accents.", schema: schema{"type": "string"}},
+	{name: "limit", description: fmt.Sprintf("Maximum number of results, %d by default.", defaultSearchResults), schema: schema{"type": "integer", "minimum": 1, "maximum": maxSearchResults}},
+}
+
+// parseSearch returns the `q` and `limit` query parameters of searches.
+func parseSearch(ctx echo.Context) (string, int, error) {
+	text := strings.TrimSpace(ctx.QueryParam("q"))
+	if text == "" {
+		return "", 0, invalidQueryParameter("q", "required", "q is required")
+	}
+
+	limit := defaultSearchResults
+	if value := ctx.QueryParam("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxSearchResults {
+			return "", 0, invalidQueryParameter("limit", "max", fmt.Sprintf("limit should be 1 to %d", maxSearchResults))
+		}
+	}
+	return text, limit, nil
+}
+
+// findRanked returns the rows with the IDs, in the order of the IDs.
+func findRanked[T any](query *gorm.DB, ids []uuid.UUID, id func(*T) uuid.UUID) ([]T, error) {
+	rows := make([]T, 0, len(ids))
+	if err := query.Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	index := indexBy(rows, id)
+	ranked := make([]T, 0, len(rows))
+	for _, id := range ids {
+		if row, ok := index[id]; ok {
+			ranked = append(ranked, *row)
+		}
+	}
+	return ranked, nil
+}
+
+// searchProducts finds the products of a restaurant by title and description, best match first.
+func searchProducts(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	text, limit, err := parseSearch(ctx)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findAccessibleRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	ids, err := search.Products(db.Connection, restaurantID, text, limit)
+	if err != nil {
+		return err
+	}
+	rows, err := findRanked(db.Connection, ids, func(product *models.Product) uuid.UUID { return product.ID })
+	if err != nil {
+		return err
+	}
+
+	products := make([]ProductResponse, 0, len(rows))
+	for _, product := range rows {
+		products = append(products, newProductResponse(&product))
+	}
+
+	return ctx.JSON(http.StatusOK, products)
+}
+
+// searchOrders finds the orders of a restaurant by table, contact, invoice number or the titles of
+// their items, best match first.
+func searchOrders(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	text, limit, err := parseSearch(ctx)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findAccessibleRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	ids, err := search.Orders(db.Connection, restaurantID, text, limit)
+	if err != nil {
+		return err
+	}
+	rows, err := findRanked(db.Connection.Preload("OrderItems"), ids, func(order *models.Order) uuid.UUID { return order.ID })
+	if err != nil {
+		return err
+	}
+
+	orders := make([]OrderResponse, 0, len(rows))
+	for _, order := range rows {
+		orders = append(orders, newOrderResponse(&order))
+	}
+
+	return ctx.JSON(http.StatusOK, orders)
+}
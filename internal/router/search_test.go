@@ -0,0 +1,37 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch(t *testing.T) {
+	f := newFixture(t)
+	gyozaID := f.owner.createProduct(t, f.restaurantID, "Gyoza", 6)
+	orderID := f.waiter.createOrder(t, f.restaurantID, "7", gyozaID)
+	f.waiter.createOrder(t, f.restaurantID, "8", f.productID)
+
+	products := []ProductResponse{}
+	f.waiter.expect(t, http.StatusOK, http.MethodGet, fmt.Sprintf("/api/restaurants/%s/products/search?q=gyo", f.restaurantID), nil).decode(t, &products)
+	require.Len(t, products, 1)
+	assert.Equal(t, gyozaID, products[0].ProductID)
+
+	orders := []OrderResponse{}
+	f.owner.expect(t, http.StatusOK, http.MethodGet, fmt.Sprintf("/api/restaurants/%s/orders/search?q=gyoza", f.restaurantID), nil).decode(t, &orders)
+	require.Len(t, orders, 1)
+	assert.Equal(t, orderID, orders[0].OrderID)
+	assert.Len(t, orders[0].Items, 1)
+
+	for query, field := range map[string]string{"": "q", "?q=%20": "q", "?q=gyoza&limit=100": "limit"} {
+		body := ErrorResponse{}
+		f.waiter.expect(t, http.StatusBadRequest, http.MethodGet, fmt.Sprintf("/api/restaurants/%s/products/search%s", f.restaurantID, query), nil).decode(t, &body)
+		require.Len(t, body.Fields, 1, query)
+		assert.Equal(t, field, body.Fields[0].Field, query)
+	}
+
+	f.otherStaff.expect(t, http.StatusNotFound, http.MethodGet, fmt.Sprintf("/api/restaurants/%s/orders/search?q=gyoza", f.restaurantID), nil)
+}
@@ -0,0 +1,405 @@
+package router
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func bindShiftsRouter(router *echo.Group) {
+	group := router.Group("/restaurants/:restaurant_id/shifts")
+	group.GET("", getShifts)
+	group.GET("/current", getCurrentShift)
+	group.POST("/clock-in", clockIn)
+	group.POST("/clock-out", clockOut)
+	group.POST("/breaks/start", startBreak)
+	group.POST("/breaks/end", endBreak)
+
+	router.GET("/restaurants/:restaurant_id/timesheets", getTimesheets)
+}
+
+var (
+	errAlreadyClockedIn = errors.New("staff member is already clocked in")
+	errOnBreak          = errors.New("staff member is already on break")
+	errNotOnBreak       = errors.New("staff member is not on break")
+)
+
+type ShiftBreakResponse struct {
+	BreakID   uuid.UUID  `json:"break_id"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+type ShiftResponse struct {
+	ShiftID       uuid.UUID            `json:"shift_id"`
+	RestaurantID  uuid.UUID            `json:"restaurant_id"`
+	StaffID       uuid.UUID            `json:"staff_id"`
+	ClockInAt     time.Time            `json:"clock_in_at"`
+	ClockOutAt    *time.Time           `json:"clock_out_at,omitempty"`
+	WorkedMinutes float64              `json:"worked_minutes"`
+	BreakMinutes  float64              `json:"break_minutes"`
+	Breaks        []ShiftBreakResponse `json:"breaks"`
+}
+
+func newShiftResponse(shift *models.Shift, now time.Time) ShiftResponse {
+	breaks := make([]ShiftBreakResponse, 0, len(shift.Breaks))
+	for _, b := range shift.Breaks {
+		breaks = append(breaks, ShiftBreakResponse{
+			BreakID:   b.ID,
+			StartedAt: b.StartedAt,
+			EndedAt:   b.EndedAt,
+		})
+	}
+	return ShiftResponse{
+		ShiftID:       shift.ID,
+		RestaurantID:  shift.RestaurantID,
+		StaffID:       shift.StaffID,
+		ClockInAt:     shift.ClockInAt,
+		ClockOutAt:    shift.ClockOutAt,
+		WorkedMinutes: shift.WorkedDuration(now).Minutes(),
+		BreakMinutes:  shift.BreakDuration(now).Minutes(),
+		Breaks:        breaks,
+	}
+}
+
+// findOpenShift returns the shift the staff member is clocked in to, or gorm.ErrRecordNotFound.
+func findOpenShift(tx *gorm.DB, staffID uuid.UUID) (*models.Shift, error) {
+	shift := &models.Shift{}
+	if err := tx.
+		Preload("Breaks", func(tx *gorm.DB) *gorm.DB { return tx.Order("started_at") }).
+		Where("staff_id = ? AND clock_out_at IS NULL", staffID).
+		First(shift).Error; err != nil {
+		return nil, err
+	}
+	return shift, nil
+}
+
+func getCurrentShift(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	staff, err := findRestaurantStaff(ctx, authUser, restaurantID)
+	if err != nil {
+		return err
+	}
+
+	shift, err := findOpenShift(db.Connection, staff.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.ErrNotFound
+		}
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, newShiftResponse(shift, db.Connection.NowFunc()))
+}
+
+func clockIn(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	// Only staff can clock in to their own restaurant
+	staff, err := findRestaurantStaff(ctx, authUser, restaurantID)
+	if err != nil {
+		return err
+	}
+
+	now := db.Connection.NowFunc()
+	shift := &models.Shift{
+		RestaurantID: restaurantID,
+		StaffID:      staff.ID,
+		ClockInAt:    now,
+		Breaks:       make([]models.ShiftBreak, 0),
+	}
+	err = db.Connection.Transaction(func(tx *gorm.DB) error {
+		if _, err := findOpenShift(tx, staff.ID); err == nil {
+			return errAlreadyClockedIn
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Create(shift).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, newShiftResponse(shift, now))
+}
+
+func clockOut(ctx echo.Context) error {
+	return updateOpenShift(ctx, func(tx *gorm.DB, shift *models.Shift, now time.Time) error {
+		// Clocking out ends the break in progress
+		if b := shift.OpenBreak(); b != nil {
+			if err := tx.Model(b).Update("ended_at", now).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(shift).Omit(clause.Associations).Update("clock_out_at", now).Error
+	})
+}
+
+func startBreak(ctx echo.Context) error {
+	return updateOpenShift(ctx, func(tx *gorm.DB, shift *models.Shift, now time.Time) error {
+		if shift.OpenBreak() != nil {
+			return errOnBreak
+		}
+		b := models.ShiftBreak{ShiftID: shift.ID, StartedAt: now}
+		if err := tx.Create(&b).Error; err != nil {
+			return err
+		}
+		shift.Breaks = append(shift.Breaks, b)
+		return nil
+	})
+}
+
+func endBreak(ctx echo.Context) error {
+	return updateOpenShift(ctx, func(tx *gorm.DB, shift *models.Shift, now time.Time) error {
+		b := shift.OpenBreak()
+		if b == nil {
+			return errNotOnBreak
+		}
+		return tx.Model(b).Update("ended_at", now).Error
+	})
+}
+
+// updateOpenShift applies the update to the shift the auth user is clocked in to.
+func updateOpenShift(ctx echo.Context, update func(tx *gorm.DB, shift *models.Shift, now time.Time) error) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	staff, err := findRestaurantStaff(ctx, authUser, restaurantID)
+	if err != nil {
+		return err
+	}
+
+	now := db.Connection.NowFunc()
+	var shift *models.Shift
+	err = db.Connection.Transaction(func(tx *gorm.DB) error {
+		shift, err = findOpenShift(tx, staff.ID)
+		if err != nil {
+			return err
+		}
+		return update(tx, shift, now)
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, newShiftResponse(shift, now))
+}
+
+// findShiftsInRange returns the shifts started in the range.
+func findShiftsInRange(tx *gorm.DB, restaurantID uuid.UUID, from, to time.Time) ([]models.Shift, error) {
+	shifts := make([]models.Shift, 0)
+	if err := preloadShifts(tx).
+		Where("restaurant_id = ? AND clock_in_at >= ? AND clock_in_at < ?", restaurantID, from.UTC(), to.UTC()).
+		Order("clock_in_at").
+		Find(&shifts).Error; err != nil {
+		return nil, err
+	}
+	return shifts, nil
+}
+
+// preloadShifts preloads the staff and breaks of the shifts of the query.
+func preloadShifts(tx *gorm.DB) *gorm.DB {
+	return tx.
+		Preload("Staff").
+		Preload("Breaks", func(tx *gorm.DB) *gorm.DB { return tx.Order("started_at") })
+}
+
+// shiftsList are the pages of shifts started between the `from` and `to` dates.
+var shiftsList = &listSpec{
+	sorts:       []string{"clock_in_at"},
+	defaultSort: "clock_in_at",
+	filters: []listFilter{
+		uuidFilter("staff_id", "staff_id", "Only list the shifts of the staff member."),
+		dateRangeFilter("clock_in_at", true),
+	},
+}
+
+// getShifts lists the shifts of a restaurant started between the `from` and `to` dates.
+func getShifts(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	// Only owners can see the shifts of their staff
+	restaurant, err := findOwnedRestaurant(ctx, authUser, restaurantID)
+	if err != nil {
+		return err
+	}
+
+	now := db.Connection.NowFunc()
+	rows, err := findPage[models.Shift](ctx, shiftsList, preloadShifts(db.Connection).Where("restaurant_id = ?", restaurantID), restaurant.Location())
+	if err != nil {
+		return err
+	}
+
+	shifts := make([]ShiftResponse, 0, len(rows))
+	for _, shift := range rows {
+		shifts = append(shifts, newShiftResponse(&shift, now))
+	}
+
+	return ctx.JSON(http.StatusOK, shifts)
+}
+
+// TimesheetEntry sums the shifts of a staff member over a pay period.
+type TimesheetEntry struct {
+	StaffID       uuid.UUID `json:"staff_id"`
+	Username      string    `json:"username"`
+	DisplayName   string    `json:"display_name"`
+	Shifts        int       `json:"shifts"`
+	WorkedMinutes float64   `json:"worked_minutes"`
+	BreakMinutes  float64   `json:"break_minutes"`
+}
+
+type TimesheetResponse struct {
+	From     string           `json:"from"`
+	To       string           `json:"to"`
+	TimeZone string           `json:"time_zone"`
+	Entries  []TimesheetEntry `json:"entries"`
+}
+
+// getTimesheets sums the time worked by each staff member over the pay period going from the `from`
+// date to the `to` date, both included. Shifts belong to the day they started in. The timesheet is
+// exported as CSV when `format=csv`.
+func getTimesheets(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	format := ctx.QueryParam("format")
+	if format != "" && format != "json" && format != "csv" {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	// Only owners can see the timesheets of their staff
+	restaurant, err := findOwnedRestaurant(ctx, authUser, restaurantID)
+	if err != nil {
+		return err
+	}
+
+	now := db.Connection.NowFunc()
+	from, to, err := parseDateRange(ctx, restaurant.Location(), now)
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	shifts, err := findShiftsInRange(db.Connection, restaurantID, from, to)
+	if err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	entriesByStaff := make(map[uuid.UUID]*TimesheetEntry)
+	for _, shift := range shifts {
+		entry, ok := entriesByStaff[shift.StaffID]
+		if !ok {
+			entry = &TimesheetEntry{
+				StaffID:     shift.StaffID,
+				Username:    shift.Staff.Username,
+				DisplayName: shift.Staff.DisplayName,
+			}
+			entriesByStaff[shift.StaffID] = entry
+		}
+		entry.Shifts++
+		entry.WorkedMinutes += shift.WorkedDuration(now).Minutes()
+		entry.BreakMinutes += shift.BreakDuration(now).Minutes()
+	}
+
+	entries := make([]TimesheetEntry, 0, len(entriesByStaff))
+	for _, entry := range entriesByStaff {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Username < entries[j].Username })
+
+	timesheet := TimesheetResponse{
+		From:     from.Format(dateLayout),
+		To:       to.AddDate(0, 0, -1).Format(dateLayout),
+		TimeZone: restaurant.Location().String(),
+		Entries:  entries,
+	}
+
+	if format == "csv" {
+		return writeTimesheetCSV(ctx, &timesheet)
+	}
+	return ctx.JSON(http.StatusOK, timesheet)
+}
+
+func writeTimesheetCSV(ctx echo.Context, timesheet *TimesheetResponse) error {
+	res := ctx.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="timesheet-%s-%s.csv"`, timesheet.From, timesheet.To))
+	res.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(res)
+	if err := w.Write([]string{"staff_id", "username", "display_name", "shifts", "worked_hours", "break_hours"}); err != nil {
+		return err
+	}
+	for _, entry := range timesheet.Entries {
+		if err := w.Write([]string{
+			entry.StaffID.String(),
+			entry.Username,
+			entry.DisplayName,
+			strconv.Itoa(entry.Shifts),
+			strconv.FormatFloat(entry.WorkedMinutes/60, 'f', 2, 64),
+			strconv.FormatFloat(entry.BreakMinutes/60, 'f', 2, 64),
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,85 @@
+package router
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShifts(t *testing.T) {
+	f := newFixture(t)
+	shifts := fmt.Sprintf("/api/restaurants/%s/shifts", f.restaurantID)
+
+	t.Run("refuses orders of staff not clocked in", func(t *testing.T) {
+		require.NoError(t, f.server.db.Connection.Model(&models.Restaurant{}).Where("id = ?", f.restaurantID).Update("require_clock_in", true).Error)
+
+		order := createOrderPayload{
+			orderTypeInput: orderTypeInput{TableNumber: "1"},
+			Products:       []orderItemInput{{ProductID: f.productID, Quantity: 1}},
+		}
+		orders := fmt.Sprintf("/api/restaurants/%s/orders", f.restaurantID)
+		refused := func() {
+			response := f.waiter.expect(t, http.StatusForbidden, http.MethodPost, orders, order)
+			body := ErrorResponse{}
+			response.decode(t, &body)
+			assert.Equal(t, "not_clocked_in", body.Code)
+		}
+
+		refused()
+		f.waiter.expect(t, http.StatusCreated, http.MethodPost, shifts+"/clock-in", nil)
+		f.waiter.expect(t, http.StatusCreated, http.MethodPost, orders, order)
+		f.waiter.expect(t, http.StatusOK, http.MethodPost, shifts+"/clock-out", nil)
+		refused()
+	})
+
+	// The manager worked 9:00 to 17:00 with a 30 minutes break on the 4th, and 10:00 to 12:00 on the 5th
+	day := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	at := func(days, hours, minutes int) *time.Time {
+		at := day.AddDate(0, 0, days).Add(time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute)
+		return &at
+	}
+	require.NoError(t, f.server.db.Connection.Create(&[]models.Shift{
+		{
+			RestaurantID: f.restaurantID,
+			StaffID:      f.managerID,
+			ClockInAt:    *at(0, 9, 0),
+			ClockOutAt:   at(0, 17, 0),
+			Breaks:       []models.ShiftBreak{{StartedAt: *at(0, 12, 0), EndedAt: at(0, 12, 30)}},
+		},
+		{RestaurantID: f.restaurantID, StaffID: f.managerID, ClockInAt: *at(1, 10, 0), ClockOutAt: at(1, 12, 0)},
+	}).Error)
+	timesheets := fmt.Sprintf("/api/restaurants/%s/timesheets?from=2024-03-04&to=2024-03-05", f.restaurantID)
+
+	t.Run("subtracts breaks from timesheets", func(t *testing.T) {
+		timesheet := TimesheetResponse{}
+		f.owner.expect(t, http.StatusOK, http.MethodGet, timesheets, nil).decode(t, &timesheet)
+		assert.Equal(t, "2024-03-04", timesheet.From)
+		assert.Equal(t, "2024-03-05", timesheet.To)
+		require.Len(t, timesheet.Entries, 1)
+		entry := timesheet.Entries[0]
+		assert.Equal(t, f.managerID, entry.StaffID)
+		assert.Equal(t, 2, entry.Shifts)
+		assert.Equal(t, 570.0, entry.WorkedMinutes)
+		assert.Equal(t, 30.0, entry.BreakMinutes)
+	})
+
+	t.Run("exports timesheets as CSV", func(t *testing.T) {
+		response := f.owner.expect(t, http.StatusOK, http.MethodGet, timesheets+"&format=csv", nil)
+		assert.Equal(t, "text/csv; charset=utf-8", response.Header.Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="timesheet-2024-03-04-2024-03-05.csv"`, response.Header.Get("Content-Disposition"))
+
+		rows, err := csv.NewReader(bytes.NewReader(response.Body)).ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"staff_id", "username", "display_name", "shifts", "worked_hours", "break_hours"},
+			{f.managerID.String(), "manager", "", "2", "9.50", "0.50"},
+		}, rows)
+	})
+}
@@ -0,0 +1,287 @@
+package router
+
+import (
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/services"
+)
+
+func bindStaffRouter(router *echo.Group) {
+	group := router.Group("/restaurants/:restaurant_id/staff")
+	group.GET("", getStaffMembers)
+	group.POST("", registerStaff)
+	group.GET("/:staff_id", getStaffMember)
+	group.PATCH("/:staff_id", updateStaffMember)
+	group.POST("/:staff_id/deactivate", deactivateStaffMember)
+	group.POST("/:staff_id/reactivate", reactivateStaffMember)
+	group.POST("/:staff_id/reset-password", resetStaffPassword)
+	group.PUT("/:staff_id/pin", setStaffPin)
+}
+
+// StaffResponse maps fields of Staff model we are willing to expose.
+type StaffResponse struct {
+	StaffID       uuid.UUID        `json:"staff_id"`
+	RestaurantID  uuid.UUID        `json:"restaurant_id"`
+	Username      string           `json:"username"`
+	DisplayName   string           `json:"display_name"`
+	Role          models.StaffRole `json:"role"`
+	Active        bool             `json:"active"`
+	DeactivatedAt *time.Time       `json:"deactivated_at,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+	UpdatedAt     time.Time        `json:"updated_at"`
+}
+
+func newStaffResponse(staff *models.Staff) StaffResponse {
+	return StaffResponse{
+		StaffID:       staff.ID,
+		RestaurantID:  staff.RestaurantID,
+		Username:      staff.Username,
+		DisplayName:   staff.DisplayName,
+		Role:          staff.Role,
+		Active:        staff.IsActive(),
+		DeactivatedAt: staff.DeactivatedAt,
+		CreatedAt:     staff.CreatedAt,
+		UpdatedAt:     staff.UpdatedAt,
+	}
+}
+
+// parseStaffPath returns the restaurant and staff IDs from the path.
+func parseStaffPath(ctx echo.Context) (uuid.UUID, uuid.UUID, error) {
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, echo.ErrBadRequest
+	}
+	staffID, err := uuid.Parse(ctx.Param("staff_id"))
+	if err != nil {
+		return uuid.Nil, uuid.Nil, echo.ErrBadRequest
+	}
+	return restaurantID, staffID, nil
+}
+
+// staffList are the pages of staff of a restaurant, deactivated staff are left out unless asked for.
+var staffList = &listSpec{
+	sorts:       []string{"username", "display_name", "created_at"},
+	defaultSort: "username",
+	filters: []listFilter{
+		includeFilter("include_inactive", "deactivated_at", "Include deactivated staff."),
+		enumFilter("role", "role", "Only list the staff with the role.", enumValues[reflect.TypeOf(models.StaffRole(""))]),
+	},
+}
+
+// getStaffMembers lists the staff of a restaurant. Deactivated staff are only listed when
+// `include_inactive` is set.
+func getStaffMembers(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	// Only owners can manage staff of their own restaurant
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+	rows, err := findPage[models.Staff](ctx, staffList, db.Connection.Where("restaurant_id = ?", restaurantID), time.UTC)
+	if err != nil {
+		return err
+	}
+
+	staff := make([]StaffResponse, 0, len(rows))
+	for _, member := range rows {
+		staff = append(staff, newStaffResponse(&member))
+	}
+
+	return ctx.JSON(http.StatusOK, staff)
+}
+
+func getStaffMember(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, staffID, err := parseStaffPath(ctx)
+	if err != nil {
+		return err
+	}
+
+	staff, err := ctx.(*routerContext).GetServices().Staff.Get(ctx.Request().Context(), authUser.actor(), restaurantID, staffID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, newStaffResponse(staff))
+}
+
+type registerStaffPayload struct {
+	Username    string           `json:"username" validate:"required"`
+	Password    string           `json:"password" validate:"required"`
+	DisplayName string           `json:"display_name"`
+	Role        models.StaffRole `json:"role" validate:"omitempty,oneof=waiter cashier kitchen manager"`
+}
+
+func registerStaff(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := registerStaffPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(&payload); err != nil {
+		return err
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	// Only owners can register staff, for their own restaurants
+	staff, err := ctx.(*routerContext).GetServices().Staff.Register(ctx.Request().Context(), authUser.actor(), restaurantID, services.NewStaff(payload))
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, map[string]string{
+		"restaurant_id": restaurantID.String(),
+		"staff_id":      staff.ID.String(),
+	})
+}
+
+type updateStaffMemberPayload struct {
+	Username    *string           `json:"username" validate:"omitempty,min=1"`
+	DisplayName *string           `json:"display_name"`
+	Role        *models.StaffRole `json:"role" validate:"omitempty,oneof=waiter cashier kitchen manager"`
+}
+
+func updateStaffMember(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := updateStaffMemberPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	restaurantID, staffID, err := parseStaffPath(ctx)
+	if err != nil {
+		return err
+	}
+
+	staff, err := ctx.(*routerContext).GetServices().Staff.Update(ctx.Request().Context(), authUser.actor(), restaurantID, staffID, services.StaffUpdate(payload))
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, newStaffResponse(staff))
+}
+
+func deactivateStaffMember(ctx echo.Context) error {
+	return setStaffActive(ctx, false)
+}
+
+func reactivateStaffMember(ctx echo.Context) error {
+	return setStaffActive(ctx, true)
+}
+
+// setStaffActive deactivates or reactivates a staff member. Deactivated staff can't sign in and
+// the tokens they were issued are revoked.
+func setStaffActive(ctx echo.Context, active bool) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, staffID, err := parseStaffPath(ctx)
+	if err != nil {
+		return err
+	}
+
+	staff, err := ctx.(*routerContext).GetServices().Staff.SetActive(ctx.Request().Context(), authUser.actor(), restaurantID, staffID, active)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, newStaffResponse(staff))
+}
+
+type resetStaffPasswordPayload struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// resetStaffPassword sets a new password for a staff member and revokes the tokens they were issued.
+func resetStaffPassword(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := resetStaffPasswordPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	restaurantID, staffID, err := parseStaffPath(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.(*routerContext).GetServices().Staff.ResetPassword(ctx.Request().Context(), authUser.actor(), restaurantID, staffID, payload.Password); err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+type setStaffPinPayload struct {
+	Pin string `json:"pin" validate:"required,numeric,min=4,max=8"`
+}
+
+// setStaffPin sets the PIN used by a staff member to sign in on terminals. It also lifts any lockout.
+func setStaffPin(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := setStaffPinPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	restaurantID, staffID, err := parseStaffPath(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.(*routerContext).GetServices().Staff.SetPin(ctx.Request().Context(), authUser.actor(), restaurantID, staffID, payload.Pin); err != nil {
+		return err
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
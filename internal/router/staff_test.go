@@ -0,0 +1,108 @@
+package router
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaff(t *testing.T) {
+	f := newFixture(t)
+	staffPath := "/api/restaurants/" + f.restaurantID.String() + "/staff"
+	restaurantPath := "/api/restaurants/" + f.restaurantID.String()
+
+	signIn := func(t *testing.T, username, password string) *testResponse {
+		return f.server.client().do(t, http.MethodPost, "/api/auth/staff/sign-in", signInStaffPayload{
+			RestaurantID: f.restaurantID,
+			Username:     username,
+			Password:     password,
+		}, nil)
+	}
+	errorCode := func(t *testing.T, response *testResponse) string {
+		body := ErrorResponse{}
+		response.decode(t, &body)
+		return body.Code
+	}
+
+	t.Run("manages staff members", func(t *testing.T) {
+		cookID := f.owner.createStaff(t, f.restaurantID, "cook", models.StaffRoleKitchen)
+		path := staffPath + "/" + cookID.String()
+
+		member := StaffResponse{}
+		f.owner.expect(t, http.StatusOK, http.MethodGet, path, nil).decode(t, &member)
+		assert.Equal(t, "cook", member.Username)
+		assert.Equal(t, models.StaffRoleKitchen, member.Role)
+		assert.True(t, member.Active)
+
+		username, displayName, role := "chef", "Chef Ando", models.StaffRoleManager
+		member = StaffResponse{}
+		f.owner.expect(t, http.StatusOK, http.MethodPatch, path, updateStaffMemberPayload{
+			Username:    &username,
+			DisplayName: &displayName,
+			Role:        &role,
+		}).decode(t, &member)
+		assert.Equal(t, "chef", member.Username)
+		assert.Equal(t, "Chef Ando", member.DisplayName)
+		assert.Equal(t, models.StaffRoleManager, member.Role)
+
+		staff := []StaffResponse{}
+		f.owner.expect(t, http.StatusOK, http.MethodGet, staffPath, nil).decode(t, &staff)
+		usernames := []string{}
+		for _, member := range staff {
+			usernames = append(usernames, member.Username)
+		}
+		assert.Equal(t, []string{"chef", "manager", "waiter"}, usernames)
+
+		// Staff are only managed by the owner of their restaurant
+		f.otherOwner.expect(t, http.StatusNotFound, http.MethodGet, path, nil)
+		f.otherOwner.expect(t, http.StatusNotFound, http.MethodPatch, path, updateStaffMemberPayload{DisplayName: &displayName})
+		f.otherOwner.expect(t, http.StatusNotFound, http.MethodGet, staffPath, nil)
+		f.owner.expect(t, http.StatusConflict, http.MethodPost, staffPath, registerStaffPayload{
+			Username: "chef",
+			Password: testPassword,
+			Role:     models.StaffRoleWaiter,
+		})
+	})
+
+	t.Run("resets passwords", func(t *testing.T) {
+		path := staffPath + "/" + f.owner.createStaff(t, f.restaurantID, "cashier", models.StaffRoleCashier).String()
+		cashier := f.server.signInStaff(t, f.restaurantID, "cashier")
+		cashier.expect(t, http.StatusOK, http.MethodGet, restaurantPath, nil)
+
+		f.owner.expect(t, http.StatusNoContent, http.MethodPost, path+"/reset-password", resetStaffPasswordPayload{Password: "new password"})
+
+		// The sessions signed in with the old password are revoked
+		cashier.expect(t, http.StatusUnauthorized, http.MethodGet, restaurantPath, nil)
+		response := signIn(t, "cashier", testPassword)
+		assert.Equal(t, http.StatusUnauthorized, response.Code)
+		assert.Equal(t, "invalid_credentials", errorCode(t, response))
+		assert.Equal(t, http.StatusOK, signIn(t, "cashier", "new password").Code)
+	})
+
+	t.Run("revokes sessions of deactivated staff", func(t *testing.T) {
+		path := staffPath + "/" + f.waiterID.String()
+		f.waiter.expect(t, http.StatusOK, http.MethodGet, restaurantPath, nil)
+
+		member := StaffResponse{}
+		f.owner.expect(t, http.StatusOK, http.MethodPost, path+"/deactivate", nil).decode(t, &member)
+		assert.False(t, member.Active)
+		assert.NotNil(t, member.DeactivatedAt)
+
+		f.waiter.expect(t, http.StatusUnauthorized, http.MethodGet, restaurantPath, nil)
+		response := signIn(t, "waiter", testPassword)
+		assert.Equal(t, http.StatusForbidden, response.Code)
+		assert.Equal(t, "staff_deactivated", errorCode(t, response))
+		assert.Equal(t, "already_inactive", errorCode(t, f.owner.expect(t, http.StatusConflict, http.MethodPost, path+"/deactivate", nil)))
+
+		member = StaffResponse{}
+		f.owner.expect(t, http.StatusOK, http.MethodPost, path+"/reactivate", nil).decode(t, &member)
+		assert.True(t, member.Active)
+		assert.Nil(t, member.DeactivatedAt)
+
+		// The revoked session stays revoked, the staff member signs in again
+		f.waiter.expect(t, http.StatusUnauthorized, http.MethodGet, restaurantPath, nil)
+		f.server.signInStaff(t, f.restaurantID, "waiter").expect(t, http.StatusOK, http.MethodGet, restaurantPath, nil)
+	})
+}
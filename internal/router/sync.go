@@ -0,0 +1,314 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/services"
+	"gorm.io/gorm"
+)
+
+// maxSyncMutations is the maximum number of mutations accepted in a single push.
+const maxSyncMutations = 100
+
+// syncCursorOverlap is how long before the cursor changes are pulled again. Rows are stamped before
+// their transaction commits, so a row stamped before a pull can become visible after it. Changes of
+// the overlap are sent twice, which clients handle by applying changes by ID.
+const syncCursorOverlap = time.Minute
+
+const (
+	syncMutationCreateOrder       = "create_order"
+	syncMutationAddOrderItems     = "add_order_items"
+	syncMutationUpdateOrderStatus = "update_order_status"
+)
+
+func bindSyncRouter(router *echo.Group) {
+	group := router.Group("/restaurants/:restaurant_id/sync")
+	group.POST("/push", pushSyncMutations)
+	group.GET("/pull", pullSyncChanges)
+}
+
+// syncMutation is a change queued by an offline client. Its ID is generated by the client and
+// makes pushing the same mutation more than once harmless.
+type syncMutation struct {
+	MutationID uuid.UUID       `json:"mutation_id" validate:"required"`
+	Type       string          `json:"type" validate:"required,oneof=create_order add_order_items update_order_status"`
+	Payload    json.RawMessage `json:"payload" validate:"required"`
+}
+
+type syncCreateOrderPayload struct {
+	OrderID     uuid.UUID            `json:"order_id" validate:"required"`
+	TableNumber string               `json:"table_number" validate:"required"`
+	Items       []syncOrderItemInput `json:"items" validate:"required,min=1,dive"`
+}
+
+type syncAddOrderItemsPayload struct {
+	OrderID uuid.UUID            `json:"order_id" validate:"required"`
+	Items   []syncOrderItemInput `json:"items" validate:"required,min=1,dive"`
+}
+
+// syncOrderItemInput is an item of an order pushed by an offline client. Unlike other clients,
+// offline clients choose the ID of items, so that pushing them again is detected.
+type syncOrderItemInput struct {
+	ItemID uuid.UUID `json:"item_id"`
+	orderItemInput
+}
+
+func newSyncOrderItems(inputs []syncOrderItemInput) []services.OrderItem {
+	items := make([]services.OrderItem, 0, len(inputs))
+	for _, input := range inputs {
+		items = append(items, services.OrderItem{
+			ItemID:    input.ItemID,
+			ProductID: input.ProductID,
+			Quantity:  input.Quantity,
+			Modifiers: input.Modifiers,
+		})
+	}
+	return items
+}
+
+type syncUpdateOrderStatusPayload struct {
+	OrderID uuid.UUID `json:"order_id" validate:"required"`
+	// From is the status the client saw when the change was made. It is used to detect
+	// changes made concurrently by someone else.
+	From models.OrderStatus `json:"from" validate:"required"`
+	To   models.OrderStatus `json:"to" validate:"required"`
+}
+
+// SyncMutationResult reports the outcome of a single pushed mutation.
+type SyncMutationResult struct {
+	MutationID uuid.UUID                 `json:"mutation_id"`
+	Status     models.SyncMutationStatus `json:"status"`
+	// Duplicate is set when the mutation had already been processed by an earlier push.
+	Duplicate bool   `json:"duplicate"`
+	Error     string `json:"error,omitempty"`
+	// Order is the server state of the affected order, so clients can resolve conflicts.
+	Order *OrderResponse `json:"order,omitempty"`
+}
+
+// SyncPullResponse lists everything that changed since the cursor sent by the client.
+type SyncPullResponse struct {
+	Cursor   string            `json:"cursor"`
+	Products []ProductResponse `json:"products"`
+	Tables   []TableResponse   `json:"tables"`
+	Orders   []OrderResponse   `json:"orders"`
+	Deleted  struct {
+		Products []uuid.UUID `json:"products"`
+		Tables   []uuid.UUID `json:"tables"`
+		Orders   []uuid.UUID `json:"orders"`
+	} `json:"deleted"`
+}
+
+type pushSyncMutationsPayload struct {
+	Mutations []syncMutation `json:"mutations" validate:"required,dive"`
+}
+
+func pushSyncMutations(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	payload := pushSyncMutationsPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+	if len(payload.Mutations) > maxSyncMutations {
+		return echo.ErrBadRequest
+	}
+
+	mutations := make([]services.SyncMutation, 0, len(payload.Mutations))
+	for _, mutation := range payload.Mutations {
+		mutations = append(mutations, services.SyncMutation{
+			ID:     mutation.MutationID,
+			Type:   mutation.Type,
+			Change: decodeSyncChange(ctx, mutation),
+		})
+	}
+
+	outcomes, err := ctx.(*routerContext).GetServices().Orders.Sync(ctx.Request().Context(), authUser.actor(), restaurantID, mutations)
+	if err != nil {
+		return err
+	}
+
+	results := make([]SyncMutationResult, 0, len(outcomes))
+	for i, outcome := range outcomes {
+		result := SyncMutationResult{
+			MutationID: mutations[i].ID,
+			Status:     outcome.Status,
+			Duplicate:  outcome.Duplicate,
+			Error:      outcome.Error,
+		}
+		if outcome.Order != nil {
+			response := newOrderResponse(outcome.Order)
+			result.Order = &response
+		}
+		results = append(results, result)
+	}
+
+	return ctx.JSON(http.StatusOK, map[string][]SyncMutationResult{
+		"results": results,
+	})
+}
+
+// decodeSyncChange decodes the payload of a mutation into the change of its type. Payloads which can't
+// be decoded are rejected when the mutation is applied, so that their outcome is recorded.
+func decodeSyncChange(ctx echo.Context, mutation syncMutation) services.SyncChange {
+	switch mutation.Type {
+	case syncMutationCreateOrder:
+		payload := syncCreateOrderPayload{}
+		if err := decodeSyncPayload(ctx, mutation.Payload, &payload); err != nil {
+			return services.SyncInvalid{Err: err}
+		}
+		return services.SyncCreateOrder{
+			OrderID:     payload.OrderID,
+			TableNumber: payload.TableNumber,
+			Items:       newSyncOrderItems(payload.Items),
+		}
+	case syncMutationAddOrderItems:
+		payload := syncAddOrderItemsPayload{}
+		if err := decodeSyncPayload(ctx, mutation.Payload, &payload); err != nil {
+			return services.SyncInvalid{Err: err}
+		}
+		return services.SyncAddOrderItems{
+			OrderID: payload.OrderID,
+			Items:   newSyncOrderItems(payload.Items),
+		}
+	case syncMutationUpdateOrderStatus:
+		payload := syncUpdateOrderStatusPayload{}
+		if err := decodeSyncPayload(ctx, mutation.Payload, &payload); err != nil {
+			return services.SyncInvalid{Err: err}
+		}
+		return services.SyncUpdateOrderStatus(payload)
+	}
+	return services.SyncInvalid{Err: errors.New("unknown mutation type")}
+}
+
+func decodeSyncPayload(ctx echo.Context, raw json.RawMessage, payload any) error {
+	if err := json.Unmarshal(raw, payload); err != nil {
+		return errors.New("malformed payload")
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return errors.New("invalid payload")
+	}
+	return nil
+}
+
+func pullSyncChanges(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	// An empty cursor means the client has nothing yet.
+	var since time.Time
+	if cursor := ctx.QueryParam("cursor"); cursor != "" {
+		since, err = parseSyncCursor(cursor)
+		if err != nil {
+			return echo.ErrBadRequest
+		}
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findAccessibleRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	// Rows written while the changes are being read will be part of the next pull, as well as rows
+	// committed late, within syncCursorOverlap.
+	until := db.Connection.NowFunc()
+
+	response := SyncPullResponse{
+		Cursor:   formatSyncCursor(until),
+		Products: make([]ProductResponse, 0),
+		Tables:   make([]TableResponse, 0),
+		Orders:   make([]OrderResponse, 0),
+	}
+	response.Deleted.Products = make([]uuid.UUID, 0)
+	response.Deleted.Tables = make([]uuid.UUID, 0)
+	response.Deleted.Orders = make([]uuid.UUID, 0)
+
+	changed := func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Unscoped().Where("restaurant_id = ? AND updated_at <= ?", restaurantID, until)
+		if since.IsZero() {
+			return tx.Where("deleted_at IS NULL")
+		}
+		from := since.Add(-syncCursorOverlap)
+		return tx.Where("updated_at > ? OR (deleted_at > ? AND deleted_at <= ?)", from, from, until)
+	}
+
+	products := make([]models.Product, 0)
+	if err := db.Connection.Scopes(changed).Find(&products).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+	for _, product := range products {
+		if product.DeletedAt.Valid {
+			response.Deleted.Products = append(response.Deleted.Products, product.ID)
+			continue
+		}
+		response.Products = append(response.Products, newProductResponse(&product))
+	}
+
+	tables := make([]models.Table, 0)
+	if err := db.Connection.Scopes(changed).Find(&tables).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+	for _, table := range tables {
+		if table.DeletedAt.Valid {
+			response.Deleted.Tables = append(response.Deleted.Tables, table.ID)
+			continue
+		}
+		response.Tables = append(response.Tables, newTableResponse(&table))
+	}
+
+	orders := make([]models.Order, 0)
+	query := db.Connection.Scopes(changed).Preload("OrderItems")
+	if since.IsZero() {
+		// Closed orders are only useful to clients that saw them open.
+		query = query.Where("status NOT IN ?", []models.OrderStatus{models.OrderStatusCompleted, models.OrderStatusCancelled})
+	}
+	if err := query.Find(&orders).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+	for _, order := range orders {
+		if order.DeletedAt.Valid {
+			response.Deleted.Orders = append(response.Deleted.Orders, order.ID)
+			continue
+		}
+		response.Orders = append(response.Orders, newOrderResponse(&order))
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+func formatSyncCursor(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 36)
+}
+
+func parseSyncCursor(cursor string) (time.Time, error) {
+	nanos, err := strconv.ParseInt(cursor, 36, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanos).UTC(), nil
+}
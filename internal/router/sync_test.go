@@ -0,0 +1,114 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSync(t *testing.T) {
+	f := newFixture(t)
+	pushPath := fmt.Sprintf("/api/restaurants/%s/sync/push", f.restaurantID)
+	pullPath := fmt.Sprintf("/api/restaurants/%s/sync/pull", f.restaurantID)
+
+	mutation := func(t *testing.T, kind string, payload any) syncMutation {
+		encoded, err := json.Marshal(payload)
+		require.NoError(t, err)
+		return syncMutation{MutationID: uuid.New(), Type: kind, Payload: encoded}
+	}
+	push := func(t *testing.T, mutations ...syncMutation) []SyncMutationResult {
+		body := struct {
+			Results []SyncMutationResult `json:"results"`
+		}{}
+		f.waiter.expect(t, http.StatusOK, http.MethodPost, pushPath, pushSyncMutationsPayload{Mutations: mutations}).decode(t, &body)
+		require.Len(t, body.Results, len(mutations))
+		return body.Results
+	}
+	countOrders := func(t *testing.T, id uuid.UUID) int64 {
+		var count int64
+		require.NoError(t, f.server.db.Connection.Model(&models.Order{}).Where("id = ?", id).Count(&count).Error)
+		return count
+	}
+
+	orderID, itemID := uuid.Must(uuid.NewV7()), uuid.Must(uuid.NewV7())
+	create := mutation(t, syncMutationCreateOrder, syncCreateOrderPayload{
+		OrderID:     orderID,
+		TableNumber: "4",
+		Items:       []syncOrderItemInput{{ItemID: itemID, orderItemInput: orderItemInput{ProductID: f.productID, Quantity: 1}}},
+	})
+
+	t.Run("applies mutations once", func(t *testing.T) {
+		result := push(t, create)[0]
+		assert.Equal(t, models.SyncMutationApplied, result.Status)
+		assert.False(t, result.Duplicate)
+		require.NotNil(t, result.Order)
+		require.Len(t, result.Order.Items, 1)
+		assert.Equal(t, itemID, result.Order.Items[0].ItemID)
+
+		// The client did not get the response and pushes again
+		result = push(t, create)[0]
+		assert.Equal(t, models.SyncMutationApplied, result.Status)
+		assert.True(t, result.Duplicate)
+		assert.Equal(t, orderID, result.Order.OrderID)
+		assert.EqualValues(t, 1, countOrders(t, orderID))
+	})
+
+	t.Run("reports conflicts with the server state", func(t *testing.T) {
+		// Another client created the same order
+		result := push(t, mutation(t, syncMutationCreateOrder, syncCreateOrderPayload{
+			OrderID:     orderID,
+			TableNumber: "5",
+			Items:       []syncOrderItemInput{{orderItemInput: orderItemInput{ProductID: f.productID, Quantity: 2}}},
+		}))[0]
+		assert.Equal(t, models.SyncMutationConflict, result.Status)
+		assert.Equal(t, "4", result.Order.TableNumber)
+
+		// Items already pushed under another mutation
+		result = push(t, mutation(t, syncMutationAddOrderItems, syncAddOrderItemsPayload{
+			OrderID: orderID,
+			Items:   []syncOrderItemInput{{ItemID: itemID, orderItemInput: orderItemInput{ProductID: f.productID, Quantity: 1}}},
+		}))[0]
+		assert.Equal(t, models.SyncMutationConflict, result.Status)
+		assert.Len(t, result.Order.Items, 1)
+
+		// Status changed on the server since the client saw the order
+		f.manager.expect(t, http.StatusOK, http.MethodPut, fmt.Sprintf("/api/orders/%s/status", orderID), updateOrderStatusPayload{Status: models.OrderStatusConfirmed})
+		result = push(t, mutation(t, syncMutationUpdateOrderStatus, syncUpdateOrderStatusPayload{
+			OrderID: orderID, From: models.OrderStatusPending, To: models.OrderStatusCancelled,
+		}))[0]
+		assert.Equal(t, models.SyncMutationConflict, result.Status)
+		assert.Equal(t, models.OrderStatusConfirmed, result.Order.Status)
+
+		// The same change was already made on the server
+		result = push(t, mutation(t, syncMutationUpdateOrderStatus, syncUpdateOrderStatusPayload{
+			OrderID: orderID, From: models.OrderStatusPending, To: models.OrderStatusConfirmed,
+		}))[0]
+		assert.Equal(t, models.SyncMutationApplied, result.Status)
+	})
+
+	t.Run("pulls rows committed after the previous pull", func(t *testing.T) {
+		pull := SyncPullResponse{}
+		f.waiter.expect(t, http.StatusOK, http.MethodGet, pullPath, nil).decode(t, &pull)
+		cursor, err := parseSyncCursor(pull.Cursor)
+		require.NoError(t, err)
+
+		// A product stamped before the cursor, whose transaction committed after the pull
+		productID := f.owner.createProduct(t, f.restaurantID, "Gyoza", 6)
+		require.NoError(t, f.server.db.Connection.Model(&models.Product{}).Where("id = ?", productID).
+			UpdateColumn("updated_at", cursor.Add(-time.Second)).Error)
+
+		f.waiter.expect(t, http.StatusOK, http.MethodGet, pullPath+"?cursor="+pull.Cursor, nil).decode(t, &pull)
+		ids := []uuid.UUID{}
+		for _, product := range pull.Products {
+			ids = append(ids, product.ProductID)
+		}
+		assert.Contains(t, ids, productID)
+	})
+}
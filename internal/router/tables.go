@@ -0,0 +1,293 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/qr"
+	"github.com/roushou/pocpoc/internal/security"
+	"gorm.io/gorm"
+)
+
+func bindTablesRouter(router *echo.Group) {
+	group := router.Group("/restaurants/:restaurant_id/tables")
+	group.GET("", getTables)
+	group.POST("", registerTable)
+	group.DELETE("/:table_id", deleteTable)
+	group.GET("/:table_id/token", getTableToken)
+	group.POST("/:table_id/token", rotateTableToken)
+	group.GET("/:table_id/qr", getTableQRCode)
+}
+
+const (
+	defaultQRCodeSize = 512
+	maxQRCodeSize     = 2048
+)
+
+// TableTokenResponse is the token guests order with at a table, and the URL its QR code links to.
+type TableTokenResponse struct {
+	TableID uuid.UUID `json:"table_id"`
+	Token   string    `json:"token"`
+	URL     string    `json:"url"`
+}
+
+// TableResponse maps fields of Table model we are willing to expose.
+type TableResponse struct {
+	TableID      uuid.UUID `json:"table_id"`
+	RestaurantID uuid.UUID `json:"restaurant_id"`
+	Number       string    `json:"number"`
+	Seats        uint32    `json:"seats"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func newTableResponse(table *models.Table) TableResponse {
+	return TableResponse{
+		TableID:      table.ID,
+		RestaurantID: table.RestaurantID,
+		Number:       table.Number,
+		Seats:        table.Seats,
+		CreatedAt:    table.CreatedAt,
+		UpdatedAt:    table.UpdatedAt,
+	}
+}
+
+// tablesList are the pages of tables of a restaurant.
+var tablesList = &listSpec{sorts: []string{"number", "seats"}, defaultSort: "number"}
+
+func getTables(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findAccessibleRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	rows, err := findPage[models.Table](ctx, tablesList, db.Connection.Where("restaurant_id = ?", restaurantID), time.UTC)
+	if err != nil {
+		return err
+	}
+
+	tables := make([]TableResponse, 0, len(rows))
+	for _, table := range rows {
+		tables = append(tables, newTableResponse(&table))
+	}
+
+	return ctx.JSON(http.StatusOK, tables)
+}
+
+type registerTablePayload struct {
+	Number string `json:"number" validate:"required"`
+	Seats  uint32 `json:"seats"`
+}
+
+func registerTable(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := registerTablePayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	// Only owners can register tables of their own restaurant
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	table := &models.Table{
+		RestaurantID: restaurantID,
+		Number:       payload.Number,
+		Seats:        payload.Seats,
+	}
+	if err := db.Connection.Create(table).Error; err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, map[string]string{
+		"table_id": table.ID.String(),
+	})
+}
+
+func deleteTable(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	tableID, err := uuid.Parse(ctx.Param("table_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	tx := db.Connection.
+		Where("id = ? AND restaurant_id = ?", tableID, restaurantID).
+		Delete(&models.Table{})
+	if tx.Error != nil {
+		return echo.ErrInternalServerError
+	}
+	if tx.RowsAffected == 0 {
+		return echo.ErrNotFound
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// newTableTokenResponse returns the current token of the table. Codes link to the guest ordering app,
+// or to the public menu of the table when there is none.
+func newTableTokenResponse(ctx echo.Context, table *models.Table) TableTokenResponse {
+	token := security.NewTableToken(table.ID, table.TokenVersion, ctx.(*routerContext).GetTableTokenKey())
+	url := ctx.(*routerContext).GetGuestOrderingURL()
+	if url == "" {
+		url = ctx.Scheme() + "://" + ctx.Request().Host + "/api/public/tables/" + token + "/menu"
+	} else {
+		url += "/" + token
+	}
+	return TableTokenResponse{TableID: table.ID, Token: token, URL: url}
+}
+
+// findAccessibleTable returns the table from the path if the auth user can access its restaurant.
+// Only owners can access tables when owned is set.
+func findAccessibleTable(ctx echo.Context, user *authUser, owned bool) (*models.Table, error) {
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return nil, echo.ErrBadRequest
+	}
+	tableID, err := uuid.Parse(ctx.Param("table_id"))
+	if err != nil {
+		return nil, echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if owned {
+		_, err = findOwnedRestaurant(ctx, user, restaurantID)
+	} else {
+		_, err = findAccessibleRestaurant(ctx, user, restaurantID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	table := &models.Table{}
+	if err := db.Connection.
+		Where("id = ? AND restaurant_id = ?", tableID, restaurantID).
+		First(table).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.ErrNotFound
+		}
+		return nil, echo.ErrInternalServerError
+	}
+	return table, nil
+}
+
+func getTableToken(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	table, err := findAccessibleTable(ctx, authUser, true)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, newTableTokenResponse(ctx, table))
+}
+
+// rotateTableToken issues a new token for the table, which revokes the printed QR codes of the table.
+func rotateTableToken(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	table, err := findAccessibleTable(ctx, authUser, true)
+	if err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	table.TokenVersion++
+	if err := db.Connection.
+		Model(table).
+		Update("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, newTableTokenResponse(ctx, table))
+}
+
+// getTableQRCode renders the QR code guests scan to order at the table, as a PNG or SVG image depending
+// on `format`, which defaults to PNG. `size` is the width of the image in pixels.
+func getTableQRCode(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	format := qr.FormatPNG
+	if param := ctx.QueryParam("format"); param != "" {
+		format = qr.Format(param)
+	}
+	if !format.IsValid() {
+		return echo.ErrBadRequest
+	}
+	size := defaultQRCodeSize
+	if param := ctx.QueryParam("size"); param != "" {
+		size, err = strconv.Atoi(param)
+		if err != nil || size < 64 || size > maxQRCodeSize {
+			return echo.ErrBadRequest
+		}
+	}
+
+	table, err := findAccessibleTable(ctx, authUser, false)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := qr.Write(&buf, newTableTokenResponse(ctx, table).URL, format, size); err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.Blob(http.StatusOK, format.ContentType(), buf.Bytes())
+}
@@ -0,0 +1,320 @@
+package router
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/security"
+	"gorm.io/gorm"
+)
+
+// terminalTokenHeader is the header in which terminals send the device token issued at registration.
+const terminalTokenHeader = "X-Terminal-Token"
+
+type terminalContextKey string
+
+const terminalKey terminalContextKey = "terminal"
+
+// bindTerminalsRouter binds the routes used by owners to manage the terminals of their restaurants.
+func bindTerminalsRouter(router *echo.Group) {
+	group := router.Group("/restaurants/:restaurant_id/terminals")
+	group.GET("", getTerminals)
+	group.POST("", registerTerminal)
+	group.POST("/:terminal_id/revoke", revokeTerminal)
+}
+
+// bindTerminalRouter binds the routes used by registered terminals, which authenticate with their device token.
+func bindTerminalRouter(router *echo.Group) {
+	group := router.Group("/terminal")
+	group.Use(TerminalMiddleware())
+	group.GET("/staff", getTerminalStaff)
+	group.POST("/pin-sign-in", signInStaffWithPin)
+}
+
+// TerminalResponse maps fields of Terminal model we are willing to expose.
+type TerminalResponse struct {
+	TerminalID   uuid.UUID  `json:"terminal_id"`
+	RestaurantID uuid.UUID  `json:"restaurant_id"`
+	Name         string     `json:"name"`
+	LastSeenAt   *time.Time `json:"last_seen_at,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func newTerminalResponse(terminal *models.Terminal) TerminalResponse {
+	return TerminalResponse{
+		TerminalID:   terminal.ID,
+		RestaurantID: terminal.RestaurantID,
+		Name:         terminal.Name,
+		LastSeenAt:   terminal.LastSeenAt,
+		RevokedAt:    terminal.RevokedAt,
+		CreatedAt:    terminal.CreatedAt,
+		UpdatedAt:    terminal.UpdatedAt,
+	}
+}
+
+// TerminalMiddleware authenticates terminals with the device token they were issued.
+func TerminalMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			rc, ok := ctx.(*routerContext)
+			if !ok {
+				return echo.ErrInternalServerError
+			}
+
+			token := ctx.Request().Header.Get(terminalTokenHeader)
+			if token == "" {
+				return echo.ErrUnauthorized
+			}
+
+			db := rc.GetDatabase()
+
+			terminal := &models.Terminal{}
+			if err := db.Connection.
+				Where("token_hash = ?", security.HashToken(token)).
+				First(terminal).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return echo.ErrUnauthorized
+				}
+				return echo.ErrInternalServerError
+			}
+			if terminal.IsRevoked() {
+				return echo.ErrUnauthorized
+			}
+			if rc.options.terminalCertificates && !hasTerminalCertificate(ctx.Request().TLS, terminal.ID) {
+				return echo.ErrUnauthorized
+			}
+
+			if err := db.Connection.
+				Model(terminal).
+				UpdateColumn("last_seen_at", db.Connection.NowFunc()).Error; err != nil {
+				return echo.ErrInternalServerError
+			}
+
+			rc.Set(string(terminalKey), terminal)
+			return next(rc)
+		}
+	}
+}
+
+// hasTerminalCertificate reports whether the connection was made with a verified client certificate
+// issued to the terminal, i.e. whose common name is its ID.
+func hasTerminalCertificate(connection *tls.ConnectionState, terminalID uuid.UUID) bool {
+	if connection == nil || len(connection.VerifiedChains) == 0 || len(connection.VerifiedChains[0]) == 0 {
+		return false
+	}
+	return connection.VerifiedChains[0][0].Subject.CommonName == terminalID.String()
+}
+
+func getTerminal(ctx echo.Context) (*models.Terminal, error) {
+	terminal, ok := ctx.Get(string(terminalKey)).(*models.Terminal)
+	if !ok {
+		return nil, errors.New("failed to retrieve terminal")
+	}
+	return terminal, nil
+}
+
+// terminalsList are the pages of terminals of a restaurant.
+var terminalsList = &listSpec{sorts: []string{"name", "created_at"}, defaultSort: "name"}
+
+func getTerminals(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	rows, err := findPage[models.Terminal](ctx, terminalsList, db.Connection.Where("restaurant_id = ?", restaurantID), time.UTC)
+	if err != nil {
+		return err
+	}
+
+	terminals := make([]TerminalResponse, 0, len(rows))
+	for _, terminal := range rows {
+		terminals = append(terminals, newTerminalResponse(&terminal))
+	}
+
+	return ctx.JSON(http.StatusOK, terminals)
+}
+
+type registerTerminalPayload struct {
+	Name string `json:"name" validate:"required"`
+}
+
+// registerTerminal registers a terminal for a restaurant. The device token is only returned once,
+// it must be stored by the terminal and sent in the X-Terminal-Token header.
+func registerTerminal(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := registerTerminalPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	// Only owners can register terminals for their own restaurant
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	token, err := security.GenerateToken()
+	if err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	terminal := &models.Terminal{
+		RestaurantID: restaurantID,
+		Name:         payload.Name,
+		TokenHash:    security.HashToken(token),
+	}
+	if err := db.Connection.Create(terminal).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusCreated, map[string]string{
+		"terminal_id":  terminal.ID.String(),
+		"device_token": token,
+	})
+}
+
+// revokeTerminal revokes a terminal, which signs out the staff using it.
+func revokeTerminal(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	terminalID, err := uuid.Parse(ctx.Param("terminal_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findOwnedRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	terminal := &models.Terminal{}
+	if err := db.Connection.
+		Where("id = ? AND restaurant_id = ?", terminalID, restaurantID).
+		First(terminal).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.ErrNotFound
+		}
+		return echo.ErrInternalServerError
+	}
+	if terminal.IsRevoked() {
+		return echo.ErrConflict
+	}
+
+	if err := db.Connection.Model(terminal).Update("revoked_at", db.Connection.NowFunc()).Error; err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, newTerminalResponse(terminal))
+}
+
+// TerminalStaffResponse is a staff member listed on terminals, without anything but what the sign-in
+// screen shows.
+type TerminalStaffResponse struct {
+	StaffID     uuid.UUID        `json:"staff_id"`
+	Username    string           `json:"username"`
+	DisplayName string           `json:"display_name"`
+	Role        models.StaffRole `json:"role"`
+}
+
+// terminalStaffList are the pages of staff who can sign in on a terminal.
+var terminalStaffList = &listSpec{sorts: []string{"username", "display_name"}, defaultSort: "username"}
+
+// getTerminalStaff lists the staff who can sign in on the terminal with their PIN.
+func getTerminalStaff(ctx echo.Context) error {
+	terminal, err := getTerminal(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	rows, err := findPage[models.Staff](ctx, terminalStaffList, db.Connection.Where("restaurant_id = ? AND deactivated_at IS NULL AND pin_hash <> ''", terminal.RestaurantID), time.UTC)
+	if err != nil {
+		return err
+	}
+
+	staff := make([]TerminalStaffResponse, 0, len(rows))
+	for _, member := range rows {
+		staff = append(staff, TerminalStaffResponse{
+			StaffID:     member.ID,
+			Username:    member.Username,
+			DisplayName: member.DisplayName,
+			Role:        member.Role,
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, staff)
+}
+
+type signInStaffWithPinPayload struct {
+	StaffID uuid.UUID `json:"staff_id" validate:"required"`
+	Pin     string    `json:"pin" validate:"required"`
+}
+
+// signInStaffWithPin signs in a staff member on a terminal. PIN sign-in is locked for a while
+// after too many wrong PINs.
+func signInStaffWithPin(ctx echo.Context) error {
+	terminal, err := getTerminal(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	payload := signInStaffWithPinPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	staff, err := ctx.(*routerContext).GetServices().Auth.SignInStaffWithPin(ctx.Request().Context(), terminal.RestaurantID, payload.StaffID, payload.Pin)
+	if err != nil {
+		return err
+	}
+
+	if err := setAuthCookie(ctx, newTerminalJWTClaims(staff.ID, staff.TokenVersion, terminal.ID)); err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, map[string]string{"message": "success"})
+}
@@ -0,0 +1,126 @@
+package router
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerminalCertificates(t *testing.T) {
+	server := newTestServer(t, WithTerminalCertificates())
+	owner := server.signUpOwner(t, "owner")
+	restaurantID := owner.createRestaurant(t, "Ramen House")
+
+	response := owner.expect(t, http.StatusCreated, http.MethodPost, "/api/restaurants/"+restaurantID.String()+"/terminals", registerTerminalPayload{Name: "Counter"})
+	terminal := struct {
+		TerminalID  uuid.UUID `json:"terminal_id"`
+		DeviceToken string    `json:"device_token"`
+	}{}
+	response.decode(t, &terminal)
+
+	// send sends the request with a client certificate issued to commonName, if any
+	send := func(request *http.Request, commonName string) *httptest.ResponseRecorder {
+		if commonName != "" {
+			certificate := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+			request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate}}}
+		}
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	listStaff := func(commonName string) int {
+		request := httptest.NewRequest(http.MethodGet, "/api/terminal/staff", nil)
+		request.Header.Set(terminalTokenHeader, terminal.DeviceToken)
+		return send(request, commonName).Code
+	}
+	assert.Equal(t, http.StatusOK, listStaff(terminal.TerminalID.String()))
+	assert.Equal(t, http.StatusUnauthorized, listStaff(""))
+	assert.Equal(t, http.StatusUnauthorized, listStaff(uuid.NewString()))
+
+	// Sessions of staff signed in on the terminal are only accepted with its certificate too
+	staffID := owner.createStaff(t, restaurantID, "waiter", models.StaffRoleWaiter)
+	owner.expect(t, http.StatusNoContent, http.MethodPut, fmt.Sprintf("/api/restaurants/%s/staff/%s/pin", restaurantID, staffID), setStaffPinPayload{Pin: "1234"})
+	payload, err := json.Marshal(signInStaffWithPinPayload{StaffID: staffID, Pin: "1234"})
+	require.NoError(t, err)
+	request := httptest.NewRequest(http.MethodPost, "/api/terminal/pin-sign-in", bytes.NewReader(payload))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(terminalTokenHeader, terminal.DeviceToken)
+	signedIn := send(request, terminal.TerminalID.String())
+	require.Equal(t, http.StatusOK, signedIn.Code, signedIn.Body.String())
+
+	getRestaurant := func(commonName string) int {
+		request := httptest.NewRequest(http.MethodGet, "/api/restaurants/"+restaurantID.String(), nil)
+		for _, cookie := range signedIn.Result().Cookies() {
+			request.AddCookie(cookie)
+		}
+		return send(request, commonName).Code
+	}
+	assert.Equal(t, http.StatusOK, getRestaurant(terminal.TerminalID.String()))
+	assert.Equal(t, http.StatusUnauthorized, getRestaurant(""))
+	assert.Equal(t, http.StatusUnauthorized, getRestaurant(uuid.NewString()))
+}
+
+func TestPinSignInLockout(t *testing.T) {
+	f := newFixture(t)
+	// Requests share a single connection, as when SQLite serializes the writers, while the PIN
+	// checks still interleave
+	sqlDB, err := f.server.db.Connection.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	response := f.owner.expect(t, http.StatusCreated, http.MethodPost, "/api/restaurants/"+f.restaurantID.String()+"/terminals", registerTerminalPayload{Name: "Counter"})
+	terminal := struct {
+		DeviceToken string `json:"device_token"`
+	}{}
+	response.decode(t, &terminal)
+	f.owner.expect(t, http.StatusNoContent, http.MethodPut, fmt.Sprintf("/api/restaurants/%s/staff/%s/pin", f.restaurantID, f.waiterID), setStaffPinPayload{Pin: "1234"})
+
+	header := http.Header{}
+	header.Set(terminalTokenHeader, terminal.DeviceToken)
+	signIn := func(pin string) int {
+		return f.server.client().do(t, http.MethodPost, "/api/terminal/pin-sign-in", signInStaffWithPinPayload{StaffID: f.waiterID, Pin: pin}, header).Code
+	}
+
+	const attempts = 3 * services.MaxFailedPinAttempts
+	codes := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- signIn("0000")
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	assert.Equal(t, map[int]int{
+		http.StatusUnauthorized:    services.MaxFailedPinAttempts,
+		http.StatusTooManyRequests: attempts - services.MaxFailedPinAttempts,
+	}, counts)
+	assert.Equal(t, http.StatusTooManyRequests, signIn("1234"))
+
+	// The lockout is lifted once it expires
+	require.NoError(t, f.server.db.Connection.Model(&models.Staff{}).Where("id = ?", f.waiterID).
+		UpdateColumn("pin_locked_until", time.Now().UTC().Add(-time.Second)).Error)
+	assert.Equal(t, http.StatusOK, signIn("1234"))
+}
@@ -2,8 +2,12 @@ package router
 
 import (
 	"errors"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/services"
 )
 
 func getAuthUser(ctx echo.Context) (*authUser, error) {
@@ -13,3 +17,57 @@ func getAuthUser(ctx echo.Context) (*authUser, error) {
 	}
 	return &authUser, nil
 }
+
+// actor returns the auth user as the actor of services.
+func (u *authUser) actor() services.Actor {
+	return services.Actor(*u)
+}
+
+// findRestaurantStaff returns the staff member matching the auth user, with their restaurant, if they
+// work at the restaurant.
+func findRestaurantStaff(ctx echo.Context, user *authUser, restaurantID uuid.UUID) (*models.Staff, error) {
+	return ctx.(*routerContext).GetServices().Staff.Member(ctx.Request().Context(), user.actor(), restaurantID)
+}
+
+// findAccessibleRestaurant returns the restaurant if the auth user owns it or works at it.
+func findAccessibleRestaurant(ctx echo.Context, user *authUser, restaurantID uuid.UUID) (*models.Restaurant, error) {
+	return ctx.(*routerContext).GetServices().Restaurants.Get(ctx.Request().Context(), user.actor(), restaurantID)
+}
+
+// findOwnedRestaurant returns the restaurant if the auth user is its owner.
+func findOwnedRestaurant(ctx echo.Context, user *authUser, restaurantID uuid.UUID) (*models.Restaurant, error) {
+	return ctx.(*routerContext).GetServices().Restaurants.GetOwned(ctx.Request().Context(), user.actor(), restaurantID)
+}
+
+// dateLayout is the layout of dates in query parameters.
+const dateLayout = "2006-01-02"
+
+// parseDateRange parses the `from` and `to` query parameters as dates in the given location. The
+// returned range starts at the beginning of `from` and ends at the end of `to`. Missing dates default
+// to today.
+func parseDateRange(ctx echo.Context, location *time.Location, now time.Time) (time.Time, time.Time, error) {
+	today := now.In(location).Format(dateLayout)
+
+	fromParam := ctx.QueryParam("from")
+	if fromParam == "" {
+		fromParam = today
+	}
+	toParam := ctx.QueryParam("to")
+	if toParam == "" {
+		toParam = today
+	}
+
+	from, err := time.ParseInLocation(dateLayout, fromParam, location)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := time.ParseInLocation(dateLayout, toParam, location)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, errors.New("invalid date range")
+	}
+
+	return from, to.AddDate(0, 0, 1), nil
+}
@@ -0,0 +1,295 @@
+package router
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/roushou/pocpoc/internal/models"
+	"gorm.io/gorm"
+)
+
+func bindZReportsRouter(router *echo.Group) {
+	group := router.Group("/restaurants/:restaurant_id/z-reports")
+	group.GET("", getZReports)
+	group.POST("", closeBusinessDay)
+	group.GET("/:business_date", getZReport)
+}
+
+var errCashSessionsOpen = errors.New("cash drawer sessions are still open")
+
+// ZReportResponse maps fields of ZReport model we are willing to expose.
+type ZReportResponse struct {
+	ReportID     uuid.UUID             `json:"report_id"`
+	RestaurantID uuid.UUID             `json:"restaurant_id"`
+	BusinessDate string                `json:"business_date"`
+	TimeZone     string                `json:"time_zone"`
+	PeriodStart  time.Time             `json:"period_start"`
+	PeriodEnd    time.Time             `json:"period_end"`
+	ClosedByID   uuid.UUID             `json:"closed_by_id"`
+	CreatedAt    time.Time             `json:"created_at"`
+	Summary      models.ZReportSummary `json:"summary"`
+}
+
+func newZReportResponse(report *models.ZReport) ZReportResponse {
+	return ZReportResponse{
+		ReportID:     report.ID,
+		RestaurantID: report.RestaurantID,
+		BusinessDate: report.BusinessDate,
+		TimeZone:     report.TimeZone,
+		PeriodStart:  report.PeriodStart,
+		PeriodEnd:    report.PeriodEnd,
+		ClosedByID:   report.ClosedByID,
+		CreatedAt:    report.CreatedAt,
+		Summary:      report.Summary,
+	}
+}
+
+// findDayClosingRestaurant returns the restaurant if the auth user can close its business day: its
+// owner or one of its managers.
+func findDayClosingRestaurant(ctx echo.Context, user *authUser, restaurantID uuid.UUID) (*models.Restaurant, error) {
+	if user.Role == models.RoleOwner {
+		return findOwnedRestaurant(ctx, user, restaurantID)
+	}
+	staff, err := findRestaurantStaff(ctx, user, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	if staff.Role != models.StaffRoleManager {
+		return nil, echo.ErrForbidden
+	}
+	return &staff.Restaurant, nil
+}
+
+// summarizeBusinessDay sums the activity of the restaurant between start and end. Orders and payments
+// are counted on the day they were created, cash sessions on the day they were closed.
+func summarizeBusinessDay(tx *gorm.DB, restaurantID uuid.UUID, start, end time.Time) (models.ZReportSummary, error) {
+	summary := models.ZReportSummary{Payments: make([]models.ZReportPaymentSummary, 0)}
+	start, end = start.UTC(), end.UTC()
+
+	orders := struct {
+		Count     int64
+		Net       float64
+		Discounts float64
+		Taxes     float64
+	}{}
+	if err := tx.
+		Model(&models.Order{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(total_amount), 0) AS net, COALESCE(SUM(discount_amount), 0) AS discounts, COALESCE(SUM(tax_amount), 0) AS taxes").
+		Where("restaurant_id = ? AND created_at >= ? AND created_at < ? AND status <> ?", restaurantID, start, end, models.OrderStatusCancelled).
+		Scan(&orders).Error; err != nil {
+		return summary, err
+	}
+	summary.OrdersCount = orders.Count
+	summary.NetSales = models.RoundAmount(orders.Net)
+	summary.Discounts = models.RoundAmount(orders.Discounts)
+	summary.GrossSales = models.RoundAmount(orders.Net + orders.Discounts)
+	summary.Taxes = models.RoundAmount(orders.Taxes)
+
+	voids := struct {
+		Count  int64
+		Amount float64
+	}{}
+	if err := tx.
+		Model(&models.Order{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(total_amount), 0) AS amount").
+		Where("restaurant_id = ? AND created_at >= ? AND created_at < ? AND status = ?", restaurantID, start, end, models.OrderStatusCancelled).
+		Scan(&voids).Error; err != nil {
+		return summary, err
+	}
+	summary.Voids = models.ZReportVoidSummary{Count: voids.Count, Amount: models.RoundAmount(voids.Amount)}
+
+	payments := make([]struct {
+		Method models.PaymentMethod
+		Count  int64
+		Amount float64
+		Tips   float64
+	}, 0)
+	if err := tx.
+		Model(&models.Payment{}).
+		Select("method, COUNT(*) AS count, COALESCE(SUM(amount), 0) AS amount, COALESCE(SUM(tip_amount), 0) AS tips").
+		Where("restaurant_id = ? AND created_at >= ? AND created_at < ?", restaurantID, start, end).
+		Group("method").
+		Order("method").
+		Scan(&payments).Error; err != nil {
+		return summary, err
+	}
+	tips := 0.0
+	for _, payment := range payments {
+		summary.Payments = append(summary.Payments, models.ZReportPaymentSummary{
+			Method: payment.Method,
+			Count:  payment.Count,
+			Amount: models.RoundAmount(payment.Amount),
+			Tips:   models.RoundAmount(payment.Tips),
+		})
+		tips += payment.Tips
+	}
+	summary.Tips = models.RoundAmount(tips)
+
+	cash := struct {
+		Count    int64
+		Expected float64
+		Counted  float64
+		Variance float64
+	}{}
+	if err := tx.
+		Model(&models.CashSession{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(expected_amount), 0) AS expected, COALESCE(SUM(counted_amount), 0) AS counted, COALESCE(SUM(variance), 0) AS variance").
+		Where("restaurant_id = ? AND closed_at >= ? AND closed_at < ?", restaurantID, start, end).
+		Scan(&cash).Error; err != nil {
+		return summary, err
+	}
+	summary.Cash = models.ZReportCashSummary{
+		Sessions: cash.Count,
+		Expected: models.RoundAmount(cash.Expected),
+		Counted:  models.RoundAmount(cash.Counted),
+		Variance: models.RoundAmount(cash.Variance),
+	}
+
+	return summary, nil
+}
+
+// zReportsList are the pages of end of day reports of a restaurant, the latest business day first.
+var zReportsList = &listSpec{sorts: []string{"business_date"}, defaultSort: "-business_date"}
+
+func getZReports(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findDayClosingRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	rows, err := findPage[models.ZReport](ctx, zReportsList, db.Connection.Where("restaurant_id = ?", restaurantID), time.UTC)
+	if err != nil {
+		return err
+	}
+
+	reports := make([]ZReportResponse, 0, len(rows))
+	for _, report := range rows {
+		reports = append(reports, newZReportResponse(&report))
+	}
+
+	return ctx.JSON(http.StatusOK, reports)
+}
+
+func getZReport(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	if _, err := findDayClosingRestaurant(ctx, authUser, restaurantID); err != nil {
+		return err
+	}
+
+	report := &models.ZReport{}
+	if err := db.Connection.
+		Where("restaurant_id = ? AND business_date = ?", restaurantID, ctx.Param("business_date")).
+		First(report).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.ErrNotFound
+		}
+		return echo.ErrInternalServerError
+	}
+
+	return ctx.JSON(http.StatusOK, newZReportResponse(report))
+}
+
+type closeBusinessDayPayload struct {
+	BusinessDate string `json:"business_date" validate:"omitempty,datetime=2006-01-02"`
+}
+
+// closeBusinessDay produces the Z report of a business day, in the restaurant time zone. All cash
+// drawers must be closed first, and a day can only be closed once.
+func closeBusinessDay(ctx echo.Context) error {
+	authUser, err := getAuthUser(ctx)
+	if err != nil {
+		return echo.ErrUnauthorized
+	}
+
+	restaurantID, err := uuid.Parse(ctx.Param("restaurant_id"))
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	payload := closeBusinessDayPayload{}
+	if err := ctx.Bind(&payload); err != nil {
+		return echo.ErrBadRequest
+	}
+	if err := ctx.Validate(payload); err != nil {
+		return err
+	}
+
+	db := ctx.(*routerContext).GetDatabase()
+
+	restaurant, err := findDayClosingRestaurant(ctx, authUser, restaurantID)
+	if err != nil {
+		return err
+	}
+
+	location := restaurant.Location()
+	now := db.Connection.NowFunc()
+	if payload.BusinessDate == "" {
+		payload.BusinessDate = now.In(location).Format(dateLayout)
+	}
+	start, err := time.ParseInLocation(dateLayout, payload.BusinessDate, location)
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	// A day that hasn't started can't be closed
+	if start.After(now) {
+		return echo.ErrBadRequest
+	}
+	end := start.AddDate(0, 0, 1)
+
+	report := &models.ZReport{
+		RestaurantID: restaurantID,
+		BusinessDate: payload.BusinessDate,
+		TimeZone:     location.String(),
+		PeriodStart:  start.UTC(),
+		PeriodEnd:    end.UTC(),
+		ClosedByID:   authUser.UserID,
+	}
+	err = db.Connection.Transaction(func(tx *gorm.DB) error {
+		var open int64
+		if err := tx.
+			Model(&models.CashSession{}).
+			Where("restaurant_id = ? AND closed_at IS NULL AND opened_at < ?", restaurantID, end.UTC()).
+			Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			return errCashSessionsOpen
+		}
+
+		report.Summary, err = summarizeBusinessDay(tx, restaurantID, start, end)
+		if err != nil {
+			return err
+		}
+		return tx.Create(report).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusCreated, newZReportResponse(report))
+}
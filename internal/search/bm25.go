@@ -0,0 +1,49 @@
+package search
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Parameters of BM25, the same as the bm25 function of FTS5.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// bm25 returns the BM25 score of a row from its FTS4 matchinfo with the 'pcnalx' format, weighting
+// its columns. Higher scores are better matches, unlike the bm25 function of FTS5 whose scores are
+// negated. See https://sqlite.org/fts3.html#matchinfo.
+func bm25(info []byte, weights []float64) float64 {
+	values := make([]float64, len(info)/4)
+	for i := range values {
+		values[i] = float64(binary.NativeEndian.Uint32(info[4*i:]))
+	}
+	if len(values) < 3 {
+		return 0
+	}
+
+	phrases, columns, rows := int(values[0]), int(values[1]), values[2]
+	if len(values) < 3+2*columns+3*phrases*columns || len(weights) < columns {
+		return 0
+	}
+	averages, lengths, hits := values[3:3+columns], values[3+columns:3+2*columns], values[3+2*columns:]
+
+	score := 0.0
+	for phrase := range phrases {
+		for column := range columns {
+			// Hits of the phrase in the column of the row, and number of rows with hits in the column
+			hit := hits[3*(phrase*columns+column):]
+			frequency, matching := hit[0], hit[2]
+			if frequency == 0 || weights[column] == 0 {
+				continue
+			}
+
+			// Phrases in most rows are still worth a little, like in FTS5
+			idf := math.Max(math.Log((rows-matching+0.5)/(matching+0.5)), 1e-6)
+			length := lengths[column] / math.Max(averages[column], 1)
+			score += weights[column] * idf * frequency * (bm25K1 + 1) / (frequency + bm25K1*(1-bm25B+bm25B*length))
+		}
+	}
+	return score
+}
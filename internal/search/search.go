@@ -0,0 +1,235 @@
+// Package search finds products and orders by the words they contain with SQLite full-text search.
+// Words are matched as prefixes, so that staff find "Ramen" as they type "ra", regardless of case
+// and accents, and results are ranked with BM25.
+//
+// The index is kept in sync by triggers on the indexed tables, so that every write is indexed in
+// its transaction. Indexes use FTS5 when SQLite was built with it, with the sqlite_fts5 build tag,
+// and fall back to FTS4, which is always built, ranking results in Go.
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// index is a full-text index of the rows of a table.
+type index struct {
+	name string
+	// key is the ID of the indexed rows, scope the ID of the restaurant searches are restricted to.
+	key, scope string
+	// columns are the indexed columns, weights their weight when ranking.
+	columns []string
+	weights []float64
+	// source selects the rowid, key, scope and columns of the indexed rows, ending with a WHERE
+	// clause more conditions are added to.
+	source   string
+	triggers []trigger
+}
+
+// trigger reindexes a row of the source table of an index on writes.
+type trigger struct {
+	// event is when the trigger runs, e.g. "AFTER INSERT ON products".
+	event string
+	// rowid is the rowid of the row to reindex in the source table, e.g. "NEW.rowid".
+	rowid string
+}
+
+var products = index{
+	name:    "products_search",
+	key:     "product_id",
+	scope:   "restaurant_id",
+	columns: []string{"title", "description"},
+	weights: []float64{10, 1},
+	source:  "SELECT rowid, id, restaurant_id, title, description FROM products WHERE deleted_at IS NULL",
+	triggers: []trigger{
+		{event: "AFTER INSERT ON products", rowid: "NEW.rowid"},
+		{event: "AFTER UPDATE OF title, description, deleted_at ON products", rowid: "NEW.rowid"},
+		{event: "AFTER DELETE ON products", rowid: "OLD.rowid"},
+	},
+}
+
+// orders are indexed by table, contact, reference e.g. invoice number, and the titles of their items.
+var orders = index{
+	name:    "orders_search",
+	key:     "order_id",
+	scope:   "restaurant_id",
+	columns: []string{"table_number", "contact", "reference", "items"},
+	weights: []float64{5, 2, 3, 1},
+	source: `SELECT o.rowid, o.id, o.restaurant_id, o.table_number,
+		trim(o.contact_name || ' ' || o.contact_phone || ' ' || o.delivery_address),
+		trim(o.invoice_number || ' ' || o.external_id),
+		coalesce((
+			SELECT group_concat(p.title, ' ') FROM order_items i JOIN products p ON p.id = i.product_id
+			WHERE i.order_id = o.id AND i.deleted_at IS NULL
+		), '')
+		FROM orders o WHERE o.deleted_at IS NULL`,
+	triggers: []trigger{
+		{event: "AFTER INSERT ON orders", rowid: "NEW.rowid"},
+		{event: "AFTER UPDATE OF table_number, contact_name, contact_phone, delivery_address, invoice_number, external_id, deleted_at ON orders", rowid: "NEW.rowid"},
+		{event: "AFTER DELETE ON orders", rowid: "OLD.rowid"},
+		{event: "AFTER INSERT ON order_items", rowid: "(SELECT rowid FROM orders WHERE id = NEW.order_id)"},
+		{event: "AFTER UPDATE OF product_id, deleted_at ON order_items", rowid: "(SELECT rowid FROM orders WHERE id = NEW.order_id)"},
+		{event: "AFTER DELETE ON order_items", rowid: "(SELECT rowid FROM orders WHERE id = OLD.order_id)"},
+	},
+}
+
+var indexes = []index{products, orders}
+
+// Migrate creates the full-text indexes and their triggers, and indexes existing rows. Indexes are
+// recreated on every migration, which keeps them consistent with their definition and with rowids
+// renumbered by VACUUM.
+func Migrate(tx *gorm.DB) error {
+	fts5, err := hasFTS5(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+		for _, index := range indexes {
+			for _, statement := range index.statements(fts5) {
+				if err := tx.Exec(statement).Error; err != nil {
+					return fmt.Errorf("failed to migrate %s: %w", index.name, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Drop drops the full-text indexes and their triggers. Tables are migrated without them, since
+// triggers referencing a table break the migrations recreating it.
+func Drop(tx *gorm.DB) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		for _, index := range indexes {
+			for i := range index.triggers {
+				if err := tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s_%d", index.name, i)).Error; err != nil {
+					return fmt.Errorf("failed to drop %s: %w", index.name, err)
+				}
+			}
+			if err := tx.Exec("DROP TABLE IF EXISTS " + index.name).Error; err != nil {
+				return fmt.Errorf("failed to drop %s: %w", index.name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// statements returns the statements recreating the index with FTS5, or FTS4.
+func (ix index) statements(fts5 bool) []string {
+	statements := []string{"DROP TABLE IF EXISTS " + ix.name}
+	if fts5 {
+		statements = append(statements, fmt.Sprintf(
+			"CREATE VIRTUAL TABLE %s USING fts5(%s UNINDEXED, %s UNINDEXED, %s, prefix='2 3', tokenize='unicode61 remove_diacritics 2')",
+			ix.name, ix.key, ix.scope, strings.Join(ix.columns, ", "),
+		))
+	} else {
+		statements = append(statements, fmt.Sprintf(
+			`CREATE VIRTUAL TABLE %[1]s USING fts4(%[2]s, %[3]s, %[4]s, notindexed=%[2]s, notindexed=%[3]s, prefix="2,3", tokenize=unicode61 "remove_diacritics=2")`,
+			ix.name, ix.key, ix.scope, strings.Join(ix.columns, ", "),
+		))
+	}
+
+	// Rows are indexed under the rowid of their source row, so that they are reindexed without
+	// scanning the index
+	columns := strings.Join(append([]string{"rowid", ix.key, ix.scope}, ix.columns...), ", ")
+	statements = append(statements, fmt.Sprintf("INSERT INTO %s (%s) %s", ix.name, columns, ix.source))
+	for i, trigger := range ix.triggers {
+		name := fmt.Sprintf("%s_%d", ix.name, i)
+		statements = append(statements,
+			"DROP TRIGGER IF EXISTS "+name,
+			fmt.Sprintf(
+				"CREATE TRIGGER %[1]s %[2]s BEGIN DELETE FROM %[3]s WHERE rowid = %[4]s; INSERT INTO %[3]s (%[5]s) %[6]s AND rowid = %[4]s; END",
+				name, trigger.event, ix.name, trigger.rowid, columns, ix.source,
+			),
+		)
+	}
+	return statements
+}
+
+// hasFTS5 reports whether SQLite was built with FTS5.
+func hasFTS5(tx *gorm.DB) (bool, error) {
+	var enabled bool
+	if err := tx.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled).Error; err != nil {
+		return false, err
+	}
+	return enabled, nil
+}
+
+// Products returns the IDs of the products of the restaurant matching the text, best match first.
+func Products(tx *gorm.DB, restaurantID uuid.UUID, text string, limit int) ([]uuid.UUID, error) {
+	return products.search(tx, restaurantID, text, limit)
+}
+
+// Orders returns the IDs of the orders of the restaurant matching the text, best match first.
+func Orders(tx *gorm.DB, restaurantID uuid.UUID, text string, limit int) ([]uuid.UUID, error) {
+	return orders.search(tx, restaurantID, text, limit)
+}
+
+func (ix index) search(tx *gorm.DB, scopeID uuid.UUID, text string, limit int) ([]uuid.UUID, error) {
+	query := matchQuery(text)
+	if query == "" {
+		return []uuid.UUID{}, nil
+	}
+	fts5, err := hasFTS5(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, 0)
+	if fts5 {
+		// Unindexed columns are weighted too
+		weights := make([]string, 0, len(ix.weights)+2)
+		weights = append(weights, "0", "0")
+		for _, weight := range ix.weights {
+			weights = append(weights, fmt.Sprint(weight))
+		}
+		err := tx.Raw(
+			fmt.Sprintf("SELECT %[2]s FROM %[1]s WHERE %[1]s MATCH ? AND %[3]s = ? ORDER BY bm25(%[1]s, %[4]s) LIMIT ?", ix.name, ix.key, ix.scope, strings.Join(weights, ", ")),
+			query, scopeID, limit,
+		).Scan(&ids).Error
+		return ids, err
+	}
+
+	// FTS4 has no ranking function, matches are ranked from their statistics
+	type match struct {
+		ID   uuid.UUID
+		Info []byte
+	}
+	matches := make([]match, 0)
+	if err := tx.Raw(
+		fmt.Sprintf("SELECT %[2]s AS id, matchinfo(%[1]s, 'pcnalx') AS info FROM %[1]s WHERE %[1]s MATCH ? AND %[3]s = ?", ix.name, ix.key, ix.scope),
+		query, scopeID,
+	).Scan(&matches).Error; err != nil {
+		return nil, err
+	}
+
+	weights := append([]float64{0, 0}, ix.weights...)
+	scores := make(map[uuid.UUID]float64, len(matches))
+	for _, match := range matches {
+		scores[match.ID] = bm25(match.Info, weights)
+		ids = append(ids, match.ID)
+	}
+	sort.SliceStable(ids, func(i, j int) bool { return scores[ids[i]] > scores[ids[j]] })
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids, nil
+}
+
+// matchQuery returns the full-text query matching rows containing every word of the text, as
+// prefixes, or "" when the text has no words. Punctuation is dropped, which leaves no operators
+// of the query syntax.
+func matchQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r)
+	})
+	for i, word := range words {
+		words[i] = word + "*"
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,121 @@
+package search_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/database"
+	"github.com/roushou/pocpoc/internal/database/databasetest"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func createProduct(t *testing.T, db *gorm.DB, restaurantID uuid.UUID, title, description string) *models.Product {
+	product := &models.Product{RestaurantID: restaurantID, Title: title, Description: description, UnitPrice: 10}
+	require.NoError(t, db.Create(product).Error)
+	return product
+}
+
+func TestProducts(t *testing.T) {
+	db := databasetest.New(t)
+	restaurantID, otherID := uuid.New(), uuid.New()
+	ramen := createProduct(t, db, restaurantID, "Ramen", "Noodles in a pork broth")
+	creme := createProduct(t, db, restaurantID, "Crème brûlée", "Custard with caramelised sugar")
+	noodles := createProduct(t, db, restaurantID, "Yakisoba", "Fried noodles")
+	createProduct(t, db, otherID, "Ramen", "")
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []uuid.UUID
+	}{
+		{name: "prefix", query: "ra", expected: []uuid.UUID{ramen.ID}},
+		{name: "case", query: "RAMEN", expected: []uuid.UUID{ramen.ID}},
+		{name: "accents", query: "creme brulee", expected: []uuid.UUID{creme.ID}},
+		{name: "accents in query", query: "Ramèn", expected: []uuid.UUID{ramen.ID}},
+		{name: "every word", query: "fried noodles", expected: []uuid.UUID{noodles.ID}},
+		{name: "titles rank first", query: "yakisoba noodles", expected: []uuid.UUID{noodles.ID}},
+		{name: "description", query: "noodles", expected: []uuid.UUID{noodles.ID, ramen.ID}},
+		{name: "punctuation", query: `"ramen"* -(`, expected: []uuid.UUID{ramen.ID}},
+		{name: "no words", query: "- *", expected: []uuid.UUID{}},
+		{name: "no match", query: "pizza", expected: []uuid.UUID{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, err := search.Products(db, restaurantID, tt.query, 10)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ids)
+		})
+	}
+
+	t.Run("ranks titles above descriptions", func(t *testing.T) {
+		broth := createProduct(t, db, restaurantID, "Pork broth", "")
+		ids, err := search.Products(db, restaurantID, "pork", 10)
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{broth.ID, ramen.ID}, ids)
+
+		ids, err = search.Products(db, restaurantID, "pork", 1)
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{broth.ID}, ids)
+	})
+
+	t.Run("stays in sync with writes", func(t *testing.T) {
+		require.NoError(t, db.Model(ramen).Update("title", "Shoyu ramen").Error)
+		ids, err := search.Products(db, restaurantID, "shoyu", 10)
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{ramen.ID}, ids)
+
+		require.NoError(t, db.Delete(ramen).Error)
+		ids, err = search.Products(db, restaurantID, "ramen", 10)
+		require.NoError(t, err)
+		assert.Empty(t, ids)
+	})
+}
+
+func TestOrders(t *testing.T) {
+	db := databasetest.New(t)
+	restaurantID := uuid.New()
+	gyoza := createProduct(t, db, restaurantID, "Gyoza", "")
+
+	dineIn := &models.Order{RestaurantID: restaurantID, TableNumber: "12"}
+	takeaway := &models.Order{RestaurantID: restaurantID, Type: models.OrderTypeTakeaway, ContactName: "Zoé Martin", ContactPhone: "0612345678"}
+	require.NoError(t, db.Create(dineIn).Error)
+	require.NoError(t, db.Create(takeaway).Error)
+
+	find := func(query string) []uuid.UUID {
+		ids, err := search.Orders(db, restaurantID, query, 10)
+		require.NoError(t, err)
+		return ids
+	}
+	assert.Equal(t, []uuid.UUID{dineIn.ID}, find("12"))
+	assert.Equal(t, []uuid.UUID{takeaway.ID}, find("zoe"))
+	assert.Equal(t, []uuid.UUID{takeaway.ID}, find("0612"))
+	assert.Empty(t, find("gyoza"))
+
+	// Orders are reindexed as items are added and removed
+	item := &models.OrderItem{OrderID: dineIn.ID, ProductID: gyoza.ID, Quantity: 2}
+	require.NoError(t, db.Create(item).Error)
+	assert.Equal(t, []uuid.UUID{dineIn.ID}, find("gyo"))
+	require.NoError(t, db.Delete(item).Error)
+	assert.Empty(t, find("gyoza"))
+
+	require.NoError(t, db.Model(takeaway).Update("invoice_number", "F-2026-0042").Error)
+	assert.Equal(t, []uuid.UUID{takeaway.ID}, find("2026 0042"))
+}
+
+func TestMigrate(t *testing.T) {
+	// Migrations recreate some tables of existing databases, which their triggers must not break
+	db, err := database.NewDatabase(t.TempDir() + "/pocpoc.db")
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate())
+	restaurantID := uuid.New()
+	ramen := createProduct(t, db.Connection, restaurantID, "Ramen", "")
+	require.NoError(t, db.AutoMigrate())
+
+	ids, err := search.Products(db.Connection, restaurantID, "ramen", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{ramen.ID}, ids)
+}
@@ -0,0 +1,33 @@
+package security
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPINLength = 4
+	maxPINLength = 8
+)
+
+// HashPIN hashes the given PIN. PINs are made of 4 to 8 digits.
+func HashPIN(pin string) (string, error) {
+	if len(pin) < minPINLength || len(pin) > maxPINLength {
+		return "", errors.New("PIN should be 4 to 8 digits long")
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return "", errors.New("PIN should only contain digits")
+		}
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+func VerifyPINHash(pin, hash string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pin))
+}
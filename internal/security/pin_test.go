@@ -0,0 +1,57 @@
+package security_test
+
+import (
+	"testing"
+
+	"github.com/roushou/pocpoc/internal/security"
+)
+
+func TestHashPIN(t *testing.T) {
+	tests := []struct {
+		name    string
+		pin     string
+		wantErr bool
+	}{
+		{
+			name:    "empty PIN",
+			pin:     "",
+			wantErr: true,
+		},
+		{
+			name:    "too short",
+			pin:     "123",
+			wantErr: true,
+		},
+		{
+			name:    "too long",
+			pin:     "123456789",
+			wantErr: true,
+		},
+		{
+			name:    "not digits",
+			pin:     "12a4",
+			wantErr: true,
+		},
+		{
+			name:    "valid PIN",
+			pin:     "0420",
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := security.HashPIN(tt.pin)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("HashPIN() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if err := security.VerifyPINHash(tt.pin, got); err != nil {
+				t.Errorf("VerifyPINHash() error = %v", err)
+			}
+		})
+	}
+}
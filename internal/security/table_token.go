@@ -0,0 +1,53 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// tableTokenSignatureSize is the size of the truncated HMAC of table tokens. Tokens are printed as QR
+// codes, keeping them short keeps the codes easy to scan.
+const tableTokenSignatureSize = 16
+
+var ErrInvalidTableToken = errors.New("invalid table token")
+
+// NewTableToken returns a URL-safe token identifying a table, signed with the secret key. Incrementing
+// the version of the table invalidates its previous tokens.
+func NewTableToken(tableID uuid.UUID, version uint32, secretKey string) string {
+	payload := make([]byte, 0, len(tableID)+4+tableTokenSignatureSize)
+	payload = append(payload, tableID[:]...)
+	payload = binary.BigEndian.AppendUint32(payload, version)
+	payload = append(payload, signTableToken(payload, secretKey)...)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+// ParseTableToken verifies the signature of a token issued by NewTableToken and returns the table ID
+// and version it was issued for.
+func ParseTableToken(token, secretKey string) (uuid.UUID, uint32, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) != len(uuid.UUID{})+4+tableTokenSignatureSize {
+		return uuid.Nil, 0, ErrInvalidTableToken
+	}
+	payload, signature := data[:len(data)-tableTokenSignatureSize], data[len(data)-tableTokenSignatureSize:]
+	if !hmac.Equal(signature, signTableToken(payload, secretKey)) {
+		return uuid.Nil, 0, ErrInvalidTableToken
+	}
+
+	tableID, err := uuid.FromBytes(payload[:len(uuid.UUID{})])
+	if err != nil {
+		return uuid.Nil, 0, ErrInvalidTableToken
+	}
+	return tableID, binary.BigEndian.Uint32(payload[len(uuid.UUID{}):]), nil
+}
+
+func signTableToken(payload []byte, secretKey string) []byte {
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte("table:"))
+	mac.Write(payload)
+	return mac.Sum(nil)[:tableTokenSignatureSize]
+}
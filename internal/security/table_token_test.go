@@ -0,0 +1,40 @@
+package security_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableToken(t *testing.T) {
+	tableID := uuid.MustParse("0195a1b2-c3d4-7e5f-8a9b-0c1d2e3f4a5b")
+	token := security.NewTableToken(tableID, 3, "secret")
+	assert.Len(t, token, 48)
+
+	parsedID, version, err := security.ParseTableToken(token, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, tableID, parsedID)
+	assert.Equal(t, uint32(3), version)
+
+	tests := []struct {
+		name  string
+		token string
+		key   string
+	}{
+		{name: "other key", token: token, key: "other"},
+		{name: "tampered", token: strings.Replace(token, token[:2], "AA", 1), key: "secret"},
+		{name: "truncated", token: token[:40], key: "secret"},
+		{name: "not base64", token: "not a token!", key: "secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := security.ParseTableToken(tt.token, tt.key)
+			assert.ErrorIs(t, err, security.ErrInvalidTableToken)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/security"
+)
+
+const (
+	// MaxFailedPinAttempts is the number of wrong PINs after which PIN sign-in is locked.
+	MaxFailedPinAttempts = 5
+	// PinLockoutDuration is how long PIN sign-in stays locked after too many wrong PINs.
+	PinLockoutDuration = 15 * time.Minute
+)
+
+// AuthService signs up and signs in owners and staff. Issuing session tokens is left to callers.
+type AuthService struct {
+	store Store
+}
+
+func NewAuthService(store Store) *AuthService {
+	return &AuthService{store: store}
+}
+
+// SignUpOwner creates an owner account.
+func (s *AuthService) SignUpOwner(ctx context.Context, username string, password string) (*models.Owner, error) {
+	hashedPassword, err := security.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	owner := &models.Owner{
+		Username:     username,
+		PasswordHash: hashedPassword,
+	}
+	if err := s.store.Owners().Create(ctx, owner); err != nil {
+		return nil, err
+	}
+	return owner, nil
+}
+
+// SignInOwner returns the owner if the password matches.
+func (s *AuthService) SignInOwner(ctx context.Context, username string, password string) (*models.Owner, error) {
+	owner, err := s.store.Owners().FindByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := security.VerifyPasswordHash(password, owner.PasswordHash); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return owner, nil
+}
+
+// SignInStaff returns the staff member if the password matches and they are active. Usernames are
+// only unique within a restaurant.
+func (s *AuthService) SignInStaff(ctx context.Context, restaurantID uuid.UUID, username string, password string) (*models.Staff, error) {
+	staff, err := s.store.Staff().FindByUsername(ctx, restaurantID, username)
+	if err != nil {
+		return nil, err
+	}
+	if err := security.VerifyPasswordHash(password, staff.PasswordHash); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	if !staff.IsActive() {
+		return nil, ErrStaffDeactivated
+	}
+	return staff, nil
+}
+
+// SignInStaffWithPin returns the staff member of the restaurant if the PIN matches and they are active.
+// PIN sign-in is locked for a while after too many wrong PINs.
+func (s *AuthService) SignInStaffWithPin(ctx context.Context, restaurantID uuid.UUID, staffID uuid.UUID, pin string) (*models.Staff, error) {
+	staff, err := s.store.Staff().Find(ctx, staffID)
+	if err != nil {
+		return nil, err
+	}
+	if staff.RestaurantID != restaurantID {
+		return nil, ErrNotFound
+	}
+	if !staff.IsActive() {
+		return nil, ErrStaffDeactivated
+	}
+	if staff.PinHash == "" {
+		return nil, ErrPinNotSet
+	}
+
+	// The attempt is counted before the PIN is verified, so that concurrent attempts can't get past
+	// the limit. Times are compared in UTC, as stored by the database
+	now := time.Now().UTC()
+	counted, err := s.store.Staff().CountPinAttempt(ctx, staff, MaxFailedPinAttempts, now.Add(PinLockoutDuration), now)
+	if err != nil {
+		return nil, err
+	}
+	if !counted {
+		return nil, ErrPinLocked
+	}
+	if err := security.VerifyPINHash(pin, staff.PinHash); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	staff.FailedPinAttempts = 0
+	staff.PinLockedUntil = nil
+	if err := s.store.Staff().Update(ctx, staff, "failed_pin_attempts", "pin_locked_until"); err != nil {
+		return nil, err
+	}
+	return staff, nil
+}
+
+// VerifyStaffToken returns ErrUnauthorized if a token issued to the staff member with the version was
+// revoked, because they were deactivated or their password was reset.
+func (s *AuthService) VerifyStaffToken(ctx context.Context, staffID uuid.UUID, tokenVersion uint32) error {
+	staff, err := s.store.Staff().Find(ctx, staffID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrUnauthorized
+		}
+		return err
+	}
+	if !staff.IsActive() || staff.TokenVersion != tokenVersion {
+		return ErrUnauthorized
+	}
+	return nil
+}
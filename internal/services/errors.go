@@ -0,0 +1,44 @@
+package services
+
+import "errors"
+
+var (
+	// ErrUnauthorized is returned when the actor isn't allowed to perform the action.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrNotFound is returned when the requested resource doesn't exist or isn't visible to the actor.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidCredentials is returned when signing in with a wrong password.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrStaffDeactivated is returned when a deactivated staff member signs in.
+	ErrStaffDeactivated = errors.New("staff member is deactivated")
+	// ErrInvalidPin is returned when a PIN isn't made of 4 to 8 digits.
+	ErrInvalidPin = errors.New("PIN should be 4 to 8 digits")
+	// ErrPinNotSet is returned when a staff member without a PIN signs in on a terminal.
+	ErrPinNotSet = errors.New("staff member has no PIN")
+	// ErrPinLocked is returned when signing in with a PIN after too many wrong PINs.
+	ErrPinLocked = errors.New("PIN sign-in is locked")
+
+	ErrAlreadyArchived = errors.New("restaurant is already archived")
+	ErrNotArchived     = errors.New("restaurant is not archived")
+	ErrAlreadyActive   = errors.New("staff member is already active")
+	ErrAlreadyInactive = errors.New("staff member is already deactivated")
+
+	ErrEmptyOrder              = errors.New("order has no products")
+	ErrUnknownProduct          = errors.New("unknown product")
+	ErrUnknownCustomer         = errors.New("unknown customer")
+	ErrInvalidOrderType        = errors.New("missing or unexpected fields for the order type")
+	ErrInvalidOrderStatus      = errors.New("unknown order status")
+	ErrInvalidStatusTransition = errors.New("invalid status transition")
+	ErrOrderPaid               = errors.New("order is paid, refunds go through credit notes")
+	ErrNotClockedIn            = errors.New("staff is not clocked in")
+	ErrOrderClosed             = errors.New("order is closed")
+	ErrOrderItemExists         = errors.New("order item already exists")
+	ErrInvalidPageSize         = errors.New("page size should be 1 to 200")
+	ErrInvalidPageToken        = errors.New("invalid page token")
+	// ErrTooManyGuestOrders is returned when the orders of a table awaiting approval are at the limit.
+	ErrTooManyGuestOrders = errors.New("too many orders awaiting approval")
+
+	ErrOrderCancelled   = errors.New("order is cancelled")
+	ErrOverpayment      = errors.New("payment exceeds the amount due")
+	ErrNoOpenCashDrawer = errors.New("no open cash drawer session")
+)
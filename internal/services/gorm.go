@@ -0,0 +1,386 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/integrations"
+	"github.com/roushou/pocpoc/internal/journal"
+	"github.com/roushou/pocpoc/internal/loyalty"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/pickup"
+	"github.com/roushou/pocpoc/internal/printing"
+	"github.com/roushou/pocpoc/internal/promotions"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// gormStore is the Store backed by the database.
+type gormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore returns a store backed by the database connection, which may be a transaction.
+func NewGormStore(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) Owners() OwnerRepository               { return &gormOwners{db: s.db} }
+func (s *gormStore) Restaurants() RestaurantRepository     { return &gormRestaurants{db: s.db} }
+func (s *gormStore) Staff() StaffRepository                { return &gormStaff{db: s.db} }
+func (s *gormStore) Products() ProductRepository           { return &gormProducts{db: s.db} }
+func (s *gormStore) Customers() CustomerRepository         { return &gormCustomers{db: s.db} }
+func (s *gormStore) Orders() OrderRepository               { return &gormOrders{db: s.db} }
+func (s *gormStore) Payments() PaymentRepository           { return &gormPayments{db: s.db} }
+func (s *gormStore) SyncMutations() SyncMutationRepository { return &gormSyncMutations{db: s.db} }
+
+func (s *gormStore) Transaction(ctx context.Context, fn func(store Store) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&gormStore{db: tx})
+	})
+}
+
+// first loads the first record matching the conditions into dest, or returns ErrNotFound.
+func first(db *gorm.DB, dest any, conds ...any) error {
+	if err := db.First(dest, conds...).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// update saves the columns of the model, leaving its associations untouched.
+func update(db *gorm.DB, model any, columns []string) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	return db.Model(model).Omit(clause.Associations).Select(columns).Updates(model).Error
+}
+
+type gormOwners struct {
+	db *gorm.DB
+}
+
+func (r *gormOwners) FindByUsername(ctx context.Context, username string) (*models.Owner, error) {
+	owner := &models.Owner{}
+	if err := first(r.db.WithContext(ctx), owner, "username = ?", username); err != nil {
+		return nil, err
+	}
+	return owner, nil
+}
+
+func (r *gormOwners) Create(ctx context.Context, owner *models.Owner) error {
+	return r.db.WithContext(ctx).Create(owner).Error
+}
+
+type gormRestaurants struct {
+	db *gorm.DB
+}
+
+func (r *gormRestaurants) Find(ctx context.Context, id uuid.UUID) (*models.Restaurant, error) {
+	restaurant := &models.Restaurant{}
+	if err := first(r.db.WithContext(ctx), restaurant, "id = ?", id); err != nil {
+		return nil, err
+	}
+	return restaurant, nil
+}
+
+func (r *gormRestaurants) ListOwned(ctx context.Context, ownerID uuid.UUID, includeArchived bool) ([]models.Restaurant, error) {
+	query := r.db.WithContext(ctx).Where("owner_id = ?", ownerID).Order("name")
+	if !includeArchived {
+		query = query.Where("archived_at IS NULL")
+	}
+	restaurants := make([]models.Restaurant, 0)
+	if err := query.Find(&restaurants).Error; err != nil {
+		return nil, err
+	}
+	return restaurants, nil
+}
+
+func (r *gormRestaurants) Create(ctx context.Context, restaurant *models.Restaurant) error {
+	return r.db.WithContext(ctx).Create(restaurant).Error
+}
+
+func (r *gormRestaurants) Update(ctx context.Context, restaurant *models.Restaurant, columns ...string) error {
+	return update(r.db.WithContext(ctx), restaurant, columns)
+}
+
+type gormStaff struct {
+	db *gorm.DB
+}
+
+func (r *gormStaff) Find(ctx context.Context, id uuid.UUID) (*models.Staff, error) {
+	staff := &models.Staff{}
+	if err := first(r.db.WithContext(ctx).Preload("Restaurant"), staff, "id = ?", id); err != nil {
+		return nil, err
+	}
+	return staff, nil
+}
+
+func (r *gormStaff) FindByUsername(ctx context.Context, restaurantID uuid.UUID, username string) (*models.Staff, error) {
+	staff := &models.Staff{}
+	if err := first(r.db.WithContext(ctx), staff, "restaurant_id = ? AND username = ?", restaurantID, username); err != nil {
+		return nil, err
+	}
+	return staff, nil
+}
+
+func (r *gormStaff) Create(ctx context.Context, staff *models.Staff) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Create(staff).Error
+}
+
+func (r *gormStaff) Update(ctx context.Context, staff *models.Staff, columns ...string) error {
+	return update(r.db.WithContext(ctx), staff, columns)
+}
+
+func (r *gormStaff) HasOpenShift(ctx context.Context, staffID uuid.UUID) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).
+		Model(&models.Shift{}).
+		Where("staff_id = ? AND clock_out_at IS NULL", staffID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *gormStaff) CountPinAttempt(ctx context.Context, staff *models.Staff, maxAttempts int, lockedUntil time.Time, now time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(staff).
+		Where("(pin_locked_until IS NULL OR pin_locked_until <= ?)", now).
+		Updates(map[string]any{
+			"failed_pin_attempts": gorm.Expr("CASE WHEN failed_pin_attempts + 1 >= ? THEN 0 ELSE failed_pin_attempts + 1 END", maxAttempts),
+			"pin_locked_until":    gorm.Expr("CASE WHEN failed_pin_attempts + 1 >= ? THEN ? ELSE pin_locked_until END", maxAttempts, lockedUntil),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+type gormProducts struct {
+	db *gorm.DB
+}
+
+func (r *gormProducts) Find(ctx context.Context, restaurantID uuid.UUID, id uuid.UUID) (*models.Product, error) {
+	product := &models.Product{}
+	if err := first(r.db.WithContext(ctx), product, "id = ? AND restaurant_id = ?", id, restaurantID); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+func (r *gormProducts) FindMany(ctx context.Context, restaurantID uuid.UUID, ids []uuid.UUID) ([]models.Product, error) {
+	products := make([]models.Product, 0, len(ids))
+	if err := r.db.WithContext(ctx).
+		Where("restaurant_id = ? AND id IN ?", restaurantID, ids).
+		Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r *gormProducts) List(ctx context.Context, restaurantID uuid.UUID) ([]models.Product, error) {
+	products := make([]models.Product, 0)
+	if err := r.db.WithContext(ctx).Where("restaurant_id = ?", restaurantID).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r *gormProducts) Create(ctx context.Context, product *models.Product) error {
+	return r.db.WithContext(ctx).Create(product).Error
+}
+
+func (r *gormProducts) Update(ctx context.Context, product *models.Product, columns ...string) error {
+	return update(r.db.WithContext(ctx), product, columns)
+}
+
+func (r *gormProducts) EnqueueMenu(ctx context.Context, restaurantID uuid.UUID) error {
+	_, err := integrations.EnqueueMenu(r.db.WithContext(ctx), restaurantID)
+	return err
+}
+
+type gormCustomers struct {
+	db *gorm.DB
+}
+
+func (r *gormCustomers) Find(ctx context.Context, ownerID uuid.UUID, id uuid.UUID) (*models.Customer, error) {
+	customer := &models.Customer{}
+	if err := first(r.db.WithContext(ctx), customer, "id = ? AND owner_id = ?", id, ownerID); err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
+
+type gormOrders struct {
+	db *gorm.DB
+}
+
+func (r *gormOrders) Find(ctx context.Context, id uuid.UUID) (*models.Order, error) {
+	order := &models.Order{}
+	if err := first(r.db.WithContext(ctx).Preload("OrderItems.Product"), order, "id = ?", id); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (r *gormOrders) Exists(ctx context.Context, id uuid.UUID) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Unscoped().Model(&models.Order{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *gormOrders) List(ctx context.Context, restaurantID uuid.UUID, status models.OrderStatus, before uuid.UUID, limit int) ([]models.Order, error) {
+	query := r.db.WithContext(ctx).Preload("OrderItems").Where("restaurant_id = ?", restaurantID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	// IDs are UUIDv7, sorting by ID sorts by creation
+	if before != uuid.Nil {
+		query = query.Where("id < ?", before)
+	}
+	orders := make([]models.Order, 0)
+	if err := query.Order("id DESC").Limit(limit).Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (r *gormOrders) Create(ctx context.Context, order *models.Order) error {
+	return r.db.WithContext(ctx).Create(order).Error
+}
+
+func (r *gormOrders) Update(ctx context.Context, order *models.Order, columns ...string) error {
+	return update(r.db.WithContext(ctx), order, columns)
+}
+
+func (r *gormOrders) AddItems(ctx context.Context, order *models.Order, items []models.OrderItem) error {
+	for i := range items {
+		items[i].OrderID = order.ID
+	}
+	if err := r.db.WithContext(ctx).Create(&items).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrOrderItemExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *gormOrders) CountAwaitingApproval(ctx context.Context, restaurantID uuid.UUID, tableNumber string) (int64, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).
+		Model(&models.Order{}).
+		Where("restaurant_id = ? AND table_number = ? AND status = ?", restaurantID, tableNumber, models.OrderStatusAwaitingApproval).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *gormOrders) BookPickup(ctx context.Context, restaurant *models.Restaurant, at time.Time, now time.Time) (time.Time, error) {
+	return pickup.Book(r.db.WithContext(ctx), restaurant, at, now)
+}
+
+func (r *gormOrders) NextPickup(ctx context.Context, restaurant *models.Restaurant, now time.Time) (time.Time, error) {
+	return pickup.Next(r.db.WithContext(ctx), restaurant, now)
+}
+
+func (r *gormOrders) FindCoupon(ctx context.Context, restaurantID uuid.UUID, code string) (*models.Promotion, error) {
+	return promotions.FindCoupon(r.db.WithContext(ctx), restaurantID, code)
+}
+
+func (r *gormOrders) ApplyPromotions(ctx context.Context, restaurant *models.Restaurant, order *models.Order, now time.Time) (*promotions.Result, error) {
+	return promotions.Apply(r.db.WithContext(ctx), restaurant, order, now)
+}
+
+func (r *gormOrders) ReleasePromotions(ctx context.Context, order *models.Order) error {
+	return promotions.Release(r.db.WithContext(ctx), order)
+}
+
+func (r *gormOrders) RestoreLoyaltyPoints(ctx context.Context, order *models.Order) error {
+	_, err := loyalty.Restore(r.db.WithContext(ctx), order)
+	return err
+}
+
+func (r *gormOrders) EarnLoyaltyPoints(ctx context.Context, order *models.Order, restaurant *models.Restaurant) error {
+	_, err := loyalty.Earn(r.db.WithContext(ctx), order, restaurant)
+	return err
+}
+
+func (r *gormOrders) Invoice(ctx context.Context, order *models.Order, restaurant *models.Restaurant) error {
+	_, err := journal.AppendInvoice(r.db.WithContext(ctx), order, restaurant)
+	return err
+}
+
+func (r *gormOrders) EnqueueKitchenTickets(ctx context.Context, order *models.Order) error {
+	_, err := printing.EnqueueKitchenTickets(r.db.WithContext(ctx), order)
+	return err
+}
+
+func (r *gormOrders) EnqueueStatus(ctx context.Context, order *models.Order, status models.OrderStatus) error {
+	_, err := integrations.EnqueueStatus(r.db.WithContext(ctx), order, status)
+	return err
+}
+
+type gormPayments struct {
+	db *gorm.DB
+}
+
+func (r *gormPayments) Create(ctx context.Context, payment *models.Payment) error {
+	return r.db.WithContext(ctx).Create(payment).Error
+}
+
+func (r *gormPayments) Update(ctx context.Context, payment *models.Payment, columns ...string) error {
+	return update(r.db.WithContext(ctx), payment, columns)
+}
+
+func (r *gormPayments) SumAmounts(ctx context.Context, orderID uuid.UUID) (float64, error) {
+	paid := 0.0
+	if err := r.db.WithContext(ctx).
+		Model(&models.Payment{}).
+		Where("order_id = ?", orderID).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&paid).Error; err != nil {
+		return 0, err
+	}
+	return models.RoundAmount(paid), nil
+}
+
+func (r *gormPayments) FindOpenCashSession(ctx context.Context, restaurantID uuid.UUID, staffID uuid.UUID, terminalID uuid.UUID) (*models.CashSession, error) {
+	query := r.db.WithContext(ctx).Where("restaurant_id = ? AND closed_at IS NULL", restaurantID)
+	if terminalID != uuid.Nil {
+		query = query.Where("terminal_id = ?", terminalID)
+	} else {
+		query = query.Where("terminal_id IS NULL AND opened_by_id = ?", staffID)
+	}
+
+	session := &models.CashSession{}
+	if err := first(query, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+type gormSyncMutations struct {
+	db *gorm.DB
+}
+
+func (r *gormSyncMutations) Find(ctx context.Context, id uuid.UUID) (*models.SyncMutation, error) {
+	mutation := &models.SyncMutation{}
+	if err := first(r.db.WithContext(ctx), mutation, "id = ?", id); err != nil {
+		return nil, err
+	}
+	return mutation, nil
+}
+
+func (r *gormSyncMutations) Create(ctx context.Context, mutation *models.SyncMutation) error {
+	return r.db.WithContext(ctx).Create(mutation).Error
+}
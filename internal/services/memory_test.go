@@ -0,0 +1,394 @@
+package services_test
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/promotions"
+	"github.com/roushou/pocpoc/internal/services"
+)
+
+// memoryStore is an in-memory services.Store. Transactions are not rolled back, tests only check
+// the outcome of successful ones.
+type memoryStore struct {
+	owners      map[uuid.UUID]*models.Owner
+	restaurants map[uuid.UUID]*models.Restaurant
+	staff       map[uuid.UUID]*models.Staff
+	products    map[uuid.UUID]*models.Product
+	customers   map[uuid.UUID]*models.Customer
+	orders      map[uuid.UUID]*models.Order
+	payments    map[uuid.UUID]*models.Payment
+	mutations   map[uuid.UUID]*models.SyncMutation
+	// cashSessions are the open cash drawer sessions.
+	cashSessions map[uuid.UUID]*models.CashSession
+	// clockedIn are the staff members with an open shift.
+	clockedIn map[uuid.UUID]bool
+
+	// menus, tickets, statuses, released and invoiced record the side effects queued by services.
+	menus    []uuid.UUID
+	tickets  []uuid.UUID
+	statuses []models.OrderStatus
+	released []uuid.UUID
+	invoiced []uuid.UUID
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		owners:       make(map[uuid.UUID]*models.Owner),
+		restaurants:  make(map[uuid.UUID]*models.Restaurant),
+		staff:        make(map[uuid.UUID]*models.Staff),
+		products:     make(map[uuid.UUID]*models.Product),
+		customers:    make(map[uuid.UUID]*models.Customer),
+		orders:       make(map[uuid.UUID]*models.Order),
+		payments:     make(map[uuid.UUID]*models.Payment),
+		mutations:    make(map[uuid.UUID]*models.SyncMutation),
+		cashSessions: make(map[uuid.UUID]*models.CashSession),
+		clockedIn:    make(map[uuid.UUID]bool),
+	}
+}
+
+func newID(id *uuid.UUID) {
+	if *id == uuid.Nil {
+		*id = uuid.Must(uuid.NewV7())
+	}
+}
+
+func (s *memoryStore) Owners() services.OwnerRepository               { return memoryOwners{s} }
+func (s *memoryStore) Restaurants() services.RestaurantRepository     { return memoryRestaurants{s} }
+func (s *memoryStore) Staff() services.StaffRepository                { return memoryStaff{s} }
+func (s *memoryStore) Products() services.ProductRepository           { return memoryProducts{s} }
+func (s *memoryStore) Customers() services.CustomerRepository         { return memoryCustomers{s} }
+func (s *memoryStore) Orders() services.OrderRepository               { return memoryOrders{s} }
+func (s *memoryStore) Payments() services.PaymentRepository           { return memoryPayments{s} }
+func (s *memoryStore) SyncMutations() services.SyncMutationRepository { return memorySyncMutations{s} }
+
+func (s *memoryStore) Transaction(ctx context.Context, fn func(store services.Store) error) error {
+	return fn(s)
+}
+
+type memoryOwners struct{ s *memoryStore }
+
+func (r memoryOwners) FindByUsername(ctx context.Context, username string) (*models.Owner, error) {
+	for _, owner := range r.s.owners {
+		if owner.Username == username {
+			return owner, nil
+		}
+	}
+	return nil, services.ErrNotFound
+}
+
+func (r memoryOwners) Create(ctx context.Context, owner *models.Owner) error {
+	newID(&owner.ID)
+	r.s.owners[owner.ID] = owner
+	return nil
+}
+
+type memoryRestaurants struct{ s *memoryStore }
+
+func (r memoryRestaurants) Find(ctx context.Context, id uuid.UUID) (*models.Restaurant, error) {
+	restaurant, ok := r.s.restaurants[id]
+	if !ok {
+		return nil, services.ErrNotFound
+	}
+	return restaurant, nil
+}
+
+func (r memoryRestaurants) ListOwned(ctx context.Context, ownerID uuid.UUID, includeArchived bool) ([]models.Restaurant, error) {
+	restaurants := make([]models.Restaurant, 0)
+	for _, restaurant := range r.s.restaurants {
+		if restaurant.OwnerID == ownerID && (includeArchived || !restaurant.IsArchived()) {
+			restaurants = append(restaurants, *restaurant)
+		}
+	}
+	sort.Slice(restaurants, func(i, j int) bool { return restaurants[i].Name < restaurants[j].Name })
+	return restaurants, nil
+}
+
+func (r memoryRestaurants) Create(ctx context.Context, restaurant *models.Restaurant) error {
+	newID(&restaurant.ID)
+	r.s.restaurants[restaurant.ID] = restaurant
+	return nil
+}
+
+func (r memoryRestaurants) Update(ctx context.Context, restaurant *models.Restaurant, columns ...string) error {
+	r.s.restaurants[restaurant.ID] = restaurant
+	return nil
+}
+
+type memoryStaff struct{ s *memoryStore }
+
+func (r memoryStaff) Find(ctx context.Context, id uuid.UUID) (*models.Staff, error) {
+	staff, ok := r.s.staff[id]
+	if !ok {
+		return nil, services.ErrNotFound
+	}
+	found := *staff
+	found.Restaurant = *r.s.restaurants[staff.RestaurantID]
+	return &found, nil
+}
+
+func (r memoryStaff) FindByUsername(ctx context.Context, restaurantID uuid.UUID, username string) (*models.Staff, error) {
+	for _, staff := range r.s.staff {
+		if staff.RestaurantID == restaurantID && staff.Username == username {
+			return r.Find(ctx, staff.ID)
+		}
+	}
+	return nil, services.ErrNotFound
+}
+
+func (r memoryStaff) Create(ctx context.Context, staff *models.Staff) error {
+	newID(&staff.ID)
+	r.s.staff[staff.ID] = staff
+	return nil
+}
+
+func (r memoryStaff) Update(ctx context.Context, staff *models.Staff, columns ...string) error {
+	r.s.staff[staff.ID] = staff
+	return nil
+}
+
+func (r memoryStaff) HasOpenShift(ctx context.Context, staffID uuid.UUID) (bool, error) {
+	return r.s.clockedIn[staffID], nil
+}
+
+func (r memoryStaff) CountPinAttempt(ctx context.Context, staff *models.Staff, maxAttempts int, lockedUntil time.Time, now time.Time) (bool, error) {
+	stored := r.s.staff[staff.ID]
+	if stored.PinLockedUntil != nil && stored.PinLockedUntil.After(now) {
+		return false, nil
+	}
+	stored.FailedPinAttempts++
+	if int(stored.FailedPinAttempts) >= maxAttempts {
+		stored.FailedPinAttempts = 0
+		stored.PinLockedUntil = &lockedUntil
+	}
+	return true, nil
+}
+
+type memoryProducts struct{ s *memoryStore }
+
+func (r memoryProducts) Find(ctx context.Context, restaurantID uuid.UUID, id uuid.UUID) (*models.Product, error) {
+	product, ok := r.s.products[id]
+	if !ok || product.RestaurantID != restaurantID {
+		return nil, services.ErrNotFound
+	}
+	return product, nil
+}
+
+func (r memoryProducts) FindMany(ctx context.Context, restaurantID uuid.UUID, ids []uuid.UUID) ([]models.Product, error) {
+	products := make([]models.Product, 0, len(ids))
+	for _, id := range ids {
+		if product, err := r.Find(ctx, restaurantID, id); err == nil {
+			products = append(products, *product)
+		}
+	}
+	return products, nil
+}
+
+func (r memoryProducts) List(ctx context.Context, restaurantID uuid.UUID) ([]models.Product, error) {
+	products := make([]models.Product, 0)
+	for _, product := range r.s.products {
+		if product.RestaurantID == restaurantID {
+			products = append(products, *product)
+		}
+	}
+	return products, nil
+}
+
+func (r memoryProducts) Create(ctx context.Context, product *models.Product) error {
+	newID(&product.ID)
+	r.s.products[product.ID] = product
+	return nil
+}
+
+func (r memoryProducts) Update(ctx context.Context, product *models.Product, columns ...string) error {
+	r.s.products[product.ID] = product
+	return nil
+}
+
+func (r memoryProducts) EnqueueMenu(ctx context.Context, restaurantID uuid.UUID) error {
+	r.s.menus = append(r.s.menus, restaurantID)
+	return nil
+}
+
+type memoryCustomers struct{ s *memoryStore }
+
+func (r memoryCustomers) Find(ctx context.Context, ownerID uuid.UUID, id uuid.UUID) (*models.Customer, error) {
+	customer, ok := r.s.customers[id]
+	if !ok || customer.OwnerID != ownerID {
+		return nil, services.ErrNotFound
+	}
+	return customer, nil
+}
+
+type memoryOrders struct{ s *memoryStore }
+
+func (r memoryOrders) Find(ctx context.Context, id uuid.UUID) (*models.Order, error) {
+	order, ok := r.s.orders[id]
+	if !ok {
+		return nil, services.ErrNotFound
+	}
+	return order, nil
+}
+
+func (r memoryOrders) List(ctx context.Context, restaurantID uuid.UUID, status models.OrderStatus, before uuid.UUID, limit int) ([]models.Order, error) {
+	orders := make([]models.Order, 0)
+	for _, order := range r.s.orders {
+		if order.RestaurantID == restaurantID && (status == "" || order.Status == status) && (before == uuid.Nil || order.ID.String() < before.String()) {
+			orders = append(orders, *order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID.String() > orders[j].ID.String() })
+	if len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders, nil
+}
+
+func (r memoryOrders) Create(ctx context.Context, order *models.Order) error {
+	newID(&order.ID)
+	if order.Status == "" {
+		order.Status = models.OrderStatusPending
+	}
+	for i := range order.OrderItems {
+		newID(&order.OrderItems[i].ID)
+		order.OrderItems[i].OrderID = order.ID
+	}
+	r.s.orders[order.ID] = order
+	return nil
+}
+
+func (r memoryOrders) Exists(ctx context.Context, id uuid.UUID) (bool, error) {
+	_, ok := r.s.orders[id]
+	return ok, nil
+}
+
+func (r memoryOrders) Update(ctx context.Context, order *models.Order, columns ...string) error {
+	r.s.orders[order.ID] = order
+	return nil
+}
+
+func (r memoryOrders) AddItems(ctx context.Context, order *models.Order, items []models.OrderItem) error {
+	for _, item := range items {
+		for _, existing := range r.s.orders[order.ID].OrderItems {
+			if item.ID != uuid.Nil && item.ID == existing.ID {
+				return services.ErrOrderItemExists
+			}
+		}
+	}
+	for i := range items {
+		newID(&items[i].ID)
+		items[i].OrderID = order.ID
+	}
+	r.s.orders[order.ID].OrderItems = append(r.s.orders[order.ID].OrderItems, items...)
+	return nil
+}
+
+func (r memoryOrders) CountAwaitingApproval(ctx context.Context, restaurantID uuid.UUID, tableNumber string) (int64, error) {
+	var count int64
+	for _, order := range r.s.orders {
+		if order.RestaurantID == restaurantID && order.TableNumber == tableNumber && order.Status == models.OrderStatusAwaitingApproval {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r memoryOrders) BookPickup(ctx context.Context, restaurant *models.Restaurant, at time.Time, now time.Time) (time.Time, error) {
+	return at, nil
+}
+
+func (r memoryOrders) NextPickup(ctx context.Context, restaurant *models.Restaurant, now time.Time) (time.Time, error) {
+	return now.Truncate(15 * time.Minute).Add(30 * time.Minute), nil
+}
+
+func (r memoryOrders) FindCoupon(ctx context.Context, restaurantID uuid.UUID, code string) (*models.Promotion, error) {
+	return nil, promotions.ErrUnknownCoupon
+}
+
+func (r memoryOrders) ApplyPromotions(ctx context.Context, restaurant *models.Restaurant, order *models.Order, now time.Time) (*promotions.Result, error) {
+	return &promotions.Result{}, nil
+}
+
+func (r memoryOrders) ReleasePromotions(ctx context.Context, order *models.Order) error {
+	r.s.released = append(r.s.released, order.ID)
+	return nil
+}
+
+func (r memoryOrders) RestoreLoyaltyPoints(ctx context.Context, order *models.Order) error {
+	return nil
+}
+
+func (r memoryOrders) EarnLoyaltyPoints(ctx context.Context, order *models.Order, restaurant *models.Restaurant) error {
+	return nil
+}
+
+func (r memoryOrders) Invoice(ctx context.Context, order *models.Order, restaurant *models.Restaurant) error {
+	r.s.invoiced = append(r.s.invoiced, order.ID)
+	return nil
+}
+
+func (r memoryOrders) EnqueueKitchenTickets(ctx context.Context, order *models.Order) error {
+	r.s.tickets = append(r.s.tickets, order.ID)
+	return nil
+}
+
+func (r memoryOrders) EnqueueStatus(ctx context.Context, order *models.Order, status models.OrderStatus) error {
+	r.s.statuses = append(r.s.statuses, status)
+	return nil
+}
+
+type memoryPayments struct{ s *memoryStore }
+
+func (r memoryPayments) Create(ctx context.Context, payment *models.Payment) error {
+	newID(&payment.ID)
+	r.s.payments[payment.ID] = payment
+	return nil
+}
+
+func (r memoryPayments) Update(ctx context.Context, payment *models.Payment, columns ...string) error {
+	r.s.payments[payment.ID] = payment
+	return nil
+}
+
+func (r memoryPayments) SumAmounts(ctx context.Context, orderID uuid.UUID) (float64, error) {
+	paid := 0.0
+	for _, payment := range r.s.payments {
+		if payment.OrderID == orderID {
+			paid += payment.Amount
+		}
+	}
+	return models.RoundAmount(paid), nil
+}
+
+func (r memoryPayments) FindOpenCashSession(ctx context.Context, restaurantID uuid.UUID, staffID uuid.UUID, terminalID uuid.UUID) (*models.CashSession, error) {
+	for _, session := range r.s.cashSessions {
+		if session.RestaurantID != restaurantID {
+			continue
+		}
+		if terminalID != uuid.Nil && session.TerminalID != nil && *session.TerminalID == terminalID {
+			return session, nil
+		}
+		if terminalID == uuid.Nil && session.TerminalID == nil && session.OpenedByID == staffID {
+			return session, nil
+		}
+	}
+	return nil, services.ErrNotFound
+}
+
+type memorySyncMutations struct{ s *memoryStore }
+
+func (r memorySyncMutations) Find(ctx context.Context, id uuid.UUID) (*models.SyncMutation, error) {
+	mutation, ok := r.s.mutations[id]
+	if !ok {
+		return nil, services.ErrNotFound
+	}
+	return mutation, nil
+}
+
+func (r memorySyncMutations) Create(ctx context.Context, mutation *models.SyncMutation) error {
+	r.s.mutations[mutation.ID] = mutation
+	return nil
+}
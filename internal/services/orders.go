@@ -0,0 +1,448 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/promotions"
+)
+
+// Sizes of the pages of orders.
+const (
+	defaultOrdersPageSize = 50
+	maxOrdersPageSize     = 200
+)
+
+// MaxGuestOrdersAwaiting is the number of orders of a table awaiting approval at once, so that a
+// leaked table token can't flood the staff with orders.
+const MaxGuestOrdersAwaiting = 3
+
+// OrderService takes orders and moves them through their lifecycle.
+type OrderService struct {
+	store       Store
+	restaurants *RestaurantService
+	staff       *StaffService
+	// updates are notified of the orders taken and moved to another status, nil for services bound
+	// to a transaction.
+	updates *OrderUpdates
+}
+
+func NewOrderService(store Store) *OrderService {
+	return &OrderService{
+		store:       store,
+		restaurants: NewRestaurantService(store),
+		staff:       NewStaffService(store),
+	}
+}
+
+// ListOrders asks for a page of orders.
+type ListOrders struct {
+	// Status only lists the orders with the status when set, e.g. guest orders awaiting approval.
+	Status models.OrderStatus
+	// PageSize is the maximum number of orders, 50 when zero.
+	PageSize int
+	// PageToken is the NextPageToken of the previous page, empty for the first page.
+	PageToken string
+}
+
+// OrdersPage is a page of orders, the most recent first.
+type OrdersPage struct {
+	Orders []models.Order
+	// NextPageToken lists the next page, it is empty on the last page.
+	NextPageToken string
+}
+
+// List lists the orders of a restaurant the actor owns or works at in pages, the most recent first.
+// Pages continue after the last order of the previous page, so that they don't shift as orders are
+// taken.
+func (s *OrderService) List(ctx context.Context, actor Actor, restaurantID uuid.UUID, input ListOrders) (*OrdersPage, error) {
+	if input.Status != "" && !input.Status.IsValid() {
+		return nil, ErrInvalidOrderStatus
+	}
+	pageSize := input.PageSize
+	if pageSize == 0 {
+		pageSize = defaultOrdersPageSize
+	}
+	if pageSize < 0 || pageSize > maxOrdersPageSize {
+		return nil, ErrInvalidPageSize
+	}
+	var before uuid.UUID
+	if input.PageToken != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(input.PageToken)
+		if err != nil {
+			return nil, ErrInvalidPageToken
+		}
+		if before, err = uuid.FromBytes(decoded); err != nil {
+			return nil, ErrInvalidPageToken
+		}
+	}
+	if _, err := s.restaurants.Get(ctx, actor, restaurantID); err != nil {
+		return nil, err
+	}
+
+	// One more order tells whether there is a next page
+	orders, err := s.store.Orders().List(ctx, restaurantID, input.Status, before, pageSize+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &OrdersPage{Orders: orders}
+	if len(orders) > pageSize {
+		page.Orders = orders[:pageSize]
+		last := page.Orders[pageSize-1].ID
+		page.NextPageToken = base64.RawURLEncoding.EncodeToString(last[:])
+	}
+	return page, nil
+}
+
+// Get returns the order, with its items, if the actor owns or works at its restaurant.
+func (s *OrderService) Get(ctx context.Context, actor Actor, orderID uuid.UUID) (*models.Order, error) {
+	order, err := s.store.Orders().Find(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.restaurants.Get(ctx, actor, order.RestaurantID); err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return order, nil
+}
+
+// OrderItem is a product to add to an order.
+type OrderItem struct {
+	// ItemID is the ID of the item when chosen by the client, e.g. for offline orders.
+	ItemID    uuid.UUID
+	ProductID uuid.UUID
+	Quantity  uint32
+	Modifiers []string
+}
+
+// OrderDetails are the fields of orders that depend on their type. Dine-in orders are served at a
+// table, takeaway and delivery orders have a contact and are scheduled in a pickup slot.
+type OrderDetails struct {
+	// Type defaults to dine-in.
+	Type            models.OrderType
+	TableNumber     string
+	ContactName     string
+	ContactPhone    string
+	PickupAt        *time.Time
+	DeliveryAddress string
+	// DeliveryFee overrides the delivery fee of the restaurant.
+	DeliveryFee *float64
+}
+
+// NewOrder is an order taken by staff.
+type NewOrder struct {
+	OrderDetails
+	Items      []OrderItem
+	CustomerID *uuid.UUID
+	CouponCode string
+}
+
+// Create takes an order on behalf of the staff member acting, priced with the promotions of the
+// restaurant.
+func (s *OrderService) Create(ctx context.Context, actor Actor, restaurantID uuid.UUID, input NewOrder) (*models.Order, *promotions.Result, error) {
+	if len(input.Items) == 0 {
+		return nil, nil, ErrEmptyOrder
+	}
+
+	staff, err := s.staff.Member(ctx, actor, restaurantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	restaurant := &staff.Restaurant
+	if err := s.RequireClockedIn(ctx, restaurant, staff.ID); err != nil {
+		return nil, nil, err
+	}
+
+	if input.CustomerID != nil {
+		if _, err := s.store.Customers().Find(ctx, restaurant.OwnerID, *input.CustomerID); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return nil, nil, ErrUnknownCustomer
+			}
+			return nil, nil, err
+		}
+	}
+
+	items, err := s.BuildItems(ctx, restaurantID, input.Items)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	order := &models.Order{
+		RestaurantID: restaurantID,
+		StaffID:      staff.ID,
+		Source:       models.OrderSourceStaff,
+		CustomerID:   input.CustomerID,
+		OrderItems:   items,
+	}
+
+	var result *promotions.Result
+	err = s.store.Transaction(ctx, func(store Store) error {
+		if input.CouponCode != "" {
+			coupon, err := store.Orders().FindCoupon(ctx, restaurantID, input.CouponCode)
+			if err != nil {
+				return err
+			}
+			order.CouponCode = coupon.Code
+		}
+		// The slot is booked in the transaction creating the order so that its capacity holds
+		if err := applyOrderDetails(ctx, store.Orders(), order, restaurant, input.OrderDetails); err != nil {
+			return err
+		}
+		order.UpdateTotals(restaurant.TaxRate)
+		if err := store.Orders().Create(ctx, order); err != nil {
+			return err
+		}
+		result, err = store.Orders().ApplyPromotions(ctx, restaurant, order, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	s.updates.Publish(order)
+	return order, result, nil
+}
+
+// CreateGuestOrder places an order guests made at the table, with its restaurant, from the QR code of
+// the table. Guest orders await the approval of the staff before being sent to the kitchen.
+func (s *OrderService) CreateGuestOrder(ctx context.Context, table *models.Table, inputs []OrderItem) (*models.Order, error) {
+	if len(inputs) == 0 {
+		return nil, ErrEmptyOrder
+	}
+
+	items, err := s.BuildItems(ctx, table.RestaurantID, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	order := &models.Order{
+		RestaurantID: table.RestaurantID,
+		Type:         models.OrderTypeDineIn,
+		TableNumber:  table.Number,
+		Status:       models.OrderStatusAwaitingApproval,
+		Source:       models.OrderSourceGuest,
+		OrderItems:   items,
+	}
+	order.UpdateTotals(table.Restaurant.TaxRate)
+
+	err = s.store.Transaction(ctx, func(store Store) error {
+		// The order is inserted before the orders awaiting approval are counted: the insert takes the
+		// write lock, so that the orders placed at the same time are counted one after another
+		if err := store.Orders().Create(ctx, order); err != nil {
+			return err
+		}
+		awaiting, err := store.Orders().CountAwaitingApproval(ctx, table.RestaurantID, table.Number)
+		if err != nil {
+			return err
+		}
+		if awaiting > MaxGuestOrdersAwaiting {
+			return ErrTooManyGuestOrders
+		}
+
+		// Automatic deals apply to guest orders too
+		_, err = store.Orders().ApplyPromotions(ctx, &table.Restaurant, order, time.Now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.updates.Publish(order)
+	return order, nil
+}
+
+// ChangeStatus moves an order of a restaurant the actor owns or works at to the status. Guest orders
+// are attributed to the staff member who approves them.
+func (s *OrderService) ChangeStatus(ctx context.Context, actor Actor, orderID uuid.UUID, status models.OrderStatus) (*models.Order, error) {
+	if !status.IsValid() {
+		return nil, ErrInvalidOrderStatus
+	}
+
+	order, err := s.Get(ctx, actor, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.store.Transaction(ctx, func(store Store) error {
+		if order.Status == models.OrderStatusAwaitingApproval && status == models.OrderStatusConfirmed && actor.Role == models.RoleStaff {
+			order.StaffID = actor.UserID
+			if err := store.Orders().Update(ctx, order, "staff_id"); err != nil {
+				return err
+			}
+		}
+		return transition(ctx, store.Orders(), order, status)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.updates.Publish(order)
+	return order, nil
+}
+
+// Watch returns a channel receiving the orders of a restaurant the actor owns or works at as they are
+// taken and change status, and a function to stop watching. The channel is closed once stopped or if
+// the watcher falls too far behind.
+func (s *OrderService) Watch(ctx context.Context, actor Actor, restaurantID uuid.UUID) (<-chan models.Order, func(), error) {
+	if _, err := s.restaurants.Get(ctx, actor, restaurantID); err != nil {
+		return nil, nil, err
+	}
+	if s.updates == nil {
+		return nil, nil, errors.New("order updates are not published")
+	}
+	updates, stop := s.updates.Subscribe(restaurantID)
+	return updates, stop, nil
+}
+
+// Publish notifies the watchers of the restaurant of an order changed outside of the service, once
+// the change is committed.
+func (s *OrderService) Publish(order *models.Order) {
+	s.updates.Publish(order)
+}
+
+// Transition moves the order to the status if the transition is allowed, without checking who asks.
+// Confirmed orders are sent to the kitchen printers. Paid orders are invoiced and can't be cancelled,
+// loyalty points redeemed on cancelled orders are given back. Platforms are notified of the status of
+// the orders they sent. Promotions applied to cancelled orders no longer count towards their limits.
+//
+// The store of the service should be bound to a transaction, the order is published to watchers by
+// the caller once it is committed.
+func (s *OrderService) Transition(ctx context.Context, order *models.Order, status models.OrderStatus) error {
+	return transition(ctx, s.store.Orders(), order, status)
+}
+
+func transition(ctx context.Context, orders OrderRepository, order *models.Order, status models.OrderStatus) error {
+	if !order.CanTransitionTo(status) {
+		return ErrInvalidStatusTransition
+	}
+	if status == models.OrderStatusCancelled && order.IsPaid() {
+		return ErrOrderPaid
+	}
+
+	order.Status = status
+	if err := orders.Update(ctx, order, "status"); err != nil {
+		return err
+	}
+	if err := orders.EnqueueStatus(ctx, order, status); err != nil {
+		return err
+	}
+	switch status {
+	case models.OrderStatusConfirmed:
+		return orders.EnqueueKitchenTickets(ctx, order)
+	case models.OrderStatusCancelled:
+		if err := orders.RestoreLoyaltyPoints(ctx, order); err != nil {
+			return err
+		}
+		return orders.ReleasePromotions(ctx, order)
+	}
+	return nil
+}
+
+// BuildItems turns the requested products into order items, capturing the current unit price of each
+// product. Products must belong to the restaurant.
+func (s *OrderService) BuildItems(ctx context.Context, restaurantID uuid.UUID, inputs []OrderItem) ([]models.OrderItem, error) {
+	productIDs := make([]uuid.UUID, 0, len(inputs))
+	for _, input := range inputs {
+		productIDs = append(productIDs, input.ProductID)
+	}
+
+	products, err := s.store.Products().FindMany(ctx, restaurantID, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	productsByID := make(map[uuid.UUID]models.Product, len(products))
+	for _, product := range products {
+		productsByID[product.ID] = product
+	}
+
+	items := make([]models.OrderItem, 0, len(inputs))
+	for _, input := range inputs {
+		product, ok := productsByID[input.ProductID]
+		if !ok {
+			return nil, ErrUnknownProduct
+		}
+		items = append(items, models.OrderItem{
+			ID:        input.ItemID,
+			ProductID: product.ID,
+			Quantity:  input.Quantity,
+			UnitPrice: product.UnitPrice,
+			Modifiers: input.Modifiers,
+		})
+	}
+	return items, nil
+}
+
+// RequireClockedIn returns ErrNotClockedIn if the restaurant requires staff to be clocked in to create
+// orders and the staff member is not.
+func (s *OrderService) RequireClockedIn(ctx context.Context, restaurant *models.Restaurant, staffID uuid.UUID) error {
+	if !restaurant.RequireClockIn {
+		return nil
+	}
+	clockedIn, err := s.store.Staff().HasOpenShift(ctx, staffID)
+	if err != nil {
+		return err
+	}
+	if !clockedIn {
+		return ErrNotClockedIn
+	}
+	return nil
+}
+
+// applyOrderDetails sets the type fields of the order, scheduling takeaway and delivery orders in the
+// requested pickup slot or the first available one.
+func applyOrderDetails(ctx context.Context, orders OrderRepository, order *models.Order, restaurant *models.Restaurant, input OrderDetails) error {
+	if input.Type == "" {
+		input.Type = models.OrderTypeDineIn
+	}
+	order.Type = input.Type
+
+	switch input.Type {
+	case models.OrderTypeDineIn:
+		if input.TableNumber == "" || input.ContactName != "" || input.ContactPhone != "" || input.PickupAt != nil ||
+			input.DeliveryAddress != "" || input.DeliveryFee != nil {
+			return ErrInvalidOrderType
+		}
+		order.TableNumber = input.TableNumber
+		return nil
+	case models.OrderTypeTakeaway:
+		if input.DeliveryAddress != "" || input.DeliveryFee != nil {
+			return ErrInvalidOrderType
+		}
+	case models.OrderTypeDelivery:
+		if input.DeliveryAddress == "" {
+			return ErrInvalidOrderType
+		}
+		order.DeliveryAddress = input.DeliveryAddress
+		order.DeliveryFee = restaurant.DeliveryFee
+		if input.DeliveryFee != nil {
+			order.DeliveryFee = models.RoundAmount(*input.DeliveryFee)
+		}
+	default:
+		return ErrInvalidOrderType
+	}
+
+	if input.TableNumber != "" || input.ContactName == "" || input.ContactPhone == "" {
+		return ErrInvalidOrderType
+	}
+	order.ContactName = input.ContactName
+	order.ContactPhone = input.ContactPhone
+
+	now := time.Now()
+	var pickupAt time.Time
+	var err error
+	if input.PickupAt != nil {
+		pickupAt, err = orders.BookPickup(ctx, restaurant, *input.PickupAt, now)
+	} else {
+		pickupAt, err = orders.NextPickup(ctx, restaurant, now)
+	}
+	if err != nil {
+		return err
+	}
+	pickupAt = pickupAt.UTC()
+	order.PickupAt = &pickupAt
+	return nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+)
+
+// PaymentService takes payments towards orders.
+type PaymentService struct {
+	store Store
+	// orders finds the orders paid and publishes them once paid.
+	orders *OrderService
+}
+
+func NewPaymentService(store Store) *PaymentService {
+	return &PaymentService{store: store, orders: NewOrderService(store)}
+}
+
+// CheckPayable returns why the order can't be paid anymore, if it can't.
+func CheckPayable(order *models.Order) error {
+	if order.Status == models.OrderStatusCancelled {
+		return ErrOrderCancelled
+	}
+	if order.IsPaid() {
+		return ErrOrderPaid
+	}
+	return nil
+}
+
+// NewPayment is a payment towards an order.
+type NewPayment struct {
+	Method    models.PaymentMethod
+	Amount    float64
+	TipAmount float64
+}
+
+// Create records a payment taken by the staff member acting towards an order of their restaurant.
+// Cash payments go in the cash drawer session open on the terminal the actor signed in on, or the one
+// they opened when not signed in on a terminal. The order is invoiced once fully paid.
+func (s *PaymentService) Create(ctx context.Context, actor Actor, orderID uuid.UUID, input NewPayment) (*models.Payment, error) {
+	// Only staff can take payments
+	if actor.Role != models.RoleStaff {
+		return nil, ErrUnauthorized
+	}
+
+	order, err := s.orders.Get(ctx, actor, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckPayable(order); err != nil {
+		return nil, err
+	}
+
+	payment := &models.Payment{
+		RestaurantID: order.RestaurantID,
+		OrderID:      order.ID,
+		StaffID:      actor.UserID,
+		Method:       input.Method,
+		Amount:       models.RoundAmount(input.Amount),
+		TipAmount:    models.RoundAmount(input.TipAmount),
+	}
+	paid := false
+	err = s.store.Transaction(ctx, func(store Store) error {
+		// The payment is inserted before the payments of the order are summed: the insert takes the
+		// write lock, so that the payments taken at the same time are summed one after another
+		if err := store.Payments().Create(ctx, payment); err != nil {
+			return err
+		}
+		amount, err := store.Payments().SumAmounts(ctx, order.ID)
+		if err != nil {
+			return err
+		}
+		if amount > order.TotalAmount {
+			return ErrOverpayment
+		}
+
+		if payment.Method == models.PaymentMethodCash {
+			session, err := store.Payments().FindOpenCashSession(ctx, order.RestaurantID, actor.UserID, actor.TerminalID)
+			if err != nil {
+				if errors.Is(err, ErrNotFound) {
+					return ErrNoOpenCashDrawer
+				}
+				return err
+			}
+			payment.CashSessionID = &session.ID
+			if err := store.Payments().Update(ctx, payment, "cash_session_id"); err != nil {
+				return err
+			}
+		}
+
+		if amount < order.TotalAmount {
+			return nil
+		}
+		paid = true
+		return markPaid(ctx, store, order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if paid {
+		s.orders.Publish(order)
+	}
+	return payment, nil
+}
+
+// MarkPaid records that the order is paid, e.g. by loyalty points covering its total. Paid orders are
+// invoiced, and their customer earns loyalty points.
+//
+// The store of the service should be bound to a transaction, the order is published to watchers by
+// the caller once it is committed.
+func (s *PaymentService) MarkPaid(ctx context.Context, order *models.Order) error {
+	return markPaid(ctx, s.store, order)
+}
+
+func markPaid(ctx context.Context, store Store, order *models.Order) error {
+	now := time.Now()
+	order.PaidAt = &now
+	if err := store.Orders().Update(ctx, order, "paid_at"); err != nil {
+		return err
+	}
+	restaurant, err := store.Restaurants().Find(ctx, order.RestaurantID)
+	if err != nil {
+		return err
+	}
+	if err := store.Orders().Invoice(ctx, order, restaurant); err != nil {
+		return err
+	}
+	return store.Orders().EarnLoyaltyPoints(ctx, order, restaurant)
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+)
+
+// ProductService manages the menu of restaurants. Changes are pushed to the delivery platforms the
+// restaurant is listed on.
+type ProductService struct {
+	store       Store
+	restaurants *RestaurantService
+}
+
+func NewProductService(store Store) *ProductService {
+	return &ProductService{store: store, restaurants: NewRestaurantService(store)}
+}
+
+// List lists the products of a restaurant the actor owns or works at.
+func (s *ProductService) List(ctx context.Context, actor Actor, restaurantID uuid.UUID) ([]models.Product, error) {
+	if _, err := s.restaurants.Get(ctx, actor, restaurantID); err != nil {
+		return nil, err
+	}
+	return s.store.Products().List(ctx, restaurantID)
+}
+
+// NewProduct is a product to add to the menu.
+type NewProduct struct {
+	Title       string
+	Description string
+	Category    string
+	UnitPrice   float64
+}
+
+// Register adds an available product to the menu of a restaurant owned by the actor.
+func (s *ProductService) Register(ctx context.Context, actor Actor, restaurantID uuid.UUID, input NewProduct) (*models.Product, error) {
+	if _, err := s.restaurants.GetOwned(ctx, actor, restaurantID); err != nil {
+		return nil, err
+	}
+
+	product := &models.Product{
+		RestaurantID: restaurantID,
+		Title:        input.Title,
+		Description:  input.Description,
+		Category:     input.Category,
+		UnitPrice:    input.UnitPrice,
+		Available:    true,
+	}
+	err := s.store.Transaction(ctx, func(store Store) error {
+		if err := store.Products().Create(ctx, product); err != nil {
+			return err
+		}
+		return store.Products().EnqueueMenu(ctx, restaurantID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// SetAvailability marks a product as sold out, or available again. Staff can change it during
+// service.
+func (s *ProductService) SetAvailability(ctx context.Context, actor Actor, restaurantID uuid.UUID, productID uuid.UUID, available bool) (*models.Product, error) {
+	if _, err := s.restaurants.Get(ctx, actor, restaurantID); err != nil {
+		return nil, err
+	}
+	product, err := s.store.Products().Find(ctx, restaurantID, productID)
+	if err != nil {
+		return nil, err
+	}
+	if product.Available == available {
+		return product, nil
+	}
+
+	product.Available = available
+	err = s.store.Transaction(ctx, func(store Store) error {
+		if err := store.Products().Update(ctx, product, "available"); err != nil {
+			return err
+		}
+		return store.Products().EnqueueMenu(ctx, restaurantID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+)
+
+// RestaurantService manages restaurants and decides who can access them.
+type RestaurantService struct {
+	store Store
+}
+
+func NewRestaurantService(store Store) *RestaurantService {
+	return &RestaurantService{store: store}
+}
+
+// List lists the restaurants of the actor: the ones they own for owners and their employer for staff.
+// Archived restaurants are only listed when includeArchived is set.
+func (s *RestaurantService) List(ctx context.Context, actor Actor, includeArchived bool) ([]models.Restaurant, error) {
+	switch actor.Role {
+	case models.RoleOwner:
+		return s.store.Restaurants().ListOwned(ctx, actor.UserID, includeArchived)
+	case models.RoleStaff:
+		staff, err := s.store.Staff().Find(ctx, actor.UserID)
+		if errors.Is(err, ErrNotFound) {
+			return []models.Restaurant{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if staff.Restaurant.IsArchived() && !includeArchived {
+			return []models.Restaurant{}, nil
+		}
+		return []models.Restaurant{staff.Restaurant}, nil
+	}
+	return nil, ErrUnauthorized
+}
+
+// Get returns the restaurant if the actor owns it or works at it.
+func (s *RestaurantService) Get(ctx context.Context, actor Actor, id uuid.UUID) (*models.Restaurant, error) {
+	switch actor.Role {
+	case models.RoleOwner:
+		restaurant, err := s.store.Restaurants().Find(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if restaurant.OwnerID != actor.UserID {
+			return nil, ErrNotFound
+		}
+		return restaurant, nil
+	case models.RoleStaff:
+		staff, err := s.store.Staff().Find(ctx, actor.UserID)
+		if errors.Is(err, ErrNotFound) || (err == nil && staff.RestaurantID != id) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &staff.Restaurant, nil
+	}
+	return nil, ErrUnauthorized
+}
+
+// GetOwned returns the restaurant if the actor owns it.
+func (s *RestaurantService) GetOwned(ctx context.Context, actor Actor, id uuid.UUID) (*models.Restaurant, error) {
+	if actor.Role != models.RoleOwner {
+		return nil, ErrUnauthorized
+	}
+	return s.Get(ctx, actor, id)
+}
+
+// Register creates a restaurant owned by the actor.
+func (s *RestaurantService) Register(ctx context.Context, actor Actor, name string) (*models.Restaurant, error) {
+	if actor.Role != models.RoleOwner {
+		return nil, ErrUnauthorized
+	}
+	restaurant := &models.Restaurant{
+		Name:    name,
+		OwnerID: actor.UserID,
+	}
+	if err := s.store.Restaurants().Create(ctx, restaurant); err != nil {
+		return nil, err
+	}
+	return restaurant, nil
+}
+
+// Rename changes the name of a restaurant owned by the actor.
+func (s *RestaurantService) Rename(ctx context.Context, actor Actor, id uuid.UUID, name string) (*models.Restaurant, error) {
+	restaurant, err := s.GetOwned(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+	restaurant.Name = name
+	if err := s.store.Restaurants().Update(ctx, restaurant, "name"); err != nil {
+		return nil, err
+	}
+	return restaurant, nil
+}
+
+// SetArchived archives or restores a restaurant owned by the actor. Archived restaurants are kept
+// with all their data but are hidden from listings.
+func (s *RestaurantService) SetArchived(ctx context.Context, actor Actor, id uuid.UUID, archived bool) (*models.Restaurant, error) {
+	restaurant, err := s.GetOwned(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+	if restaurant.IsArchived() == archived {
+		if archived {
+			return nil, ErrAlreadyArchived
+		}
+		return nil, ErrNotArchived
+	}
+
+	restaurant.ArchivedAt = nil
+	if archived {
+		now := time.Now()
+		restaurant.ArchivedAt = &now
+	}
+	if err := s.store.Restaurants().Update(ctx, restaurant, "archived_at"); err != nil {
+		return nil, err
+	}
+	return restaurant, nil
+}
+
+// RestaurantSettings are the settings of a restaurant owners can change.
+type RestaurantSettings struct {
+	Address      string
+	TimeZone     string
+	Currency     string
+	TaxID        string
+	OpeningHours []models.OpeningHours
+	// ReceiptFooter is printed at the bottom of receipts.
+	ReceiptFooter string
+	// TaxRate is the percentage of tax included in prices.
+	TaxRate float64
+	// RequireClockIn prevents staff who are not clocked in from creating orders.
+	RequireClockIn bool
+	Loyalty        models.LoyaltyRules
+	Pickup         models.PickupRules
+	DeliveryFee    float64
+}
+
+// UpdateSettings replaces the settings of a restaurant owned by the actor.
+func (s *RestaurantService) UpdateSettings(ctx context.Context, actor Actor, id uuid.UUID, settings RestaurantSettings) (*models.Restaurant, error) {
+	restaurant, err := s.GetOwned(ctx, actor, id)
+	if err != nil {
+		return nil, err
+	}
+
+	restaurant.Address = settings.Address
+	restaurant.TimeZone = settings.TimeZone
+	restaurant.Currency = settings.Currency
+	restaurant.TaxID = settings.TaxID
+	restaurant.OpeningHours = settings.OpeningHours
+	restaurant.ReceiptFooter = settings.ReceiptFooter
+	restaurant.TaxRate = settings.TaxRate
+	restaurant.RequireClockIn = settings.RequireClockIn
+	restaurant.Loyalty = settings.Loyalty
+	restaurant.Pickup = settings.Pickup
+	restaurant.DeliveryFee = settings.DeliveryFee
+	if err := s.store.Restaurants().Update(ctx, restaurant,
+		"address", "time_zone", "currency", "tax_id", "opening_hours", "receipt_footer", "tax_rate", "require_clock_in",
+		"loyalty_points_per_unit", "loyalty_point_value", "loyalty_min_redemption",
+		"pickup_slot_minutes", "pickup_slot_capacity", "pickup_lead_minutes", "delivery_fee"); err != nil {
+		return nil, err
+	}
+	return restaurant, nil
+}
@@ -0,0 +1,44 @@
+// Package services holds the business logic of restaurants, staff, products, orders, payments and
+// authentication, independent of HTTP. Services persist models through the repositories of a Store,
+// backed by GORM in production and by in-memory fakes in tests.
+package services
+
+import (
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+)
+
+// Actor is the authenticated user a service acts on behalf of.
+type Actor struct {
+	UserID uuid.UUID
+	Role   models.Role
+	// TerminalID is set when the user signed in on a terminal.
+	TerminalID uuid.UUID
+}
+
+// Services are the services sharing a store.
+type Services struct {
+	Auth        *AuthService
+	Restaurants *RestaurantService
+	Staff       *StaffService
+	Products    *ProductService
+	Orders      *OrderService
+	Payments    *PaymentService
+}
+
+// New returns the services sharing the store. Their orders are published to the watchers of the
+// order service.
+func New(store Store) *Services {
+	orders := NewOrderService(store)
+	orders.updates = NewOrderUpdates()
+	payments := NewPaymentService(store)
+	payments.orders = orders
+	return &Services{
+		Auth:        NewAuthService(store),
+		Restaurants: NewRestaurantService(store),
+		Staff:       NewStaffService(store),
+		Products:    NewProductService(store),
+		Orders:      orders,
+		Payments:    payments,
+	}
+}
@@ -0,0 +1,611 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/security"
+	"github.com/roushou/pocpoc/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixture is a restaurant with a waiter and a product at 10, owned by owner.
+type fixture struct {
+	store      *memoryStore
+	services   *services.Services
+	owner      services.Actor
+	restaurant *models.Restaurant
+	waiter     *models.Staff
+	product    *models.Product
+}
+
+func newFixture(t *testing.T) *fixture {
+	ctx := context.Background()
+	store := newMemoryStore()
+	f := &fixture{store: store, services: services.New(store)}
+
+	owner := &models.Owner{Username: "owner"}
+	require.NoError(t, store.Owners().Create(ctx, owner))
+	f.owner = services.Actor{UserID: owner.ID, Role: models.RoleOwner}
+
+	f.restaurant = &models.Restaurant{Name: "r", OwnerID: owner.ID, TaxRate: 10}
+	require.NoError(t, store.Restaurants().Create(ctx, f.restaurant))
+
+	hashedPassword, err := security.HashPassword("password")
+	require.NoError(t, err)
+	f.waiter = &models.Staff{RestaurantID: f.restaurant.ID, Username: "waiter", PasswordHash: hashedPassword, Role: models.StaffRoleWaiter}
+	require.NoError(t, store.Staff().Create(ctx, f.waiter))
+
+	f.product = &models.Product{RestaurantID: f.restaurant.ID, Title: "Ramen", UnitPrice: 10, Available: true}
+	require.NoError(t, store.Products().Create(ctx, f.product))
+	return f
+}
+
+func (f *fixture) staff() services.Actor {
+	return services.Actor{UserID: f.waiter.ID, Role: models.RoleStaff}
+}
+
+func TestRestaurantAccess(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		actor    services.Actor
+		getErr   error
+		ownedErr error
+	}{
+		{name: "owner", actor: f.owner},
+		{name: "staff", actor: f.staff(), ownedErr: services.ErrUnauthorized},
+		{
+			name:     "other owner",
+			actor:    services.Actor{UserID: uuid.New(), Role: models.RoleOwner},
+			getErr:   services.ErrNotFound,
+			ownedErr: services.ErrNotFound,
+		},
+		{
+			name:     "unknown staff",
+			actor:    services.Actor{UserID: uuid.New(), Role: models.RoleStaff},
+			getErr:   services.ErrNotFound,
+			ownedErr: services.ErrUnauthorized,
+		},
+		{
+			name:     "unknown role",
+			actor:    services.Actor{UserID: uuid.New()},
+			getErr:   services.ErrUnauthorized,
+			ownedErr: services.ErrUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restaurant, err := f.services.Restaurants.Get(ctx, tt.actor, f.restaurant.ID)
+			if tt.getErr != nil {
+				assert.ErrorIs(t, err, tt.getErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, f.restaurant.ID, restaurant.ID)
+			}
+
+			_, err = f.services.Restaurants.GetOwned(ctx, tt.actor, f.restaurant.ID)
+			if tt.ownedErr != nil {
+				assert.ErrorIs(t, err, tt.ownedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRestaurantSetArchived(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	_, err := f.services.Restaurants.SetArchived(ctx, f.owner, f.restaurant.ID, false)
+	assert.ErrorIs(t, err, services.ErrNotArchived)
+
+	restaurant, err := f.services.Restaurants.SetArchived(ctx, f.owner, f.restaurant.ID, true)
+	require.NoError(t, err)
+	assert.True(t, restaurant.IsArchived())
+
+	_, err = f.services.Restaurants.SetArchived(ctx, f.owner, f.restaurant.ID, true)
+	assert.ErrorIs(t, err, services.ErrAlreadyArchived)
+
+	restaurants, err := f.services.Restaurants.List(ctx, f.owner, false)
+	require.NoError(t, err)
+	assert.Empty(t, restaurants)
+}
+
+func TestStaffSetActive(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	_, err := f.services.Staff.SetActive(ctx, f.owner, f.restaurant.ID, f.waiter.ID, true)
+	assert.ErrorIs(t, err, services.ErrAlreadyActive)
+
+	staff, err := f.services.Staff.SetActive(ctx, f.owner, f.restaurant.ID, f.waiter.ID, false)
+	require.NoError(t, err)
+	assert.False(t, staff.IsActive())
+	assert.Equal(t, uint32(1), staff.TokenVersion)
+
+	// Tokens issued before the deactivation are revoked
+	assert.ErrorIs(t, f.services.Auth.VerifyStaffToken(ctx, f.waiter.ID, 0), services.ErrUnauthorized)
+	_, err = f.services.Auth.SignInStaff(ctx, f.restaurant.ID, "waiter", "password")
+	assert.ErrorIs(t, err, services.ErrStaffDeactivated)
+
+	_, err = f.services.Staff.SetActive(ctx, f.owner, f.restaurant.ID, f.waiter.ID, false)
+	assert.ErrorIs(t, err, services.ErrAlreadyInactive)
+
+	staff, err = f.services.Staff.SetActive(ctx, f.owner, f.restaurant.ID, f.waiter.ID, true)
+	require.NoError(t, err)
+	assert.True(t, staff.IsActive())
+	assert.NoError(t, f.services.Auth.VerifyStaffToken(ctx, f.waiter.ID, 1))
+
+	// Staff can't manage their colleagues
+	_, err = f.services.Staff.SetActive(ctx, f.staff(), f.restaurant.ID, f.waiter.ID, false)
+	assert.ErrorIs(t, err, services.ErrUnauthorized)
+}
+
+func TestAuthSignIn(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	_, err := f.services.Auth.SignUpOwner(ctx, "alice", "secret")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		err      error
+	}{
+		{name: "valid", username: "alice", password: "secret"},
+		{name: "wrong password", username: "alice", password: "wrong", err: services.ErrInvalidCredentials},
+		{name: "unknown owner", username: "bob", password: "secret", err: services.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner, err := f.services.Auth.SignInOwner(ctx, tt.username, tt.password)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.username, owner.Username)
+		})
+	}
+
+	// Staff usernames are only unique within a restaurant
+	_, err = f.services.Auth.SignInStaff(ctx, uuid.New(), "waiter", "password")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+	staff, err := f.services.Auth.SignInStaff(ctx, f.restaurant.ID, "waiter", "password")
+	require.NoError(t, err)
+	assert.Equal(t, f.waiter.ID, staff.ID)
+}
+
+func TestProductSetAvailability(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	product, err := f.services.Products.Register(ctx, f.owner, f.restaurant.ID, services.NewProduct{Title: "Gyoza", UnitPrice: 6})
+	require.NoError(t, err)
+	assert.True(t, product.Available)
+	assert.Equal(t, []uuid.UUID{f.restaurant.ID}, f.store.menus)
+
+	// Staff mark products as sold out during service, but can't add any
+	_, err = f.services.Products.Register(ctx, f.staff(), f.restaurant.ID, services.NewProduct{Title: "Beer", UnitPrice: 5})
+	assert.ErrorIs(t, err, services.ErrUnauthorized)
+
+	product, err = f.services.Products.SetAvailability(ctx, f.staff(), f.restaurant.ID, product.ID, false)
+	require.NoError(t, err)
+	assert.False(t, product.Available)
+	assert.Len(t, f.store.menus, 2)
+
+	// Unchanged availability isn't pushed again
+	_, err = f.services.Products.SetAvailability(ctx, f.staff(), f.restaurant.ID, product.ID, false)
+	require.NoError(t, err)
+	assert.Len(t, f.store.menus, 2)
+}
+
+func TestOrderCreate(t *testing.T) {
+	pickupAt := time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		requireClockIn bool
+		actor          func(f *fixture) services.Actor
+		order          func(f *fixture) services.NewOrder
+		err            error
+	}{
+		{
+			name: "dine-in",
+			order: func(f *fixture) services.NewOrder {
+				return services.NewOrder{
+					OrderDetails: services.OrderDetails{TableNumber: "1"},
+					Items:        []services.OrderItem{{ProductID: f.product.ID, Quantity: 2}},
+				}
+			},
+		},
+		{
+			name: "takeaway",
+			order: func(f *fixture) services.NewOrder {
+				return services.NewOrder{
+					OrderDetails: services.OrderDetails{
+						Type:         models.OrderTypeTakeaway,
+						ContactName:  "Ada",
+						ContactPhone: "0600000000",
+						PickupAt:     &pickupAt,
+					},
+					Items: []services.OrderItem{{ProductID: f.product.ID, Quantity: 2}},
+				}
+			},
+		},
+		{
+			name: "no items",
+			order: func(f *fixture) services.NewOrder {
+				return services.NewOrder{OrderDetails: services.OrderDetails{TableNumber: "1"}}
+			},
+			err: services.ErrEmptyOrder,
+		},
+		{
+			name: "unknown product",
+			order: func(f *fixture) services.NewOrder {
+				return services.NewOrder{
+					OrderDetails: services.OrderDetails{TableNumber: "1"},
+					Items:        []services.OrderItem{{ProductID: uuid.New(), Quantity: 1}},
+				}
+			},
+			err: services.ErrUnknownProduct,
+		},
+		{
+			name: "unknown customer",
+			order: func(f *fixture) services.NewOrder {
+				customerID := uuid.New()
+				return services.NewOrder{
+					OrderDetails: services.OrderDetails{TableNumber: "1"},
+					Items:        []services.OrderItem{{ProductID: f.product.ID, Quantity: 1}},
+					CustomerID:   &customerID,
+				}
+			},
+			err: services.ErrUnknownCustomer,
+		},
+		{
+			name: "dine-in without table",
+			order: func(f *fixture) services.NewOrder {
+				return services.NewOrder{Items: []services.OrderItem{{ProductID: f.product.ID, Quantity: 1}}}
+			},
+			err: services.ErrInvalidOrderType,
+		},
+		{
+			name: "delivery without address",
+			order: func(f *fixture) services.NewOrder {
+				return services.NewOrder{
+					OrderDetails: services.OrderDetails{Type: models.OrderTypeDelivery, ContactName: "Ada", ContactPhone: "0600000000"},
+					Items:        []services.OrderItem{{ProductID: f.product.ID, Quantity: 1}},
+				}
+			},
+			err: services.ErrInvalidOrderType,
+		},
+		{
+			name:           "not clocked in",
+			requireClockIn: true,
+			order: func(f *fixture) services.NewOrder {
+				return services.NewOrder{
+					OrderDetails: services.OrderDetails{TableNumber: "1"},
+					Items:        []services.OrderItem{{ProductID: f.product.ID, Quantity: 1}},
+				}
+			},
+			err: services.ErrNotClockedIn,
+		},
+		{
+			name:  "owner",
+			actor: func(f *fixture) services.Actor { return f.owner },
+			order: func(f *fixture) services.NewOrder {
+				return services.NewOrder{
+					OrderDetails: services.OrderDetails{TableNumber: "1"},
+					Items:        []services.OrderItem{{ProductID: f.product.ID, Quantity: 1}},
+				}
+			},
+			err: services.ErrUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			f.restaurant.RequireClockIn = tt.requireClockIn
+			actor := f.staff()
+			if tt.actor != nil {
+				actor = tt.actor(f)
+			}
+
+			order, _, err := f.services.Orders.Create(context.Background(), actor, f.restaurant.ID, tt.order(f))
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Empty(t, f.store.orders)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, f.waiter.ID, order.StaffID)
+			assert.Equal(t, models.OrderSourceStaff, order.Source)
+			assert.Equal(t, 10.0, order.OrderItems[0].UnitPrice)
+			assert.Equal(t, 20.0, order.TotalAmount)
+			assert.Contains(t, f.store.orders, order.ID)
+		})
+	}
+}
+
+func TestOrderList(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	orders := make([]*models.Order, 0, 5)
+	for _, status := range []models.OrderStatus{models.OrderStatusPending, models.OrderStatusConfirmed, models.OrderStatusPending, models.OrderStatusPending, models.OrderStatusPending} {
+		order := &models.Order{RestaurantID: f.restaurant.ID, Type: models.OrderTypeDineIn, Status: status}
+		require.NoError(t, f.store.Orders().Create(ctx, order))
+		orders = append(orders, order)
+	}
+	listedIDs := func(page *services.OrdersPage) []uuid.UUID {
+		ids := make([]uuid.UUID, 0, len(page.Orders))
+		for _, order := range page.Orders {
+			ids = append(ids, order.ID)
+		}
+		return ids
+	}
+
+	// Pending orders are listed in pages, the most recent first
+	page, err := f.services.Orders.List(ctx, f.staff(), f.restaurant.ID, services.ListOrders{Status: models.OrderStatusPending, PageSize: 3})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{orders[4].ID, orders[3].ID, orders[2].ID}, listedIDs(page))
+	require.NotEmpty(t, page.NextPageToken)
+
+	// Orders taken meanwhile don't shift the next page
+	require.NoError(t, f.store.Orders().Create(ctx, &models.Order{RestaurantID: f.restaurant.ID, Type: models.OrderTypeDineIn, Status: models.OrderStatusPending}))
+	page, err = f.services.Orders.List(ctx, f.staff(), f.restaurant.ID, services.ListOrders{Status: models.OrderStatusPending, PageSize: 3, PageToken: page.NextPageToken})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{orders[0].ID}, listedIDs(page))
+	assert.Empty(t, page.NextPageToken)
+
+	page, err = f.services.Orders.List(ctx, f.owner, f.restaurant.ID, services.ListOrders{})
+	require.NoError(t, err)
+	assert.Len(t, page.Orders, 6)
+	assert.Empty(t, page.NextPageToken)
+
+	for _, tt := range []struct {
+		input services.ListOrders
+		err   error
+	}{
+		{input: services.ListOrders{Status: "lost"}, err: services.ErrInvalidOrderStatus},
+		{input: services.ListOrders{PageSize: 201}, err: services.ErrInvalidPageSize},
+		{input: services.ListOrders{PageSize: -1}, err: services.ErrInvalidPageSize},
+		{input: services.ListOrders{PageToken: "not a token"}, err: services.ErrInvalidPageToken},
+	} {
+		_, err := f.services.Orders.List(ctx, f.owner, f.restaurant.ID, tt.input)
+		assert.ErrorIs(t, err, tt.err)
+	}
+
+	// Other owners don't see the orders
+	_, err = f.services.Orders.List(ctx, services.Actor{UserID: uuid.New(), Role: models.RoleOwner}, f.restaurant.ID, services.ListOrders{})
+	assert.ErrorIs(t, err, services.ErrNotFound)
+}
+
+func TestOrderChangeStatus(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	newOrder := func(status models.OrderStatus, paid bool) *models.Order {
+		order := &models.Order{RestaurantID: f.restaurant.ID, Type: models.OrderTypeDineIn, Status: status}
+		if paid {
+			now := time.Now()
+			order.PaidAt = &now
+		}
+		require.NoError(t, f.store.Orders().Create(ctx, order))
+		return order
+	}
+
+	_, err := f.services.Orders.ChangeStatus(ctx, f.staff(), uuid.New(), models.OrderStatusConfirmed)
+	assert.ErrorIs(t, err, services.ErrNotFound)
+
+	_, err = f.services.Orders.ChangeStatus(ctx, f.staff(), newOrder(models.OrderStatusPending, false).ID, "lost")
+	assert.ErrorIs(t, err, services.ErrInvalidOrderStatus)
+
+	// Other owners don't see the order
+	other := services.Actor{UserID: uuid.New(), Role: models.RoleOwner}
+	_, err = f.services.Orders.ChangeStatus(ctx, other, newOrder(models.OrderStatusPending, false).ID, models.OrderStatusConfirmed)
+	assert.ErrorIs(t, err, services.ErrNotFound)
+
+	_, err = f.services.Orders.ChangeStatus(ctx, f.staff(), newOrder(models.OrderStatusCompleted, false).ID, models.OrderStatusPending)
+	assert.ErrorIs(t, err, services.ErrInvalidStatusTransition)
+
+	_, err = f.services.Orders.ChangeStatus(ctx, f.owner, newOrder(models.OrderStatusPending, true).ID, models.OrderStatusCancelled)
+	assert.ErrorIs(t, err, services.ErrOrderPaid)
+	assert.Empty(t, f.store.statuses)
+
+	// Guest orders are attributed to the staff member who approves them and sent to the kitchen
+	guestOrder := newOrder(models.OrderStatusAwaitingApproval, false)
+	order, err := f.services.Orders.ChangeStatus(ctx, f.staff(), guestOrder.ID, models.OrderStatusConfirmed)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusConfirmed, order.Status)
+	assert.Equal(t, f.waiter.ID, order.StaffID)
+	assert.Equal(t, []uuid.UUID{guestOrder.ID}, f.store.tickets)
+
+	order, err = f.services.Orders.ChangeStatus(ctx, f.owner, guestOrder.ID, models.OrderStatusCancelled)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusCancelled, order.Status)
+	assert.Equal(t, []uuid.UUID{guestOrder.ID}, f.store.released)
+	assert.Equal(t, []models.OrderStatus{models.OrderStatusConfirmed, models.OrderStatusCancelled}, f.store.statuses)
+}
+
+func TestOrderCreateGuestOrder(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	table := &models.Table{RestaurantID: f.restaurant.ID, Restaurant: *f.restaurant, Number: "4"}
+	items := []services.OrderItem{{ProductID: f.product.ID, Quantity: 2}}
+
+	updates, stop, err := f.services.Orders.Watch(ctx, f.owner, f.restaurant.ID)
+	require.NoError(t, err)
+	defer stop()
+
+	order, err := f.services.Orders.CreateGuestOrder(ctx, table, items)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderStatusAwaitingApproval, order.Status)
+	assert.Equal(t, models.OrderSourceGuest, order.Source)
+	assert.Equal(t, "4", order.TableNumber)
+	assert.Equal(t, 20.0, order.TotalAmount)
+	assert.Equal(t, order.ID, (<-updates).ID)
+
+	_, err = f.services.Orders.CreateGuestOrder(ctx, table, nil)
+	assert.ErrorIs(t, err, services.ErrEmptyOrder)
+
+	for range services.MaxGuestOrdersAwaiting - 1 {
+		_, err = f.services.Orders.CreateGuestOrder(ctx, table, items)
+		require.NoError(t, err)
+	}
+	_, err = f.services.Orders.CreateGuestOrder(ctx, table, items)
+	assert.ErrorIs(t, err, services.ErrTooManyGuestOrders)
+}
+
+func TestOrderSync(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	updates, stop, err := f.services.Orders.Watch(ctx, f.owner, f.restaurant.ID)
+	require.NoError(t, err)
+	defer stop()
+
+	orderID := uuid.Must(uuid.NewV7())
+	create := services.SyncMutation{
+		ID:   uuid.New(),
+		Type: "create_order",
+		Change: services.SyncCreateOrder{
+			OrderID:     orderID,
+			TableNumber: "4",
+			Items:       []services.OrderItem{{ItemID: uuid.Must(uuid.NewV7()), ProductID: f.product.ID, Quantity: 1}},
+		},
+	}
+	invalid := services.SyncMutation{ID: uuid.New(), Type: "create_order", Change: services.SyncInvalid{Err: errors.New("malformed payload")}}
+	cancel := services.SyncMutation{
+		ID:     uuid.New(),
+		Type:   "update_order_status",
+		Change: services.SyncUpdateOrderStatus{OrderID: orderID, From: models.OrderStatusConfirmed, To: models.OrderStatusCancelled},
+	}
+
+	results, err := f.services.Orders.Sync(ctx, f.staff(), f.restaurant.ID, []services.SyncMutation{create, create, invalid, cancel})
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+
+	assert.Equal(t, models.SyncMutationApplied, results[0].Status)
+	assert.False(t, results[0].Duplicate)
+	assert.Equal(t, orderID, results[0].Order.ID)
+	assert.Equal(t, orderID, (<-updates).ID)
+
+	// Mutations pushed again are not applied twice
+	assert.Equal(t, models.SyncMutationApplied, results[1].Status)
+	assert.True(t, results[1].Duplicate)
+	assert.Len(t, f.store.orders, 1)
+
+	assert.Equal(t, models.SyncMutationRejected, results[2].Status)
+	assert.Equal(t, "malformed payload", results[2].Error)
+
+	// The order is still pending on the server
+	assert.Equal(t, models.SyncMutationConflict, results[3].Status)
+	assert.Equal(t, models.OrderStatusPending, results[3].Order.Status)
+
+	_, err = f.services.Orders.Sync(ctx, f.owner, f.restaurant.ID, []services.SyncMutation{create})
+	assert.ErrorIs(t, err, services.ErrUnauthorized)
+}
+
+func TestPaymentCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		actor   func(f *fixture) services.Actor
+		status  models.OrderStatus
+		drawer  bool
+		payment services.NewPayment
+		paid    bool
+		err     error
+	}{
+		{name: "partial", payment: services.NewPayment{Method: models.PaymentMethodCard, Amount: 5}},
+		{name: "full", payment: services.NewPayment{Method: models.PaymentMethodCard, Amount: 20, TipAmount: 2}, paid: true},
+		{name: "cash", drawer: true, payment: services.NewPayment{Method: models.PaymentMethodCash, Amount: 5}},
+		{name: "overpayment", payment: services.NewPayment{Method: models.PaymentMethodCard, Amount: 25}, err: services.ErrOverpayment},
+		{name: "no cash drawer", payment: services.NewPayment{Method: models.PaymentMethodCash, Amount: 5}, err: services.ErrNoOpenCashDrawer},
+		{name: "cancelled order", status: models.OrderStatusCancelled, payment: services.NewPayment{Method: models.PaymentMethodCard, Amount: 5}, err: services.ErrOrderCancelled},
+		{
+			name:    "owner",
+			actor:   func(f *fixture) services.Actor { return f.owner },
+			payment: services.NewPayment{Method: models.PaymentMethodCard, Amount: 5},
+			err:     services.ErrUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			ctx := context.Background()
+			actor := f.staff()
+			if tt.actor != nil {
+				actor = tt.actor(f)
+			}
+			status := tt.status
+			if status == "" {
+				status = models.OrderStatusPending
+			}
+			order := &models.Order{RestaurantID: f.restaurant.ID, Type: models.OrderTypeDineIn, Status: status, TotalAmount: 20}
+			require.NoError(t, f.store.Orders().Create(ctx, order))
+			if tt.drawer {
+				session := &models.CashSession{ID: uuid.New(), RestaurantID: f.restaurant.ID, OpenedByID: f.waiter.ID}
+				f.store.cashSessions[session.ID] = session
+			}
+
+			payment, err := f.services.Payments.Create(ctx, actor, order.ID, tt.payment)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Empty(t, f.store.invoiced)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, f.waiter.ID, payment.StaffID)
+			assert.Equal(t, tt.drawer, payment.CashSessionID != nil)
+			assert.Equal(t, tt.paid, order.IsPaid())
+			if tt.paid {
+				assert.Equal(t, []uuid.UUID{order.ID}, f.store.invoiced)
+			}
+		})
+	}
+}
+
+func TestAuthSignInStaffWithPin(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	_, err := f.services.Auth.SignInStaffWithPin(ctx, f.restaurant.ID, f.waiter.ID, "1234")
+	assert.ErrorIs(t, err, services.ErrPinNotSet)
+
+	require.NoError(t, f.services.Staff.SetPin(ctx, f.owner, f.restaurant.ID, f.waiter.ID, "1234"))
+	_, err = f.services.Auth.SignInStaffWithPin(ctx, uuid.New(), f.waiter.ID, "1234")
+	assert.ErrorIs(t, err, services.ErrNotFound)
+
+	staff, err := f.services.Auth.SignInStaffWithPin(ctx, f.restaurant.ID, f.waiter.ID, "1234")
+	require.NoError(t, err)
+	assert.Equal(t, f.waiter.ID, staff.ID)
+
+	for range services.MaxFailedPinAttempts {
+		_, err = f.services.Auth.SignInStaffWithPin(ctx, f.restaurant.ID, f.waiter.ID, "0000")
+		assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+	}
+	_, err = f.services.Auth.SignInStaffWithPin(ctx, f.restaurant.ID, f.waiter.ID, "1234")
+	assert.ErrorIs(t, err, services.ErrPinLocked)
+
+	// The lockout is lifted once it expires
+	expired := time.Now().Add(-time.Second)
+	f.store.staff[f.waiter.ID].PinLockedUntil = &expired
+	_, err = f.services.Auth.SignInStaffWithPin(ctx, f.restaurant.ID, f.waiter.ID, "1234")
+	require.NoError(t, err)
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/security"
+)
+
+// StaffService manages the staff of restaurants on behalf of their owner.
+type StaffService struct {
+	store       Store
+	restaurants *RestaurantService
+}
+
+func NewStaffService(store Store) *StaffService {
+	return &StaffService{store: store, restaurants: NewRestaurantService(store)}
+}
+
+// Member returns the staff member acting, with their restaurant, if they work at the restaurant.
+func (s *StaffService) Member(ctx context.Context, actor Actor, restaurantID uuid.UUID) (*models.Staff, error) {
+	if actor.Role != models.RoleStaff {
+		return nil, ErrUnauthorized
+	}
+	staff, err := s.store.Staff().Find(ctx, actor.UserID)
+	if errors.Is(err, ErrNotFound) || (err == nil && staff.RestaurantID != restaurantID) {
+		return nil, ErrUnauthorized
+	}
+	if err != nil {
+		return nil, err
+	}
+	return staff, nil
+}
+
+// Get returns the staff member if they work at a restaurant owned by the actor.
+func (s *StaffService) Get(ctx context.Context, actor Actor, restaurantID uuid.UUID, staffID uuid.UUID) (*models.Staff, error) {
+	if _, err := s.restaurants.GetOwned(ctx, actor, restaurantID); err != nil {
+		return nil, err
+	}
+	staff, err := s.store.Staff().Find(ctx, staffID)
+	if err != nil {
+		return nil, err
+	}
+	if staff.RestaurantID != restaurantID {
+		return nil, ErrNotFound
+	}
+	return staff, nil
+}
+
+// NewStaff is a staff member to register.
+type NewStaff struct {
+	Username    string
+	Password    string
+	DisplayName string
+	// Role defaults to waiter.
+	Role models.StaffRole
+}
+
+// Register creates a staff member at a restaurant owned by the actor.
+func (s *StaffService) Register(ctx context.Context, actor Actor, restaurantID uuid.UUID, input NewStaff) (*models.Staff, error) {
+	if _, err := s.restaurants.GetOwned(ctx, actor, restaurantID); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := security.HashPassword(input.Password)
+	if err != nil {
+		return nil, err
+	}
+	if input.Role == "" {
+		input.Role = models.StaffRoleWaiter
+	}
+
+	staff := &models.Staff{
+		RestaurantID: restaurantID,
+		Username:     input.Username,
+		DisplayName:  input.DisplayName,
+		Role:         input.Role,
+		PasswordHash: hashedPassword,
+	}
+	if err := s.store.Staff().Create(ctx, staff); err != nil {
+		return nil, err
+	}
+	return staff, nil
+}
+
+// StaffUpdate are the changes to a staff member, nil fields are left unchanged.
+type StaffUpdate struct {
+	Username    *string
+	DisplayName *string
+	Role        *models.StaffRole
+}
+
+// Update changes a staff member of a restaurant owned by the actor.
+func (s *StaffService) Update(ctx context.Context, actor Actor, restaurantID uuid.UUID, staffID uuid.UUID, input StaffUpdate) (*models.Staff, error) {
+	staff, err := s.Get(ctx, actor, restaurantID, staffID)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, 0, 3)
+	if input.Username != nil {
+		staff.Username = *input.Username
+		columns = append(columns, "username")
+	}
+	if input.DisplayName != nil {
+		staff.DisplayName = *input.DisplayName
+		columns = append(columns, "display_name")
+	}
+	if input.Role != nil {
+		staff.Role = *input.Role
+		columns = append(columns, "role")
+	}
+	if err := s.store.Staff().Update(ctx, staff, columns...); err != nil {
+		return nil, err
+	}
+	return staff, nil
+}
+
+// SetActive deactivates or reactivates a staff member of a restaurant owned by the actor.
+// Deactivated staff can't sign in and the tokens they were issued are revoked.
+func (s *StaffService) SetActive(ctx context.Context, actor Actor, restaurantID uuid.UUID, staffID uuid.UUID, active bool) (*models.Staff, error) {
+	staff, err := s.Get(ctx, actor, restaurantID, staffID)
+	if err != nil {
+		return nil, err
+	}
+	if staff.IsActive() == active {
+		if active {
+			return nil, ErrAlreadyActive
+		}
+		return nil, ErrAlreadyInactive
+	}
+
+	columns := []string{"deactivated_at"}
+	staff.DeactivatedAt = nil
+	if !active {
+		now := time.Now()
+		staff.DeactivatedAt = &now
+		staff.TokenVersion++
+		columns = append(columns, "token_version")
+	}
+	if err := s.store.Staff().Update(ctx, staff, columns...); err != nil {
+		return nil, err
+	}
+	return staff, nil
+}
+
+// ResetPassword sets a new password for a staff member of a restaurant owned by the actor and revokes
+// the tokens they were issued.
+func (s *StaffService) ResetPassword(ctx context.Context, actor Actor, restaurantID uuid.UUID, staffID uuid.UUID, password string) error {
+	staff, err := s.Get(ctx, actor, restaurantID, staffID)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := security.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	staff.PasswordHash = hashedPassword
+	staff.TokenVersion++
+	return s.store.Staff().Update(ctx, staff, "password_hash", "token_version")
+}
+
+// SetPin sets the PIN a staff member of a restaurant owned by the actor signs in on terminals with. It
+// also lifts any lockout.
+func (s *StaffService) SetPin(ctx context.Context, actor Actor, restaurantID uuid.UUID, staffID uuid.UUID, pin string) error {
+	staff, err := s.Get(ctx, actor, restaurantID, staffID)
+	if err != nil {
+		return err
+	}
+
+	hashedPin, err := security.HashPIN(pin)
+	if err != nil {
+		return ErrInvalidPin
+	}
+	staff.PinHash = hashedPin
+	staff.FailedPinAttempts = 0
+	staff.PinLockedUntil = nil
+	return s.store.Staff().Update(ctx, staff, "pin_hash", "failed_pin_attempts", "pin_locked_until")
+}
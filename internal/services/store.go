@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+	"github.com/roushou/pocpoc/internal/promotions"
+)
+
+// Store gives access to the repositories services persist models with. Repositories return
+// ErrNotFound for missing records.
+type Store interface {
+	Owners() OwnerRepository
+	Restaurants() RestaurantRepository
+	Staff() StaffRepository
+	Products() ProductRepository
+	Customers() CustomerRepository
+	Orders() OrderRepository
+	Payments() PaymentRepository
+	SyncMutations() SyncMutationRepository
+	// Transaction runs fn with a store bound to a transaction, which is committed if fn returns nil
+	// and rolled back otherwise.
+	Transaction(ctx context.Context, fn func(store Store) error) error
+}
+
+type OwnerRepository interface {
+	FindByUsername(ctx context.Context, username string) (*models.Owner, error)
+	Create(ctx context.Context, owner *models.Owner) error
+}
+
+type RestaurantRepository interface {
+	Find(ctx context.Context, id uuid.UUID) (*models.Restaurant, error)
+	// ListOwned lists the restaurants of the owner by name.
+	ListOwned(ctx context.Context, ownerID uuid.UUID, includeArchived bool) ([]models.Restaurant, error)
+	Create(ctx context.Context, restaurant *models.Restaurant) error
+	// Update saves the columns of the restaurant.
+	Update(ctx context.Context, restaurant *models.Restaurant, columns ...string) error
+}
+
+type StaffRepository interface {
+	// Find returns the staff member with their restaurant.
+	Find(ctx context.Context, id uuid.UUID) (*models.Staff, error)
+	FindByUsername(ctx context.Context, restaurantID uuid.UUID, username string) (*models.Staff, error)
+	Create(ctx context.Context, staff *models.Staff) error
+	// Update saves the columns of the staff member.
+	Update(ctx context.Context, staff *models.Staff, columns ...string) error
+	// HasOpenShift reports whether the staff member is clocked in.
+	HasOpenShift(ctx context.Context, staffID uuid.UUID) (bool, error)
+	// CountPinAttempt counts an attempt to sign in with the PIN of the staff member, unless PIN sign-in
+	// is locked, and locks it until lockedUntil once maxAttempts are reached. It reports whether the
+	// attempt was counted. Checking and counting are done at once so that concurrent attempts can't get
+	// past the limit.
+	CountPinAttempt(ctx context.Context, staff *models.Staff, maxAttempts int, lockedUntil time.Time, now time.Time) (bool, error)
+}
+
+type ProductRepository interface {
+	Find(ctx context.Context, restaurantID uuid.UUID, id uuid.UUID) (*models.Product, error)
+	// FindMany returns the products of the restaurant among ids, unknown products are left out.
+	FindMany(ctx context.Context, restaurantID uuid.UUID, ids []uuid.UUID) ([]models.Product, error)
+	List(ctx context.Context, restaurantID uuid.UUID) ([]models.Product, error)
+	Create(ctx context.Context, product *models.Product) error
+	// Update saves the columns of the product.
+	Update(ctx context.Context, product *models.Product, columns ...string) error
+	// EnqueueMenu queues the menu of the restaurant to be pushed to its delivery platforms.
+	EnqueueMenu(ctx context.Context, restaurantID uuid.UUID) error
+}
+
+// CustomerRepository finds customers, which are shared by the restaurants of their owner.
+type CustomerRepository interface {
+	Find(ctx context.Context, ownerID uuid.UUID, id uuid.UUID) (*models.Customer, error)
+}
+
+// OrderRepository persists orders and runs the side effects of their lifecycle: pickup slots,
+// promotions, loyalty points, kitchen tickets and platform notifications.
+type OrderRepository interface {
+	// Find returns the order with its items and their product.
+	Find(ctx context.Context, id uuid.UUID) (*models.Order, error)
+	// Exists reports whether an order with the ID was created, even if it was deleted since.
+	Exists(ctx context.Context, id uuid.UUID) (bool, error)
+	// List lists the orders of the restaurant with their items, the most recent first, optionally
+	// filtered by status. Only the orders created before the order with the ID before are listed
+	// unless it is nil.
+	List(ctx context.Context, restaurantID uuid.UUID, status models.OrderStatus, before uuid.UUID, limit int) ([]models.Order, error)
+	// Create saves the order with its items.
+	Create(ctx context.Context, order *models.Order) error
+	// Update saves the columns of the order.
+	Update(ctx context.Context, order *models.Order, columns ...string) error
+	// AddItems saves new items of the order, or returns ErrOrderItemExists if one of them was already
+	// saved.
+	AddItems(ctx context.Context, order *models.Order, items []models.OrderItem) error
+	// CountAwaitingApproval counts the guest orders of the table awaiting approval.
+	CountAwaitingApproval(ctx context.Context, restaurantID uuid.UUID, tableNumber string) (int64, error)
+
+	// BookPickup books the pickup slot starting at the given time and returns its start.
+	BookPickup(ctx context.Context, restaurant *models.Restaurant, at time.Time, now time.Time) (time.Time, error)
+	// NextPickup books the first available pickup slot and returns its start.
+	NextPickup(ctx context.Context, restaurant *models.Restaurant, now time.Time) (time.Time, error)
+	FindCoupon(ctx context.Context, restaurantID uuid.UUID, code string) (*models.Promotion, error)
+	// ApplyPromotions prices the order with the promotions of the restaurant.
+	ApplyPromotions(ctx context.Context, restaurant *models.Restaurant, order *models.Order, now time.Time) (*promotions.Result, error)
+	// ReleasePromotions stops the promotions applied to the order counting towards their limits.
+	ReleasePromotions(ctx context.Context, order *models.Order) error
+	// RestoreLoyaltyPoints gives back the loyalty points redeemed on the order.
+	RestoreLoyaltyPoints(ctx context.Context, order *models.Order) error
+	// EarnLoyaltyPoints credits the customer of the paid order with loyalty points.
+	EarnLoyaltyPoints(ctx context.Context, order *models.Order, restaurant *models.Restaurant) error
+	// Invoice appends the invoice of the paid order to the journal of the restaurant.
+	Invoice(ctx context.Context, order *models.Order, restaurant *models.Restaurant) error
+	EnqueueKitchenTickets(ctx context.Context, order *models.Order) error
+	// EnqueueStatus queues the status of the order to be pushed to the platform it came from.
+	EnqueueStatus(ctx context.Context, order *models.Order, status models.OrderStatus) error
+}
+
+type PaymentRepository interface {
+	Create(ctx context.Context, payment *models.Payment) error
+	// Update saves the columns of the payment.
+	Update(ctx context.Context, payment *models.Payment, columns ...string) error
+	// SumAmounts returns the amount paid towards the order.
+	SumAmounts(ctx context.Context, orderID uuid.UUID) (float64, error)
+	// FindOpenCashSession returns the drawer session open on the terminal or, without a terminal, the
+	// one opened by the staff member.
+	FindOpenCashSession(ctx context.Context, restaurantID uuid.UUID, staffID uuid.UUID, terminalID uuid.UUID) (*models.CashSession, error)
+}
+
+// SyncMutationRepository records the outcome of the mutations pushed by offline clients.
+type SyncMutationRepository interface {
+	Find(ctx context.Context, id uuid.UUID) (*models.SyncMutation, error)
+	Create(ctx context.Context, mutation *models.SyncMutation) error
+}
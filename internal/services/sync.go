@@ -0,0 +1,307 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+)
+
+// SyncMutation is a change queued by an offline client. Its ID is generated by the client and makes
+// pushing the same mutation more than once harmless.
+type SyncMutation struct {
+	ID   uuid.UUID
+	Type string
+	// Change is a SyncCreateOrder, a SyncAddOrderItems, a SyncUpdateOrderStatus or, when the client
+	// sent a change which couldn't be decoded, a SyncInvalid.
+	Change SyncChange
+}
+
+// SyncChange is the change of a mutation.
+type SyncChange interface {
+	// apply makes the change with the service and returns the ID of the affected order.
+	apply(ctx context.Context, orders *OrderService, staff *models.Staff) (uuid.UUID, error)
+}
+
+// SyncCreateOrder creates a dine-in order. Its ID is chosen by the client and must be a UUIDv7.
+type SyncCreateOrder struct {
+	OrderID     uuid.UUID
+	TableNumber string
+	// Items have their ID chosen by the client, so that pushing them again is detected.
+	Items []OrderItem
+}
+
+// SyncAddOrderItems adds items, with an ID chosen by the client, to an open order.
+type SyncAddOrderItems struct {
+	OrderID uuid.UUID
+	Items   []OrderItem
+}
+
+// SyncUpdateOrderStatus moves an order to another status.
+type SyncUpdateOrderStatus struct {
+	OrderID uuid.UUID
+	// From is the status the client saw when the change was made. It is used to detect changes made
+	// concurrently by someone else.
+	From models.OrderStatus
+	To   models.OrderStatus
+}
+
+// SyncInvalid is a change which couldn't be decoded, it is rejected with its error.
+type SyncInvalid struct {
+	Err error
+}
+
+// SyncResult is the outcome of a mutation.
+type SyncResult struct {
+	Status models.SyncMutationStatus
+	// Duplicate is set when the mutation had already been processed by an earlier push.
+	Duplicate bool
+	Error     string
+	// Order is the state of the affected order, so that clients can resolve conflicts, nil if there
+	// is none.
+	Order *models.Order
+}
+
+// syncError is an error caused by the content of a mutation rather than by the server.
+type syncError struct {
+	status models.SyncMutationStatus
+	err    error
+}
+
+func (e *syncError) Error() string {
+	return e.err.Error()
+}
+
+func syncConflict(err error) error {
+	return &syncError{status: models.SyncMutationConflict, err: err}
+}
+
+func syncRejected(err error) error {
+	return &syncError{status: models.SyncMutationRejected, err: err}
+}
+
+// Sync applies the mutations pushed by the staff member acting, each in its own transaction, and
+// records their outcome. Mutations that were already processed are not applied again, their recorded
+// outcome is returned instead.
+func (s *OrderService) Sync(ctx context.Context, actor Actor, restaurantID uuid.UUID, mutations []SyncMutation) ([]SyncResult, error) {
+	// Only staff of the restaurant can push orders
+	staff, err := s.staff.Member(ctx, actor, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SyncResult, 0, len(mutations))
+	for _, mutation := range mutations {
+		result, err := s.sync(ctx, staff, mutation)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
+
+func (s *OrderService) sync(ctx context.Context, staff *models.Staff, mutation SyncMutation) (*SyncResult, error) {
+	result := &SyncResult{}
+	// applied is the order changed by the mutation, published to watchers once committed
+	var applied *models.Order
+
+	err := s.store.Transaction(ctx, func(store Store) error {
+		previous, err := store.SyncMutations().Find(ctx, mutation.ID)
+		if err == nil {
+			if previous.RestaurantID != staff.RestaurantID {
+				return syncRejected(errors.New("mutation id already used"))
+			}
+			result.Duplicate = true
+			result.Status = previous.Status
+			result.Error = previous.Error
+			result.Order, err = findSyncOrder(ctx, store, staff.RestaurantID, previous.OrderID)
+			return err
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+
+		record := &models.SyncMutation{
+			ID:           mutation.ID,
+			RestaurantID: staff.RestaurantID,
+			StaffID:      staff.ID,
+			Type:         mutation.Type,
+			Status:       models.SyncMutationApplied,
+		}
+
+		// Changes are made in a savepoint so that a conflicting mutation can still be recorded
+		err = store.Transaction(ctx, func(store Store) error {
+			orderID, err := mutation.Change.apply(ctx, NewOrderService(store), staff)
+			record.OrderID = orderID
+			return err
+		})
+		var se *syncError
+		if errors.As(err, &se) {
+			record.Status = se.status
+			record.Error = se.Error()
+		} else if err != nil {
+			return err
+		}
+
+		if err := store.SyncMutations().Create(ctx, record); err != nil {
+			return err
+		}
+		result.Status = record.Status
+		result.Error = record.Error
+		result.Order, err = findSyncOrder(ctx, store, staff.RestaurantID, record.OrderID)
+		if record.Status == models.SyncMutationApplied {
+			applied = result.Order
+		}
+		return err
+	})
+
+	var se *syncError
+	if errors.As(err, &se) {
+		result.Status = se.status
+		result.Error = se.Error()
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if applied != nil {
+		s.updates.Publish(applied)
+	}
+	return result, nil
+}
+
+// findSyncOrder returns the order of the restaurant affected by a mutation, nil if there is none.
+func findSyncOrder(ctx context.Context, store Store, restaurantID uuid.UUID, orderID uuid.UUID) (*models.Order, error) {
+	if orderID == uuid.Nil {
+		return nil, nil
+	}
+	order, err := store.Orders().Find(ctx, orderID)
+	if errors.Is(err, ErrNotFound) || (err == nil && order.RestaurantID != restaurantID) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// findChangedOrder returns the order of the restaurant a change is made to.
+func findChangedOrder(ctx context.Context, store Store, staff *models.Staff, orderID uuid.UUID) (*models.Order, error) {
+	order, err := findSyncOrder(ctx, store, staff.RestaurantID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, syncRejected(errors.New("unknown order"))
+	}
+	return order, nil
+}
+
+func (c SyncCreateOrder) apply(ctx context.Context, orders *OrderService, staff *models.Staff) (uuid.UUID, error) {
+	if c.OrderID.Version() != 7 {
+		return c.OrderID, syncRejected(errors.New("order id must be a UUIDv7"))
+	}
+
+	exists, err := orders.store.Orders().Exists(ctx, c.OrderID)
+	if err != nil {
+		return c.OrderID, err
+	}
+	if exists {
+		return c.OrderID, syncConflict(errors.New("order already exists"))
+	}
+
+	if err := orders.RequireClockedIn(ctx, &staff.Restaurant, staff.ID); err != nil {
+		if errors.Is(err, ErrNotClockedIn) {
+			return c.OrderID, syncRejected(err)
+		}
+		return c.OrderID, err
+	}
+
+	items, err := orders.BuildItems(ctx, staff.RestaurantID, c.Items)
+	if err != nil {
+		if errors.Is(err, ErrUnknownProduct) {
+			return c.OrderID, syncRejected(err)
+		}
+		return c.OrderID, err
+	}
+
+	order := &models.Order{
+		ID:           c.OrderID,
+		RestaurantID: staff.RestaurantID,
+		StaffID:      staff.ID,
+		Type:         models.OrderTypeDineIn,
+		TableNumber:  c.TableNumber,
+		OrderItems:   items,
+	}
+	order.UpdateTotals(staff.Restaurant.TaxRate)
+	if err := orders.store.Orders().Create(ctx, order); err != nil {
+		return c.OrderID, err
+	}
+	_, err = orders.store.Orders().ApplyPromotions(ctx, &staff.Restaurant, order, time.Now())
+	return c.OrderID, err
+}
+
+func (c SyncAddOrderItems) apply(ctx context.Context, orders *OrderService, staff *models.Staff) (uuid.UUID, error) {
+	order, err := findChangedOrder(ctx, orders.store, staff, c.OrderID)
+	if err != nil {
+		return c.OrderID, err
+	}
+	if !order.Status.IsOpen() || order.IsPaid() {
+		return c.OrderID, syncConflict(ErrOrderClosed)
+	}
+
+	items, err := orders.BuildItems(ctx, staff.RestaurantID, c.Items)
+	if err != nil {
+		if errors.Is(err, ErrUnknownProduct) {
+			return c.OrderID, syncRejected(err)
+		}
+		return c.OrderID, err
+	}
+	if err := orders.store.Orders().AddItems(ctx, order, items); err != nil {
+		if errors.Is(err, ErrOrderItemExists) {
+			return c.OrderID, syncConflict(err)
+		}
+		return c.OrderID, err
+	}
+
+	// Promotions are evaluated again with the new items
+	order.OrderItems = append(order.OrderItems, items...)
+	_, err = orders.store.Orders().ApplyPromotions(ctx, &staff.Restaurant, order, time.Now())
+	return c.OrderID, err
+}
+
+func (c SyncUpdateOrderStatus) apply(ctx context.Context, orders *OrderService, staff *models.Staff) (uuid.UUID, error) {
+	if !c.From.IsValid() || !c.To.IsValid() {
+		return c.OrderID, syncRejected(ErrInvalidOrderStatus)
+	}
+
+	order, err := findChangedOrder(ctx, orders.store, staff, c.OrderID)
+	if err != nil {
+		return c.OrderID, err
+	}
+	if order.Status == c.To {
+		// Someone else already made the same change
+		return c.OrderID, nil
+	}
+	if order.Status != c.From {
+		return c.OrderID, syncConflict(errors.New("order status changed on the server"))
+	}
+
+	if err := orders.Transition(ctx, order, c.To); err != nil {
+		if errors.Is(err, ErrInvalidStatusTransition) {
+			return c.OrderID, syncRejected(err)
+		}
+		if errors.Is(err, ErrOrderPaid) {
+			return c.OrderID, syncConflict(err)
+		}
+		return c.OrderID, err
+	}
+	return c.OrderID, nil
+}
+
+func (c SyncInvalid) apply(ctx context.Context, orders *OrderService, staff *models.Staff) (uuid.UUID, error) {
+	return uuid.Nil, syncRejected(c.Err)
+}
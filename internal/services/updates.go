@@ -0,0 +1,72 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/roushou/pocpoc/internal/models"
+)
+
+// updatesBuffer is the number of updates a subscriber can fall behind before being unsubscribed.
+const updatesBuffer = 32
+
+// OrderUpdates fans out the orders taken or moved to another status to the subscribers following
+// their restaurant, e.g. kitchen displays. Only subscribers of the same process are notified.
+type OrderUpdates struct {
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan models.Order]struct{}
+}
+
+func NewOrderUpdates() *OrderUpdates {
+	return &OrderUpdates{subscribers: make(map[uuid.UUID]map[chan models.Order]struct{})}
+}
+
+// Subscribe returns a channel receiving the updated orders of the restaurant, and a function to stop
+// receiving them. The channel is closed once unsubscribed, which also happens when the subscriber
+// falls too far behind.
+func (u *OrderUpdates) Subscribe(restaurantID uuid.UUID) (<-chan models.Order, func()) {
+	ch := make(chan models.Order, updatesBuffer)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.subscribers[restaurantID] == nil {
+		u.subscribers[restaurantID] = make(map[chan models.Order]struct{})
+	}
+	u.subscribers[restaurantID][ch] = struct{}{}
+
+	return ch, func() {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		u.unsubscribe(restaurantID, ch)
+	}
+}
+
+// Publish notifies the subscribers of the restaurant of the order. It never blocks, subscribers which
+// can't keep up are unsubscribed rather than silently missing updates.
+func (u *OrderUpdates) Publish(order *models.Order) {
+	if u == nil {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for ch := range u.subscribers[order.RestaurantID] {
+		select {
+		case ch <- *order:
+		default:
+			u.unsubscribe(order.RestaurantID, ch)
+		}
+	}
+}
+
+func (u *OrderUpdates) unsubscribe(restaurantID uuid.UUID, ch chan models.Order) {
+	subscribers := u.subscribers[restaurantID]
+	if _, ok := subscribers[ch]; !ok {
+		return
+	}
+	delete(subscribers, ch)
+	close(ch)
+	if len(subscribers) == 0 {
+		delete(u.subscribers, restaurantID)
+	}
+}